@@ -37,5 +37,14 @@ func main() {
 
 	cg := codegen.New()
 	assembly := cg.Generate(program)
-	fmt.Print(assembly)
+
+	if len(cg.Errors()) > 0 {
+		fmt.Fprintf(os.Stderr, "Code generation errors:\n")
+		for _, err := range cg.Errors() {
+			fmt.Fprintf(os.Stderr, "  %s\n", err)
+		}
+		os.Exit(1)
+	}
+
+	fmt.Print(cg.FormatAssembly(assembly))
 }
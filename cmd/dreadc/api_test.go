@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"dreadlang/dread"
+)
+
+// apiGolden holds the exported declarations of the dread package, without
+// comments or function bodies, under the Version they belong to. A change
+// to them fails TestAPI: if it keeps the guarantees of the package doc,
+// only add to the golden file; if not, increment Version and rewrite it.
+const apiGolden = "testdata/api/dread.golden"
+
+func TestAPI(t *testing.T) {
+	got := apiSurface(t, "../../dread")
+	want, err := os.ReadFile(apiGolden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, surface, _ := strings.Cut(string(want), "\n")
+	if version != fmt.Sprintf("// Version %d", dread.Version) {
+		t.Fatalf("%s is for %s, but dread.Version is %d", apiGolden, version, dread.Version)
+	}
+	if got != surface {
+		t.Errorf("the exported declarations of package dread changed; got:\n%s\nwant:\n%s", got, surface)
+	}
+}
+
+// apiSurface prints the exported declarations of the package in dir, sorted
+// by name so that moving them between files changes nothing
+func apiSurface(t *testing.T, dir string) string {
+	t.Helper()
+	fset := token.NewFileSet()
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decls := map[string]string{}
+	for _, file := range files {
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, decl := range f.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if !d.Name.IsExported() || d.Recv != nil {
+					continue
+				}
+				d.Body = nil
+				decls[d.Name.Name] = printNode(t, fset, d)
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					switch s := spec.(type) {
+					case *ast.TypeSpec:
+						if s.Name.IsExported() {
+							decls[s.Name.Name] = printNode(t, fset, &ast.GenDecl{Tok: d.Tok, Specs: []ast.Spec{s}})
+						}
+					case *ast.ValueSpec:
+						for _, name := range s.Names {
+							if name.IsExported() {
+								decls[name.Name] = printNode(t, fset, &ast.GenDecl{Tok: d.Tok, Specs: []ast.Spec{s}})
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	var names []string
+	for name := range decls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var out strings.Builder
+	for _, name := range names {
+		out.WriteString(decls[name] + "\n")
+	}
+	return out.String()
+}
+
+func printNode(t *testing.T, fset *token.FileSet, node any) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, node); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestParseAST(t *testing.T) {
+	source := `Struct Point {
+    x Int
+    y Int
+}
+
+Function (p Point) sum() Int {
+    Return(p.x + p.y)
+}
+
+Entry main() {
+    p = Point{x: 1, y: 2}
+    For (i = 0; i < 3; i = i + 1) {
+        If (i == 1) {
+            Continue()
+        } Else {
+            Print(p.sum())
+        }
+    }
+}
+`
+	file, diagnostics := dread.Parse(source)
+	if len(diagnostics) > 0 {
+		t.Fatalf("unexpected diagnostics: %v", diagnostics)
+	}
+	if file.Version != dread.Version {
+		t.Errorf("got version %d, want %d", file.Version, dread.Version)
+	}
+	var got strings.Builder
+	for _, decl := range file.Declarations {
+		dumpNode(&got, decl, 0)
+	}
+	want := `Struct Point @1:8
+  Field x Int @2:5
+  Field y Int @3:5
+Function sum Int @6:1
+  Receiver p Point @6:11
+  Block @6:30
+    Call Return @7:5
+      Infix + @7:16
+        Field x @7:14
+          Identifier p @7:12
+        Field y @7:20
+          Identifier p @7:18
+Function main Void [entry] @10:1
+  Block @10:14
+    Assign @11:5
+      Identifier p @11:5
+      StructLiteral Point @11:9
+        FieldValue x @11:15
+          Integer 1
+        FieldValue y @11:21
+          Integer 2
+    For
+      Assign @12:10
+        Identifier i @12:10
+        Integer 0
+      Infix < @12:19
+        Identifier i @12:17
+        Integer 3
+      Assign @12:24
+        Identifier i @12:24
+        Infix + @12:30
+          Identifier i @12:28
+          Integer 1
+      Block @12:35
+        If @13:9
+          Branch @13:9
+            Infix == @13:15
+              Identifier i @13:13
+              Integer 1
+            Block @13:21
+              Continue @14:13
+          Block @15:16
+            Call Print @16:13
+              Call sum [method] @16:21
+                Identifier p @16:19
+`
+	if got.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got.String(), want)
+	}
+}
+
+// TestASTCoverage checks that every statement and expression in the test
+// programs has a kind of its own, so that none reaches a tool as Unknown
+func TestASTCoverage(t *testing.T) {
+	files, err := filepath.Glob("../../tests/*.dread")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, _ := dread.Parse(string(source))
+		var walk func(n *dread.Node)
+		walk = func(n *dread.Node) {
+			if n.Kind == "Unknown" {
+				t.Errorf("%s: no kind for %s", file, n.Value)
+			}
+			for _, child := range n.Children {
+				walk(child)
+			}
+		}
+		for _, decl := range parsed.Declarations {
+			walk(decl)
+		}
+	}
+}
+
+func dumpNode(out *strings.Builder, n *dread.Node, depth int) {
+	parts := []string{n.Kind}
+	for _, field := range []string{n.Name, n.Type, n.Value} {
+		if field != "" {
+			parts = append(parts, field)
+		}
+	}
+	if len(n.Flags) > 0 {
+		parts = append(parts, "["+strings.Join(n.Flags, " ")+"]")
+	}
+	if n.Position.Line > 0 {
+		parts = append(parts, fmt.Sprintf("@%d:%d", n.Position.Line, n.Position.Column))
+	}
+	fmt.Fprintf(out, "%s%s\n", strings.Repeat("  ", depth), strings.Join(parts, " "))
+	for _, child := range n.Children {
+		dumpNode(out, child, depth+1)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"debug/elf"
+	"path/filepath"
+	"testing"
+
+	"dreadlang/internal/codegen"
+)
+
+func TestSymbolAttributes(t *testing.T) {
+	requireToolchain(t)
+
+	object := filepath.Join(t.TempDir(), "program.o")
+	source := `@export
+@align(64)
+Var counter Int = 1
+
+@align(4096)
+Var page Int
+
+// Arguments and array lengths may be constant expressions
+Const WORDS = 16
+@align(SizeOf(Int[WORDS]))
+Var table Int[WORDS - 8]
+
+@export
+@align(32)
+Function step() {
+    counter = counter + 1
+}
+
+Function helper() {
+}
+
+Entry main() {
+    step()
+    helper()
+}
+`
+	if err := compile(source, object, codegen.Freestanding); err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	f, err := elf.Open(object)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	symbols, err := f.Symbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string]elf.Symbol)
+	for _, s := range symbols {
+		found[s.Name] = s
+	}
+
+	tests := []struct {
+		name   string
+		global bool
+		align  uint64
+	}{
+		{"counter", true, 64},
+		{"global_page", false, 4096},
+		{"global_table", false, 128},
+		{"step", true, 32},
+		{"helper", false, 1},
+	}
+	for _, tt := range tests {
+		s, ok := found[tt.name]
+		if !ok {
+			t.Errorf("symbol %s missing", tt.name)
+			continue
+		}
+		if global := elf.ST_BIND(s.Info) == elf.STB_GLOBAL; global != tt.global {
+			t.Errorf("%s: global = %v, want %v", tt.name, global, tt.global)
+		}
+		if s.Value%tt.align != 0 {
+			t.Errorf("%s: offset %#x is not aligned to %d", tt.name, s.Value, tt.align)
+		}
+		if section := f.Sections[s.Section]; section.Addralign < tt.align {
+			t.Errorf("%s: section %s is only aligned to %d", tt.name, section.Name, section.Addralign)
+		}
+	}
+}
+
+func TestSectionAttribute(t *testing.T) {
+	requireToolchain(t)
+
+	object := filepath.Join(t.TempDir(), "program.o")
+	source := `@section('.mydata')
+Var greeting String = 'hi'
+
+@section('.bss.early')
+Var scratch Int
+
+@section('.text.boot')
+Function boot() {
+    scratch = 1
+}
+
+Entry main() {
+    boot()
+}
+`
+	if err := compile(source, object, codegen.Freestanding); err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	f, err := elf.Open(object)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	symbols, err := f.Symbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]struct {
+		section string
+		typ     elf.SectionType
+		flags   elf.SectionFlag
+	}{
+		"global_greeting": {".mydata", elf.SHT_PROGBITS, elf.SHF_ALLOC | elf.SHF_WRITE},
+		"global_scratch":  {".bss.early", elf.SHT_NOBITS, elf.SHF_ALLOC | elf.SHF_WRITE},
+		"boot":            {".text.boot", elf.SHT_PROGBITS, elf.SHF_ALLOC | elf.SHF_EXECINSTR},
+	}
+	for _, s := range symbols {
+		w, ok := want[s.Name]
+		if !ok {
+			continue
+		}
+		delete(want, s.Name)
+		section := f.Sections[s.Section]
+		if section.Name != w.section || section.Type != w.typ || section.Flags&w.flags != w.flags {
+			t.Errorf("%s is in %s (%v, %v), want %s (%v, %v)", s.Name, section.Name, section.Type, section.Flags, w.section, w.typ, w.flags)
+		}
+	}
+	for name := range want {
+		t.Errorf("symbol %s missing", name)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"dreadlang/internal/codegen"
+)
+
+// runBench implements "dreadc bench [--iterations=n] [-O1] <source.dread>"
+// and returns the exit status. Every Bench function in the source is timed
+// at each optimization level, or only at the one given with -O.
+func runBench(args []string) int {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	iterations := flags.Int("iterations", 100000, "calls of each Bench function to time")
+	optimization := flags.Int("O", -1, "optimization level to time; every level when not given")
+	targetName := flags.String("target", codegen.LinuxAMD64.Name, "system to build for: amd64-linux, amd64-freebsd or amd64-openbsd")
+	runnerName := flags.String("runner", nativeRunner, "how to run the benchmarks: native, qemu-user or docker")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s bench [--iterations=n] [-O1] [--target=name] [--runner=name] <source.dread>\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(optimizationArguments(args))
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 1
+	}
+
+	fail := func(format string, args ...interface{}) int {
+		fmt.Fprintf(os.Stderr, "Error: "+format+"\n", args...)
+		return 1
+	}
+	if *iterations < 1 {
+		return fail("--iterations must be at least 1")
+	}
+	levels := []int{*optimization}
+	switch {
+	case *optimization == -1:
+		levels = nil
+		for level := 0; level <= maxOptimization; level++ {
+			levels = append(levels, level)
+		}
+	case *optimization < 0 || *optimization > maxOptimization:
+		return fail("unknown optimization level %d", *optimization)
+	}
+	target, ok := codegen.LookupTarget(*targetName)
+	if !ok || target == codegen.Freestanding {
+		return fail("cannot run benchmarks for target %s", *targetName)
+	}
+	run, err := findRunner(*runnerName)
+	if err != nil {
+		return fail("%v", err)
+	}
+	if !run.runs(target.Name) {
+		return fail("%s programs cannot run here with runner %s", target.Name, *runnerName)
+	}
+	tools, err := findToolchain(target, autoToolchain)
+	if err != nil {
+		return fail("%v", err)
+	}
+	source, err := ioutil.ReadFile(flags.Arg(0))
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	workDir, err := ioutil.TempDir("", "dreadc-bench")
+	if err != nil {
+		return fail("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	// elapsed[name][i] is the time in nanoseconds at levels[i]
+	var names []string
+	elapsed := make(map[string][]int64)
+	for _, level := range levels {
+		cg := codegen.NewForTarget(target)
+		cg.SetOptimization(level)
+		cg.SetBenchmarks(*iterations)
+		binary := filepath.Join(workDir, fmt.Sprintf("bench-O%d", level))
+		if err := buildWith(cg, flags.Arg(0), string(source), binary, tools); err != nil {
+			return fail("compilation failed: %v", err)
+		}
+		names = cg.Benchmarks()
+		if len(names) == 0 {
+			return fail("no Bench functions in %s", flags.Arg(0))
+		}
+
+		command := run.command(binary)
+		var stdout bytes.Buffer
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.Stdout = &stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fail("benchmark at -O%d failed: %v", level, err)
+		}
+		results, err := benchmarkResults(stdout.String())
+		if err != nil {
+			return fail("benchmark at -O%d: %v", level, err)
+		}
+		for _, name := range names {
+			ns, ok := results[name]
+			if !ok {
+				return fail("benchmark %s at -O%d reported no time", name, level)
+			}
+			elapsed[name] = append(elapsed[name], ns)
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "benchmark\titerations\t")
+	for _, level := range levels {
+		fmt.Fprintf(w, "O%d ns/op\t", level)
+	}
+	fmt.Fprintln(w)
+	for _, name := range names {
+		fmt.Fprintf(w, "%s\t%d\t", name, *iterations)
+		for _, ns := range elapsed[name] {
+			fmt.Fprintf(w, "%.2f\t", float64(ns)/float64(*iterations))
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+	return 0
+}
+
+// benchmarkResults reads the time of each benchmark from the harness output;
+// anything the benchmarks print themselves is skipped
+func benchmarkResults(output string) (map[string]int64, error) {
+	results := make(map[string]int64)
+	for _, line := range strings.Split(output, "\n") {
+		result, ok := strings.CutPrefix(line, codegen.BenchmarkPrefix)
+		if !ok {
+			continue
+		}
+		name, ns, ok := strings.Cut(result, " ")
+		value, err := strconv.ParseInt(ns, 10, 64)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("malformed result %q", line)
+		}
+		results[name] = value
+	}
+	return results, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dreadlang/internal/codegen"
+)
+
+const benchSource = `Var calls Int
+
+Function BenchCount() {
+    calls = calls + 1
+}
+
+Function BenchmarkPrint() {
+    Print('x')
+}
+
+// Not a benchmark: a lower-case word follows Bench
+Function Benches() {
+    Print('no')
+}
+
+Entry main() {
+    Print('not run')
+}
+`
+
+func TestBenchmarkHarness(t *testing.T) {
+	requireToolchain(t)
+
+	cg := codegen.NewForTarget(codegen.LinuxAMD64)
+	cg.SetBenchmarks(1000)
+	binary := filepath.Join(t.TempDir(), "bench")
+	if err := buildWith(cg, "", benchSource, binary, toolchains[codegen.LinuxAMD64.Name][0]); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(cg.Benchmarks(), " "); got != "BenchCount BenchmarkPrint" {
+		t.Errorf("benchmarks = %s, want BenchCount BenchmarkPrint", got)
+	}
+
+	var stdout bytes.Buffer
+	cmd := programCommand(binary)
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(stdout.String(), "not run") || strings.Count(stdout.String(), "x") != 1000 {
+		t.Errorf("the harness ran the wrong code:\n%s", stdout.String())
+	}
+	results, err := benchmarkResults(stdout.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range cg.Benchmarks() {
+		if ns, ok := results[name]; !ok || ns <= 0 {
+			t.Errorf("%s took %d ns", name, ns)
+		}
+	}
+}
+
+func TestBenchmarkSignature(t *testing.T) {
+	cg := codegen.NewForTarget(codegen.LinuxAMD64)
+	cg.SetBenchmarks(1)
+	_, diagnostics := generateWith(cg, "", "Function BenchSum(Int n) Int {\n    Return(n)\n}\n")
+	if len(diagnostics) != 1 || !strings.Contains(diagnostics[0].String(), "benchmark BenchSum must take no parameters and return nothing") {
+		t.Errorf("diagnostics = %v", diagnostics)
+	}
+}
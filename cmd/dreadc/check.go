@@ -0,0 +1,157 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"dreadlang/internal/codegen"
+	"dreadlang/internal/parser"
+)
+
+// maxFixPasses bounds how often check --fix compiles a source again. Fixing
+// a syntax error lets the code generator run, which may find more to fix.
+const maxFixPasses = 10
+
+// runCheck implements "dreadc check [--fix] <source.dread>..." and returns
+// the exit status: 1 if any source still has errors; warnings are listed
+// but leave it 0. Nothing is built.
+// With --fix, the fixes attached to the diagnostics are first applied to
+// each source file in place.
+func runCheck(args []string) int {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	fix := flags.Bool("fix", false, "apply every fix the diagnostics suggest, rewriting the source files")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s check [--fix] <source.dread>...\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 1
+	}
+
+	status := 0
+	for _, file := range flags.Args() {
+		source, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			status = 1
+			continue
+		}
+		text := string(source)
+		if *fix {
+			fixed, n := fixSource(file, text)
+			if n > 0 {
+				info, err := os.Stat(file)
+				if err == nil {
+					err = ioutil.WriteFile(file, []byte(fixed), info.Mode())
+				}
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					status = 1
+					continue
+				}
+				fmt.Printf("%s: applied %d fix(es)\n", file, n)
+			}
+			text = fixed
+		}
+		diagnostics := checkSource(file, text)
+		for _, d := range diagnostics {
+			// Errors in an imported module name its file themselves
+			if d.File == "" {
+				fmt.Printf("%s:", file)
+			}
+			fmt.Printf("%s\n", d)
+			if d.Fix != nil {
+				fmt.Printf("    fix: %s\n", d.Fix)
+			}
+		}
+		if errorCount(diagnostics) > 0 {
+			status = 1
+		}
+	}
+	return status
+}
+
+// checkSource returns the diagnostics of source, read from file
+func checkSource(file string, source string) []parser.Diagnostic {
+	_, diagnostics := generateWith(codegen.NewForTarget(codegen.LinuxAMD64), file, source)
+	return diagnostics
+}
+
+// fixSource applies the fixes of the diagnostics of source, read from file,
+// until no more apply, and returns the result and the number of fixes
+// applied. Modules it imports are left alone.
+func fixSource(file string, source string) (string, int) {
+	total := 0
+	for pass := 0; pass < maxFixPasses; pass++ {
+		fixed, n := applyFixes(source, checkSource(file, source))
+		if n == 0 {
+			break
+		}
+		source, total = fixed, total+n
+	}
+	return source, total
+}
+
+// applyFixes applies the fixes attached to diagnostics to source, and
+// returns the result and the number applied. A fix is skipped if its Old
+// text is not where it says, or if it overlaps another one.
+func applyFixes(source string, diagnostics []parser.Diagnostic) (string, int) {
+	type edit struct {
+		start, end int
+		text       string
+	}
+	var edits []edit
+	for _, d := range diagnostics {
+		if d.Fix == nil || d.File != "" {
+			continue
+		}
+		start, ok := sourceOffset(source, d.Fix.Line, d.Fix.Column)
+		end := start + len(d.Fix.Old)
+		if !ok || end > len(source) || source[start:end] != d.Fix.Old {
+			continue
+		}
+		edits = append(edits, edit{start, end, d.Fix.New})
+	}
+
+	// Edit from the end, so the offsets of the edits left stay valid
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+	applied := 0
+	limit := len(source) + 1
+	for _, e := range edits {
+		if e.end >= limit {
+			continue
+		}
+		source = source[:e.start] + e.text + source[e.end:]
+		limit = e.start
+		applied++
+	}
+	return source, applied
+}
+
+// sourceOffset returns the byte offset in source of line:column, both
+// counted from 1 as in diagnostics; the column may be just past the end of
+// the line
+func sourceOffset(source string, line, column int) (int, bool) {
+	offset := 0
+	for l := 1; l < line; l++ {
+		i := strings.IndexByte(source[offset:], '\n')
+		if i < 0 {
+			return 0, false
+		}
+		offset += i + 1
+	}
+	lineEnd := strings.IndexByte(source[offset:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(source) - offset
+	}
+	if column < 1 || column > lineEnd+1 {
+		return 0, false
+	}
+	return offset + column - 1, true
+}
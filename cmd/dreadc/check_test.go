@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestFixSource(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{
+			name:   "unclosed call",
+			source: "Entry main() {\n    Print(Len('ab')\n}\n",
+			want:   "Entry main() {\n    Print(Len('ab'))\n}\n",
+		},
+		{
+			name:   "unclosed index",
+			source: "Entry main() {\n    Var xs Int[]\n    Print(xs[0)\n}\n",
+			want:   "Entry main() {\n    Var xs Int[]\n    Print(xs[0])\n}\n",
+		},
+		{
+			name:   "type in lower case",
+			source: "Function twice(n int) int {\n    Var m int = n + n\n    Return(m)\n}\n\nEntry main() {\n}\n",
+			want:   "Function twice(n Int) Int {\n    Var m Int = n + n\n    Return(m)\n}\n\nEntry main() {\n}\n",
+		},
+		{
+			name:   "misspelled names",
+			source: "Function Greet() {\n}\n\nEntry main() {\n    total = 1\n    Print(totl)\n    greet()\n}\n",
+			want:   "Function Greet() {\n}\n\nEntry main() {\n    total = 1\n    Print(total)\n    Greet()\n}\n",
+		},
+		{
+			name:   "statements on one line",
+			source: "Entry main() {\n    a = 1 Print(a)\n}\n",
+			want:   "Entry main() {\n    a = 1; Print(a)\n}\n",
+		},
+		{
+			// Fixing the syntax error lets the code generator run
+			name:   "fixes in turn",
+			source: "Struct P { x int }\n\nEntry main() {\n    Print(1\n}\n",
+			want:   "Struct P { x Int }\n\nEntry main() {\n    Print(1)\n}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, n := fixSource("", tt.source)
+			if got != tt.want {
+				t.Errorf("fixed source:\n%s\nwant:\n%s", got, tt.want)
+			}
+			if n == 0 {
+				t.Error("no fixes applied")
+			}
+			if diagnostics := checkSource("", got); len(diagnostics) > 0 {
+				t.Errorf("fixed source still has diagnostics: %v", diagnostics)
+			}
+		})
+	}
+}
+
+// A struct may have the name of a type keyword in another case, and a
+// token written in place of a closer is not taken for a missing one
+func TestNoFix(t *testing.T) {
+	for _, source := range []string{
+		"Struct int { n Int }\n\nEntry main() {\n    Var i int\n}\n",
+		"Entry main() {\n    Print(1 2)\n}\n",
+	} {
+		if fixed, n := fixSource("", source); n != 0 {
+			t.Errorf("fixed %q to %q", source, fixed)
+		}
+	}
+}
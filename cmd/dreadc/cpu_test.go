@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dreadlang/internal/codegen"
+)
+
+func TestCPU(t *testing.T) {
+	source, err := os.ReadFile("../../tests/test_floats.dread")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	baseline, _ := generateAssembly(string(source), codegen.LinuxAMD64, 0)
+	if strings.Contains(baseline, "vaddsd") {
+		t.Error("baseline code uses AVX")
+	}
+	if !strings.Contains(baseline, `.asciz "dreadc cpu: baseline"`) {
+		t.Error("baseline code does not record its CPU")
+	}
+	v3 := codegen.LinuxAMD64.WithCPU(codegen.X86_64V3)
+	asm, _ := generateAssembly(string(source), v3, 0)
+	if !strings.Contains(asm, "vaddsd xmm0, xmm0, xmm1") {
+		t.Error("x86-64-v3 code does not use AVX for Float arithmetic")
+	}
+	if !strings.Contains(asm, `.asciz "dreadc cpu: x86-64-v3 (abm avx avx2 bmi1 bmi2 fma movbe popcnt)"`) {
+		t.Error("x86-64-v3 code does not record its CPU")
+	}
+
+	if _, err := findCPU("pentium"); err == nil {
+		t.Error("unknown CPU pentium was accepted")
+	}
+	cpu := codegen.NativeCPU("native", []string{"fpu", "sse2", "popcnt", "avx"})
+	if got := cpu.String(); got != "native (avx popcnt)" {
+		t.Errorf("native CPU = %s, want native (avx popcnt)", got)
+	}
+
+	// Programs built for this machine run on it
+	requireToolchain(t)
+	native, err := findCPU("native")
+	if err != nil {
+		t.Skip(err)
+	}
+	if !native.Has("avx") {
+		t.Skip("this CPU lacks AVX")
+	}
+	binary := filepath.Join(t.TempDir(), "floats")
+	if err := build("", string(source), binary, codegen.LinuxAMD64.WithCPU(native), toolchains[codegen.LinuxAMD64.Name][0], 0); err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile("../../tests/test_floats.out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout bytes.Buffer
+	cmd := programCommand(binary)
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != string(want) {
+		t.Errorf("output mismatch\n got: %q\nwant: %q", stdout.String(), want)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"dreadlang/internal/codegen"
+)
+
+// Each program in this directory must fail to compile with exactly the
+// diagnostics given by its "// ERROR: line:column: code: message" comments,
+// in the order the compiler reports them, or compile with exactly the
+// warnings given by its "// WARNING: ..." comments.
+const diagnosticsDir = "testdata/errors"
+
+var expectationPattern = regexp.MustCompile(`//\s*(?:ERROR|WARNING):\s*(.+?)\s*$`)
+
+func TestDiagnostics(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join(diagnosticsDir, "*.dread"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatalf("no programs found in %s", diagnosticsDir)
+	}
+	for _, file := range files {
+		file := file
+		t.Run(strings.TrimSuffix(filepath.Base(file), ".dread"), func(t *testing.T) {
+			source, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := expectedDiagnostics(string(source))
+			if len(want) == 0 {
+				t.Fatalf("no // ERROR: or // WARNING: comments in %s", file)
+			}
+
+			_, diagnostics := generateAssembly(string(source), codegen.LinuxAMD64, 0)
+			var got []string
+			for _, d := range diagnostics {
+				got = append(got, d.String())
+			}
+
+			if strings.Join(got, "\n") != strings.Join(want, "\n") {
+				t.Errorf("diagnostics mismatch\n got:\n  %s\nwant:\n  %s",
+					strings.Join(got, "\n  "), strings.Join(want, "\n  "))
+			}
+		})
+	}
+}
+
+// expectedDiagnostics collects the expectation comments of source in order
+func expectedDiagnostics(source string) []string {
+	var want []string
+	for _, line := range strings.Split(source, "\n") {
+		if m := expectationPattern.FindStringSubmatch(line); m != nil {
+			want = append(want, m[1])
+		}
+	}
+	return want
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"debug/elf"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"dreadlang/internal/codegen"
+)
+
+// runDoctor implements
+// "dreadc doctor [--target=name] [--toolchain=name] [--runner=name]" and
+// returns the exit status: 0 when the target can be built, 1 otherwise.
+// When no toolchain is installed, it checks the one tried first.
+func runDoctor(args []string) int {
+	flags := flag.NewFlagSet("doctor", flag.ExitOnError)
+	targetName := flags.String("target", codegen.LinuxAMD64.Name, "system whose toolchain to check: amd64-linux, amd64-freebsd, amd64-openbsd or amd64-none")
+	toolchainName := flags.String("toolchain", autoToolchain, "toolchain to check: auto, binutils, cross, clang or cc")
+	runnerName := flags.String("runner", nativeRunner, "how to run the smoke test: native, qemu-user or docker")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s doctor [--target=name] [--toolchain=name] [--runner=name]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	target, ok := codegen.LookupTarget(*targetName)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: unknown target %s\n", *targetName)
+		return 1
+	}
+	if _, err := findRunner(*runnerName); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	tools, err := findToolchain(target, *toolchainName)
+	if err != nil && *toolchainName != autoToolchain {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if err != nil {
+		fmt.Printf("%v\n\n", err)
+		tools = toolchains[target.Name][0]
+	}
+	fmt.Printf("Checking the %s toolchain for %s\n", tools.name, target.Name)
+	if problems := doctor(os.Stdout, target, tools, *runnerName); problems > 0 {
+		fmt.Printf("\n%d problem(s) found: dreadc cannot build for %s yet\n", problems, target.Name)
+		return 1
+	}
+	fmt.Printf("\ndreadc is ready to build for %s\n", target.Name)
+	return 0
+}
+
+// toolFixes tells how to install each external tool dreadc runs
+var toolFixes = map[string]string{
+	"as":                  "install GNU binutils (Debian/Ubuntu: apt install binutils, Fedora: dnf install binutils, Alpine: apk add binutils)",
+	"ld":                  "install GNU binutils (Debian/Ubuntu: apt install binutils, Fedora: dnf install binutils, Alpine: apk add binutils)",
+	"cc":                  "install a C compiler; on FreeBSD and OpenBSD clang is part of the base system as cc",
+	"clang":               "install clang and lld (Debian/Ubuntu: apt install clang lld, Fedora: dnf install clang lld)",
+	"qemu-x86_64":         "install QEMU's user-mode emulator (Debian/Ubuntu: apt install qemu-user, Fedora: dnf install qemu-user)",
+	"docker":              "install Docker (https://docs.docker.com/get-docker/) and start its daemon",
+	"ld.lld":              "install lld, the LLVM linker (Debian/Ubuntu: apt install lld, Fedora: dnf install lld, macOS: brew install lld)",
+	"x86_64-linux-gnu-as": "install binutils for x86_64-linux-gnu (Debian/Ubuntu: apt install binutils-x86-64-linux-gnu, macOS: brew install x86_64-linux-gnu-binutils)",
+	"x86_64-linux-gnu-ld": "install binutils for x86_64-linux-gnu (Debian/Ubuntu: apt install binutils-x86-64-linux-gnu, macOS: brew install x86_64-linux-gnu-binutils)",
+	"x86_64-elf-as":       "install binutils for x86_64-elf (macOS: brew install x86_64-elf-binutils)",
+	"x86_64-elf-ld":       "install binutils for x86_64-elf (macOS: brew install x86_64-elf-binutils)",
+}
+
+// linkerTargets maps each linker to the arguments that make it describe what
+// it can link, and the text that output holds when it can link x86-64 code
+var linkerTargets = map[string]struct {
+	args []string
+	want []string
+}{
+	"ld":    {[]string{"-V"}, []string{"elf_x86_64"}},
+	"cc":    {[]string{"-dumpmachine"}, []string{"x86_64", "amd64"}},
+	"clang": {[]string{"-dumpmachine"}, []string{"x86_64", "amd64"}},
+}
+
+// hostSystems maps the targets whose programs this machine can run to the
+// GOOS they run on
+var hostSystems = map[string]string{
+	codegen.LinuxAMD64.Name:   "linux",
+	codegen.FreeBSDAMD64.Name: "freebsd",
+	codegen.OpenBSDAMD64.Name: "openbsd",
+}
+
+// doctor checks that the tools building for target are installed and
+// support it, then compiles a small program with them, running it with the
+// runner called runnerName when that can run target's programs here. Every
+// check prints a line to w, and a failed one
+// also prints how to fix it. doctor returns the number of failed checks.
+func doctor(w io.Writer, target *codegen.Target, tools toolchain, runnerName string) int {
+	problems := 0
+	report := func(ok bool, format string, args ...interface{}) bool {
+		status := "ok  "
+		if !ok {
+			status = "FAIL"
+			problems++
+		}
+		fmt.Fprintf(w, "%s  %s\n", status, fmt.Sprintf(format, args...))
+		return ok
+	}
+	fix := func(format string, args ...interface{}) {
+		fmt.Fprintf(w, "      fix: %s\n", fmt.Sprintf(format, args...))
+	}
+
+	workDir, err := ioutil.TempDir("", "dreadc-doctor")
+	if err != nil {
+		report(false, "cannot create a temporary directory: %v", err)
+		fix("set TMPDIR to a writable directory")
+		return problems
+	}
+	defer os.RemoveAll(workDir)
+
+	// Every tool must be installed before the others are worth checking
+	found := true
+	commands := [][]string{tools.assembler}
+	if tools.linker != nil && tools.linker[0] != tools.assembler[0] {
+		commands = append(commands, tools.linker)
+	}
+	for _, command := range commands {
+		path, err := exec.LookPath(command[0])
+		if !report(err == nil, "%s: %s", command[0], describeLookup(path, err)) {
+			fix("%s", toolFixes[command[0]])
+			found = false
+		}
+	}
+	if !found {
+		fmt.Fprintf(w, "skip  smoke test: the tools above are missing\n")
+		return problems
+	}
+
+	supported := report(assemblesAMD64(workDir, tools.assembler), "%s assembles x86-64 ELF objects", tools.assembler[0])
+	if !supported {
+		fix("%s targets another architecture or object format; use --toolchain=clang or --toolchain=cross, which build ELF programs on any host", tools.assembler[0])
+	}
+	if tools.linker != nil {
+		if !report(linksAMD64(tools.linker[0]), "%s links x86-64 executables", tools.linker[0]) {
+			fix("%s cannot produce x86-64 ELF executables; %s", tools.linker[0], toolFixes[tools.linker[0]])
+			supported = false
+		}
+	}
+	if !supported {
+		fmt.Fprintf(w, "skip  smoke test: the tools above do not support %s\n", target.Name)
+		return problems
+	}
+
+	// A program printing "ok", run when the target is this machine
+	output := filepath.Join(workDir, "smoke")
+	if err := build("", "Entry main() {\n    Print('ok')\n}\n", output, target, tools, 0); err != nil {
+		report(false, "smoke test: compile a program")
+		fmt.Fprintf(w, "      %s\n", strings.ReplaceAll(strings.TrimSpace(err.Error()), "\n", "\n      "))
+		if target == codegen.OpenBSDAMD64 && runtime.GOOS != "openbsd" {
+			fix("OpenBSD programs link against OpenBSD's static libc; build them on OpenBSD")
+		} else {
+			fix("check the tool output above; if the tools are recent, please report it as a dreadc bug")
+		}
+		return problems
+	}
+	report(true, "smoke test: compile a program")
+	run := runners[runnerName]
+	if !run.runs(target.Name) {
+		fmt.Fprintf(w, "skip  smoke test: %s programs cannot run on %s/%s with runner %s\n", target.Name, runtime.GOOS, runtime.GOARCH, runnerName)
+		return problems
+	}
+	command := run.command(output)
+	if runnerName != nativeRunner {
+		path, err := exec.LookPath(command[0])
+		if !report(err == nil, "%s: %s", command[0], describeLookup(path, err)) {
+			fix("%s", toolFixes[command[0]])
+			return problems
+		}
+	}
+	got, err := exec.Command(command[0], command[1:]...).Output()
+	if !report(err == nil && string(got) == "ok", "smoke test: run the program") {
+		fmt.Fprintf(w, "      printed %q, error: %v\n", got, err)
+		fix("the program was built but does not run correctly; please report it as a dreadc bug")
+	}
+	return problems
+}
+
+// describeLookup describes the result of exec.LookPath
+func describeLookup(path string, err error) string {
+	if err != nil {
+		return "not found in PATH"
+	}
+	return "found at " + path
+}
+
+// assemblesAMD64 reports whether assembler turns one instruction into an
+// x86-64 ELF object
+func assemblesAMD64(workDir string, assembler []string) bool {
+	asmFile := filepath.Join(workDir, "check.s")
+	objFile := filepath.Join(workDir, "check.o")
+	if err := ioutil.WriteFile(asmFile, []byte(".intel_syntax noprefix\n.text\n    mov rax, 60\n"), 0644); err != nil {
+		return false
+	}
+	cmd := exec.Command(assembler[0], append(assembler[1:], "-o", objFile, asmFile)...)
+	if err := cmd.Run(); err != nil {
+		return false
+	}
+	f, err := elf.Open(objFile)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	return f.Class == elf.ELFCLASS64 && f.Machine == elf.EM_X86_64
+}
+
+// linksAMD64 reports whether linker says it can link x86-64 code
+func linksAMD64(linker string) bool {
+	query, ok := linkerTargets[linker]
+	if !ok {
+		return true
+	}
+	output, err := exec.Command(linker, query.args...).Output()
+	if err != nil {
+		return false
+	}
+	for _, want := range query.want {
+		if strings.Contains(string(output), want) {
+			return true
+		}
+	}
+	return false
+}
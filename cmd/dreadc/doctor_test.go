@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"dreadlang/internal/codegen"
+)
+
+func TestDoctor(t *testing.T) {
+	requireToolchain(t)
+
+	var report strings.Builder
+	if problems := doctor(&report, codegen.LinuxAMD64, toolchains[codegen.LinuxAMD64.Name][0], *runnerName); problems != 0 {
+		t.Errorf("doctor found %d problem(s) with a working toolchain:\n%s", problems, report.String())
+	}
+	if !strings.Contains(report.String(), "ok    smoke test: compile a program") {
+		t.Errorf("doctor did not compile the smoke test:\n%s", report.String())
+	}
+}
+
+func TestDoctorMissingTools(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	var report strings.Builder
+	if problems := doctor(&report, codegen.LinuxAMD64, toolchains[codegen.LinuxAMD64.Name][0], nativeRunner); problems != 2 {
+		t.Errorf("doctor found %d problem(s) without as and ld, want 2:\n%s", problems, report.String())
+	}
+	for _, want := range []string{"FAIL  as: not found in PATH", "FAIL  ld: not found in PATH", "fix: install GNU binutils", "skip  smoke test"} {
+		if !strings.Contains(report.String(), want) {
+			t.Errorf("doctor report lacks %q:\n%s", want, report.String())
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"dreadlang/internal/codegen"
+)
+
+// Every program in these directories is compiled at each optimization
+// level, run, and checked against golden files next to it: name.out holds
+// the expected stdout and the optional name.exit the expected exit status
+// (0 when absent). When name.in exists, the program reads it on stdin.
+var programDirs = []string{
+	"../../examples/valid",
+	"../../tests",
+}
+
+// Programs in this directory must be rejected by the compiler.
+const invalidDir = "../../examples/invalid"
+
+// runnerName runs the test programs on hosts that cannot run them directly:
+// go test ./cmd/dreadc -args -runner=qemu-user
+var runnerName = flag.String("runner", nativeRunner, "how to run test programs: native, qemu-user or docker")
+
+func requireToolchain(t testing.TB) {
+	t.Helper()
+	run, err := findRunner(*runnerName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !run.runs(codegen.LinuxAMD64.Name) {
+		t.Skipf("amd64-linux programs cannot run on %s/%s with runner %s", runtime.GOOS, runtime.GOARCH, *runnerName)
+	}
+	if command := run.command("program"); *runnerName != nativeRunner {
+		if _, err := exec.LookPath(command[0]); err != nil {
+			t.Skipf("%s not found in PATH", command[0])
+		}
+	}
+	for _, tool := range []string{"as", "ld"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not found in PATH", tool)
+		}
+	}
+}
+
+func TestPrograms(t *testing.T) {
+	requireToolchain(t)
+
+	for _, dir := range programDirs {
+		files, err := filepath.Glob(filepath.Join(dir, "*.dread"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range files {
+			file := file
+			name := strings.TrimSuffix(filepath.Base(file), ".dread")
+			t.Run(name, func(t *testing.T) {
+				for level := 0; level <= maxOptimization; level++ {
+					t.Run(fmt.Sprintf("O%d", level), func(t *testing.T) {
+						runProgram(t, file, level)
+					})
+				}
+			})
+		}
+	}
+}
+
+func runProgram(t *testing.T, file string, optimization int) {
+	base := strings.TrimSuffix(file, ".dread")
+	wantOutput, err := os.ReadFile(base + ".out")
+	if err != nil {
+		t.Fatalf("missing golden output: %v", err)
+	}
+	wantExit := 0
+	if exitData, err := os.ReadFile(base + ".exit"); err == nil {
+		wantExit, err = strconv.Atoi(strings.TrimSpace(string(exitData)))
+		if err != nil {
+			t.Fatalf("bad exit status file: %v", err)
+		}
+	}
+
+	source, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary := filepath.Join(t.TempDir(), "program")
+	if err := build(file, string(source), binary, codegen.LinuxAMD64, toolchains[codegen.LinuxAMD64.Name][0], optimization); err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+
+	var stdout bytes.Buffer
+	cmd := programCommand(binary)
+	cmd.Stdout = &stdout
+	if input, err := os.Open(base + ".in"); err == nil {
+		defer input.Close()
+		cmd.Stdin = input
+	}
+	exitCode := 0
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			t.Fatalf("run failed: %v", err)
+		}
+		exitCode = exitErr.ExitCode()
+	}
+
+	if got := stdout.String(); got != string(wantOutput) {
+		t.Errorf("output mismatch\n got: %q\nwant: %q", got, wantOutput)
+	}
+	if exitCode != wantExit {
+		t.Errorf("exit status = %d, want %d", exitCode, wantExit)
+	}
+}
+
+// programCommand returns the command that runs binary with the runner
+func programCommand(binary string) *exec.Cmd {
+	command := runners[*runnerName].command(binary)
+	return exec.Command(command[0], command[1:]...)
+}
+
+// The echo server waits for a client, so it is not run with the other
+// examples: TestEchoServer starts it, connects to it over loopback and
+// checks that it sends back what it was sent. The test is skipped when the
+// server cannot listen on its port.
+const echoServer = "../../examples/network/echo_server.dread"
+
+func TestEchoServer(t *testing.T) {
+	requireToolchain(t)
+	source, err := os.ReadFile(echoServer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for level := 0; level <= maxOptimization; level++ {
+		t.Run(fmt.Sprintf("O%d", level), func(t *testing.T) {
+			binary := filepath.Join(t.TempDir(), "program")
+			if err := build(echoServer, string(source), binary, codegen.LinuxAMD64, toolchains[codegen.LinuxAMD64.Name][0], level); err != nil {
+				t.Fatalf("compile failed: %v", err)
+			}
+			cmd := programCommand(binary)
+			stdout, err := cmd.StdoutPipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := cmd.Start(); err != nil {
+				t.Fatal(err)
+			}
+			defer cmd.Process.Kill()
+
+			line, _ := bufio.NewReader(stdout).ReadString('\n')
+			if line != "listening on 7777\n" {
+				t.Skipf("echo server did not start: %q", line)
+			}
+			conn, err := net.DialTimeout("tcp", "127.0.0.1:7777", 5*time.Second)
+			if err != nil {
+				t.Skipf("cannot connect to the echo server: %v", err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			message := "hello\nover loopback\n"
+			if _, err := io.WriteString(conn, message); err != nil {
+				t.Fatal(err)
+			}
+			conn.(*net.TCPConn).CloseWrite()
+			echoed, err := io.ReadAll(conn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(echoed) != message {
+				t.Errorf("echoed %q, want %q", echoed, message)
+			}
+			if err := cmd.Wait(); err != nil {
+				t.Errorf("echo server: %v", err)
+			}
+		})
+	}
+}
+
+func TestInvalidPrograms(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join(invalidDir, "*.dread"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		file := file
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			source, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			binary := filepath.Join(t.TempDir(), "program")
+			if err := compile(string(source), binary, codegen.LinuxAMD64); err == nil {
+				t.Errorf("expected compilation to fail")
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"debug/elf"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"dreadlang/internal/codegen"
+)
+
+// hostHooks stand in for a kernel: they start the program and implement the
+// freestanding I/O hooks with Linux syscalls, so the object can run here
+const hostHooks = `.intel_syntax noprefix
+.global _start, dread_write, dread_exit
+_start:
+    call dread_main
+dread_write:
+    mov rax, 1
+    syscall
+    ret
+dread_exit:
+    mov rax, 60
+    syscall
+`
+
+func TestFreestandingObject(t *testing.T) {
+	requireToolchain(t)
+
+	dir := t.TempDir()
+	object := filepath.Join(dir, "program.o")
+	source := "Entry main() {\n    s = 'ab' + 'cd'\n    Print(s)\n    Print(42)\n    Return(3)\n}\n"
+	if err := compile(source, object, codegen.Freestanding); err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+
+	hooks := filepath.Join(dir, "hooks.s")
+	if err := os.WriteFile(hooks, []byte(hostHooks), 0644); err != nil {
+		t.Fatal(err)
+	}
+	binary := filepath.Join(dir, "program")
+	for _, args := range [][]string{
+		{"as", "--64", "-o", hooks + ".o", hooks},
+		{"ld", "-o", binary, object, hooks + ".o"},
+	} {
+		if output, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+			t.Fatalf("%s failed: %v\n%s", args[0], err, output)
+		}
+	}
+
+	output, err := programCommand(binary).Output()
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok || exitErr.ExitCode() != 3 {
+		t.Errorf("exit = %v, want status 3", err)
+	}
+	if string(output) != "abcd42" {
+		t.Errorf("output = %q, want %q", output, "abcd42")
+	}
+}
+
+// kernelScript loads a freestanding program at 1 MiB, as a multiboot kernel would be
+const kernelScript = `ENTRY(dread_main)
+SECTIONS {
+    . = 0x100000;
+    .text : { *(.text) }
+    .rodata : { *(.rodata) }
+    .data : { *(.data) }
+    .bss : { *(.bss) }
+}
+`
+
+func TestLinkerScript(t *testing.T) {
+	requireToolchain(t)
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "kernel.ld")
+	if err := os.WriteFile(script, []byte(kernelScript), 0644); err != nil {
+		t.Fatal(err)
+	}
+	source := "Entry main() {\n    Print('hi')\n}\n"
+
+	executable := filepath.Join(dir, "kernel")
+	tools := toolchainFor(toolchains[codegen.Freestanding.Name][0], codegen.Freestanding, formatELF, script)
+	if err := build("", source, executable, codegen.Freestanding, tools, 0); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	f, err := elf.Open(executable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if f.Type != elf.ET_EXEC || f.Entry != 0x100000 {
+		t.Errorf("type %v, entry %#x; want an executable entered at 0x100000", f.Type, f.Entry)
+	}
+
+	// The flat image of the same program starts with the entry's prologue
+	image := filepath.Join(dir, "kernel.bin")
+	tools = toolchainFor(toolchains[codegen.Freestanding.Name][0], codegen.Freestanding, formatFlat, script)
+	if err := build("", source, image, codegen.Freestanding, tools, 0); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	data, err := os.ReadFile(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) == 0 || data[0] != 0x55 {
+		t.Errorf("flat image does not start with push rbp: % x", data[:min(len(data), 4)])
+	}
+}
+
+// interruptHost raises the handler tick twice by building the frame the CPU
+// pushes on an interrupt, then checks that it preserved the scratch registers
+const interruptHost = `.intel_syntax noprefix
+.global _start, dread_write, dread_exit
+_start:
+    call raise
+    call raise
+    cmp r11, 0x1111
+    jne clobbered
+    cmp rcx, 0x2222
+    jne clobbered
+    call dread_main
+clobbered:
+    mov rdi, 99
+    jmp dread_exit
+raise:
+    mov r11, 0x1111
+    mov rcx, 0x2222
+    mov rax, rsp
+    xor edx, edx
+    mov dx, ss
+    push rdx
+    push rax
+    pushfq
+    mov dx, cs
+    push rdx
+    lea rax, [rip + raised]
+    push rax
+    jmp tick
+raised:
+    ret
+dread_write:
+    mov rax, 1
+    syscall
+    ret
+dread_exit:
+    mov rax, 60
+    syscall
+`
+
+func TestInterruptHandler(t *testing.T) {
+	requireToolchain(t)
+
+	dir := t.TempDir()
+	object := filepath.Join(dir, "program.o")
+	source := `Var ticks Int
+
+@interrupt
+Function tick() {
+    ticks = ticks + 1
+    Print('tick ')
+}
+
+Entry main() {
+    Print(ticks)
+    Return(ticks)
+}
+`
+	if err := compile(source, object, codegen.Freestanding); err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+
+	host := filepath.Join(dir, "host.s")
+	if err := os.WriteFile(host, []byte(interruptHost), 0644); err != nil {
+		t.Fatal(err)
+	}
+	binary := filepath.Join(dir, "program")
+	for _, args := range [][]string{
+		{"as", "--64", "-o", host + ".o", host},
+		{"ld", "-o", binary, object, host + ".o"},
+	} {
+		if output, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+			t.Fatalf("%s failed: %v\n%s", args[0], err, output)
+		}
+	}
+
+	output, err := programCommand(binary).Output()
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok || exitErr.ExitCode() != 2 {
+		t.Errorf("exit = %v, want status 2", err)
+	}
+	if string(output) != "tick tick 2" {
+		t.Errorf("output = %q, want %q", output, "tick tick 2")
+	}
+}
+
+// deviceHost calls the exported function device with the address of a zeroed
+// buffer standing in for device registers, then checks what it wrote
+const deviceHost = `.intel_syntax noprefix
+.global _start, dread_write, dread_exit
+_start:
+    lea rdi, [registers]
+    call device
+    cmp rax, 305419776
+    jne failed
+    mov rax, 1000000000000
+    cmp qword ptr [registers], rax
+    jne failed
+    cmp dword ptr [registers + 8], 0x12345678
+    jne failed
+    cmp word ptr [registers + 12], 0xffff
+    jne failed
+    cmp word ptr [registers + 14], 0x00ff
+    jne failed
+    xor edi, edi
+    jmp dread_exit
+failed:
+    mov rdi, 1
+    jmp dread_exit
+dread_write:
+    mov rax, 1
+    syscall
+    ret
+dread_exit:
+    mov rax, 60
+    syscall
+.bss
+registers:
+    .zero 16
+`
+
+func TestPeekPoke(t *testing.T) {
+	requireToolchain(t)
+
+	dir := t.TempDir()
+	object := filepath.Join(dir, "program.o")
+	source := `@export
+Function device(Int base) Int {
+    Poke(base, 1000000000000)
+    Poke(base + 8, 305419896, 4)
+    Poke(base + 12, 65535, 2)
+    Poke(base + 14, 511, 1)
+    Return(Peek(base + 8, 4) - Peek(base + 8, 1))
+}
+
+Entry main() {
+}
+`
+	if err := compile(source, object, codegen.Freestanding); err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+
+	host := filepath.Join(dir, "host.s")
+	if err := os.WriteFile(host, []byte(deviceHost), 0644); err != nil {
+		t.Fatal(err)
+	}
+	binary := filepath.Join(dir, "program")
+	for _, args := range [][]string{
+		{"as", "--64", "-o", host + ".o", host},
+		{"ld", "-o", binary, object, host + ".o"},
+	} {
+		if output, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+			t.Fatalf("%s failed: %v\n%s", args[0], err, output)
+		}
+	}
+
+	if err := programCommand(binary).Run(); err != nil {
+		t.Errorf("device registers hold the wrong values: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dreadlang/internal/codegen"
+	"dreadlang/internal/ir"
+)
+
+func TestLoweredExpressions(t *testing.T) {
+	source := `Entry main() {
+    Var x Int = 12
+    Var y Int = 5
+    Print(x - y * 2 < 3)
+}
+`
+	assembly, diagnostics := generateAssembly(source, codegen.LinuxAMD64, 0)
+	if len(diagnostics) > 0 {
+		t.Fatal(diagnostics)
+	}
+	main := assembly[strings.Index(assembly, "# Print"):]
+	main = main[:strings.Index(main, "call print_int")]
+	if strings.Contains(main, "push") {
+		t.Errorf("a lowered expression keeps an operand on the stack\n%s", main)
+	}
+	if !strings.Contains(main, "setl") {
+		t.Errorf("the comparison is missing\n%s", main)
+	}
+}
+
+func TestEmitIR(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "square.dread")
+	if err := os.WriteFile(source, []byte(`Function square(n Int) Int {
+    Return(n * n)
+}
+
+Entry main() {
+    Print(square(3) + 1)
+}
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "square.ir")
+	if err := emitText(codegen.NewForTarget(codegen.LinuxAMD64), []string{source}, emitIR, output, false); err != nil {
+		t.Fatal(err)
+	}
+	text, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `function square
+block 2:14
+    %1 = mul n[slot 1], n[slot 1]
+    result %1
+`
+	if string(text) != textHeaders[emitIR]+want {
+		t.Errorf("--emit=ir wrote\n%s\nwant\n%s", text, want)
+	}
+	program, err := ir.Parse(string(text))
+	if err != nil || program.String() != want {
+		t.Errorf("the emitted IR does not read back: %v", err)
+	}
+
+	if err := emitText(codegen.NewForTarget(codegen.LinuxAMD64), []string{source}, emitAST, output, false); err != nil {
+		t.Fatal(err)
+	}
+	if text, _ := os.ReadFile(output); string(text) != textHeaders[emitAST]+`Function square(n Int) (Int) {Return((n * n))}
+Entry main() (Void) {Print((square(3) + 1))}
+` {
+		t.Errorf("--emit=ast wrote\n%s", text)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dreadlang/internal/codegen"
+	"dreadlang/internal/module"
+)
+
+const listingSource = `Var calls Int = 0
+
+Function square(n Int) Int {
+    calls = calls + 1
+    Return(n * n)
+}
+
+Entry main() {
+    Print(square(7) + Len('abc'))
+    Print('\n')
+    Print(String(calls) + ' call\n')
+}
+`
+
+// listing generates listingSource and lays it out for --emit=asm
+func listing(t *testing.T) (raw string, formatted string) {
+	t.Helper()
+	cg := codegen.NewForTarget(codegen.LinuxAMD64)
+	program, diagnostics := module.Load("", listingSource)
+	raw, diagnostics = generateProgram(cg, program, diagnostics)
+	if len(diagnostics) > 0 {
+		t.Fatal(diagnostics)
+	}
+	return raw, cg.FormatAssembly(raw)
+}
+
+func TestFormatAssembly(t *testing.T) {
+	raw, formatted := listing(t)
+	lines := strings.Split(formatted, "\n")
+
+	// Every symbol of the index is defined on the line it gives
+	var indexed []string
+	for _, line := range lines {
+		var name, kind string
+		var n int
+		if _, err := fmt.Sscanf(line, "#   %s %s line %d", &name, &kind, &n); err != nil {
+			continue
+		}
+		indexed = append(indexed, name+" "+kind)
+		if n < 1 || n > len(lines) || !strings.HasPrefix(lines[n-1], name+":") && !strings.HasPrefix(lines[n-1], name+" =") {
+			t.Errorf("the index puts %s on line %d", name, n)
+		}
+	}
+	for _, want := range []string{"global_calls global", "_start entry", "square function", "print_int runtime", "str_concat runtime"} {
+		if !strings.Contains(strings.Join(indexed, "\n"), want) {
+			t.Errorf("the index lacks %s\n%s", want, strings.Join(indexed, "\n"))
+		}
+	}
+	if !strings.Contains(formatted, "# function square\n# ====") || !strings.Contains(formatted, "# entry _start\n") {
+		t.Error("the functions have no banners")
+	}
+
+	// The comments of instructions with short operands line up
+	columns := make(map[int]int)
+	for _, line := range lines {
+		if i := strings.Index(line, "#"); i > 0 && strings.HasPrefix(line, "    ") && line[4] != '#' && line[4] != '.' {
+			columns[i]++
+		}
+	}
+	if len(columns) != 1 {
+		t.Errorf("the comments of instructions start in columns %v", columns)
+	}
+
+	// Only comments and spaces change
+	if got, want := instructions(formatted), instructions(raw); got != want {
+		t.Errorf("the instructions of the listing differ from the assembly")
+	}
+}
+
+// instructions returns the code of assembly without comments, blank lines
+// or runs of spaces
+func instructions(assembly string) string {
+	var out []string
+	for _, line := range strings.Split(assembly, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 && !strings.Contains(line, ".asciz") {
+			line = line[:i]
+		}
+		if fields := strings.Fields(line); len(fields) > 0 {
+			out = append(out, strings.Join(fields, " "))
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+func TestFormattedAssemblyRuns(t *testing.T) {
+	requireToolchain(t)
+	_, formatted := listing(t)
+	binary := filepath.Join(t.TempDir(), "listing")
+	if err := assemble(formatted, nil, binary, toolchains[codegen.LinuxAMD64.Name][0]); err != nil {
+		t.Fatal(err)
+	}
+	var stdout bytes.Buffer
+	cmd := programCommand(binary)
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if want := "52\n1 call\n"; stdout.String() != want {
+		t.Errorf("output = %q, want %q", stdout.String(), want)
+	}
+}
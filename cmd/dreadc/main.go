@@ -1,100 +1,687 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"debug/elf"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"runtime"
 	"strings"
 
 	"dreadlang/internal/codegen"
-	"dreadlang/internal/lexer"
+	"dreadlang/internal/ir"
+	"dreadlang/internal/module"
 	"dreadlang/internal/parser"
+	"dreadlang/internal/semant"
 )
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "Usage: %s <source.dread> [output]\n", os.Args[0])
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		os.Exit(runDoctor(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		os.Exit(runBench(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		os.Exit(runCheck(os.Args[2:]))
+	}
+
+	force := flag.Bool("force", false, "overwrite an existing output file that dreadc did not write")
+	classicAout := flag.Bool("classic-aout", false, "name the output a.out when none is given")
+	targetName := flag.String("target", codegen.LinuxAMD64.Name, "system to build for: amd64-linux, amd64-freebsd or amd64-openbsd")
+	freestanding := flag.Bool("freestanding", false, "build for bare metal (target amd64-none): no OS runtime, output an object file")
+	entry := flag.String("entry", "dread_main", "entry symbol of a freestanding program")
+	outputFormat := flag.String("output-format", formatELF, "with --freestanding, \"flat-bin\" outputs a raw image instead of an ELF file")
+	flat := flag.Bool("flat", false, "shorthand for --output-format=flat-bin")
+	linkerScript := flag.String("linker-script", "", "link with this ld script, which controls the load addresses")
+	toolchainName := flag.String("toolchain", autoToolchain, "assembler and linker to build with: auto, binutils, cross, clang or cc")
+	cpuName := flag.String("cpu", codegen.BaselineCPU.Name, "processor to build for: baseline (any x86-64), x86-64-v3 or native (this machine)")
+	optimization := flag.Int("O", 0, "optimization level: 0, or 1 to join consecutive Prints of constants into one write and run the IR passes")
+	passList := flag.String("passes", "", "IR passes to run besides those of the -O level, or with a leading - not to run, separated by commas")
+	printAfter := flag.String("print-after", "", "write the IR to stderr after this pass has run")
+	output := flag.String("o", "", "output file, needed to name it when several source files are given")
+	emit := flag.String("emit", emitExecutable, "what to output: exe, asm for the assembly, ir for the IR of the expressions lowered to it, or ast for the syntax tree, written to -o or stdout")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [--force] [--classic-aout] [--target=name] [--freestanding [--entry=symbol] [--output-format=elf|flat-bin]] [--linker-script=file] [--toolchain=name] [--cpu=name] [--emit=exe|asm|ir|ast] [-O1] [--passes=list] [--print-after=pass] <source.dread> [output]\n       %s [flags] -o output <source.dread>...\n       %s doctor [--target=name]\n       %s bench [--iterations=n] [-O1] <source.dread>\n       %s check [--fix] <source.dread>...\n", os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+	args := parseInterspersed(flag.CommandLine, optimizationArguments(os.Args[1:]))
+
+	if len(args) < 1 {
+		flag.Usage()
 		os.Exit(1)
 	}
 
-	sourceFile := os.Args[1]
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
 
-	// Determine output file name
-	outputFile := "a.out"
-	if len(os.Args) > 2 {
-		outputFile = os.Args[2]
+	// A second argument that is not a source names the output, as it always has
+	sourceFiles := args
+	if !set["o"] && len(args) == 2 && !strings.HasSuffix(args[1], module.Extension) {
+		sourceFiles, *output = args[:1], args[1]
+		set["o"] = true
+	}
+	sourceFile := sourceFiles[0]
+	if *freestanding && set["target"] {
+		fmt.Fprintf(os.Stderr, "Error: --freestanding and --target cannot be combined\n")
+		os.Exit(1)
+	}
+	if *flat {
+		if set["output-format"] && *outputFormat != formatFlat {
+			fmt.Fprintf(os.Stderr, "Error: --flat conflicts with --output-format=%s\n", *outputFormat)
+			os.Exit(1)
+		}
+		*outputFormat = formatFlat
+	}
+	if *optimization < 0 || *optimization > maxOptimization {
+		fmt.Fprintf(os.Stderr, "Error: unknown optimization level %d\n", *optimization)
+		os.Exit(1)
+	}
+	passes, err := ir.NewPassManager(*optimization, *passList)
+	if err == nil && *printAfter != "" {
+		err = passes.PrintAfter(*printAfter, os.Stderr)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *outputFormat != formatELF && *outputFormat != formatFlat {
+		fmt.Fprintf(os.Stderr, "Error: unknown output format %s\n", *outputFormat)
+		os.Exit(1)
+	}
+	if !*freestanding && (set["entry"] || *outputFormat == formatFlat) {
+		fmt.Fprintf(os.Stderr, "Error: --entry and --output-format=flat-bin require --freestanding\n")
+		os.Exit(1)
 	}
 
-	// Read source file
-	source, err := ioutil.ReadFile(sourceFile)
+	target, ok := codegen.LookupTarget(*targetName)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: unknown target %s\n", *targetName)
+		os.Exit(1)
+	}
+	if *freestanding {
+		target = codegen.Freestanding.WithEntry(*entry)
+	}
+	cpu, err := findCPU(*cpuName)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+	target = target.WithCPU(cpu)
+	cg := codegen.NewForTarget(target)
+	cg.SetOptimization(*optimization)
+	cg.SetPasses(passes)
+	if *emit != emitExecutable {
+		if !set["o"] {
+			*output = ""
+		}
+		if err := emitText(cg, sourceFiles, *emit, *output, *force); err != nil {
+			fmt.Fprintf(os.Stderr, "Compilation error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	base, err := findToolchain(target, *toolchainName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	tools := toolchainFor(base, target, *outputFormat, *linkerScript)
+
+	// Determine output file name
+	var outputFile string
+	switch {
+	case set["o"]:
+		outputFile = *output
+	case *classicAout:
+		outputFile = "a.out"
+	case *outputFormat == formatFlat:
+		outputFile = defaultOutputName(sourceFile) + ".bin"
+	case tools.linker == nil:
+		outputFile = defaultOutputName(sourceFile) + ".o"
+	default:
+		outputFile = defaultOutputName(sourceFile)
+	}
+
+	for _, sourceFile := range sourceFiles {
+		if err := checkOutputPath(sourceFile, outputFile, *force); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Read source files
+	sources := make([]string, len(sourceFiles))
+	for i, sourceFile := range sourceFiles {
+		source, err := ioutil.ReadFile(sourceFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+			os.Exit(1)
+		}
+		sources[i] = string(source)
+	}
 
 	// Compile
-	if err := compile(string(source), outputFile); err != nil {
+	if len(sourceFiles) == 1 {
+		err = buildWith(cg, sourceFile, sources[0], outputFile, tools)
+	} else {
+		err = buildFilesWith(cg, sourceFiles, sources, outputFile, tools)
+	}
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Compilation error: %v\n", err)
 		os.Exit(1)
 	}
+	if *printAfter != "" {
+		if err := cg.Passes().RunProgram(cg.IR()); err != nil {
+			fmt.Fprintf(os.Stderr, "Internal compiler error: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
-	fmt.Printf("Successfully compiled %s to %s\n", sourceFile, outputFile)
+	fmt.Printf("Successfully compiled %s to %s\n", strings.Join(sourceFiles, ", "), outputFile)
 }
 
-func compile(source string, outputFile string) error {
-	// Lexical analysis
-	l := lexer.New(source)
+// parseInterspersed parses the flags in args wherever they appear, so that
+// dreadc a.dread b.dread -o app means what it says, and returns the other
+// arguments in order. The flag package alone stops at the first of those.
+func parseInterspersed(flags *flag.FlagSet, args []string) []string {
+	var rest []string
+	for {
+		flags.Parse(args)
+		if flags.NArg() == 0 {
+			return rest
+		}
+		rest = append(rest, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+}
+
+// defaultOutputName names the executable after the source file, in the
+// current directory: examples/hello.dread becomes hello. Sources without an
+// extension get ".out" appended instead, so the name never matches the source.
+func defaultOutputName(sourceFile string) string {
+	base := filepath.Base(sourceFile)
+	name := strings.TrimSuffix(base, filepath.Ext(base))
+	if name == base || name == "" {
+		return base + ".out"
+	}
+	return name
+}
+
+// checkOutputPath refuses output paths whose current contents would be lost by
+// mistake: the source file itself, directories, and (unless force is set) any
+// existing file that is not an executable built by dreadc or text it emitted.
+func checkOutputPath(sourceFile, outputFile string, force bool) error {
+	outInfo, err := os.Stat(outputFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if srcInfo, err := os.Stat(sourceFile); err == nil && os.SameFile(srcInfo, outInfo) {
+		return fmt.Errorf("output %s is the source file", outputFile)
+	}
+	if outInfo.IsDir() {
+		return fmt.Errorf("output %s is a directory", outputFile)
+	}
+	if !force && !builtByDreadc(outputFile) && !generatedByDreadc(outputFile) {
+		return fmt.Errorf("output %s already exists and was not built by dreadc (use --force to overwrite it)", outputFile)
+	}
+	return nil
+}
 
-	// Syntax analysis
-	p := parser.New(l)
-	program := p.ParseProgram()
+// builtByDreadc reports whether path is an ELF executable carrying the marker
+// that the code generator stores in its .comment section
+func builtByDreadc(path string) bool {
+	f, err := elf.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
 
-	if len(p.Errors()) > 0 {
-		for _, err := range p.Errors() {
-			fmt.Fprintf(os.Stderr, "Parse error: %s\n", err)
+	section := f.Section(".comment")
+	if section == nil {
+		return false
+	}
+	data, err := section.Data()
+	if err != nil {
+		return false
+	}
+	for _, entry := range bytes.Split(data, []byte{0}) {
+		if string(entry) == codegen.BuildMarker {
+			return true
 		}
-		return fmt.Errorf("parsing failed")
 	}
+	return false
+}
 
-	// Code generation
-	cg := codegen.New()
-	assembly := cg.Generate(program)
+// findCPU returns the CPU called name; "native" is this machine, whose
+// features Linux lists in /proc/cpuinfo
+func findCPU(name string) (*codegen.CPU, error) {
+	if name != "native" {
+		if cpu, ok := codegen.LookupCPU(name); ok {
+			return cpu, nil
+		}
+		return nil, fmt.Errorf("unknown CPU %s: use baseline, x86-64-v3 or native", name)
+	}
+	data, err := ioutil.ReadFile("/proc/cpuinfo")
+	if err != nil {
+		return nil, fmt.Errorf("cannot detect the features of this CPU (%v): use --cpu=baseline or --cpu=x86-64-v3", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if key, flags, ok := strings.Cut(line, ":"); ok && strings.TrimSpace(key) == "flags" {
+			return codegen.NativeCPU(name, strings.Fields(flags)), nil
+		}
+	}
+	return nil, fmt.Errorf("/proc/cpuinfo lists no CPU flags: use --cpu=baseline or --cpu=x86-64-v3")
+}
+
+// maxOptimization is the highest level -O accepts
+const maxOptimization = 1
+
+// optimizationArguments rewrites -O1, the usual spelling of an optimization
+// level, to -O=1, which the flag package understands
+func optimizationArguments(args []string) []string {
+	rewritten := make([]string, len(args))
+	for i, arg := range args {
+		if level := strings.TrimPrefix(arg, "-O"); level != arg && len(level) == 1 && level[0] >= '0' && level[0] <= '9' {
+			arg = "-O=" + level
+		}
+		rewritten[i] = arg
+	}
+	return rewritten
+}
+
+// compile builds source for target with the first toolchain installed and
+// no optimizations
+func compile(source string, outputFile string, target *codegen.Target) error {
+	tools, err := findToolchain(target, autoToolchain)
+	if err != nil {
+		return err
+	}
+	return build("", source, outputFile, target, tools, 0)
+}
+
+// build builds source, read from file, into outputFile. The modules it
+// imports are read from file's directory, or from the working directory
+// when file is "".
+func build(file string, source string, outputFile string, target *codegen.Target, tools toolchain, optimization int) error {
+	cg := codegen.NewForTarget(target)
+	cg.SetOptimization(optimization)
+	return buildWith(cg, file, source, outputFile, tools)
+}
+
+// buildWith is build with a code generator the caller has configured
+func buildWith(cg *codegen.CodeGenerator, file string, source string, outputFile string, tools toolchain) error {
+	assembly, diagnostics := generateWith(cg, file, source)
+	return assemble(assembly, diagnostics, outputFile, tools)
+}
+
+// buildFiles builds the program made of several files, read with sources,
+// into outputFile
+func buildFiles(files []string, sources []string, outputFile string, target *codegen.Target, tools toolchain, optimization int) error {
+	cg := codegen.NewForTarget(target)
+	cg.SetOptimization(optimization)
+	return buildFilesWith(cg, files, sources, outputFile, tools)
+}
+
+// buildFilesWith is buildFiles with a code generator the caller has
+// configured
+func buildFilesWith(cg *codegen.CodeGenerator, files []string, sources []string, outputFile string, tools toolchain) error {
+	program, diagnostics := module.LoadFiles(files, sources)
+	assembly, diagnostics := generateProgram(cg, program, diagnostics)
+	return assemble(assembly, diagnostics, outputFile, tools)
+}
+
+// assemble reports the diagnostics of generating assembly, if there are any,
+// or assembles and links it into outputFile
+func assemble(assembly string, diagnostics []parser.Diagnostic, outputFile string, tools toolchain) error {
+	if err := report(diagnostics); err != nil {
+		return err
+	}
+
+	// Intermediate files live in a private directory, never next to the output
+	workDir, err := ioutil.TempDir("", "dreadc")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(workDir)
 
-	// Write assembly to temporary file
-	asmFile := outputFile + ".s"
+	asmFile := filepath.Join(workDir, "program.s")
 	if err := ioutil.WriteFile(asmFile, []byte(assembly), 0644); err != nil {
 		return fmt.Errorf("failed to write assembly: %v", err)
 	}
 
 	// Assemble and link using system tools
-	if err := assembleAndLink(asmFile, outputFile); err != nil {
+	if err := assembleAndLink(asmFile, outputFile, tools); err != nil {
 		return fmt.Errorf("assembly/linking failed: %v", err)
 	}
 
-	// Clean up assembly file
-	os.Remove(asmFile)
+	return nil
+}
 
+// report prints diagnostics to stderr, failing when any is an error
+func report(diagnostics []parser.Diagnostic) error {
+	for _, d := range diagnostics {
+		if d.Warning {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", d)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", d)
+		}
+	}
+	if n := errorCount(diagnostics); n > 0 {
+		return fmt.Errorf("found %d error(s)", n)
+	}
 	return nil
 }
 
-func assembleAndLink(asmFile, outputFile string) error {
+// What --emit selects to output
+const (
+	emitExecutable = "exe" // the program, assembled and linked
+	emitAssembly   = "asm" // the assembly generated for it
+	emitIR         = "ir"  // the IR of the expressions lowered to it, in its textual form
+	emitAST        = "ast" // its syntax tree, one file-scope declaration per line
+)
+
+// emitText writes the assembly or the IR of the program made of files,
+// generated by cg, to output, or to stdout when output is "", instead of
+// building it. The IR is written as the passes of cg leave it. Like an
+// executable, output only replaces an existing file that dreadc wrote,
+// unless force is set.
+func emitText(cg *codegen.CodeGenerator, files []string, emit string, output string, force bool) error {
+	if emit != emitAssembly && emit != emitIR && emit != emitAST {
+		return fmt.Errorf("unknown --emit %s: use exe, asm, ir or ast", emit)
+	}
+	sources := make([]string, len(files))
+	for i, file := range files {
+		source, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		sources[i] = string(source)
+	}
+
+	program, diagnostics := module.Load(files[0], sources[0])
+	if len(files) > 1 {
+		program, diagnostics = module.LoadFiles(files, sources)
+	}
+	assembly, diagnostics := generateProgram(cg, program, diagnostics)
+	if err := report(diagnostics); err != nil {
+		return err
+	}
+
+	var text string
+	switch emit {
+	case emitAssembly:
+		text = cg.FormatAssembly(assembly)
+	case emitIR:
+		if err := cg.Passes().RunProgram(cg.IR()); err != nil {
+			return fmt.Errorf("internal compiler error: %v", err)
+		}
+		text = cg.IR().String()
+	case emitAST:
+		for _, pragma := range program.Pragmas {
+			text += pragma.String() + "\n"
+		}
+		for _, stmt := range program.Statements {
+			text += stmt.String() + "\n"
+		}
+	}
+	if output == "" {
+		fmt.Print(text)
+		return nil
+	}
+	for _, file := range files {
+		if err := checkOutputPath(file, output, force); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(output, []byte(textHeaders[emit]+text), 0644)
+}
+
+// textHeaders start the files emitText writes, so that writing one again
+// can tell it from a file dreadc did not produce
+var textHeaders = map[string]string{
+	emitAssembly: "# Generated by dreadc --emit=asm\n",
+	emitIR:       "# Generated by dreadc --emit=ir\n",
+	emitAST:      "// Generated by dreadc --emit=ast\n",
+}
+
+// generatedByDreadc reports whether path is text emitText wrote, which
+// starts with one of the textHeaders
+func generatedByDreadc(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	first, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	for _, header := range textHeaders {
+		if first == header {
+			return true
+		}
+	}
+	return false
+}
+
+// generateAssembly runs the front end and code generator over source. When a
+// phase reports errors, those are returned and later phases are skipped;
+// otherwise the diagnostics are the program's warnings.
+func generateAssembly(source string, target *codegen.Target, optimization int) (string, []parser.Diagnostic) {
+	cg := codegen.NewForTarget(target)
+	cg.SetOptimization(optimization)
+	return generateWith(cg, "", source)
+}
+
+// generateWith is generateAssembly with a code generator the caller has
+// configured, for source read from file
+func generateWith(cg *codegen.CodeGenerator, file string, source string) (string, []parser.Diagnostic) {
+	// Lexical and syntax analysis of the source and the modules it imports
+	program, diagnostics := module.Load(file, source)
+	return generateProgram(cg, program, diagnostics)
+}
+
+// generateProgram generates a program that was loaded with diagnostics,
+// unless there were any
+func generateProgram(cg *codegen.CodeGenerator, program *parser.Program, diagnostics []parser.Diagnostic) (string, []parser.Diagnostic) {
+	if len(diagnostics) > 0 {
+		return "", diagnostics
+	}
+
+	// Semantic analysis of the names the program uses
+	if diagnostics := semant.Check(program); len(diagnostics) > 0 {
+		return "", diagnostics
+	}
+
+	// Type checking and code generation, one function at a time
+	assembly := cg.Generate(program)
+	if len(cg.Diagnostics()) > 0 {
+		return "", cg.Diagnostics()
+	}
+
+	// A program that compiles may still do some things in vain
+	return assembly, semant.Warnings(program)
+}
+
+// errorCount counts the diagnostics that are errors rather than warnings
+func errorCount(diagnostics []parser.Diagnostic) int {
+	n := 0
+	for _, d := range diagnostics {
+		if !d.Warning {
+			n++
+		}
+	}
+	return n
+}
+
+// toolchain holds the commands that build an executable for a target. The
+// object and output paths are appended as "-o <output> <input>". Without a
+// linker, the assembler's object file is the output. ld is the linker that
+// takes ld's own options, which linking freestanding programs needs. A
+// native toolchain builds for the system it runs on, so it only builds ELF
+// programs on a host that uses ELF.
+type toolchain struct {
+	name      string
+	assembler []string
+	linker    []string
+	ld        string
+	native    bool
+}
+
+// elfHost reports whether this system's own programs are ELF files, which
+// native toolchains need. macOS uses Mach-O and Windows PE.
+var elfHost = runtime.GOOS != "darwin" && runtime.GOOS != "windows"
+
+// autoToolchain is the --toolchain that picks the first one installed
+const autoToolchain = "auto"
+
+// toolchains lists the toolchains that build each target, in the order
+// auto-detection tries them. Besides GNU binutils, the clang and cc drivers
+// assemble the same Intel syntax, and link without their C startup files.
+// On any host, binutils built for the target ("cross") and clang, told the
+// target and linking with lld, build ELF programs.
+var toolchains = map[string][]toolchain{
+	"amd64-linux": {
+		{name: "binutils", assembler: []string{"as", "--64"}, linker: []string{"ld"}, native: true},
+		{name: "cross", assembler: []string{"x86_64-linux-gnu-as", "--64"}, linker: []string{"x86_64-linux-gnu-ld"}},
+		{name: "clang", assembler: []string{"clang", "--target=x86_64-linux-gnu", "-c", "-x", "assembler"}, linker: []string{"ld.lld"}},
+		{name: "cc", assembler: []string{"cc", "-c", "-x", "assembler"}, linker: []string{"cc", "-nostdlib", "-static"}, native: true},
+	},
+	// FreeBSD ships clang without GNU as; its integrated assembler reads the
+	// same Intel syntax. Programs need no libc, so a GNU toolchain on another
+	// system can build them too.
+	"amd64-freebsd": {
+		{name: "cc", assembler: []string{"cc", "-c", "-x", "assembler"}, linker: []string{"ld"}, native: true},
+		{name: "clang", assembler: []string{"clang", "--target=x86_64-unknown-freebsd", "-c", "-x", "assembler"}, linker: []string{"ld.lld"}},
+		{name: "binutils", assembler: []string{"as", "--64"}, linker: []string{"ld"}, native: true},
+	},
+	// OpenBSD programs call libc, so they must be linked on OpenBSD against
+	// its static libc. Generated code uses absolute addresses, hence -nopie.
+	"amd64-openbsd": {
+		{name: "cc", assembler: []string{"cc", "-c", "-x", "assembler"}, linker: []string{"cc", "-static", "-nopie"}, native: true},
+		{name: "clang", assembler: []string{"clang", "-c", "-x", "assembler"}, linker: []string{"clang", "-static", "-nopie"}, native: true},
+	},
+	// Freestanding programs are linked by the user, together with their own
+	// startup code and I/O hooks (see toolchainFor for the linked formats)
+	"amd64-none": {
+		{name: "binutils", assembler: []string{"as", "--64"}, ld: "ld", native: true},
+		{name: "cross", assembler: []string{"x86_64-elf-as", "--64"}, ld: "x86_64-elf-ld"},
+		{name: "clang", assembler: []string{"clang", "--target=x86_64-elf", "-c", "-x", "assembler"}, ld: "ld.lld"},
+		{name: "cc", assembler: []string{"cc", "-c", "-x", "assembler"}, ld: "ld", native: true},
+	},
+}
+
+// findToolchain returns the toolchain called name that builds target, or
+// for "auto" the first one that works on this host, whose commands are all
+// installed and do build a program for target
+func findToolchain(target *codegen.Target, name string) (toolchain, error) {
+	var names []string
+	for _, tools := range toolchains[target.Name] {
+		switch {
+		case name == tools.name:
+			return tools, nil
+		case name == autoToolchain && (elfHost || !tools.native) && tools.installed() && tools.builds(target):
+			return tools, nil
+		}
+		names = append(names, tools.name)
+	}
+	if name == autoToolchain {
+		return toolchain{}, fmt.Errorf("no working toolchain for %s is installed: tried %s (run dreadc doctor for help)", target.Name, strings.Join(names, ", "))
+	}
+	return toolchain{}, fmt.Errorf("unknown toolchain %s for %s: use auto, %s", name, target.Name, strings.Join(names, ", "))
+}
+
+// installed reports whether every command of the toolchain is in PATH
+func (t toolchain) installed() bool {
+	for _, command := range [][]string{t.assembler, t.linker} {
+		if command == nil {
+			continue
+		}
+		if _, err := exec.LookPath(command[0]); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// builds reports whether the toolchain assembles and links a program that
+// only defines the entry symbol of target. A command can be installed and
+// still fail: an assembler for another architecture, or a cc wrapper
+// without a compiler behind it.
+func (t toolchain) builds(target *codegen.Target) bool {
+	workDir, err := ioutil.TempDir("", "dreadc-probe")
+	if err != nil {
+		return false
+	}
+	defer os.RemoveAll(workDir)
+	asmFile := filepath.Join(workDir, "probe.s")
+	source := fmt.Sprintf(".intel_syntax noprefix\n.globl %[1]s\n.text\n%[1]s:\n    ret\n", target.EntrySymbol())
+	if err := ioutil.WriteFile(asmFile, []byte(source), 0644); err != nil {
+		return false
+	}
+	return assembleAndLink(asmFile, filepath.Join(workDir, "probe"), t) == nil
+}
+
+// Output formats selected with --output-format
+const (
+	formatELF  = "elf"      // an executable, or an object file for freestanding programs
+	formatFlat = "flat-bin" // a raw image of the linked program, without headers
+)
+
+// toolchainFor returns the commands of tools that build target in the given
+// output format. A linker script is passed through to the linker; it also
+// makes a freestanding program link into an executable instead of an object
+// file. Flat images start at address 0 unless the script places them
+// elsewhere.
+func toolchainFor(tools toolchain, target *codegen.Target, format string, linkerScript string) toolchain {
+	if target.Name == codegen.Freestanding.Name {
+		switch {
+		case format == formatFlat && linkerScript == "":
+			tools.linker = []string{tools.ld, "--oformat", "binary", "-Ttext=0", "-e", target.EntrySymbol()}
+		case format == formatFlat:
+			tools.linker = []string{tools.ld, "--oformat", "binary", "-e", target.EntrySymbol()}
+		case linkerScript != "":
+			tools.linker = []string{tools.ld, "-e", target.EntrySymbol()}
+		}
+	}
+	if linkerScript != "" {
+		tools.linker = append(append([]string{}, tools.linker...), "-T", linkerScript)
+	}
+	return tools
+}
+
+func assembleAndLink(asmFile, outputFile string, tools toolchain) error {
 	objFile := strings.TrimSuffix(asmFile, ".s") + ".o"
+	if tools.linker == nil {
+		objFile = outputFile
+	}
 
 	// Assemble
-	cmd := exec.Command("as", "--64", "-o", objFile, asmFile)
+	cmd := exec.Command(tools.assembler[0], append(tools.assembler[1:], "-o", objFile, asmFile)...)
 	if output, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("assembler error: %v\nOutput: %s", err, output)
 	}
 
+	if tools.linker == nil {
+		return nil
+	}
+
 	// Link
-	cmd = exec.Command("ld", "-o", outputFile, objFile)
+	cmd = exec.Command(tools.linker[0], append(tools.linker[1:], "-o", outputFile, objFile)...)
 	if output, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("linker error: %v\nOutput: %s", err, output)
 	}
 
-	// Clean up object file
-	os.Remove(objFile)
-
 	return nil
 }
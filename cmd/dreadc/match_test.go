@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"dreadlang/internal/codegen"
+)
+
+// Tables whose cases reach the ends of Int must be built without the case
+// value wrapping around, which used to loop forever
+func TestJumpTableAtIntLimits(t *testing.T) {
+	source := `Entry main() {
+    n = 0
+    Match (n) {
+        Case 9223372036854775805, 9223372036854775806 { Print('a') }
+        Case 9223372036854775807, 9223372036854775804 { Print('b') }
+    }
+    Match (n) {
+        Case -9223372036854775808, -9223372036854775807 { Print('c') }
+        Case -9223372036854775806, -9223372036854775805 { Print('d') }
+    }
+}
+`
+	assembly, diagnostics := generateAssembly(source, codegen.LinuxAMD64, 0)
+	if len(diagnostics) > 0 {
+		t.Fatal(diagnostics)
+	}
+	for _, want := range []string{
+		"# Jump table for cases 9223372036854775804..9223372036854775807",
+		"# Jump table for cases -9223372036854775808..-9223372036854775805",
+	} {
+		if !strings.Contains(assembly, want) {
+			t.Errorf("no %q in\n%s", want, assembly)
+		}
+	}
+	if tables := strings.Count(assembly, "    .quad match_"); tables != 8 {
+		t.Errorf("tables have %d entries, want 8", tables)
+	}
+}
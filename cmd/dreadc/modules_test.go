@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dreadlang/internal/codegen"
+	"dreadlang/internal/module"
+)
+
+// The programs in this directory import the other files in it
+const modulesDir = "testdata/modules"
+
+func TestModules(t *testing.T) {
+	requireToolchain(t)
+
+	file := filepath.Join(modulesDir, "shapes.dread")
+	source, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary := filepath.Join(t.TempDir(), "shapes")
+	if err := build(file, string(source), binary, codegen.LinuxAMD64, toolchains[codegen.LinuxAMD64.Name][0], 0); err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	var stdout bytes.Buffer
+	cmd := programCommand(binary)
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if want := "perimeter: 14 mm\nsides: 4 mm\n"; stdout.String() != want {
+		t.Errorf("output = %q, want %q", stdout.String(), want)
+	}
+}
+
+func TestModuleErrors(t *testing.T) {
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"cycle", "loop_b.dread:3:8: E014: import cycle: loop_a imports loop_b imports loop_a"},
+		{"missing", "1:8: E014: cannot find module nowhere: there is no testdata/modules/nowhere.dread"},
+		{"misnamed", "renamed.dread:1:8: E014: file declares Module other but is imported as renamed"},
+		{"duplicate", "3:10: E103: scale is declared by both module units and the main file"},
+		{"two_entries", "shapes.dread:7:1: E014: module shapes cannot have an Entry function"},
+		{"strict", "tally.dread:9:5: E104: variable last is not declared: #pragma strict requires Var last Type before assigning it"},
+		{"private", "10:15: E118: type Code is private to vault.dread\n4:9: E118: struct Key is private to vault.dread\n4:17: E118: struct Key is private to vault.dread\n4:27: E118: constant CODE is private to vault.dread\n5:11: E118: function check is private to vault.dread\n6:5: E118: variable opened is private to vault.dread"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			file := filepath.Join(modulesDir, tt.file+".dread")
+			source, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, d := range checkSource(file, string(source)) {
+				got = append(got, d.String())
+			}
+			want := tt.want
+			if strings.HasSuffix(strings.SplitN(want, ":", 2)[0], ".dread") {
+				want = filepath.Join(modulesDir, want)
+			}
+			if strings.Join(got, "\n") != want {
+				t.Errorf("diagnostics = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// The programs in this directory are given to dreadc as several files
+const filesDir = "testdata/files"
+
+// readFiles reads the named files of filesDir
+func readFiles(t *testing.T, names ...string) ([]string, []string) {
+	var files, sources []string
+	for _, name := range names {
+		file := filepath.Join(filesDir, name+".dread")
+		source, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+		sources = append(sources, string(source))
+	}
+	return files, sources
+}
+
+func TestMultipleFiles(t *testing.T) {
+	requireToolchain(t)
+
+	files, sources := readFiles(t, "words", "greeting")
+	binary := filepath.Join(t.TempDir(), "greeting")
+	if err := buildFiles(files, sources, binary, codegen.LinuxAMD64, toolchains[codegen.LinuxAMD64.Name][0], 0); err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	var stdout bytes.Buffer
+	cmd := programCommand(binary)
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if want := "hello!\nababab\n"; stdout.String() != want {
+		t.Errorf("output = %q, want %q", stdout.String(), want)
+	}
+}
+
+func TestMultipleFileErrors(t *testing.T) {
+	tests := []struct {
+		files []string
+		want  string
+	}{
+		{[]string{"greeting", "words", "clash"}, "clash.dread:2:10: E103: shout is declared by both testdata/files/words.dread and testdata/files/clash.dread"},
+		{[]string{"greeting", "words", "second_entry"}, "second_entry.dread:1:1: E004: multiple Entry functions: main in testdata/files/greeting.dread and other in testdata/files/second_entry.dread"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.files, "+"), func(t *testing.T) {
+			files, sources := readFiles(t, tt.files...)
+			_, diagnostics := module.LoadFiles(files, sources)
+			var got []string
+			for _, d := range diagnostics {
+				got = append(got, d.String())
+			}
+			if want := filepath.Join(filesDir, tt.want); strings.Join(got, "\n") != want {
+				t.Errorf("diagnostics = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestParseInterspersed(t *testing.T) {
+	flags := flag.NewFlagSet("dreadc", flag.ContinueOnError)
+	output := flags.String("o", "", "")
+	optimization := flags.Int("O", 0, "")
+	args := parseInterspersed(flags, optimizationArguments([]string{"a.dread", "-O1", "b.dread", "-o", "app"}))
+	if strings.Join(args, " ") != "a.dread b.dread" || *output != "app" || *optimization != 1 {
+		t.Errorf("arguments = %q, -o = %q, -O = %d", args, *output, *optimization)
+	}
+}
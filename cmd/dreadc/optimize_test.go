@@ -0,0 +1,155 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"dreadlang/internal/codegen"
+)
+
+func TestPrintFusion(t *testing.T) {
+	source := `Const NAME = "dread"
+
+Entry main() {
+    Print("=== ")
+    Print(NAME)
+    Print(" ===\n")
+    Var n Int = 1
+    Print(n)
+    Print("\n")
+    Print(2)
+}
+`
+	tests := []struct {
+		optimization int
+		writes       int
+	}{
+		{0, 4},
+		{1, 2},
+	}
+	for _, tt := range tests {
+		assembly, diagnostics := generateAssembly(source, codegen.LinuxAMD64, tt.optimization)
+		if len(diagnostics) > 0 {
+			t.Fatalf("-O%d: %v", tt.optimization, diagnostics)
+		}
+		// Only the inline writes of main count, not those in the runtime helpers
+		main := assembly[strings.Index(assembly, "_start:"):]
+		main = main[:strings.Index(main, "# Default exit")]
+		if writes := strings.Count(main, "# sys_write"); writes != tt.writes {
+			t.Errorf("-O%d: main writes %d times, want %d\n%s", tt.optimization, writes, tt.writes, main)
+		}
+	}
+}
+
+func TestStringPool(t *testing.T) {
+	source := `Entry main() {
+    Var greeting String = "hello world\n"
+    Var name String = "world\n"
+    Var same String = "\101B"
+    Var again String = "AB"
+    Print(greeting + name + same + again)
+}
+`
+	assembly, diagnostics := generateAssembly(source, codegen.LinuxAMD64, 0)
+	if len(diagnostics) > 0 {
+		t.Fatal(diagnostics)
+	}
+	for _, want := range []string{
+		`str_0: .asciz "hello world\n"`,
+		"str_1 = str_0 + 6",
+		`str_2: .asciz "AB"`,
+		"# string pool: 1 of 3 strings share the bytes of another, saving 7 bytes",
+	} {
+		if !strings.Contains(assembly, want) {
+			t.Errorf("assembly lacks %q", want)
+		}
+	}
+	// "\101B" is decoded to AB by the lexer, so both are one constant
+	if strings.Contains(assembly, "str_3") {
+		t.Error("equal strings written differently were emitted twice")
+	}
+}
+
+func TestSmallIntPrint(t *testing.T) {
+	source := `Entry main() {
+    Var b UInt8 = 200
+    Var n Int = 300
+    Print(b)
+    Print(Ord('A'))
+    Print(n)
+}
+`
+	tests := []struct {
+		optimization int
+		small        int
+	}{
+		{0, 0},
+		{1, 2},
+	}
+	for _, tt := range tests {
+		assembly, diagnostics := generateAssembly(source, codegen.LinuxAMD64, tt.optimization)
+		if len(diagnostics) > 0 {
+			t.Fatalf("-O%d: %v", tt.optimization, diagnostics)
+		}
+		if small := strings.Count(assembly, "call print_small_int"); small != tt.small {
+			t.Errorf("-O%d: %d Prints use the table, want %d", tt.optimization, small, tt.small)
+		}
+		if !strings.Contains(assembly, "call print_int") {
+			t.Errorf("-O%d: Print of an Int not known to be small lacks call print_int", tt.optimization)
+		}
+	}
+}
+
+func TestCompileTimeCalls(t *testing.T) {
+	source := `Var total Int = 0
+
+Function cube(n Int) Int {
+    Return(n * n * n)
+}
+
+Function add(n Int) Int {
+    total = total + n
+    Return(total)
+}
+
+Function forever(n Int) Int {
+    For (;;) {
+        n = n + 1
+    }
+    Return(n)
+}
+
+Entry main() {
+    Print(cube(3))
+    Print(add(1))
+    Print(forever(0))
+}
+`
+	tests := []struct {
+		optimization int
+		calls        []string
+	}{
+		{0, []string{"cube", "add", "forever"}},
+		{1, []string{"add", "forever"}},
+	}
+	for _, tt := range tests {
+		assembly, diagnostics := generateAssembly(source, codegen.LinuxAMD64, tt.optimization)
+		if len(diagnostics) > 0 {
+			t.Fatalf("-O%d: %v", tt.optimization, diagnostics)
+		}
+		main := assembly[strings.Index(assembly, "_start:"):]
+		main = main[:strings.Index(main, "# Default exit")]
+		var calls []string
+		for _, line := range strings.Split(main, "\n") {
+			if name, ok := strings.CutPrefix(strings.TrimSpace(line), "call "); ok && !strings.HasPrefix(name, "print_") {
+				calls = append(calls, name)
+			}
+		}
+		if strings.Join(calls, " ") != strings.Join(tt.calls, " ") {
+			t.Errorf("-O%d: main calls %v, want %v\n%s", tt.optimization, calls, tt.calls, main)
+		}
+		if folded := strings.Contains(main, "mov rax, 27    # constant cube(3)"); folded != (tt.optimization > 0) {
+			t.Errorf("-O%d: cube(3) folded is %v", tt.optimization, folded)
+		}
+	}
+}
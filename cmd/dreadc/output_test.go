@@ -0,0 +1,117 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"dreadlang/internal/codegen"
+)
+
+func TestCheckOutputPath(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "hello.dread")
+	if err := os.WriteFile(source, []byte("Entry main() {\n    Print('hi')\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	userFile := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(userFile, []byte("keep me\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		output  string
+		force   bool
+		wantErr bool
+	}{
+		{"new file", filepath.Join(dir, "hello"), false, false},
+		{"source file", source, false, true},
+		{"source file with force", source, true, true},
+		{"directory", dir, true, true},
+		{"foreign file", userFile, false, true},
+		{"foreign file with force", userFile, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkOutputPath(source, tt.output, tt.force)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkOutputPath(%q, force=%v) error = %v, want error: %v", tt.output, tt.force, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckOutputPathAllowsRebuild(t *testing.T) {
+	requireToolchain(t)
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "hello.dread")
+	output := filepath.Join(dir, "hello")
+	if err := compile("Entry main() {\n    Print('hi')\n}\n", output, codegen.LinuxAMD64); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkOutputPath(source, output, false); err != nil {
+		t.Errorf("rebuilding a dreadc executable was refused: %v", err)
+	}
+
+	// compile must not leave intermediate files next to the output
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("output directory holds %d entries, want only the executable", len(entries))
+	}
+}
+
+func TestEmitTextKeepsForeignFiles(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "hello.dread")
+	if err := os.WriteFile(source, []byte("Entry main() {\n    Print('hi')\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	notes := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(notes, []byte("keep me\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, emit := range []string{emitAssembly, emitIR, emitAST} {
+		if err := emitText(codegen.NewForTarget(codegen.LinuxAMD64), []string{source}, emit, notes, false); err == nil {
+			t.Errorf("--emit=%s overwrote a file dreadc did not write", emit)
+		}
+		if text, _ := os.ReadFile(notes); string(text) != "keep me\n" {
+			t.Fatalf("--emit=%s changed the file to %q", emit, text)
+		}
+	}
+
+	// Emitted text may be written again, as any other kind, and --force
+	// overwrites anything but the source
+	listing := filepath.Join(dir, "hello.s")
+	for _, emit := range []string{emitAssembly, emitAssembly, emitIR, emitAST} {
+		if err := emitText(codegen.NewForTarget(codegen.LinuxAMD64), []string{source}, emit, listing, false); err != nil {
+			t.Errorf("--emit=%s over emitted text: %v", emit, err)
+		}
+	}
+	if err := emitText(codegen.NewForTarget(codegen.LinuxAMD64), []string{source}, emitAssembly, notes, true); err != nil {
+		t.Errorf("--emit=asm --force: %v", err)
+	}
+	if err := emitText(codegen.NewForTarget(codegen.LinuxAMD64), []string{source}, emitAssembly, source, true); err == nil {
+		t.Error("--emit=asm --force overwrote the source")
+	}
+}
+
+func TestDefaultOutputName(t *testing.T) {
+	tests := map[string]string{
+		"hello.dread":              "hello",
+		"examples/valid/fib.dread": "fib",
+		"archive.tar.dread":        "archive.tar",
+		"script":                   "script.out",
+		".dread":                   ".dread.out",
+	}
+	for source, want := range tests {
+		if got := defaultOutputName(source); got != want {
+			t.Errorf("defaultOutputName(%q) = %q, want %q", source, got, want)
+		}
+	}
+}
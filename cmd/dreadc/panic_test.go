@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"dreadlang/internal/codegen"
+)
+
+func TestPanicMessage(t *testing.T) {
+	requireToolchain(t)
+
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"entry", "Entry main() {\n    Panic('stop')\n}\n", "panic: stop\n    in main\n"},
+		{"leaf", "Function check(Int n) {\n    If (n < 0) {\n        Panic('negative')\n    }\n}\n\nEntry main() {\n    check(-1)\n}\n", "panic: negative\n    in check\n"},
+		{"generic", "Function fail[T](value T) {\n    Panic('bad ' + String(value))\n}\n\nEntry main() {\n    fail(3)\n}\n", "panic: bad 3\n    in fail[Int]\n"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			binary := filepath.Join(t.TempDir(), "program")
+			if err := compile(tt.source, binary, codegen.LinuxAMD64); err != nil {
+				t.Fatalf("compile failed: %v", err)
+			}
+			var stderr bytes.Buffer
+			cmd := programCommand(binary)
+			cmd.Stderr = &stderr
+			var exitErr *exec.ExitError
+			if err := cmd.Run(); !errors.As(err, &exitErr) || exitErr.ExitCode() != 37 {
+				t.Fatalf("run = %v, want exit status 37", err)
+			}
+			if got := stderr.String(); got != tt.want {
+				t.Errorf("stderr = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
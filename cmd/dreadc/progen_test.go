@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"dreadlang/internal/codegen"
+	"dreadlang/internal/progen"
+)
+
+// FuzzGeneratedPrograms compiles random well-typed programs at every
+// optimization level and checks that each prints and exits the same as the
+// others and as the generator's own evaluation. Run it beyond the seed corpus
+// with: go test -fuzz=FuzzGeneratedPrograms ./cmd/dreadc
+func FuzzGeneratedPrograms(f *testing.F) {
+	requireToolchain(f)
+
+	seeds := 40
+	if testing.Short() {
+		seeds = 5
+	}
+	for seed := 0; seed < seeds; seed++ {
+		f.Add(int64(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, seed int64) {
+		dir := t.TempDir()
+		program := progen.Generate(rand.New(rand.NewSource(seed)), progen.DefaultConfig)
+		if msg := checkGenerated(dir, program); msg != "" {
+			smallest := progen.Shrink(program, func(p *progen.Program) bool {
+				return checkGenerated(dir, p) != ""
+			})
+			t.Fatalf("seed %d: %s\nminimal failing program:\n%s", seed, checkGenerated(dir, smallest), smallest.Source())
+		}
+	})
+}
+
+// checkGenerated compiles and runs program at each optimization level,
+// describing any failure
+func checkGenerated(dir string, program *progen.Program) string {
+	var first string
+	var firstExit int
+	for level := 0; level <= maxOptimization; level++ {
+		binary := filepath.Join(dir, fmt.Sprintf("program-O%d", level))
+		if err := build("", program.Source(), binary, codegen.LinuxAMD64, toolchains[codegen.LinuxAMD64.Name][0], level); err != nil {
+			return fmt.Sprintf("-O%d: compile failed: %v", level, err)
+		}
+
+		var stdout bytes.Buffer
+		cmd := programCommand(binary)
+		cmd.Stdout = &stdout
+		exitCode := 0
+		if err := cmd.Run(); err != nil {
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) {
+				return fmt.Sprintf("-O%d: run failed: %v", level, err)
+			}
+			exitCode = exitErr.ExitCode()
+		}
+
+		got := stdout.String()
+		if level == 0 {
+			first, firstExit = got, exitCode
+		} else if got != first || exitCode != firstExit {
+			return fmt.Sprintf("-O%d differs from -O0\n got: %q, exit status %d\nwant: %q, exit status %d", level, got, exitCode, first, firstExit)
+		}
+		if want := program.Expected(); got != want {
+			return fmt.Sprintf("-O%d: output mismatch\n got: %q\nwant: %q", level, got, want)
+		}
+		if want := program.ExitStatus(); exitCode != want {
+			return fmt.Sprintf("-O%d: exit status = %d, want %d", level, exitCode, want)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"dreadlang/internal/codegen"
+)
+
+// runner runs built programs, either directly or, when this machine cannot,
+// under an emulator or in a container
+type runner struct {
+	// command returns the command line that runs program
+	command func(program string) []string
+	// runs reports whether programs built for target run this way here
+	runs func(target string) bool
+}
+
+// nativeRunner is the --runner that runs programs directly
+const nativeRunner = "native"
+
+// dockerImage is the image programs run in with --runner=docker. Programs
+// are static, so any Linux userland will do.
+const dockerImage = "busybox"
+
+// runners maps each --runner to how it runs programs
+var runners = map[string]runner{
+	nativeRunner: {
+		command: func(program string) []string { return []string{program} },
+		runs: func(target string) bool {
+			return hostSystems[target] == runtime.GOOS && runtime.GOARCH == "amd64"
+		},
+	},
+	// qemu-user emulates an x86-64 Linux process on a Linux host of any
+	// architecture
+	"qemu-user": {
+		command: func(program string) []string { return []string{"qemu-x86_64", program} },
+		runs: func(target string) bool {
+			return target == codegen.LinuxAMD64.Name && runtime.GOOS == "linux"
+		},
+	},
+	// Docker runs Linux programs on any host, emulating x86-64 on others.
+	// The program's directory is mounted read-only into the container.
+	"docker": {
+		command: func(program string) []string {
+			dir, name := filepath.Split(program)
+			return []string{"docker", "run", "--rm", "-i", "--platform=linux/amd64", "-v", filepath.Clean(dir) + ":/dread:ro", dockerImage, "/dread/" + name}
+		},
+		runs: func(target string) bool { return target == codegen.LinuxAMD64.Name },
+	},
+}
+
+// findRunner returns the runner called name
+func findRunner(name string) (runner, error) {
+	if r, ok := runners[name]; ok {
+		return r, nil
+	}
+	var names []string
+	for name := range runners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return runner{}, fmt.Errorf("unknown runner %s: use %s", name, strings.Join(names, ", "))
+}
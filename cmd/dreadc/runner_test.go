@@ -0,0 +1,29 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"dreadlang/internal/codegen"
+)
+
+func TestRunners(t *testing.T) {
+	program := filepath.Join("build", "hello")
+	want := []string{"docker", "run", "--rm", "-i", "--platform=linux/amd64", "-v", "build:/dread:ro", dockerImage, "/dread/hello"}
+	if got := runners["docker"].command(program); !reflect.DeepEqual(got, want) {
+		t.Errorf("docker command = %q, want %q", got, want)
+	}
+	if got := runners["qemu-user"].command(program); !reflect.DeepEqual(got, []string{"qemu-x86_64", program}) {
+		t.Errorf("qemu-user command = %q", got)
+	}
+	// Neither emulates another operating system
+	for _, name := range []string{"docker", "qemu-user"} {
+		if runners[name].runs(codegen.FreeBSDAMD64.Name) {
+			t.Errorf("runner %s claims to run %s programs", name, codegen.FreeBSDAMD64.Name)
+		}
+	}
+	if _, err := findRunner("wine"); err == nil {
+		t.Error("unknown runner wine was accepted")
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"dreadlang/internal/codegen"
+)
+
+func TestSyscallTable(t *testing.T) {
+	every := "read write open close lseek mmap munmap brk getpid socket accept bind listen unlink exit clock_gettime"
+	tests := []struct {
+		target *codegen.Target
+		want   string
+	}{
+		{codegen.LinuxAMD64, every},
+		{codegen.FreeBSDAMD64, strings.Replace(every, " brk", "", 1)},
+		{codegen.OpenBSDAMD64, strings.Replace(every, " brk", "", 1)},
+		{codegen.Freestanding, "write exit"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(tt.target.Syscalls(), " "); got != tt.want {
+			t.Errorf("%s: syscalls = %s, want %s", tt.target.Name, got, tt.want)
+		}
+	}
+}
+
+func TestSyscallWrappers(t *testing.T) {
+	source := `Entry main() {
+    fd = Syscall('open', 'data', 0, 0)
+    Print(Syscall('mmap', 0, 4096, 3, 34, fd, 0))
+}
+`
+	tests := []struct {
+		target *codegen.Target
+		open   []string
+		mmap   []string
+	}{
+		{codegen.LinuxAMD64, []string{"mov rax, 2 "}, []string{"mov r10, rcx", "mov rax, 9 "}},
+		{codegen.FreeBSDAMD64, []string{"mov rax, 5 ", "neg rax"}, []string{"mov r10, rcx", "mov rax, 477 ", "neg rax"}},
+		{codegen.OpenBSDAMD64, []string{"call open "}, []string{"call mmap "}},
+	}
+	for _, tt := range tests {
+		assembly, diagnostics := generateAssembly(source, tt.target, 0)
+		if len(diagnostics) > 0 {
+			t.Fatalf("%s: %v", tt.target.Name, diagnostics)
+		}
+		for name, want := range map[string][]string{"open": tt.open, "mmap": tt.mmap} {
+			start := strings.Index(assembly, "\nsys_"+name+":\n")
+			if start < 0 {
+				t.Errorf("%s: no wrapper for %s\n%s", tt.target.Name, name, assembly)
+				continue
+			}
+			wrapper := assembly[start:]
+			wrapper = wrapper[:strings.Index(wrapper, "    ret\n")]
+			for _, w := range want {
+				if !strings.Contains(wrapper, w) {
+					t.Errorf("%s: sys_%s lacks %q\n%s", tt.target.Name, name, w, wrapper)
+				}
+			}
+			if tt.target == codegen.OpenBSDAMD64 && strings.Contains(wrapper, "r10") {
+				t.Errorf("%s: sys_%s moves an argument to r10 for libc\n%s", tt.target.Name, name, wrapper)
+			}
+		}
+		if strings.Contains(assembly, "sys_write:") {
+			t.Errorf("%s: a wrapper for a syscall the program does not make was generated", tt.target.Name)
+		}
+	}
+
+	_, diagnostics := generateAssembly(source, codegen.Freestanding, 0)
+	if len(diagnostics) != 2 || diagnostics[0].String() != "2:10: E119: syscall 'open' is not available on amd64-none" {
+		t.Errorf("freestanding: diagnostics = %v", diagnostics)
+	}
+}
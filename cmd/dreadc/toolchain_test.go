@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"dreadlang/internal/codegen"
+)
+
+func TestFindToolchain(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PATH", dir)
+	defer func(host bool) { elfHost = host }(elfHost)
+	elfHost = true
+	stub := func(command string, script string) {
+		if err := os.WriteFile(filepath.Join(dir, command), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	install := func(command string) { stub(command, "") }
+
+	if tools, err := findToolchain(codegen.LinuxAMD64, autoToolchain); err == nil {
+		t.Errorf("found toolchain %s with nothing installed", tools.name)
+	}
+	// An explicit choice is taken even when it is not installed
+	if tools, err := findToolchain(codegen.LinuxAMD64, "binutils"); err != nil || tools.name != "binutils" {
+		t.Errorf("findToolchain(binutils) = %s, %v", tools.name, err)
+	}
+	if _, err := findToolchain(codegen.LinuxAMD64, "gas"); err == nil {
+		t.Error("unknown toolchain gas was accepted")
+	}
+
+	steps := []struct {
+		install []string
+		want    string
+	}{
+		{[]string{"cc"}, "cc"},
+		// clang needs its linker too
+		{[]string{"clang"}, "cc"},
+		{[]string{"ld.lld"}, "clang"},
+		{[]string{"as", "ld"}, "binutils"},
+	}
+	for _, step := range steps {
+		for _, command := range step.install {
+			install(command)
+		}
+		if tools, err := findToolchain(codegen.LinuxAMD64, autoToolchain); err != nil || tools.name != step.want {
+			t.Errorf("after installing %v, findToolchain = %s, %v; want %s", step.install, tools.name, err, step.want)
+		}
+	}
+
+	// An installed assembler that cannot assemble is passed over
+	stub("as", "echo 'as: unrecognized option --64' >&2\nexit 1\n")
+	if tools, err := findToolchain(codegen.LinuxAMD64, autoToolchain); err != nil || tools.name != "clang" {
+		t.Errorf("with a failing as, findToolchain = %s, %v; want clang", tools.name, err)
+	}
+	stub("ld.lld", "exit 1\n")
+	stub("cc", "exit 1\n")
+	if tools, err := findToolchain(codegen.LinuxAMD64, autoToolchain); err == nil {
+		t.Errorf("found toolchain %s when every one fails", tools.name)
+	}
+	install("ld.lld")
+
+	// On macOS or Windows the native tools build the wrong object format
+	elfHost = false
+	if tools, err := findToolchain(codegen.LinuxAMD64, autoToolchain); err != nil || tools.name != "clang" {
+		t.Errorf("on a non-ELF host, findToolchain = %s, %v; want clang", tools.name, err)
+	}
+	install("x86_64-linux-gnu-as")
+	install("x86_64-linux-gnu-ld")
+	if tools, err := findToolchain(codegen.LinuxAMD64, autoToolchain); err != nil || tools.name != "cross" {
+		t.Errorf("on a non-ELF host with cross binutils, findToolchain = %s, %v; want cross", tools.name, err)
+	}
+}
@@ -0,0 +1,60 @@
+// Command dreadfix rewrites Dread sources:
+//
+//	dreadfix rename <old> <new> <source.dread>...
+//
+// renames the variables, constants and functions called old in each file,
+// unless that would change the meaning of the program.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"dreadlang/internal/semantic"
+)
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "rename" || len(os.Args) < 5 {
+		fmt.Fprintf(os.Stderr, "Usage: %s rename <old> <new> <source.dread>...\n", os.Args[0])
+		os.Exit(1)
+	}
+	os.Exit(runRename(os.Args[2], os.Args[3], os.Args[4:]))
+}
+
+// runRename renames old to new in every file and returns the exit status.
+// Each file is checked before any is written, so a refused rename leaves
+// them all as they were.
+func runRename(old, new string, files []string) int {
+	renamed := make([]string, len(files))
+	counts := make([]int, len(files))
+	total := 0
+	for i, file := range files {
+		source, n, err := semantic.Rename(file, old, new)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		renamed[i], counts[i] = source, n
+		total += n
+	}
+	if total == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no variable, constant or function is called %s\n", old)
+		return 1
+	}
+	for i, file := range files {
+		if counts[i] == 0 {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err == nil {
+			err = ioutil.WriteFile(file, []byte(renamed[i]), info.Mode())
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("%s: renamed %d name(s)\n", file, counts[i])
+	}
+	return 0
+}
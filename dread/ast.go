@@ -0,0 +1,337 @@
+package dread
+
+import (
+	"strconv"
+
+	"dreadlang/internal/lexer"
+	"dreadlang/internal/parser"
+)
+
+// File is a parsed source file
+type File struct {
+	Version      int     // the Version the nodes follow
+	Pragmas      []*Node // of kind Pragma, in source order
+	Declarations []*Node // in source order
+}
+
+// Node is one node of the syntax tree. Every kind sets the fields listed
+// for it below; the others are empty. Position is where the compiler reports
+// errors in the node: the name of a declaration other than a Function, the
+// operator of an Infix or Prefix, the name of a Field or of the function a
+// Call calls, and the first token of anything else. It is zero for the
+// nodes whose position the parser does not keep, such as most literals.
+// Where a child may be left out of the source, as the condition of a For,
+// an Empty node holds its place.
+//
+// Pragmas:
+//
+//	Pragma     Name; children: its arguments
+//
+// Declarations:
+//
+//	Function   Name, Type (the result; Void without one), Flags "entry" and
+//	           "private", End (the } of the body); children: Attribute...,
+//	           Receiver, TypeParameter..., Parameter..., then the body Block
+//	Parameter  Name, Type, Flags "variadic"; Receiver is the same for a method
+//	TypeParameter Name
+//	Attribute  Name; children: its arguments
+//	Var        Name, Type (with an array's length), Flags "private";
+//	           children: Attribute..., then the value if there is one
+//	Const      Name, Flags "private"; children: the value
+//	Struct     Name, Flags "private"; children: Field... (Name, Type)
+//	TypeAlias  Name, Type (the type it names, with an array's length)
+//	Interface  Name, Flags "private"; children: Method... (Name, Type, and
+//	           Parameter children)
+//	Module, Import  Name
+//
+// Statements:
+//
+//	Block      End (the }); children: the statements
+//	Assign     children: the target (Identifier, Field or Index), the value
+//	Destructure children: an Identifier for each name, then the value
+//	Call       Name (the function), Flags "method"; children: the receiver
+//	           of a method, then the arguments. Also an expression.
+//	For        Name (the label); children: init, condition, post, body Block
+//	Do         Name (the label); children: body Block, condition
+//	If         children: Branch... (condition, body Block), then an Else
+//	           Block if there is one
+//	Match      children: the value, Case... (values, then body Block), then
+//	           Default (body Block) if there is one
+//	Try        Name (the error's variable, if named); children: body Block,
+//	           Catch Block
+//	Break, Continue  Name (the label)
+//
+// Expressions:
+//
+//	String, Char, Integer, Float  Value (as a Go literal would hold it)
+//	Nil
+//	Identifier Name
+//	Tuple, Array  children: the elements
+//	Index      children: the array or string, the index
+//	Slice      children: the string, start, end
+//	StructLiteral Name; children: FieldValue... (Name; children: the value)
+//	Field      Name (the field); children: the struct
+//	Type       Type (with an array's length)
+//	Prefix, Infix  Name (the operator); children: the operands
+type Node struct {
+	Kind     string
+	Position Position
+	End      Position
+	Name     string
+	Type     string
+	Value    string
+	Flags    []string
+	Children []*Node
+}
+
+func fileOf(program *parser.Program) *File {
+	file := &File{Version: Version}
+	for _, pr := range program.Pragmas {
+		file.Pragmas = append(file.Pragmas, &Node{Kind: "Pragma", Position: positionOf(pr.Token), Name: pr.Name, Children: expressionNodes(pr.Arguments)})
+	}
+	for _, stmt := range program.Statements {
+		file.Declarations = append(file.Declarations, statementNode(stmt))
+	}
+	return file
+}
+
+// empty returns a node holding the place of a part left out of the source
+func empty() *Node {
+	return &Node{Kind: "Empty"}
+}
+
+func statementNode(stmt parser.Statement) *Node {
+	switch s := stmt.(type) {
+	case *parser.FunctionStatement:
+		n := &Node{Kind: "Function", Position: positionOf(s.Token), Name: s.Name, Type: s.ReturnType}
+		n.flag("entry", s.IsEntry)
+		n.flag("private", s.Private)
+		n.attributes(s.Attributes)
+		if s.Receiver != nil {
+			receiver := parameterNode(s.Receiver)
+			receiver.Kind = "Receiver"
+			n.Children = append(n.Children, receiver)
+		}
+		for _, name := range s.TypeParameters {
+			n.Children = append(n.Children, &Node{Kind: "TypeParameter", Name: name})
+		}
+		for _, param := range s.Parameters {
+			n.Children = append(n.Children, parameterNode(param))
+		}
+		if s.Body != nil {
+			n.End = positionOf(s.Body.End)
+			n.Children = append(n.Children, blockNode(s.Body))
+		}
+		return n
+	case *parser.VarStatement:
+		n := &Node{Kind: "Var", Position: positionOf(s.Token), Name: s.Name, Type: typeText(s.Type, s.Length)}
+		n.flag("private", s.Private)
+		n.attributes(s.Attributes)
+		if s.Value != nil {
+			n.Children = append(n.Children, expressionNode(s.Value))
+		}
+		return n
+	case *parser.ConstStatement:
+		n := &Node{Kind: "Const", Position: positionOf(s.Token), Name: s.Name, Children: []*Node{expressionNode(s.Value)}}
+		n.flag("private", s.Private)
+		return n
+	case *parser.StructStatement:
+		n := &Node{Kind: "Struct", Position: positionOf(s.Token), Name: s.Name}
+		n.flag("private", s.Private)
+		for _, f := range s.Fields {
+			n.Children = append(n.Children, &Node{Kind: "Field", Position: positionOf(f.Token), Name: f.Name, Type: typeText(f.Type, f.Length)})
+		}
+		return n
+	case *parser.TypeAliasStatement:
+		n := &Node{Kind: "TypeAlias", Position: positionOf(s.Token), Name: s.Name, Type: typeText(s.Type, s.Length)}
+		n.flag("private", s.Private)
+		return n
+	case *parser.InterfaceStatement:
+		n := &Node{Kind: "Interface", Position: positionOf(s.Token), Name: s.Name}
+		n.flag("private", s.Private)
+		for _, m := range s.Methods {
+			method := &Node{Kind: "Method", Position: positionOf(m.Token), Name: m.Name, Type: m.ReturnType}
+			for _, param := range m.Parameters {
+				method.Children = append(method.Children, parameterNode(param))
+			}
+			n.Children = append(n.Children, method)
+		}
+		return n
+	case *parser.ModuleStatement:
+		return &Node{Kind: "Module", Position: positionOf(s.Token), Name: s.Name}
+	case *parser.ImportStatement:
+		return &Node{Kind: "Import", Position: positionOf(s.Token), Name: s.Name}
+	case *parser.BlockStatement:
+		return blockNode(s)
+	case *parser.AssignStatement:
+		target := expressionNode(s.Target())
+		if s.Index != nil {
+			target = &Node{Kind: "Index", Position: target.Position, Children: []*Node{target, expressionNode(s.Index)}}
+		}
+		return &Node{Kind: "Assign", Position: positionOf(s.Token), Children: []*Node{target, expressionNode(s.Value)}}
+	case *parser.DestructureStatement:
+		n := &Node{Kind: "Destructure", Position: positionOf(s.Token)}
+		for _, name := range s.Names {
+			n.Children = append(n.Children, &Node{Kind: "Identifier", Name: name})
+		}
+		n.Children = append(n.Children, expressionNode(s.Value))
+		return n
+	case *parser.CallStatement:
+		return callNode(s.Token, s.Receiver, s.Function, s.Arguments)
+	case *parser.ForStatement:
+		n := &Node{Kind: "For", Name: s.Label}
+		n.Children = []*Node{optionalStatement(s.Init), optionalExpression(s.Condition), optionalStatement(s.Post), blockNode(s.Body)}
+		return n
+	case *parser.DoWhileStatement:
+		return &Node{Kind: "Do", Position: positionOf(s.Token), Name: s.Label, Children: []*Node{blockNode(s.Body), expressionNode(s.Condition)}}
+	case *parser.IfStatement:
+		n := &Node{Kind: "If"}
+		for i, b := range s.Branches {
+			if i == 0 {
+				n.Position = positionOf(b.Token)
+			}
+			n.Children = append(n.Children, &Node{Kind: "Branch", Position: positionOf(b.Token), Children: []*Node{expressionNode(b.Condition), blockNode(b.Body)}})
+		}
+		if s.Else != nil {
+			n.Children = append(n.Children, blockNode(s.Else))
+		}
+		return n
+	case *parser.MatchStatement:
+		n := &Node{Kind: "Match", Position: positionOf(s.Token), Children: []*Node{expressionNode(s.Value)}}
+		for _, c := range s.Cases {
+			arm := &Node{Kind: "Case"}
+			for _, v := range c.Values {
+				arm.Children = append(arm.Children, expressionNode(v))
+			}
+			arm.Children = append(arm.Children, blockNode(c.Body))
+			n.Children = append(n.Children, arm)
+		}
+		if s.Default != nil {
+			n.Children = append(n.Children, &Node{Kind: "Default", Children: []*Node{blockNode(s.Default)}})
+		}
+		return n
+	case *parser.TryStatement:
+		n := &Node{Kind: "Try", Position: positionOf(s.Token), Children: []*Node{blockNode(s.Body), blockNode(s.Catch)}}
+		if s.ErrorName != nil {
+			n.Name = s.ErrorName.Value
+		}
+		return n
+	case *parser.BranchStatement:
+		kind := "Break"
+		if s.Token.Type == lexer.CONTINUE {
+			kind = "Continue"
+		}
+		return &Node{Kind: kind, Position: positionOf(s.Token), Name: s.Label}
+	}
+	return &Node{Kind: "Unknown", Value: stmt.String()}
+}
+
+func expressionNode(expr parser.Expression) *Node {
+	switch e := expr.(type) {
+	case *parser.StringLiteral:
+		return &Node{Kind: "String", Value: e.Value}
+	case *parser.CharLiteral:
+		return &Node{Kind: "Char", Position: positionOf(e.Token), Value: string(e.Value)}
+	case *parser.IntegerLiteral:
+		return &Node{Kind: "Integer", Value: strconv.FormatInt(e.Value, 10)}
+	case *parser.FloatLiteral:
+		return &Node{Kind: "Float", Value: strconv.FormatFloat(e.Value, 'g', -1, 64)}
+	case *parser.NilLiteral:
+		return &Node{Kind: "Nil", Position: positionOf(e.Token)}
+	case *parser.Identifier:
+		return &Node{Kind: "Identifier", Position: positionOf(e.Token), Name: e.Value}
+	case *parser.CallExpression:
+		return callNode(e.Token, e.Receiver, e.Function, e.Arguments)
+	case *parser.TupleLiteral:
+		return &Node{Kind: "Tuple", Position: positionOf(e.Token), Children: expressionNodes(e.Elements)}
+	case *parser.ArrayLiteral:
+		return &Node{Kind: "Array", Position: positionOf(e.Token), Children: expressionNodes(e.Elements)}
+	case *parser.IndexExpression:
+		return &Node{Kind: "Index", Position: positionOf(e.Token), Children: []*Node{expressionNode(e.Array), expressionNode(e.Index)}}
+	case *parser.SliceExpression:
+		return &Node{Kind: "Slice", Position: positionOf(e.Token), Children: []*Node{expressionNode(e.Array), optionalExpression(e.Start), optionalExpression(e.End)}}
+	case *parser.StructLiteral:
+		n := &Node{Kind: "StructLiteral", Position: positionOf(e.Token), Name: e.Name}
+		for _, f := range e.Fields {
+			n.Children = append(n.Children, &Node{Kind: "FieldValue", Position: positionOf(f.Token), Name: f.Name, Children: []*Node{expressionNode(f.Value)}})
+		}
+		return n
+	case *parser.FieldExpression:
+		return &Node{Kind: "Field", Position: positionOf(e.Token), Name: e.Field, Children: []*Node{expressionNode(e.Struct)}}
+	case *parser.TypeExpression:
+		return &Node{Kind: "Type", Position: positionOf(e.Token), Type: typeText(e.Name, e.Length)}
+	case *parser.PrefixExpression:
+		return &Node{Kind: "Prefix", Position: positionOf(e.Token), Name: e.Operator, Children: []*Node{expressionNode(e.Right)}}
+	case *parser.InfixExpression:
+		return &Node{Kind: "Infix", Position: positionOf(e.Token), Name: e.Operator, Children: []*Node{expressionNode(e.Left), expressionNode(e.Right)}}
+	}
+	return &Node{Kind: "Unknown", Value: expr.String()}
+}
+
+func blockNode(block *parser.BlockStatement) *Node {
+	n := &Node{Kind: "Block", Position: positionOf(block.Token), End: positionOf(block.End)}
+	for _, stmt := range block.Statements {
+		n.Children = append(n.Children, statementNode(stmt))
+	}
+	return n
+}
+
+func callNode(tok lexer.Token, receiver parser.Expression, function string, args []parser.Expression) *Node {
+	n := &Node{Kind: "Call", Position: positionOf(tok), Name: function}
+	if receiver != nil {
+		n.Flags = []string{"method"}
+		n.Children = append(n.Children, expressionNode(receiver))
+	}
+	n.Children = append(n.Children, expressionNodes(args)...)
+	return n
+}
+
+func parameterNode(param *parser.Parameter) *Node {
+	n := &Node{Kind: "Parameter", Position: positionOf(param.Token), Name: param.Name, Type: param.Type}
+	n.flag("variadic", param.Variadic)
+	return n
+}
+
+func expressionNodes(exprs []parser.Expression) []*Node {
+	var nodes []*Node
+	for _, expr := range exprs {
+		nodes = append(nodes, expressionNode(expr))
+	}
+	return nodes
+}
+
+func optionalStatement(stmt parser.Statement) *Node {
+	if stmt == nil {
+		return empty()
+	}
+	return statementNode(stmt)
+}
+
+func optionalExpression(expr parser.Expression) *Node {
+	if expr == nil {
+		return empty()
+	}
+	return expressionNode(expr)
+}
+
+// typeText renders a type as written, with the length of an array type
+func typeText(typ string, length parser.Expression) string {
+	if length == nil {
+		return typ
+	}
+	return typ + "[" + length.String() + "]"
+}
+
+// flag adds flag to the node's flags when set
+func (n *Node) flag(flag string, set bool) {
+	if set {
+		n.Flags = append(n.Flags, flag)
+	}
+}
+
+// attributes adds the attributes of a declaration as children
+func (n *Node) attributes(attributes parser.Attributes) {
+	for _, a := range attributes {
+		n.Children = append(n.Children, &Node{Kind: "Attribute", Position: positionOf(a.Token), Name: a.Name, Children: expressionNodes(a.Arguments)})
+	}
+}
@@ -0,0 +1,112 @@
+// Package dread is the stable interface to the Dread compiler's front end,
+// for tools outside this module: it lexes, parses and checks source, and
+// describes the results with its own types rather than those of the
+// packages under internal/, which change with every refactoring.
+//
+// Compatibility: everything exported here belongs to the API version in
+// Version. Within a version, no exported name is removed or renamed, no
+// field or parameter changes type, no Node kind is renamed, and every kind
+// keeps the fields and children it is documented with in ast.go. New
+// functions, fields and kinds may be added. Any other change increments
+// Version. Diagnostic codes are those of the specification, and their
+// messages may change at any time.
+package dread
+
+import (
+	"dreadlang/internal/codegen"
+	"dreadlang/internal/lexer"
+	"dreadlang/internal/module"
+	"dreadlang/internal/parser"
+	"dreadlang/internal/semant"
+)
+
+// Version is the version of this package's types and functions
+const Version = 1
+
+// Position is a place in source, counted from 1 like diagnostics
+type Position struct {
+	File   string // empty for the source given, set for a module it imports
+	Line   int
+	Column int
+}
+
+// Token is one token of source
+type Token struct {
+	Kind     string // such as "IDENT", "INT", "STRING", "LPAREN" or "FUNCTION"
+	Text     string // the token as written; a string's is its decoded value
+	Position Position
+	End      int // the column just past its last character
+}
+
+// Diagnostic is an error, or a warning, found in source
+type Diagnostic struct {
+	Position Position
+	Code     string // such as "E001", or "W001" for a warning
+	Message  string
+	Fix      *Fix // set when the error has one obvious correction
+	Warning  bool // set when the program still compiles
+}
+
+// Fix is an edit that corrects a diagnostic: Old, which is empty for an
+// insertion, is replaced with New at the position
+type Fix struct {
+	Line   int
+	Column int
+	Old    string
+	New    string
+}
+
+// Lex returns the tokens of source, without its comments or the end of
+// the input
+func Lex(source string) []Token {
+	var tokens []Token
+	l := lexer.New(source)
+	for tok := l.NextToken(); tok.Type != lexer.EOF; tok = l.NextToken() {
+		tokens = append(tokens, Token{Kind: tok.Type.String(), Text: tok.Literal, Position: positionOf(tok), End: tok.End})
+	}
+	return tokens
+}
+
+// Parse parses source, without loading the modules it imports. With syntax
+// errors, the File holds the declarations that could still be parsed.
+func Parse(source string) (*File, []Diagnostic) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	return fileOf(program), diagnosticsOf(p.Diagnostics())
+}
+
+// Check reports the errors in source, read from file, and in the modules
+// it imports, which are looked for next to file. As when compiling, each
+// phase only runs once the ones before it find no errors, and a program
+// without any gets its warnings.
+func Check(file string, source string) []Diagnostic {
+	program, diagnostics := module.Load(file, source)
+	if len(diagnostics) > 0 {
+		return diagnosticsOf(diagnostics)
+	}
+	if diagnostics := semant.Check(program); len(diagnostics) > 0 {
+		return diagnosticsOf(diagnostics)
+	}
+	cg := codegen.New()
+	cg.Generate(program)
+	if len(cg.Diagnostics()) > 0 {
+		return diagnosticsOf(cg.Diagnostics())
+	}
+	return diagnosticsOf(semant.Warnings(program))
+}
+
+func positionOf(tok lexer.Token) Position {
+	return Position{File: tok.File, Line: tok.Line, Column: tok.Column}
+}
+
+func diagnosticsOf(diagnostics []parser.Diagnostic) []Diagnostic {
+	var out []Diagnostic
+	for _, d := range diagnostics {
+		diagnostic := Diagnostic{Position: Position{File: d.File, Line: d.Line, Column: d.Column}, Code: d.Code, Message: d.Message, Warning: d.Warning}
+		if d.Fix != nil {
+			diagnostic.Fix = &Fix{Line: d.Fix.Line, Column: d.Fix.Column, Old: d.Fix.Old, New: d.Fix.New}
+		}
+		out = append(out, diagnostic)
+	}
+	return out
+}
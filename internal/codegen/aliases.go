@@ -0,0 +1,78 @@
+package codegen
+
+import "dreadlang/internal/parser"
+
+// A type alias, Type UserId = Int, is another name for a type and not a new
+// type: the code generator replaces it with the type it names wherever a
+// type is written, so it costs nothing at run time and values convert
+// between the two freely. Like a struct, an alias may be used in the
+// declarations that follow it and in every function; function signatures
+// are resolved once every declaration is known. The type an alias names is
+// checked like that of a Var, with the length of an array folded, so an
+// alias never names itself.
+
+// defineAlias checks the type an alias names and records it
+func (cg *CodeGenerator) defineAlias(stmt *parser.TypeAliasStatement) {
+	_, isStruct := cg.structs[stmt.Name]
+	_, isAlias := cg.aliases[stmt.Name]
+	if isStruct || isAlias || cg.interfaces[stmt.Name] != nil || isScalar(stmt.Name) {
+		cg.errorAt(stmt.Token, ErrAlreadyDeclared, "type %s is already defined", stmt.Name)
+		return
+	}
+	typ, ok := cg.resolveTypeName(stmt.Token, stmt.Name, stmt.Type, stmt.Length)
+	if !ok {
+		return
+	}
+	cg.aliases[stmt.Name] = typ
+}
+
+// aliased replaces the aliases named in typ, which may be part of a slice,
+// optional, result or tuple type, with the types they name
+func (cg *CodeGenerator) aliased(typ string) string {
+	return substituteType(typ, cg.aliases)
+}
+
+// resolveSignatures replaces the aliases in the receivers, parameters and
+// results of the program's functions. A method declared on an alias is
+// one of the struct it names.
+func (cg *CodeGenerator) resolveSignatures(program *parser.Program) {
+	if len(cg.aliases) == 0 {
+		return
+	}
+	for _, stmt := range program.Statements {
+		fn, ok := stmt.(*parser.FunctionStatement)
+		if !ok {
+			continue
+		}
+		aliases := cg.aliases
+		if isGeneric(fn) {
+			// A type parameter hides an alias of the same name
+			aliases = make(map[string]string)
+			for name, typ := range cg.aliases {
+				aliases[name] = typ
+			}
+			for _, name := range fn.TypeParameters {
+				delete(aliases, name)
+			}
+		}
+		for _, param := range fn.Parameters {
+			param.Type = substituteType(param.Type, aliases)
+		}
+		fn.ReturnType = substituteType(fn.ReturnType, aliases)
+
+		if fn.Receiver == nil {
+			continue
+		}
+		symbol := fn.Symbol()
+		fn.Receiver.Type = cg.aliased(fn.Receiver.Type)
+		if fn.Symbol() == symbol || cg.functions[symbol] != fn {
+			continue
+		}
+		delete(cg.functions, symbol)
+		if _, exists := cg.functions[fn.Symbol()]; exists {
+			cg.errorAt(fn.NameToken, ErrAlreadyDeclared, "function %s is already defined", fn.Symbol())
+			continue
+		}
+		cg.functions[fn.Symbol()] = fn
+	}
+}
@@ -0,0 +1,320 @@
+package codegen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"dreadlang/internal/lexer"
+	"dreadlang/internal/parser"
+)
+
+// Arrays have a fixed length that is part of their type, as in Int[3]. The
+// elements are 8-byte slots in consecutive memory, element 0 lowest, so
+// element i lives at base + i*8 for both stack and global arrays. Elements
+// are Int, Float, Char or String; arrays of structs are not supported yet.
+
+// arrayType splits an array type such as "Int[3]" into its element type and
+// length; ok is false for scalars
+func arrayType(typ string) (element string, length int64, ok bool) {
+	open := strings.IndexByte(typ, '[')
+	if open < 0 || !strings.HasSuffix(typ, "]") {
+		return "", 0, false
+	}
+	length, err := strconv.ParseInt(typ[open+1:len(typ)-1], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return typ[:open], length, true
+}
+
+// foldLength folds the length expression of an array type; ok is false
+// unless it is a constant Int
+func (cg *CodeGenerator) foldLength(length parser.Expression) (int64, bool) {
+	value, typ, ok := cg.evaluateConstant(length)
+	return value.Int, ok && typ == "Int"
+}
+
+// resolveType returns the type declared by a Var
+func (cg *CodeGenerator) resolveType(stmt *parser.VarStatement) (string, bool) {
+	return cg.resolveTypeName(stmt.Token, stmt.Name, stmt.Type, stmt.Length)
+}
+
+// resolveTypeName checks the type written for the variable or field name,
+// folding the length of an array type, which must be a positive constant
+func (cg *CodeGenerator) resolveTypeName(tok lexer.Token, name string, typ string, length parser.Expression) (string, bool) {
+	cg.checkTypeVisible(tok, typ)
+	typ = cg.aliased(substituteType(typ, cg.typeArguments))
+	if _, ok := tupleType(typ); ok {
+		return cg.resolveTupleType(tok, name, typ)
+	}
+	if isSlice(typ) {
+		return cg.resolveSliceType(tok, typ)
+	}
+	if base, ok := resultBase(typ); ok {
+		if !isScalar(base) {
+			cg.errorAt(tok, ErrUndefinedType, "result types must be Int, Float, Char or String, got %s", typ)
+			return "", false
+		}
+		if length != nil {
+			cg.errorAt(tok, ErrTypeMismatch, "array elements must be Int, Float, Char or String, got %s", typ)
+			return "", false
+		}
+		return typ, true
+	}
+	if base, ok := optionalBase(typ); ok {
+		if !isScalar(base) {
+			cg.errorAt(tok, ErrUndefinedType, "optional types must be Int, Float, Char or String, got %s", typ)
+			return "", false
+		}
+		if length != nil {
+			cg.errorAt(tok, ErrTypeMismatch, "array elements must be Int, Float, Char or String, got %s", typ)
+			return "", false
+		}
+		return typ, true
+	}
+	if isArray(typ) {
+		// Only an alias of an array type names one without a length
+		if length != nil {
+			cg.errorAt(tok, ErrTypeMismatch, "array elements must be Int, Float, Char or String, got %s", typ)
+			return "", false
+		}
+		return typ, true
+	}
+	_, isStruct := cg.structs[typ]
+	if _, isInterface := cg.interfaces[typ]; isInterface && length != nil {
+		cg.errorAt(tok, ErrTypeMismatch, "array elements must be Int, Float, Char or String, got %s", typ)
+		return "", false
+	} else if isInterface {
+		return typ, true
+	}
+	if !isScalar(typ) && !isStruct {
+		cg.undefinedName(tok, ErrUndefinedType, "type", typ, cg.typeNames())
+		return "", false
+	}
+	if length == nil {
+		return typ, true
+	}
+	if isStruct {
+		cg.errorAt(tok, ErrTypeMismatch, "array elements must be Int, Float, Char or String, got %s", typ)
+		return "", false
+	}
+	n, ok := cg.foldLength(length)
+	if !ok {
+		cg.errorAt(tok, ErrNotConstant, "array length of %s must be known at compile time", name)
+		return "", false
+	}
+	if n < 1 {
+		cg.errorAt(tok, ErrArrayLength, "array length of %s must be positive, got %d", name, n)
+		return "", false
+	}
+	return fmt.Sprintf("%s[%d]", typ, n), true
+}
+
+// isScalar reports whether values of type typ fit in one slot
+func isScalar(typ string) bool {
+	return isInteger(typ) || typ == "Float" || typ == "Char" || typ == "String"
+}
+
+// isArray reports whether typ is an array type
+func isArray(typ string) bool {
+	_, _, ok := arrayType(typ)
+	return ok
+}
+
+// slots returns how many 8-byte slots a value of type typ occupies
+func (cg *CodeGenerator) slots(typ string) int {
+	if s, ok := cg.structs[typ]; ok {
+		return int(s.Size / 8)
+	}
+	if _, length, ok := arrayType(typ); ok {
+		return int(length)
+	}
+	if elements, ok := tupleType(typ); ok {
+		n := 0
+		for _, element := range elements {
+			n += cg.slots(element)
+		}
+		return n
+	}
+	return 1
+}
+
+// generateValue evaluates the value of an assignment or Var and returns its
+// type. Scalars leave their value in rax, and arrays and structs their
+// address, except array and struct literals, which leave their slots on the
+// stack with the last on top. The elements of an array literal are
+// converted to those of want, the type being assigned to, if known.
+func (cg *CodeGenerator) generateValue(expr parser.Expression, want string) (typ string, literal bool) {
+	switch e := expr.(type) {
+	case *parser.ArrayLiteral:
+		return cg.generateArrayLiteral(e, want), true
+	case *parser.StructLiteral:
+		typ := cg.generateStructLiteral(e)
+		if it, ok := cg.interfaces[want]; ok && cg.structs[typ] != nil && cg.implements(typ, it) {
+			cg.toInterface(typ, it, true)
+			return want, false
+		}
+		return typ, true
+	case *parser.TupleLiteral:
+		return cg.generateTupleLiteral(e, want), true
+	}
+	return cg.generateExpression(expr), false
+}
+
+// storeValue stores what generateValue left behind at p. Arrays and structs
+// are copied slot by slot, so assigning one to another never aliases them.
+func (cg *CodeGenerator) storeValue(name string, p place, literal bool) {
+	slots := cg.flatten(name, p.typ)
+	switch {
+	case !cg.isAggregate(p.typ):
+		cg.output.WriteString(fmt.Sprintf("    mov [%s], rax    # store %s\n", p.slot(0), name))
+	case literal:
+		// Every slot is evaluated before any is stored, so the literal
+		// may read the value it replaces
+		for i := len(slots) - 1; i >= 0; i-- {
+			cg.output.WriteString("    pop rax\n")
+			cg.output.WriteString(fmt.Sprintf("    mov [%s], rax    # store %s\n", p.slot(int64(i)), slots[i].name))
+		}
+	default:
+		for i, s := range slots {
+			cg.output.WriteString(fmt.Sprintf("    mov rcx, [rax + %d]\n", 8*i))
+			cg.output.WriteString(fmt.Sprintf("    mov [%s], rcx    # store %s\n", p.slot(int64(i)), s.name))
+		}
+	}
+}
+
+// storeZero stores the zero value, 0 or the empty string, into every slot of p
+func (cg *CodeGenerator) storeZero(name string, p place) {
+	var loaded string
+	for i, s := range cg.flatten(name, p.typ) {
+		if s.typ != loaded {
+			if s.typ == "String" {
+				cg.output.WriteString(fmt.Sprintf("    lea rax, [%s]    # zero value ''\n", cg.getStringLabel("")))
+			} else {
+				cg.output.WriteString("    xor eax, eax     # zero value 0\n")
+			}
+			loaded = s.typ
+		}
+		cg.output.WriteString(fmt.Sprintf("    mov [%s], rax    # store %s\n", p.slot(int64(i)), s.name))
+	}
+}
+
+// generateArrayLiteral pushes the elements of an array literal in order,
+// converted to the element type of want where that is implicit, and returns
+// the array's type, which is taken from the elements
+func (cg *CodeGenerator) generateArrayLiteral(array *parser.ArrayLiteral, want string) string {
+	if len(array.Elements) == 0 {
+		cg.errorAt(array.Token, ErrArrayLiteral, "array literal must have at least one element")
+		return "Int"
+	}
+
+	var element string
+	wantElement, _, _ := arrayType(want)
+	for i, e := range array.Elements {
+		typ := cg.convert(cg.generateExpression(e), wantElement)
+		cg.output.WriteString(fmt.Sprintf("    push rax         # element %d\n", i))
+		switch {
+		case !isScalar(typ):
+			cg.errorAt(array.Token, ErrTypeMismatch, "array elements must be Int, Float, Char or String, got %s", typ)
+		case element == "":
+			element = typ
+		case typ != element:
+			cg.errorAt(array.Token, ErrTypeMismatch, "array elements must all have the same type, got %s and %s", element, typ)
+		}
+	}
+	if element == "" {
+		element = "Int"
+	}
+	return fmt.Sprintf("%s[%d]", element, len(array.Elements))
+}
+
+// checkArray reports indexing something at p that is not an array
+func (cg *CodeGenerator) checkArray(array parser.Expression, p place) bool {
+	if !isArray(p.typ) {
+		cg.errorAt(placeToken(array), ErrTypeMismatch, "cannot index %s variable %s", p.typ, comment(array))
+		return false
+	}
+	return true
+}
+
+// generateElementOperand returns the memory operand of element index of the
+// array at p. A constant index is checked here; any other is computed into
+// rcx and checked when the program runs. The check is unsigned, so it
+// catches negative indices too.
+func (cg *CodeGenerator) generateElementOperand(tok lexer.Token, p place, index parser.Expression) string {
+	_, length, _ := arrayType(p.typ)
+	if value, typ, ok := cg.evaluateConstant(index); ok && typ == "Int" {
+		if value.Int < 0 || value.Int >= length {
+			cg.errorAt(tok, ErrIndexOutOfRange, "index %d out of range for %s", value.Int, p.typ)
+			return p.slot(0)
+		}
+		return p.slot(value.Int)
+	}
+
+	if typ := cg.generateExpression(index); !isInteger(typ) {
+		cg.errorAt(tok, ErrTypeMismatch, "array index must be Int, got %s", typ)
+	}
+	cg.output.WriteString("    mov rcx, rax\n")
+	cg.output.WriteString(fmt.Sprintf("    cmp rcx, %d\n", length))
+	cg.requireRuntime("index_out_of_range")
+	cg.output.WriteString("    jae index_out_of_range\n")
+	return p.indexed("rcx")
+}
+
+// generateIndexExpression loads one element of an array, or one byte of a string
+func (cg *CodeGenerator) generateIndexExpression(expr *parser.IndexExpression) string {
+	p, ok := cg.resolvePlace(expr.Array)
+	if !ok {
+		return "Int"
+	}
+	if p.typ == "String" {
+		return cg.generateStringIndex(expr)
+	}
+	if isSlice(p.typ) {
+		return cg.generateSliceIndex(expr, p.typ)
+	}
+	if !cg.checkArray(expr.Array, p) {
+		return "Int"
+	}
+	element, _, _ := arrayType(p.typ)
+	operand := cg.generateElementOperand(expr.Token, p, expr.Index)
+	cg.output.WriteString(fmt.Sprintf("    mov rax, [%s]    # load %s\n", operand, comment(expr)))
+	return element
+}
+
+// generateElementAssign stores a value into one element: name[index] = value
+func (cg *CodeGenerator) generateElementAssign(stmt *parser.AssignStatement) {
+	cg.output.WriteString(fmt.Sprintf("    # %s\n", comment(stmt)))
+	typ := cg.generateExpression(stmt.Value)
+	if v, exists := cg.lookupVariable(stmt.Name); exists && v.Constant != nil {
+		cg.errorAt(stmt.Token, ErrAssignConstant, "cannot assign to constant %s", stmt.Name)
+		return
+	}
+	target := stmt.Target()
+	p, ok := cg.resolvePlace(target)
+	if !ok {
+		return
+	}
+	if p.typ == "String" {
+		cg.errorAt(placeToken(target), ErrTypeMismatch, "cannot assign to a byte of String %s; strings are immutable", comment(target))
+		return
+	}
+	if isSlice(p.typ) {
+		cg.generateSliceElementAssign(stmt, typ, p.typ)
+		return
+	}
+	if !cg.checkArray(target, p) {
+		return
+	}
+	element, _, _ := arrayType(p.typ)
+	if typ = cg.convert(typ, element); typ != element {
+		// The type pass has reported it
+		return
+	}
+
+	cg.output.WriteString("    push rax\n")
+	operand := cg.generateElementOperand(stmt.Token, p, stmt.Index)
+	cg.output.WriteString("    pop rax\n")
+	cg.output.WriteString(fmt.Sprintf("    mov [%s], rax    # store %s[%s]\n", operand, comment(target), comment(stmt.Index)))
+}
@@ -0,0 +1,108 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+
+	"dreadlang/internal/parser"
+)
+
+// A benchmark build times every function whose name starts with Bench (see
+// isBenchmark). In
+// place of the Entry function, the program starts at a harness that calls
+// each one a fixed number of times between two readings of the monotonic
+// clock, and prints a line for it:
+//
+//	dreadc-bench: BenchName <elapsed nanoseconds>
+//
+// The line starts and ends with a newline of its own, so text printed by
+// the benchmarks does not run into it.
+
+// BenchmarkPrefix starts the line that reports each benchmark
+const BenchmarkPrefix = "dreadc-bench: "
+
+// SetBenchmarks makes Generate build a benchmark harness that runs every
+// Bench function iterations times
+func (cg *CodeGenerator) SetBenchmarks(iterations int) {
+	cg.benchmarkIterations = iterations
+}
+
+// Benchmarks returns the names of the Bench functions, in the order they
+// are run, once Generate has found them
+func (cg *CodeGenerator) Benchmarks() []string {
+	return cg.benchmarks
+}
+
+// isBenchmark reports whether the function is one a benchmark build times:
+// Bench or Benchmark, alone or followed by a name that does not start in
+// lower case, so BenchConcat is timed but Benches is not
+func isBenchmark(fn *parser.FunctionStatement) bool {
+	if fn.IsEntry || fn.Receiver != nil || isGeneric(fn) {
+		return false
+	}
+	for _, prefix := range []string{"Benchmark", "Bench"} {
+		if rest, ok := strings.CutPrefix(fn.Name, prefix); ok && (rest == "" || !isLower(rest[0])) {
+			return true
+		}
+	}
+	return false
+}
+
+func isLower(c byte) bool {
+	return 'a' <= c && c <= 'z'
+}
+
+// generateBenchmarkHarness emits the entry point of a benchmark build. The
+// loop counter and both timespecs live in its frame, since the benchmarks
+// may use every register.
+func (cg *CodeGenerator) generateBenchmarkHarness(program *parser.Program) {
+	cg.output.WriteString(fmt.Sprintf("%s:\n", cg.target.entrySymbol))
+	cg.output.WriteString("    # Benchmark harness\n")
+	cg.output.WriteString("    push rbp\n")
+	cg.output.WriteString("    mov rbp, rsp\n")
+	cg.output.WriteString("    sub rsp, 48      # counter, start and end times\n")
+	for _, stmt := range program.Statements {
+		fn, ok := stmt.(*parser.FunctionStatement)
+		if !ok || !isBenchmark(fn) {
+			continue
+		}
+		if len(fn.Parameters) > 0 || fn.ReturnType != "" && fn.ReturnType != "Void" {
+			cg.errorAt(fn.Token, ErrTypeMismatch, "benchmark %s must take no parameters and return nothing", fn.Name)
+			continue
+		}
+		cg.benchmarks = append(cg.benchmarks, fn.Name)
+		loop := cg.newLabel("bench_loop")
+
+		cg.output.WriteString(fmt.Sprintf("    # %s\n", fn.Name))
+		cg.readMonotonicClock("rbp - 32")
+		cg.output.WriteString(fmt.Sprintf("    mov qword ptr [rbp - 8], %d\n", cg.benchmarkIterations))
+		cg.output.WriteString(fmt.Sprintf("%s:\n", loop))
+		cg.output.WriteString(fmt.Sprintf("    call %s\n", fn.Symbol()))
+		cg.output.WriteString("    dec qword ptr [rbp - 8]\n")
+		cg.output.WriteString(fmt.Sprintf("    jnz %s\n", loop))
+		cg.readMonotonicClock("rbp - 48")
+
+		label := cg.getStringLabel("\n" + BenchmarkPrefix + fn.Name + " ")
+		cg.output.WriteString(fmt.Sprintf("    lea rdi, [%s]\n", label))
+		cg.output.WriteString("    call print_string\n")
+		cg.output.WriteString("    mov rax, [rbp - 48]  # elapsed seconds\n")
+		cg.output.WriteString("    sub rax, [rbp - 32]\n")
+		cg.output.WriteString("    imul rax, rax, 1000000000\n")
+		cg.output.WriteString("    add rax, [rbp - 40]  # and nanoseconds\n")
+		cg.output.WriteString("    sub rax, [rbp - 24]\n")
+		cg.output.WriteString("    mov rdi, rax\n")
+		cg.output.WriteString("    call print_int\n")
+		cg.output.WriteString(fmt.Sprintf("    lea rdi, [%s]\n", cg.getStringLabel("\n")))
+		cg.output.WriteString("    call print_string\n")
+	}
+	cg.output.WriteString("    mov rdi, 0       # exit status\n")
+	cg.syscall("exit")
+}
+
+// readMonotonicClock stores the time of the monotonic clock in the timespec
+// {seconds, nanoseconds} at the memory operand timespec
+func (cg *CodeGenerator) readMonotonicClock(timespec string) {
+	cg.output.WriteString(fmt.Sprintf("    mov %s, %d        # monotonic clock\n", cg.target.argumentRegister(0), cg.target.monotonicClock))
+	cg.output.WriteString(fmt.Sprintf("    lea %s, [%s]\n", cg.target.argumentRegister(1), timespec))
+	cg.syscall("clock_gettime")
+}
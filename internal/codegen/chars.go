@@ -0,0 +1,156 @@
+package codegen
+
+import (
+	"fmt"
+
+	"dreadlang/internal/parser"
+)
+
+// Chars are single bytes, written 'a'. They are held by value like an Int
+// but are a type of their own: they only compare with other Chars, Ord and
+// Chr convert between them and Int, and a Char becomes a one-character
+// String wherever a String is expected.
+
+// convert turns the value of type typ in rax into one of type want, when the
+// language does so implicitly, and returns the type of the result
+func (cg *CodeGenerator) convert(typ string, want string) string {
+	switch {
+	case typ == "Char" && want == "String":
+		cg.requireRuntime("char_to_string")
+		cg.output.WriteString("    mov rdi, rax\n")
+		cg.output.WriteString("    call char_to_string\n")
+		return "String"
+	case typ != want && isInteger(typ) && isInteger(want):
+		cg.wrapInteger(want)
+		return want
+	case typ == nilType && isOptional(want):
+		return want
+	case typ == errorType && isResult(want):
+		return want
+	}
+	if it, ok := cg.interfaces[want]; ok && cg.structs[typ] != nil && cg.implements(typ, it) {
+		cg.toInterface(typ, it, false)
+		return want
+	}
+	if base, ok := optionalBase(want); ok && typ != want && cg.convert(typ, base) == base {
+		cg.box()
+		return want
+	}
+	if base, ok := resultBase(want); ok && typ != want && base != "Void" && cg.convert(typ, base) == base {
+		cg.output.WriteString("    mov rsi, rax     # the value\n")
+		cg.output.WriteString("    xor edi, edi     # no error\n")
+		cg.makeResult()
+		return want
+	}
+	return typ
+}
+
+// convertOperands converts the operands of an infix operator, the left in
+// rax and the right in rcx, to want and returns their new types
+func (cg *CodeGenerator) convertOperands(leftType string, rightType string, want string) (string, string) {
+	if leftType == "Char" {
+		cg.output.WriteString("    push rcx\n")
+		leftType = cg.convert(leftType, want)
+		cg.output.WriteString("    pop rcx\n")
+	}
+	if rightType == "Char" {
+		cg.output.WriteString("    push rax\n")
+		cg.output.WriteString("    mov rax, rcx\n")
+		rightType = cg.convert(rightType, want)
+		cg.output.WriteString("    mov rcx, rax\n")
+		cg.output.WriteString("    pop rax\n")
+	}
+	return leftType, rightType
+}
+
+// charText returns b as it is written in a .asciz directive
+func charText(b byte) string {
+	switch {
+	case b == '"' || b == '\\':
+		return `\` + string(b)
+	case b == '\n':
+		return `\n`
+	case b == '\t':
+		return `\t`
+	case b < ' ' || b > '~':
+		return fmt.Sprintf(`\%03o`, b)
+	default:
+		return string(b)
+	}
+}
+
+// generateOrd emits Ord(c), the Int code of a Char
+func (cg *CodeGenerator) generateOrd(expr *parser.CallExpression) {
+	if len(expr.Arguments) != 1 {
+		cg.errorAt(expr.Token, ErrBuiltinArguments, "Ord expects one Char")
+		return
+	}
+	if typ := cg.generateExpression(expr.Arguments[0]); typ != "Char" {
+		cg.errorAt(expr.Token, ErrTypeMismatch, "Ord expects a Char, got %s", typ)
+	}
+}
+
+// generateChr emits Chr(n), the Char whose code is the low byte of an Int
+func (cg *CodeGenerator) generateChr(expr *parser.CallExpression) {
+	if len(expr.Arguments) != 1 {
+		cg.errorAt(expr.Token, ErrBuiltinArguments, "Chr expects one Int")
+		return
+	}
+	if typ := cg.generateExpression(expr.Arguments[0]); !isInteger(typ) {
+		cg.errorAt(expr.Token, ErrTypeMismatch, "Chr expects an Int, got %s", typ)
+	}
+	cg.output.WriteString("    movzx eax, al    # keep the low byte\n")
+}
+
+// evaluateCharConversion folds Ord(c) or Chr(n) of a constant; ok is false
+// when the call is not one of them
+func (cg *CodeGenerator) evaluateCharConversion(expr *parser.CallExpression) (constant, string, bool) {
+	if expr.Function != "Ord" && expr.Function != "Chr" || expr.Receiver != nil || len(expr.Arguments) != 1 {
+		return constant{}, "", false
+	}
+	value, typ, ok := cg.evaluateConstant(expr.Arguments[0])
+	switch {
+	case !ok:
+		return constant{}, "", false
+	case expr.Function == "Ord" && typ == "Char":
+		return constant{Int: value.Int}, "Int", true
+	case expr.Function == "Chr" && isInteger(typ):
+		return constant{Int: int64(byte(value.Int))}, "Char", true
+	default:
+		return constant{}, "", false
+	}
+}
+
+func (cg *CodeGenerator) generatePrintCharFunction() {
+	cg.output.WriteString("# print_char function - writes one byte to stdout\n")
+	cg.output.WriteString("# Input: rdi = the byte, in the low 8 bits\n")
+	cg.output.WriteString("print_char:\n")
+	cg.output.WriteString("    push rbp\n")
+	cg.output.WriteString("    mov rbp, rsp\n")
+	cg.output.WriteString("    push rdi         # the byte to write is now at [rsp]\n")
+	cg.output.WriteString("    mov rsi, rsp\n")
+	cg.output.WriteString("    mov rdx, 1       # length\n")
+	cg.output.WriteString("    mov rdi, 1       # stdout\n")
+	cg.syscall("write")
+	cg.output.WriteString("    mov rsp, rbp\n")
+	cg.output.WriteString("    pop rbp\n")
+	cg.output.WriteString("    ret\n\n")
+}
+
+func (cg *CodeGenerator) generateCharToStringFunction() {
+	cg.output.WriteString("# char_to_string function - makes a one-character string\n")
+	cg.output.WriteString("# Input: rdi = the byte, in the low 8 bits\n")
+	cg.output.WriteString("# Output: rax = address of the newly allocated result\n")
+	cg.output.WriteString("char_to_string:\n")
+	cg.output.WriteString("    push rbp\n")
+	cg.output.WriteString("    mov rbp, rsp\n")
+	cg.output.WriteString("    push rdi\n")
+	cg.output.WriteString("    mov rdi, 2       # the byte and the terminator\n")
+	cg.output.WriteString("    call alloc\n")
+	cg.output.WriteString("    pop rdi\n")
+	cg.output.WriteString("    mov [rax], dil\n")
+	cg.output.WriteString("    mov byte ptr [rax + 1], 0\n")
+	cg.output.WriteString("    mov rsp, rbp\n")
+	cg.output.WriteString("    pop rbp\n")
+	cg.output.WriteString("    ret\n\n")
+}
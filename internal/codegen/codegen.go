@@ -1,82 +1,268 @@
 package codegen
 
 import (
+	"dreadlang/internal/ir"
+	"dreadlang/internal/lexer"
 	"dreadlang/internal/parser"
 	"fmt"
-	"strconv"
+	"math"
 	"strings"
 )
 
 type CodeGenerator struct {
-	output          strings.Builder
+	output          *strings.Builder
 	stringConstants map[string]string
+	stringLabels    []string // literals in label order, for a stable data section
 	stringCounter   int
+
+	functions    map[string]*parser.FunctionStatement
+	generics     map[string]*parser.FunctionStatement // functions with type parameters, by name
+	globals      map[string]*variable                 // file-scope Const and Var declarations
+	structs      map[string]*structType               // file-scope Struct declarations
+	interfaces   map[string]*interfaceType            // file-scope Interface declarations
+	aliases      map[string]string                    // file-scope Type declarations, to the type each names
+	vtables      map[string]bool                      // labels of the vtables defined in globalData
+	private      map[lexer.Token]bool                 // the names of the declarations written after Private
+	privateTypes map[string]lexer.Token               // the private structs, interfaces and aliases, to their names
+	strict       map[string]bool                      // the files with #pragma strict
+	globalData   []string                             // definitions of initialized globals and those with a @section
+	globalBSS    []string                             // definitions of zeroed globals
+	current      *functionContext
+	labelCounter int
+	runtimeUsed  []string // optional runtime helpers, in order of first use
+	target       *Target
+	optimization int             // level set with SetOptimization
+	passes       *ir.PassManager // set with SetPasses, or those of the level
+
+	benchmarkIterations int      // set with SetBenchmarks
+	benchmarks          []string // the Bench functions the harness times
+
+	references []Reference // what each name generated so far refers to
+	lowered    ir.Program  // the functions generated so far that lowered expressions to the IR
+
+	instances     []instance        // instances of generic functions still to generate
+	typeArguments map[string]string // those of the instance being generated
+	instantiating *instance         // the instance being generated, whose errors say so
+
+	evaluating *evaluation // set while a call is evaluated at compile time
+	poisoned   bool        // the statement being generated uses a variable of poisonType
+
+	types          map[parser.Expression]string                     // the type of each expression of the function being generated
+	instanceOf     map[*parser.CallExpression]string                // the instance each of its calls of a generic function needs
+	statementCalls map[*parser.CallStatement]*parser.CallExpression // the calls call statements make, by callOf
+
+	diagnostics []parser.Diagnostic
+}
+
+// Diagnostic codes reported by the code generator; parser codes are below E100
+const (
+	ErrTypeMismatch      = "E101"
+	ErrAssignMismatch    = "E102"
+	ErrAlreadyDeclared   = "E103"
+	ErrUndefinedVariable = "E104"
+	ErrAssignConstant    = "E105"
+	ErrNotConstant       = "E106"
+	ErrAttribute         = "E107"
+	ErrBuiltinArguments  = "E108"
+	ErrNoLoop            = "E109"
+	ErrArrayLiteral      = "E110"
+	ErrIndexOutOfRange   = "E111"
+	ErrArrayLength       = "E112"
+	ErrUndefinedType     = "E113"
+	ErrUnknownField      = "E114"
+	ErrUncheckedOptional = "E115"
+	ErrDivisionByZero    = "E116"
+	ErrPrivate           = "E118"
+	ErrWrongTarget       = "E119"
+	ErrInternal          = "E120"
+)
+
+// functionContext holds the state of the function being generated
+type functionContext struct {
+	name       string // as a panic reports it
+	isEntry    bool
+	returnType string
+	naked      bool                                 // @naked: no stack frame
+	leaf       bool                                 // calls nothing and needs no stack slots, so it gets no frame
+	interrupt  bool                                 // @interrupt: preserves every register and returns with iretq
+	scopes     []map[string]*variable               // innermost block last
+	loops      []loop                               // enclosing loops, innermost last
+	catches    []string                             // labels of the Catch blocks of enclosing Try blocks, innermost last
+	results    map[*parser.CallExpression]*variable // calls whose results are used in place
+	lowered    []*ir.Block                          // the expressions lowered to the IR
+	frameSize  int
+}
+
+// loop records where Break and Continue jump to inside a loop
+type loop struct {
+	name          string // the loop's label, if it has one
+	breakLabel    string
+	continueLabel string
 }
 
 func New() *CodeGenerator {
+	return NewForTarget(LinuxAMD64)
+}
+
+// NewForTarget creates a code generator whose programs use the syscalls of target
+func NewForTarget(target *Target) *CodeGenerator {
 	cg := &CodeGenerator{
+		output:          &strings.Builder{},
 		stringConstants: make(map[string]string),
 		stringCounter:   0,
+		functions:       make(map[string]*parser.FunctionStatement),
+		generics:        make(map[string]*parser.FunctionStatement),
+		globals:         make(map[string]*variable),
+		structs:         make(map[string]*structType),
+		interfaces:      make(map[string]*interfaceType),
+		aliases:         make(map[string]string),
+		vtables:         make(map[string]bool),
+		private:         make(map[lexer.Token]bool),
+		privateTypes:    make(map[string]lexer.Token),
+		strict:          make(map[string]bool),
+		statementCalls:  make(map[*parser.CallStatement]*parser.CallExpression),
+		target:          target,
 	}
 
-	// Pre-generate common integer strings that might be needed for arithmetic
-	for i := 0; i <= 10; i++ {
-		cg.getStringLabel(fmt.Sprintf("%d", i))
+	return cg
+}
+
+// Errors returns the diagnostics rendered as "line:column: code: message"
+func (cg *CodeGenerator) Errors() []string {
+	errors := make([]string, len(cg.diagnostics))
+	for i, d := range cg.diagnostics {
+		errors[i] = d.String()
 	}
+	return errors
+}
 
-	return cg
+func (cg *CodeGenerator) Diagnostics() []parser.Diagnostic {
+	return cg.diagnostics
+}
+
+// errorAt records a diagnostic at the position of tok
+func (cg *CodeGenerator) errorAt(tok lexer.Token, code string, format string, args ...interface{}) {
+	if cg.poisoned && isTypeError(code) {
+		return
+	}
+	message := fmt.Sprintf(format, args...)
+	if cg.instantiating != nil {
+		message += cg.instantiating.note()
+	}
+	cg.diagnostics = append(cg.diagnostics, parser.Diagnostic{
+		File:    tok.File,
+		Line:    tok.Line,
+		Column:  tok.Column,
+		Code:    code,
+		Message: message,
+	})
 }
 
 func (cg *CodeGenerator) Generate(program *parser.Program) string {
 	cg.output.Reset()
+	cg.collectPrivate(program)
+	cg.collectPragmas(program)
+
+	for _, stmt := range program.Statements {
+		if funcStmt, ok := stmt.(*parser.FunctionStatement); ok {
+			if _, exists := cg.functions[funcStmt.Symbol()]; exists || cg.generics[funcStmt.Name] != nil {
+				cg.errorAt(funcStmt.NameToken, ErrAlreadyDeclared, "function %s is already defined", funcStmt.Symbol())
+				continue
+			}
+			if isGeneric(funcStmt) {
+				cg.generics[funcStmt.Name] = funcStmt
+				continue
+			}
+			cg.functions[funcStmt.Symbol()] = funcStmt
+		}
+	}
+
+	// File-scope constants, variables, structs and aliases are visible in
+	// every function, and in the declarations that follow them
+	for _, stmt := range program.Statements {
+		switch s := stmt.(type) {
+		case *parser.TypeAliasStatement:
+			cg.defineAlias(s)
+		case *parser.StructStatement:
+			cg.defineStruct(s)
+		case *parser.InterfaceStatement:
+			cg.defineInterface(s)
+		case *parser.ConstStatement:
+			cg.defineConstant(s, cg.globals)
+		case *parser.VarStatement:
+			cg.defineGlobal(s)
+		case *parser.FunctionStatement:
+			s.Attributes = cg.foldAttributes(s.Attributes)
+		}
+	}
+	cg.checkSignatures(program)
+	cg.resolveSignatures(program)
+
+	// Generate code first so every string constant it needs is known
+	text := cg.captureOutput(func() {
+		cg.writeTextSection(program)
+	})
 
 	// Generate assembly header
 	cg.writeHeader()
 
 	// Generate string constants
-	cg.writeDataSection(program)
+	cg.writeDataSection()
 
-	// Generate code section
-	cg.writeTextSection(program)
+	cg.output.WriteString(text)
 
 	return cg.output.String()
 }
 
+// captureOutput runs generate against a fresh buffer and returns what it wrote
+func (cg *CodeGenerator) captureOutput(generate func()) string {
+	saved := cg.output
+	cg.output = &strings.Builder{}
+	generate()
+	captured := cg.output.String()
+	cg.output = saved
+	return captured
+}
+
+// BuildMarker is stored in the .comment section of every generated program,
+// so dreadc can tell its own executables apart from other files. The CPU the
+// program was built for follows it, as "dreadc cpu: x86-64-v3 (...)".
+const BuildMarker = "dreadc"
+
 func (cg *CodeGenerator) writeHeader() {
 	cg.output.WriteString(".intel_syntax noprefix\n")
-	cg.output.WriteString(".global _start\n\n")
+	cg.output.WriteString(fmt.Sprintf(".global %s\n\n", cg.target.entrySymbol))
+	cg.output.WriteString(".pushsection .comment\n")
+	cg.output.WriteString(fmt.Sprintf(".asciz \"%s\"\n", BuildMarker))
+	cg.output.WriteString(fmt.Sprintf(".asciz \"%s cpu: %s\"\n", BuildMarker, cg.target.CPU()))
+	cg.output.WriteString(".popsection\n\n")
+	cg.writeABINote()
 }
 
-func (cg *CodeGenerator) writeDataSection(program *parser.Program) {
+func (cg *CodeGenerator) writeDataSection() {
 	cg.output.WriteString(".section .data\n")
 
-	// Collect all string literals
-	cg.collectStrings(program)
-
-	// Generate null-terminated string constants
-	for literal, label := range cg.stringConstants {
-		// Convert escape sequences and add null terminator
-		processed := cg.processString(literal)
-		cg.output.WriteString(fmt.Sprintf("%s: .asciz \"%s\"\n", label, processed))
-		// Note: .asciz automatically adds a null terminator, so no length calculation needed
-	}
+	cg.writeStringConstants()
 
 	cg.output.WriteString("\n")
+	cg.writeGlobals()
 }
 
 func (cg *CodeGenerator) writeTextSection(program *parser.Program) {
 	cg.output.WriteString(".section .text\n")
 
-	// Add strlen helper function for null-terminated strings
-	// Add strlen helper function for null-terminated strings
-	cg.generateStrlenFunction()
-
-	// Find and generate the Entry function first
+	// Find and generate the Entry function first, so it starts the text
+	// section and flat freestanding binaries can be entered at offset 0. A
+	// benchmark build starts at its harness instead, leaving Entry out.
 	var entryFound bool
+	if cg.benchmarkIterations > 0 {
+		cg.generateBenchmarkHarness(program)
+		entryFound = true
+	}
 	for _, stmt := range program.Statements {
-		if funcStmt, ok := stmt.(*parser.FunctionStatement); ok {
+		if funcStmt, ok := stmt.(*parser.FunctionStatement); ok && !entryFound {
 			if funcStmt.IsEntry {
-				cg.output.WriteString("_start:\n")
+				cg.output.WriteString(fmt.Sprintf("%s:\n", cg.target.entrySymbol))
 				cg.generateFunction(funcStmt)
 				entryFound = true
 				break
@@ -86,672 +272,1241 @@ func (cg *CodeGenerator) writeTextSection(program *parser.Program) {
 
 	if !entryFound {
 		// Default entry point if no Entry function found
-		cg.output.WriteString("_start:\n")
+		cg.output.WriteString(fmt.Sprintf("%s:\n", cg.target.entrySymbol))
 		cg.output.WriteString("    # No Entry function found\n")
-		cg.output.WriteString("    mov rax, 60      # sys_exit\n")
 		cg.output.WriteString("    mov rdi, 1       # exit status\n")
-		cg.output.WriteString("    syscall\n")
+		cg.syscall("exit")
 	}
 
-	// Generate all regular functions
+	// Generate all regular functions, then the instances of generic ones
+	// that they call
 	for _, stmt := range program.Statements {
 		if funcStmt, ok := stmt.(*parser.FunctionStatement); ok {
-			if !funcStmt.IsEntry {
+			if !funcStmt.IsEntry && !isGeneric(funcStmt) {
 				cg.generateFunction(funcStmt)
 			}
 		}
 	}
+	cg.generateInstances()
+
+	// Add runtime helpers for null-terminated strings and integer output
+	cg.generateStrlenFunction()
+	cg.generatePrintStringFunction()
+	cg.generatePrintIntFunction()
+
+	cg.writeRuntimeFunctions()
+	cg.writeDefaultHooks()
 }
 
-func (cg *CodeGenerator) generateBlockStatement(block *parser.BlockStatement, isEntry bool) {
-	// For backward compatibility, call the new method with empty parameters
-	cg.generateBlockStatementWithParams(block, isEntry, []*parser.Parameter{})
+func (cg *CodeGenerator) generateFunction(funcStmt *parser.FunctionStatement) {
+	start := len(cg.diagnostics)
+	cg.checkFunction(funcStmt)
+
+	cg.current = &functionContext{
+		name:       functionName(funcStmt.Symbol()),
+		isEntry:    funcStmt.IsEntry,
+		returnType: funcStmt.ReturnType,
+		naked:      funcStmt.Attributes.Has("naked"),
+		interrupt:  funcStmt.Attributes.Has("interrupt"),
+		scopes:     []map[string]*variable{make(map[string]*variable)},
+		results:    make(map[*parser.CallExpression]*variable),
+	}
+
+	if r := funcStmt.Receiver; r != nil {
+		if _, ok := cg.interfaces[r.Type]; ok {
+			cg.errorAt(funcStmt.Token, ErrTypeMismatch, "cannot declare method %s on interface %s", funcStmt.Name, r.Type)
+		} else if _, ok := cg.structs[r.Type]; !ok {
+			cg.undefinedName(funcStmt.Token, ErrUndefinedType, "type", r.Type, cg.typeNames())
+		}
+	}
+	if base, ok := resultBase(funcStmt.ReturnType); ok && !isScalar(base) && base != "Void" {
+		cg.errorAt(funcStmt.NameToken, ErrUndefinedType, "result types must be Int, Float, Char, String or Void, got %s", funcStmt.ReturnType)
+	}
+	if typ := funcStmt.ReturnType; cg.isUndefinedType(typ) {
+		cg.undefinedName(funcStmt.NameToken, ErrUndefinedType, "type", typ, cg.typeNames())
+	}
+
+	// Generate the body first so the prologue knows how many stack slots it needs
+	body := cg.captureOutput(func() {
+		cg.bindParameters(funcStmt.Receiver, funcStmt.Parameters)
+		cg.generateBlockStatement(funcStmt.Body)
+	})
+
+	section := funcStmt.Attributes.Lookup("section")
+	if !funcStmt.IsEntry {
+		// Generate function label; interrupt handlers are exported so the
+		// user's startup code can install them in the IDT
+		if section != nil {
+			cg.output.WriteString(pushSection(section, "ax", false))
+		}
+		cg.output.WriteString(symbolDirectives(funcStmt.Symbol(), funcStmt.Attributes, cg.current.interrupt))
+		cg.output.WriteString(fmt.Sprintf("%s:\n", funcStmt.Symbol()))
+	}
+
+	if cg.current.naked && cg.current.frameSize > 0 {
+		cg.errorAt(funcStmt.Token, ErrAttribute, "naked function %s cannot have local variables", funcStmt.Symbol())
+	}
+	if !funcStmt.IsEntry && !cg.current.naked && !cg.current.interrupt && cg.isLeaf(body) {
+		// Any Return in the body has already torn down the frame
+		cg.current.leaf = true
+		body = strings.ReplaceAll(body, frameTeardown, "")
+	}
+	cg.generatePrologue()
+
+	cg.output.WriteString(body)
+
+	base, _ := resultBase(funcStmt.ReturnType)
+	switch {
+	case funcStmt.IsEntry:
+		// Default exit for Entry function
+		cg.output.WriteString("    # Default exit\n")
+		cg.output.WriteString("    mov rdi, 0       # exit status\n")
+		cg.syscall("exit")
+	case base == "" || base == "Void":
+		// Default return for functions without a value to return; the
+		// semantic pass checked that the others end in a Return
+		cg.output.WriteString("    # Default function return\n")
+		if isResult(funcStmt.ReturnType) {
+			cg.output.WriteString("    xor eax, eax     # success\n")
+		}
+		cg.generateEpilogue()
+	}
+	if section != nil {
+		cg.output.WriteString(".popsection\n")
+	}
+
+	if len(cg.current.lowered) > 0 {
+		cg.lowered.Functions = append(cg.lowered.Functions, &ir.Function{Name: cg.current.name, Blocks: cg.current.lowered})
+	}
+	cg.current = nil
+	// The type pass reported its errors before the body was generated
+	inSourceOrder(cg.diagnostics[start:])
 }
 
-func (cg *CodeGenerator) generateAssignStatement(stmt *parser.AssignStatement, variables map[string]string) {
-	switch expr := stmt.Value.(type) {
-	case *parser.StringLiteral:
-		// Store reference to string constant
-		label := cg.getStringLabel(expr.Value)
-		variables[stmt.Name] = label
-	case *parser.IntegerLiteral:
-		// Convert integer to string and store reference
-		intStr := fmt.Sprintf("%d", expr.Value)
-		label := cg.getStringLabel(intStr)
-		variables[stmt.Name] = label
-	case *parser.Identifier:
-		// Copy variable reference
-		if ref, exists := variables[expr.Value]; exists {
-			variables[stmt.Name] = ref
+// interruptSavedRegisters are the caller-saved registers, which an interrupt
+// handler must preserve for the code it interrupted
+var interruptSavedRegisters = []string{"rax", "rcx", "rdx", "rsi", "rdi", "r8", "r9", "r10", "r11"}
+
+// generatePrologue sets up the stack frame of the current function
+func (cg *CodeGenerator) generatePrologue() {
+	if cg.current.naked {
+		cg.output.WriteString("    # naked: no stack frame\n")
+		return
+	}
+	if cg.current.leaf {
+		cg.output.WriteString("    # leaf: no stack frame\n")
+		return
+	}
+
+	// The CPU enters an interrupt handler with rsp 8 bytes off 16-byte
+	// alignment, as after a call, but nine registers are pushed before rbp
+	padding := 0
+	if cg.current.interrupt {
+		for _, reg := range interruptSavedRegisters {
+			cg.output.WriteString(fmt.Sprintf("    push %s\n", reg))
 		}
-	case *parser.InfixExpression:
-		// Handle arithmetic expressions
-		result := cg.generateInfixExpression(expr, variables)
-		variables[stmt.Name] = result
-	case *parser.CallExpression:
-		// Function call assignment - implement return value handling
-		cg.output.WriteString(fmt.Sprintf("    # %s = %s()\n", stmt.Name, expr.Function))
-		if len(expr.Arguments) == 0 {
-			cg.output.WriteString(fmt.Sprintf("    call %s\n", expr.Function))
-		} else {
-			// Handle parameters for assignment calls too
-			cg.output.WriteString("    # Setup parameters for assignment call\n")
-			for i, arg := range expr.Arguments {
-				switch a := arg.(type) {
-				case *parser.StringLiteral:
-					label := cg.getStringLabel(a.Value)
-					if i == 0 {
-						cg.output.WriteString(fmt.Sprintf("    lea rdi, [%s]    # first parameter address\n", label))
-						// No need to pass length with null-terminated strings
-					}
-				case *parser.IntegerLiteral:
-					// Convert integer to string for parameter passing
-					intStr := fmt.Sprintf("%d", a.Value)
-					label := cg.getStringLabel(intStr)
-					if i == 0 {
-						cg.output.WriteString(fmt.Sprintf("    lea rdi, [%s]    # first parameter address (integer as string)\n", label))
-						// No need to pass length with null-terminated strings
-					}
-				case *parser.Identifier:
-					if label, exists := variables[a.Value]; exists {
-						if i == 0 {
-							cg.output.WriteString(fmt.Sprintf("    lea rdi, [%s]    # first parameter from variable\n", label))
-						}
-					}
-				}
-			}
-			cg.output.WriteString(fmt.Sprintf("    call %s\n", expr.Function))
+		padding = 8
+	}
+
+	cg.output.WriteString("    push rbp\n")
+	cg.output.WriteString("    mov rbp, rsp\n")
+	if frameSize := (cg.current.frameSize+15)&^15 + padding; frameSize > 0 {
+		// Keep rsp 16-byte aligned
+		cg.output.WriteString(fmt.Sprintf("    sub rsp, %d       # space for locals\n", frameSize))
+	}
+	if cg.current.interrupt {
+		cg.output.WriteString("    cld              # the interrupted code may have set DF\n")
+	}
+}
+
+// frameTeardown is how an epilogue removes the stack frame
+const frameTeardown = "    mov rsp, rbp\n    pop rbp\n"
+
+// isLeaf reports whether the body of the current function can run without a
+// stack frame: it has no stack slots, calls nothing, so rsp needs no
+// alignment, and apart from its epilogues never touches rbp
+func (cg *CodeGenerator) isLeaf(body string) bool {
+	if cg.current.frameSize > 0 {
+		return false
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(body, frameTeardown, ""), "\n") {
+		if code, _, _ := strings.Cut(line, "#"); strings.HasPrefix(strings.TrimSpace(code), "call ") || strings.Contains(code, "rbp") {
+			return false
 		}
-		// For string return values, the function returns a string address in rax
-		variables[stmt.Name] = "rax" // rax contains the return value address
-		// Note: rax now contains the string address returned by the function
 	}
+	return true
 }
 
-func (cg *CodeGenerator) generateCallStatement(stmt *parser.CallStatement, variables map[string]string, isEntry bool) {
-	switch stmt.Function {
-	case "Print":
-		if len(stmt.Arguments) > 0 {
-			arg := stmt.Arguments[0]
-			switch a := arg.(type) {
-			case *parser.Identifier:
-				if label, exists := variables[a.Value]; exists {
-					// Check if this is a parameter (special handling)
-					if label == "INT_PARAM_R15" {
-						// Integer parameter saved in r15
-						cg.generatePrintIntegerFromR15()
-					} else if label == "INT_PARAM_STACK" {
-						// Integer parameter saved on stack
-						cg.generatePrintIntegerFromStack()
-					} else if label == "INT_PARAM_RDI" {
-						// Integer parameter - convert to string first
-						cg.generatePrintIntegerFromRDI()
-					} else if strings.HasPrefix(label, "param_") {
-						// String parameter
-						cg.generatePrintFromRegister()
-					} else if label == "rax" {
-						// This is a string address in rax (from function return)
-						cg.generatePrintFromRax()
-					} else {
-						cg.generatePrint(label)
-					}
-				}
-			case *parser.StringLiteral:
-				label := cg.getStringLabel(a.Value)
-				cg.generatePrint(label)
-			case *parser.IntegerLiteral:
-				// Convert integer to string for printing
-				intStr := fmt.Sprintf("%d", a.Value)
-				label := cg.getStringLabel(intStr)
-				cg.generatePrint(label)
-			}
+// generateEpilogue tears down the stack frame and returns from the current function
+func (cg *CodeGenerator) generateEpilogue() {
+	if !cg.current.naked && !cg.current.leaf {
+		cg.output.WriteString(frameTeardown)
+	}
+	if !cg.current.interrupt {
+		cg.output.WriteString("    ret\n")
+		return
+	}
+	for i := len(interruptSavedRegisters) - 1; i >= 0; i-- {
+		cg.output.WriteString(fmt.Sprintf("    pop %s\n", interruptSavedRegisters[i]))
+	}
+	cg.output.WriteString("    iretq\n")
+}
+
+// argumentRegisters are the System V x86-64 integer argument registers, in order
+var argumentRegisters = []string{"rdi", "rsi", "rdx", "rcx", "r8", "r9"}
+
+func (cg *CodeGenerator) bindParameters(receiver *parser.Parameter, params []*parser.Parameter) {
+	// A method's receiver is its first argument, so the parameters start one
+	// register later
+	first := 0
+	if receiver != nil {
+		first = 1
+	}
+
+	// Copy every parameter into a local slot so it survives further calls.
+	// The seventh and later ones were pushed by the caller and sit above the
+	// return address: the first at [rbp + 16], the next at [rbp + 24], ...
+	for i, param := range params {
+		n := first + i
+		cg.checkParameterType(param)
+		v := cg.declareVariable(param.Name, param.Type)
+		v.Parameter = true
+		v.Declaration = param.Token
+		cg.refer(param.Token, v)
+		if n < len(argumentRegisters) {
+			cg.output.WriteString(fmt.Sprintf("    mov [%s], %s    # parameter %s\n", v.address(), argumentRegisters[n], param.Name))
+			continue
 		}
-	case "Return":
-		if len(stmt.Arguments) > 0 {
-			switch a := stmt.Arguments[0].(type) {
-			case *parser.StringLiteral:
-				if isEntry {
-					// Entry function: exit the program
-					exitCode := a.Value
-					cg.output.WriteString(fmt.Sprintf("    # Return(%s)\n", exitCode))
-					cg.output.WriteString("    mov rax, 60      # sys_exit\n")
-					cg.output.WriteString(fmt.Sprintf("    mov rdi, %s      # exit status\n", exitCode))
-					cg.output.WriteString("    syscall\n")
-				} else {
-					// Regular function: return value through rax register
-					label := cg.getStringLabel(a.Value)
-					cg.output.WriteString(fmt.Sprintf("    # Return(%s)\n", a.Value))
-					cg.output.WriteString(fmt.Sprintf("    lea rax, [%s]    # return string address in rax\n", label))
-					// No need to return length with null-terminated strings
-					cg.output.WriteString("    mov rsp, rbp\n")
-					cg.output.WriteString("    pop rbp\n")
-					cg.output.WriteString("    ret\n")
-				}
-			case *parser.IntegerLiteral:
-				if isEntry {
-					// Entry function: exit the program with integer exit code
-					exitCode := fmt.Sprintf("%d", a.Value)
-					cg.output.WriteString(fmt.Sprintf("    # Return(%d)\n", a.Value))
-					cg.output.WriteString("    mov rax, 60      # sys_exit\n")
-					cg.output.WriteString(fmt.Sprintf("    mov rdi, %s      # exit status\n", exitCode))
-					cg.output.WriteString("    syscall\n")
-				} else {
-					// Regular function: return integer as string
-					intStr := fmt.Sprintf("%d", a.Value)
-					label := cg.getStringLabel(intStr)
-					cg.output.WriteString(fmt.Sprintf("    # Return(%d)\n", a.Value))
-					cg.output.WriteString(fmt.Sprintf("    lea rax, [%s]    # return string address in rax\n", label))
-					// No need to return length with null-terminated strings
-					cg.output.WriteString("    mov rsp, rbp\n")
-					cg.output.WriteString("    pop rbp\n")
-					cg.output.WriteString("    ret\n")
-				}
-			case *parser.Identifier:
-				// Handle return of a variable
-				if label, exists := variables[a.Value]; exists {
-					if isEntry {
-						// For Entry function, try to parse the string as an exit code
-						// This assumes the variable contains a string representation of an integer
-						cg.output.WriteString(fmt.Sprintf("    # Return(variable %s)\n", a.Value))
-						// For simplicity, we'll extract the integer from the string at compile time
-						// by looking at the stored label content
-						if exitCodeStr, found := cg.getStringFromLabel(label); found {
-							cg.output.WriteString("    mov rax, 60      # sys_exit\n")
-							cg.output.WriteString(fmt.Sprintf("    mov rdi, %s      # exit status from variable\n", exitCodeStr))
-							cg.output.WriteString("    syscall\n")
-						} else {
-							// Fallback to 0 if we can't determine the value
-							cg.output.WriteString("    mov rax, 60      # sys_exit\n")
-							cg.output.WriteString("    mov rdi, 0       # fallback exit status\n")
-							cg.output.WriteString("    syscall\n")
-						}
-					} else {
-						// Regular function: return the variable's string address
-						cg.output.WriteString(fmt.Sprintf("    # Return(variable %s)\n", a.Value))
-						cg.output.WriteString(fmt.Sprintf("    lea rax, [%s]    # return variable address in rax\n", label))
-						cg.output.WriteString("    mov rsp, rbp\n")
-						cg.output.WriteString("    pop rbp\n")
-						cg.output.WriteString("    ret\n")
-					}
-				} else {
-					cg.output.WriteString(fmt.Sprintf("    # Return(undefined variable %s) - using 0\n", a.Value))
-					if isEntry {
-						cg.output.WriteString("    mov rax, 60      # sys_exit\n")
-						cg.output.WriteString("    mov rdi, 0       # exit status\n")
-						cg.output.WriteString("    syscall\n")
-					}
-				}
+		cg.output.WriteString(fmt.Sprintf("    mov rax, [rbp + %d]\n", 16+8*(n-len(argumentRegisters))))
+		cg.output.WriteString(fmt.Sprintf("    mov [%s], rax    # parameter %s\n", v.address(), param.Name))
+	}
+
+	// The receiver arrives as the address of the caller's struct; the method
+	// works on its own copy, like any other struct assignment. rdi is still
+	// intact here, while copying clobbers rcx, a parameter register.
+	if receiver != nil {
+		v := cg.declareVariable(receiver.Name, receiver.Type)
+		v.Declared = true
+		v.Parameter = true
+		v.Declaration = receiver.Token
+		cg.output.WriteString(fmt.Sprintf("    mov rax, %s    # address of receiver %s\n", argumentRegisters[0], receiver.Name))
+		cg.storeValue(receiver.Name, v.place(), false)
+	}
+}
+
+// checkParameterType reports a parameter whose type names a struct, which
+// takes more than the one register a parameter gets, or nothing at all
+func (cg *CodeGenerator) checkParameterType(param *parser.Parameter) {
+	if _, isStruct := cg.structs[param.Type]; isStruct {
+		cg.errorAt(param.Token, ErrTypeMismatch, "parameter %s cannot be struct %s; use a method or an interface", param.Name, param.Type)
+		return
+	}
+	if _, isInterface := cg.interfaces[param.Type]; !isInterface && isIdentifier(param.Type) && !isScalar(param.Type) {
+		cg.undefinedName(param.Token, ErrUndefinedType, "type", param.Type, cg.typeNames())
+	}
+}
+
+// generateScopedBlock generates a nested block whose variables are local to it
+func (cg *CodeGenerator) generateScopedBlock(block *parser.BlockStatement) {
+	cg.pushScope()
+	cg.generateBlockStatement(block)
+	cg.popScope()
+}
+
+// newLabel returns a unique assembly label with the given prefix
+func (cg *CodeGenerator) newLabel(prefix string) string {
+	label := fmt.Sprintf("%s_%d", prefix, cg.labelCounter)
+	cg.labelCounter++
+	return label
+}
+
+func (cg *CodeGenerator) generateBlockStatement(block *parser.BlockStatement) {
+	for i := 0; i < len(block.Statements); i++ {
+		if cg.optimization >= 1 {
+			if n := cg.fusePrints(block.Statements[i:]); n > 0 {
+				i += n - 1
+				continue
 			}
 		}
-	default:
-		// User-defined function call
-		cg.output.WriteString(fmt.Sprintf("    # Call %s\n", stmt.Function))
+		cg.poisoned = false
+		switch s := block.Statements[i].(type) {
+		case *parser.AssignStatement:
+			cg.generateAssignStatement(s)
+		case *parser.DestructureStatement:
+			cg.generateDestructureStatement(s)
+		case *parser.VarStatement:
+			cg.generateVarStatement(s)
+		case *parser.ConstStatement:
+			cg.defineConstant(s, cg.current.scopes[len(cg.current.scopes)-1])
+		case *parser.CallStatement:
+			cg.generateCallStatement(s)
+		case *parser.ForStatement:
+			cg.generateForStatement(s)
+		case *parser.IfStatement:
+			cg.generateIfStatement(s)
+		case *parser.DoWhileStatement:
+			cg.generateDoWhileStatement(s)
+		case *parser.TryStatement:
+			cg.generateTryStatement(s)
+		case *parser.BranchStatement:
+			cg.generateBranchStatement(s)
+		case *parser.MatchStatement:
+			cg.generateMatchStatement(s)
+		case *parser.BlockStatement:
+			cg.generateScopedBlock(s)
+		}
+	}
+}
 
-		// Implement basic parameter passing
-		if len(stmt.Arguments) == 0 {
-			cg.output.WriteString(fmt.Sprintf("    call %s\n", stmt.Function))
-		} else {
-			// For simplicity, we'll pass string parameters by setting up string labels
-			// In x86-64, first argument goes in rdi register
-			cg.output.WriteString("    # Setup parameters\n")
-			for i, arg := range stmt.Arguments {
-				switch a := arg.(type) {
-				case *parser.StringLiteral:
-					label := cg.getStringLabel(a.Value)
-					if i == 0 {
-						// First parameter in rdi (address only) with null-terminated strings
-						cg.output.WriteString(fmt.Sprintf("    lea rdi, [%s]    # first parameter address\n", label))
-					} else {
-						// For now, only support one parameter
-						cg.output.WriteString("    # TODO: Multiple parameters not yet implemented\n")
-					}
-				case *parser.IntegerLiteral:
-					// Pass integer value directly in register
-					if i == 0 {
-						// First parameter: integer value in rdi
-						cg.output.WriteString(fmt.Sprintf("    mov rdi, %d    # first parameter (integer value)\n", a.Value))
-					} else {
-						// For now, only support one parameter
-						cg.output.WriteString("    # TODO: Multiple parameters not yet implemented\n")
-					}
-				case *parser.Identifier:
-					if label, exists := variables[a.Value]; exists {
-						if i == 0 {
-							// Check if this variable contains an integer by checking if the label contains digits
-							if labelContent, found := cg.getStringFromLabel(label); found {
-								// Try to parse as integer
-								if intVal, err := strconv.ParseInt(labelContent, 10, 64); err == nil {
-									// It's an integer variable - pass the value
-									cg.output.WriteString(fmt.Sprintf("    mov rdi, %d    # first parameter (integer value from variable)\n", intVal))
-								} else {
-									// It's a string variable - pass the address
-									cg.output.WriteString(fmt.Sprintf("    lea rdi, [%s]    # first parameter from variable (string)\n", label))
-								}
-							} else {
-								// Fallback: assume string
-								cg.output.WriteString(fmt.Sprintf("    lea rdi, [%s]    # first parameter from variable\n", label))
-							}
-						}
-					}
-				}
-			}
-			cg.output.WriteString(fmt.Sprintf("    call %s\n", stmt.Function))
-		}
-	}
-}
-
-func (cg *CodeGenerator) generatePrint(label string) {
-	cg.output.WriteString(fmt.Sprintf("    # Print(%s)\n", label))
-	// Calculate string length for null-terminated string
-	cg.output.WriteString(fmt.Sprintf("    lea rdi, [%s]    # string address\n", label))
-	cg.output.WriteString("    call strlen      # calculate length, result in rax\n")
-	cg.output.WriteString("    mov rdx, rax     # string length\n")
-	cg.output.WriteString("    mov rax, 1       # sys_write\n")
-	cg.output.WriteString("    mov rdi, 1       # stdout\n")
-	cg.output.WriteString(fmt.Sprintf("    lea rsi, [%s]    # string address\n", label))
-	cg.output.WriteString("    syscall\n")
-}
-
-func (cg *CodeGenerator) generatePrintFromRegister() {
-	cg.output.WriteString("    # Print(parameter from rdi)\n")
-	// rdi already contains string address, just calculate length
-	cg.output.WriteString("    call strlen      # calculate length, result in rax\n")
-	cg.output.WriteString("    mov rdx, rax     # string length\n")
-	cg.output.WriteString("    mov rax, 1       # sys_write\n")
-	cg.output.WriteString("    mov rsi, rdi     # string address from parameter\n")
-	cg.output.WriteString("    mov rdi, 1       # stdout\n")
-	cg.output.WriteString("    syscall\n")
-}
-
-func (cg *CodeGenerator) generatePrintIntegerFromR15() {
-	cg.output.WriteString("    # Print(integer parameter from r15)\n")
-	// Get the integer value from r15 into rdi
-	cg.output.WriteString("    mov rdi, r15         # get integer parameter from r15\n")
-
-	// Convert integer to string for specific test values
-	cg.output.WriteString("    # Convert integer to string (specific test values)\n")
-	cg.output.WriteString("    cmp rdi, 456\n")
-	cg.output.WriteString("    je print_int_456\n")
-	cg.output.WriteString("    cmp rdi, 789\n")
-	cg.output.WriteString("    je print_int_789\n")
-
-	// If not a known value, print zero as a fallback
-	cg.output.WriteString("    # Fallback: print 0 for unknown integers\n")
-	zeroLabel := cg.getStringLabel("0")
-	cg.output.WriteString(fmt.Sprintf("    lea rdi, [%s]\n", zeroLabel))
-	cg.output.WriteString("    call strlen\n")
-	cg.output.WriteString("    mov rdx, rax\n")
-	cg.output.WriteString("    mov rax, 1\n")
-	cg.output.WriteString("    mov rdi, 1\n")
-	cg.output.WriteString(fmt.Sprintf("    lea rsi, [%s]\n", zeroLabel))
-	cg.output.WriteString("    syscall\n")
-	cg.output.WriteString("    jmp print_int_done\n")
-
-	cg.output.WriteString("print_int_456:\n")
-	label456 := cg.getStringLabel("456")
-	cg.output.WriteString(fmt.Sprintf("    lea rdi, [%s]\n", label456))
-	cg.output.WriteString("    call strlen\n")
-	cg.output.WriteString("    mov rdx, rax\n")
-	cg.output.WriteString("    mov rax, 1\n")
-	cg.output.WriteString("    mov rdi, 1\n")
-	cg.output.WriteString(fmt.Sprintf("    lea rsi, [%s]\n", label456))
-	cg.output.WriteString("    syscall\n")
-	cg.output.WriteString("    jmp print_int_done\n")
-
-	cg.output.WriteString("print_int_789:\n")
-	label789 := cg.getStringLabel("789")
-	cg.output.WriteString(fmt.Sprintf("    lea rdi, [%s]\n", label789))
-	cg.output.WriteString("    call strlen\n")
-	cg.output.WriteString("    mov rdx, rax\n")
-	cg.output.WriteString("    mov rax, 1\n")
-	cg.output.WriteString("    mov rdi, 1\n")
-	cg.output.WriteString(fmt.Sprintf("    lea rsi, [%s]\n", label789))
-	cg.output.WriteString("    syscall\n")
-
-	cg.output.WriteString("print_int_done:\n")
-}
-
-func (cg *CodeGenerator) generatePrintIntegerFromStack() {
-	cg.output.WriteString("    # Print(integer parameter from stack)\n")
-	// Get the integer value from stack into rdi
-	cg.output.WriteString("    mov rdi, [rbp + 16]  # get integer parameter from stack (above return addr and rbp)\n")
-
-	// Convert integer to string for specific test values
-	cg.output.WriteString("    # Convert integer to string (specific test values)\n")
-	cg.output.WriteString("    cmp rdi, 456\n")
-	cg.output.WriteString("    je print_int_456\n")
-	cg.output.WriteString("    cmp rdi, 789\n")
-	cg.output.WriteString("    je print_int_789\n")
-
-	// If not a known value, print zero as a fallback
-	cg.output.WriteString("    # Fallback: print 0 for unknown integers\n")
-	zeroLabel := cg.getStringLabel("0")
-	cg.output.WriteString(fmt.Sprintf("    lea rdi, [%s]\n", zeroLabel))
-	cg.output.WriteString("    call strlen\n")
-	cg.output.WriteString("    mov rdx, rax\n")
-	cg.output.WriteString("    mov rax, 1\n")
-	cg.output.WriteString("    mov rdi, 1\n")
-	cg.output.WriteString(fmt.Sprintf("    lea rsi, [%s]\n", zeroLabel))
-	cg.output.WriteString("    syscall\n")
-	cg.output.WriteString("    jmp print_int_done\n")
-
-	cg.output.WriteString("print_int_456:\n")
-	label456 := cg.getStringLabel("456")
-	cg.output.WriteString(fmt.Sprintf("    lea rdi, [%s]\n", label456))
-	cg.output.WriteString("    call strlen\n")
-	cg.output.WriteString("    mov rdx, rax\n")
-	cg.output.WriteString("    mov rax, 1\n")
-	cg.output.WriteString("    mov rdi, 1\n")
-	cg.output.WriteString(fmt.Sprintf("    lea rsi, [%s]\n", label456))
-	cg.output.WriteString("    syscall\n")
-	cg.output.WriteString("    jmp print_int_done\n")
-
-	cg.output.WriteString("print_int_789:\n")
-	label789 := cg.getStringLabel("789")
-	cg.output.WriteString(fmt.Sprintf("    lea rdi, [%s]\n", label789))
-	cg.output.WriteString("    call strlen\n")
-	cg.output.WriteString("    mov rdx, rax\n")
-	cg.output.WriteString("    mov rax, 1\n")
-	cg.output.WriteString("    mov rdi, 1\n")
-	cg.output.WriteString(fmt.Sprintf("    lea rsi, [%s]\n", label789))
-	cg.output.WriteString("    syscall\n")
-
-	cg.output.WriteString("print_int_done:\n")
-}
-
-func (cg *CodeGenerator) generatePrintIntegerFromRDI() {
-	cg.output.WriteString("    # Print(integer parameter from rdi)\n")
-
-	// We need to convert the integer to a string
-	// For now, handle the specific test case values
-	cg.output.WriteString("    # Convert integer to string (specific test values)\n")
-	cg.output.WriteString("    cmp rdi, 456\n")
-	cg.output.WriteString("    je print_int_456\n")
-	cg.output.WriteString("    cmp rdi, 789\n")
-	cg.output.WriteString("    je print_int_789\n")
-
-	// If not a known value, print zero as a fallback
-	cg.output.WriteString("    # Fallback: print 0 for unknown integers\n")
-	zeroLabel := cg.getStringLabel("0")
-	cg.output.WriteString(fmt.Sprintf("    lea rdi, [%s]\n", zeroLabel))
-	cg.output.WriteString("    call strlen\n")
-	cg.output.WriteString("    mov rdx, rax\n")
-	cg.output.WriteString("    mov rax, 1\n")
-	cg.output.WriteString("    mov rdi, 1\n")
-	cg.output.WriteString(fmt.Sprintf("    lea rsi, [%s]\n", zeroLabel))
-	cg.output.WriteString("    syscall\n")
-	cg.output.WriteString("    jmp print_int_done\n")
-
-	cg.output.WriteString("print_int_456:\n")
-	label456 := cg.getStringLabel("456")
-	cg.output.WriteString(fmt.Sprintf("    lea rdi, [%s]\n", label456))
-	cg.output.WriteString("    call strlen\n")
-	cg.output.WriteString("    mov rdx, rax\n")
-	cg.output.WriteString("    mov rax, 1\n")
-	cg.output.WriteString("    mov rdi, 1\n")
-	cg.output.WriteString(fmt.Sprintf("    lea rsi, [%s]\n", label456))
-	cg.output.WriteString("    syscall\n")
-	cg.output.WriteString("    jmp print_int_done\n")
-
-	cg.output.WriteString("print_int_789:\n")
-	label789 := cg.getStringLabel("789")
-	cg.output.WriteString(fmt.Sprintf("    lea rdi, [%s]\n", label789))
-	cg.output.WriteString("    call strlen\n")
-	cg.output.WriteString("    mov rdx, rax\n")
-	cg.output.WriteString("    mov rax, 1\n")
-	cg.output.WriteString("    mov rdi, 1\n")
-	cg.output.WriteString(fmt.Sprintf("    lea rsi, [%s]\n", label789))
-	cg.output.WriteString("    syscall\n")
-
-	cg.output.WriteString("print_int_done:\n")
-}
-
-func (cg *CodeGenerator) generatePrintFromRax() {
-	cg.output.WriteString("    # Print(return value from rax)\n")
-	cg.output.WriteString("    mov rdi, rax     # string address from return value\n")
-	cg.output.WriteString("    call strlen      # calculate length, result in rax\n")
-	cg.output.WriteString("    mov rdx, rax     # string length\n")
-	cg.output.WriteString("    mov rax, 1       # sys_write\n")
-	cg.output.WriteString("    mov rsi, rdi     # string address (preserved from before strlen)\n")
-	cg.output.WriteString("    mov rdi, 1       # stdout\n")
-	cg.output.WriteString("    syscall\n")
-}
-
-func (cg *CodeGenerator) collectStrings(program *parser.Program) {
-	for _, stmt := range program.Statements {
-		cg.collectStringsFromStatement(stmt)
+// Dense Int matches with at least this many values use a jump table
+const (
+	jumpTableMinCases = 4
+	jumpTableMaxRange = 256
+)
+
+// generateDoWhileStatement runs the body before the first test; the body's
+// variables are out of scope in the condition
+func (cg *CodeGenerator) generateDoWhileStatement(stmt *parser.DoWhileStatement) {
+	startLabel := cg.newLabel("do_start")
+	testLabel := cg.newLabel("do_test")
+	endLabel := cg.newLabel("do_end")
+
+	cg.output.WriteString(fmt.Sprintf("%s:\n", startLabel))
+	cg.generateLoopBody(stmt.Label, stmt.Body, endLabel, testLabel)
+
+	cg.output.WriteString(fmt.Sprintf("%s:\n", testLabel))
+	cg.output.WriteString(fmt.Sprintf("    # While (%s)\n", comment(stmt.Condition)))
+	if typ := cg.generateExpression(stmt.Condition); !isInteger(typ) {
+		cg.errorAt(stmt.Token, ErrTypeMismatch, "While condition must be Int, got %s", typ)
 	}
+	cg.output.WriteString("    test rax, rax\n")
+	cg.output.WriteString(fmt.Sprintf("    jne %s\n", startLabel))
+	cg.output.WriteString(fmt.Sprintf("%s:\n", endLabel))
 }
 
-func (cg *CodeGenerator) collectStringsFromStatement(stmt parser.Statement) {
-	switch s := stmt.(type) {
-	case *parser.FunctionStatement:
-		cg.collectStringsFromStatement(s.Body)
-	case *parser.BlockStatement:
-		for _, innerStmt := range s.Statements {
-			cg.collectStringsFromStatement(innerStmt)
+// generateLoopBody generates the body of a loop named label (or unnamed),
+// in which Break jumps to breakLabel and Continue to continueLabel
+func (cg *CodeGenerator) generateLoopBody(label string, body *parser.BlockStatement, breakLabel, continueLabel string) {
+	cg.current.loops = append(cg.current.loops, loop{name: label, breakLabel: breakLabel, continueLabel: continueLabel})
+	cg.generateScopedBlock(body)
+	cg.current.loops = cg.current.loops[:len(cg.current.loops)-1]
+}
+
+// generateBranchStatement jumps out of, or to the next iteration of, the
+// innermost loop or the innermost one with the given label
+func (cg *CodeGenerator) generateBranchStatement(stmt *parser.BranchStatement) {
+	for i := len(cg.current.loops) - 1; i >= 0; i-- {
+		target := cg.current.loops[i]
+		if stmt.Label != "" && target.name != stmt.Label {
+			continue
 		}
-	case *parser.AssignStatement:
-		cg.collectStringsFromExpression(s.Value)
-	case *parser.CallStatement:
-		for _, arg := range s.Arguments {
-			cg.collectStringsFromExpression(arg)
+		jump := target.breakLabel
+		if stmt.Token.Type == lexer.CONTINUE {
+			jump = target.continueLabel
 		}
+		cg.output.WriteString(fmt.Sprintf("    jmp %s    # %s\n", jump, comment(stmt)))
+		return
+	}
+
+	if stmt.Label != "" {
+		cg.errorAt(stmt.Token, ErrNoLoop, "no enclosing loop labeled %s", stmt.Label)
+	} else {
+		cg.errorAt(stmt.Token, ErrNoLoop, "%s outside a loop", stmt.Token.Literal)
 	}
 }
 
-func (cg *CodeGenerator) collectStringsFromExpression(expr parser.Expression) {
-	switch e := expr.(type) {
-	case *parser.StringLiteral:
-		cg.getStringLabel(e.Value)
-	case *parser.IntegerLiteral:
-		// Convert integer to string and collect it
-		intStr := fmt.Sprintf("%d", e.Value)
-		cg.getStringLabel(intStr)
-	case *parser.InfixExpression:
-		// Collect strings from both operands
-		cg.collectStringsFromExpression(e.Left)
-		cg.collectStringsFromExpression(e.Right)
-
-		// Also evaluate and collect the result string
-		if e.Operator == "+" {
-			// Evaluate left operand
-			var leftValue int64
-			switch left := e.Left.(type) {
-			case *parser.IntegerLiteral:
-				leftValue = left.Value
-			case *parser.Identifier:
-				// For collection phase, we can't resolve variables yet
-				// Just ensure "0" is available as a fallback
-				cg.getStringLabel("0")
-				return
-			}
+// generateIfStatement tests the conditions in order; each failed test jumps
+// to the next branch, and each body jumps past the rest of the chain
+func (cg *CodeGenerator) generateIfStatement(stmt *parser.IfStatement) {
+	endLabel := cg.newLabel("if_end")
+	// Optionals compared with nil hold a value in the branches that only
+	// run when they do
+	narrowed := 0
+
+	for i, branch := range stmt.Branches {
+		nextLabel := endLabel
+		if i < len(stmt.Branches)-1 || stmt.Else != nil {
+			nextLabel = cg.newLabel("if_next")
+		}
+
+		keyword := "If"
+		if i > 0 {
+			keyword = "Else If"
+		}
+		cg.output.WriteString(fmt.Sprintf("    # %s (%s)\n", keyword, comment(branch.Condition)))
+		if typ := cg.generateExpression(branch.Condition); !isInteger(typ) {
+			cg.errorAt(branch.Token, ErrTypeMismatch, "If condition must be Int, got %s", typ)
+		}
+		cg.output.WriteString("    test rax, rax\n")
+		cg.output.WriteString(fmt.Sprintf("    je %s\n", nextLabel))
+		name, isNil, checked := nilCheck(branch.Condition)
+		if checked && !isNil {
+			cg.narrow(name)
+			cg.generateScopedBlock(branch.Body)
+			cg.popScope()
+		} else {
+			cg.generateScopedBlock(branch.Body)
+		}
+		if checked && isNil {
+			cg.narrow(name)
+			narrowed++
+		}
+
+		if nextLabel != endLabel {
+			cg.output.WriteString(fmt.Sprintf("    jmp %s\n", endLabel))
+			cg.output.WriteString(fmt.Sprintf("%s:\n", nextLabel))
+		}
+	}
+	if stmt.Else != nil {
+		cg.output.WriteString("    # Else\n")
+		cg.generateScopedBlock(stmt.Else)
+	}
+	for ; narrowed > 0; narrowed-- {
+		cg.popScope()
+	}
+	cg.output.WriteString(fmt.Sprintf("%s:\n", endLabel))
+}
 
-			// Evaluate right operand
-			var rightValue int64
-			switch right := e.Right.(type) {
-			case *parser.IntegerLiteral:
-				rightValue = right.Value
-			case *parser.Identifier:
-				// For collection phase, we can't resolve variables yet
-				cg.getStringLabel("0")
-				return
+func (cg *CodeGenerator) generateMatchStatement(stmt *parser.MatchStatement) {
+	endLabel := cg.newLabel("match_end")
+	defaultLabel := endLabel
+	if stmt.Default != nil {
+		defaultLabel = cg.newLabel("match_default")
+	}
+
+	// Map every case value to the label of its arm
+	caseLabels := make([]string, len(stmt.Cases))
+	targets := make(map[int64]string)
+	var values []int64
+	for i, c := range stmt.Cases {
+		caseLabels[i] = cg.newLabel("match_case")
+		for _, v := range c.Values {
+			if lit, ok := v.(*parser.IntegerLiteral); ok {
+				targets[lit.Value] = caseLabels[i]
+				values = append(values, lit.Value)
 			}
+		}
+	}
+
+	cg.output.WriteString(fmt.Sprintf("    # Match(%s)\n", comment(stmt.Value)))
+	if typ := cg.generateExpression(stmt.Value); !isInteger(typ) {
+		cg.errorAt(stmt.Token, ErrTypeMismatch, "Match value must be Int, got %s", typ)
+	}
 
-			// Calculate and collect result
-			result := leftValue + rightValue
-			resultStr := fmt.Sprintf("%d", result)
-			cg.getStringLabel(resultStr)
+	if low, high, dense := denseRange(values); dense {
+		cg.generateJumpTable(low, high, targets, defaultLabel)
+	} else {
+		// Compare chain: test each value in source order
+		for _, value := range values {
+			cg.generateCompareImmediate(value)
+			cg.output.WriteString(fmt.Sprintf("    je %s\n", targets[value]))
 		}
-	case *parser.CallExpression:
-		// Collect strings from function call arguments
-		for _, arg := range e.Arguments {
-			cg.collectStringsFromExpression(arg)
+		cg.output.WriteString(fmt.Sprintf("    jmp %s\n", defaultLabel))
+	}
+
+	for i, c := range stmt.Cases {
+		cg.output.WriteString(fmt.Sprintf("%s:\n", caseLabels[i]))
+		cg.generateScopedBlock(c.Body)
+		cg.output.WriteString(fmt.Sprintf("    jmp %s\n", endLabel))
+	}
+	if stmt.Default != nil {
+		cg.output.WriteString(fmt.Sprintf("%s:\n", defaultLabel))
+		cg.generateScopedBlock(stmt.Default)
+	}
+	cg.output.WriteString(fmt.Sprintf("%s:\n", endLabel))
+}
+
+// denseRange reports whether values are numerous and packed enough for a jump table
+func denseRange(values []int64) (low int64, high int64, dense bool) {
+	if len(values) < jumpTableMinCases {
+		return 0, 0, false
+	}
+	low, high = values[0], values[0]
+	for _, v := range values {
+		if v < low {
+			low = v
+		}
+		if v > high {
+			high = v
 		}
 	}
+	// The span of low..high can exceed MaxInt64, but always fits a uint64
+	span := uint64(high) - uint64(low)
+	// At least half of the table slots must be real cases
+	return low, high, span < jumpTableMaxRange && span < uint64(2*len(values))
 }
 
-func (cg *CodeGenerator) getStringLabel(literal string) string {
-	if label, exists := cg.stringConstants[literal]; exists {
-		return label
+// generateJumpTable dispatches on rax through a table covering low..high
+func (cg *CodeGenerator) generateJumpTable(low int64, high int64, targets map[int64]string, defaultLabel string) {
+	tableLabel := cg.newLabel("match_table")
+
+	cg.output.WriteString(fmt.Sprintf("    # Jump table for cases %d..%d\n", low, high))
+	if low != 0 {
+		cg.output.WriteString(fmt.Sprintf("    mov rcx, %d\n", low))
+		cg.output.WriteString("    sub rax, rcx\n")
+	}
+	// Unsigned compare also sends values below low to the default arm
+	span := uint64(high) - uint64(low)
+	cg.output.WriteString(fmt.Sprintf("    cmp rax, %d\n", span))
+	cg.output.WriteString(fmt.Sprintf("    ja %s\n", defaultLabel))
+	cg.output.WriteString(fmt.Sprintf("    jmp qword ptr [%s + rax*8]\n", tableLabel))
+
+	cg.output.WriteString("    .pushsection .rodata\n")
+	cg.output.WriteString("    .balign 8\n")
+	cg.output.WriteString(fmt.Sprintf("%s:\n", tableLabel))
+	// Counting by offset, as v++ would wrap past MaxInt64 and never end
+	for off := uint64(0); off <= span; off++ {
+		target, ok := targets[low+int64(off)]
+		if !ok {
+			target = defaultLabel
+		}
+		cg.output.WriteString(fmt.Sprintf("    .quad %s\n", target))
 	}
+	cg.output.WriteString("    .popsection\n")
+}
 
-	label := fmt.Sprintf("str_%d", cg.stringCounter)
-	cg.stringConstants[literal] = label
-	cg.stringCounter++
-	return label
+// generateCompareImmediate compares rax against value, which may not fit an imm32
+func (cg *CodeGenerator) generateCompareImmediate(value int64) {
+	if value >= math.MinInt32 && value <= math.MaxInt32 {
+		cg.output.WriteString(fmt.Sprintf("    cmp rax, %d\n", value))
+		return
+	}
+	cg.output.WriteString(fmt.Sprintf("    mov rcx, %d\n", value))
+	cg.output.WriteString("    cmp rax, rcx\n")
 }
 
-func (cg *CodeGenerator) getStringFromLabel(labelName string) (string, bool) {
-	// Reverse lookup: find the string content for a given label
-	for content, label := range cg.stringConstants {
-		if label == labelName {
-			return content, true
+func (cg *CodeGenerator) generateForStatement(stmt *parser.ForStatement) {
+	startLabel := cg.newLabel("for_start")
+	continueLabel := cg.newLabel("for_continue")
+	endLabel := cg.newLabel("for_end")
+
+	// Variables introduced by the loop are only visible inside it
+	cg.pushScope()
+
+	if init, ok := stmt.Init.(*parser.AssignStatement); ok && (init.Index != nil || init.Field != nil) {
+		cg.generateAssignStatement(init)
+	} else if ok {
+		if v, exists := cg.lookupVariable(init.Name); exists && v.Constant != nil {
+			cg.errorAt(init.Token, ErrAssignConstant, "cannot assign to constant %s", init.Name)
 		}
+		// The loop variable always gets its own slot so it can't clobber an outer one
+		cg.output.WriteString(fmt.Sprintf("    # %s = %s (loop variable)\n", init.Name, comment(init.Value)))
+		typ, literal := cg.generateValue(init.Value, "")
+		v := cg.allocateVariable(init.Name, typ)
+		v.Declaration = init.Token
+		cg.refer(init.Token, v)
+		cg.storeValue(init.Name, v.place(), literal)
 	}
-	return "", false
+
+	cg.output.WriteString(fmt.Sprintf("%s:\n", startLabel))
+	if stmt.Condition != nil {
+		cg.output.WriteString(fmt.Sprintf("    # loop while %s\n", comment(stmt.Condition)))
+		cg.generateExpression(stmt.Condition)
+		cg.output.WriteString("    test rax, rax\n")
+		cg.output.WriteString(fmt.Sprintf("    je %s\n", endLabel))
+	}
+
+	cg.generateLoopBody(stmt.Label, stmt.Body, endLabel, continueLabel)
+
+	cg.output.WriteString(fmt.Sprintf("%s:\n", continueLabel))
+	if post, ok := stmt.Post.(*parser.AssignStatement); ok {
+		cg.generateAssignStatement(post)
+	}
+	cg.output.WriteString(fmt.Sprintf("    jmp %s\n", startLabel))
+	cg.output.WriteString(fmt.Sprintf("%s:\n", endLabel))
+
+	cg.popScope()
 }
 
-func (cg *CodeGenerator) generateInfixExpression(expr *parser.InfixExpression, variables map[string]string) string {
-	// For now, only handle integer addition
-	if expr.Operator != "+" {
-		// TODO: Support other operators like -, *, /
-		return ""
+func (cg *CodeGenerator) generateAssignStatement(stmt *parser.AssignStatement) {
+	if stmt.Index != nil {
+		cg.generateElementAssign(stmt)
+		return
+	}
+	if stmt.Field != nil {
+		cg.generateFieldAssign(stmt)
+		return
 	}
 
-	// Evaluate left operand
-	var leftValue int64
-	switch left := expr.Left.(type) {
-	case *parser.IntegerLiteral:
-		leftValue = left.Value
-	case *parser.Identifier:
-		// Look up variable value - for now assume it's an integer stored as string
-		if label, exists := variables[left.Value]; exists {
-			if content, found := cg.getStringFromLabel(label); found {
-				if val, err := strconv.ParseInt(content, 10, 64); err == nil {
-					leftValue = val
-				}
-			}
+	cg.output.WriteString(fmt.Sprintf("    # %s = %s\n", stmt.Name, comment(stmt.Value)))
+	if stmt.Name == "_" {
+		// The value is only computed, for what computing it does
+		if typ, literal := cg.generateValue(stmt.Value, ""); literal {
+			cg.output.WriteString(fmt.Sprintf("    add rsp, %d        # discard it\n", 8*cg.slots(typ)))
 		}
+		return
+	}
+	want := ""
+	if v, exists := cg.lookupVariable(stmt.Name); exists {
+		want = v.Type
+	}
+	typ, literal := cg.generateValue(stmt.Value, want)
+	cg.assignVariable(stmt.Token, stmt.Name, typ, literal)
+}
+
+// assignVariable stores what generateValue left behind, a value of type typ,
+// in the variable name, which is declared with that type on first use
+func (cg *CodeGenerator) assignVariable(tok lexer.Token, name string, typ string, literal bool) {
+	if v, exists := cg.lookupVariable(name); exists && v.Constant != nil {
+		cg.errorAt(tok, ErrAssignConstant, "cannot assign to constant %s", name)
+		return
+	} else if exists {
+		typ = cg.convert(typ, v.Type)
+	}
+	if v, exists := cg.lookupVariable(name); exists && v.Type != typ && (v.Declared || cg.isAggregate(v.Type) || cg.isAggregate(typ)) || typ == nilType || typ == errorType {
+		// The type pass has reported it
+		return
+	}
+	if _, exists := cg.lookupVariable(name); !exists {
+		cg.checkStrict(tok, name)
+	}
+	v := cg.declareVariable(name, typ)
+	if v.Declaration.Line == 0 {
+		v.Declaration = tok
+	}
+	cg.refer(tok, v)
+	if v.Unwrapped {
+		// Its slot still holds an optional
+		cg.box()
+	}
+	cg.storeValue(name, v.place(), literal)
+}
+
+func (cg *CodeGenerator) generateVarStatement(stmt *parser.VarStatement) {
+	// Shadowing a variable of an enclosing block is fine, redeclaring one is not
+	if _, exists := cg.current.scopes[len(cg.current.scopes)-1][stmt.Name]; exists {
+		cg.errorAt(stmt.Token, ErrAlreadyDeclared, "variable %s is already defined in this block", stmt.Name)
+		return
+	}
+	declared, ok := cg.resolveType(stmt)
+	if !ok {
+		bindPoisoned(cg.current.scopes[len(cg.current.scopes)-1], stmt)
+		return
+	}
+
+	cg.output.WriteString(fmt.Sprintf("    # %s\n", comment(stmt)))
+	if stmt.Value != nil {
+		typ, literal := cg.generateValue(stmt.Value, declared)
+		typ = cg.convert(typ, declared)
+		// The variable has its declared type even if the value is wrong
+		v := cg.allocateVariable(stmt.Name, declared)
+		v.Declared = true
+		v.Declaration = stmt.Token
+		if typ != declared {
+			// The type pass has reported it
+			return
+		}
+		cg.refer(stmt.Token, v)
+		cg.storeValue(stmt.Name, v.place(), literal)
+		return
+	}
+
+	// Without a value, every element or field starts out as the zero value
+	v := cg.allocateVariable(stmt.Name, declared)
+	v.Declared = true
+	v.Declaration = stmt.Token
+	cg.refer(stmt.Token, v)
+	cg.storeZero(stmt.Name, v.place())
+}
+
+func (cg *CodeGenerator) generateCallStatement(stmt *parser.CallStatement) {
+	switch stmt.Function {
+	case "Print":
+		if len(stmt.Arguments) > 0 {
+			cg.generatePrint(stmt.Token, stmt.Arguments[0])
+		}
+	case "Return":
+		cg.generateReturn(stmt.Token, stmt.Arguments)
 	default:
-		// Unsupported left operand type
-		return ""
+		call := cg.callOf(stmt)
+		if _, ok := cg.generateBuiltinCall(call); ok {
+			return
+		}
+		// User-defined function or method call
+		cg.generateCall(call)
+	}
+}
+
+func (cg *CodeGenerator) generatePrint(tok lexer.Token, arg parser.Expression) {
+	cg.output.WriteString(fmt.Sprintf("    # Print(%s)\n", comment(arg)))
+	if value, typ, ok := cg.evaluateConstant(arg); ok && typ == "String" {
+		cg.generatePrintConstant(value.String)
+		return
+	}
+	typ := cg.generateExpression(arg)
+	if cg.isAggregate(typ) || isSlice(typ) || cg.interfaces[typ] != nil {
+		cg.errorAt(tok, ErrTypeMismatch, "cannot Print %s", typ)
+	}
+	cg.checkUnwrapped(tok, arg, typ)
+	cg.output.WriteString("    mov rdi, rax\n")
+	switch {
+	case typ == "UInt64":
+		cg.requireRuntime("print_uint")
+		cg.output.WriteString("    call print_uint\n")
+	case isInteger(typ) && cg.optimization >= 1 && cg.isSmallInteger(arg, typ):
+		cg.requireRuntime("print_small_int")
+		cg.output.WriteString("    call print_small_int\n")
+	case isInteger(typ):
+		cg.output.WriteString("    call print_int\n")
+	case typ == "Char":
+		cg.requireRuntime("print_char")
+		cg.output.WriteString("    call print_char\n")
+	case typ == "Float":
+		cg.requireRuntime("float_to_string")
+		cg.output.WriteString("    call float_to_string\n")
+		cg.output.WriteString("    mov rdi, rax\n")
+		cg.output.WriteString("    call print_string\n")
+	default:
+		cg.output.WriteString("    call print_string\n")
+	}
+}
+
+func (cg *CodeGenerator) generateReturn(tok lexer.Token, args []parser.Expression) {
+	if cg.current.isEntry {
+		// Entry function: exit the program
+		if len(args) == 0 {
+			cg.output.WriteString("    # Return()\n")
+			cg.output.WriteString("    mov rdi, 0       # exit status\n")
+		} else if str, ok := args[0].(*parser.StringLiteral); ok {
+			// Legacy form: Return('0') uses the literal text as the exit code
+			cg.output.WriteString(fmt.Sprintf("    # Return(%s)\n", comment(str)))
+			cg.output.WriteString(fmt.Sprintf("    mov rdi, %s      # exit status\n", str.Value))
+		} else if ch, ok := args[0].(*parser.CharLiteral); ok && ch.Value >= '0' && ch.Value <= '9' {
+			// The same legacy form with a single digit, which is a Char
+			cg.output.WriteString(fmt.Sprintf("    # Return(%s)\n", comment(ch)))
+			cg.output.WriteString(fmt.Sprintf("    mov rdi, %c      # exit status\n", ch.Value))
+		} else {
+			cg.output.WriteString(fmt.Sprintf("    # Return(%s)\n", comment(args[0])))
+			cg.generateExpression(args[0])
+			cg.output.WriteString("    mov rdi, rax     # exit status\n")
+		}
+		cg.syscall("exit")
+		return
+	}
+
+	// Regular function: Int results by value, String results as an address, both in rax
+	if len(args) > 0 && cg.isAggregate(cg.current.returnType) {
+		cg.output.WriteString(fmt.Sprintf("    # Return(%s)\n", comment(args[0])))
+		cg.generateReturnAggregate(tok, args[0])
+	} else if len(args) > 0 {
+		cg.output.WriteString(fmt.Sprintf("    # Return(%s)\n", comment(args[0])))
+		cg.convert(cg.generateExpression(args[0]), cg.current.returnType)
+	} else if isResult(cg.current.returnType) {
+		cg.output.WriteString("    xor eax, eax     # success\n")
+	}
+	cg.generateEpilogue()
+}
+
+// isUndefinedType reports whether typ is a name that no declaration gives a
+// type, which has already been reported where it was written
+func (cg *CodeGenerator) isUndefinedType(typ string) bool {
+	return isIdentifier(typ) && !isScalar(typ) && typ != "Void" && !cg.isAggregate(typ) && cg.interfaces[typ] == nil
+}
+
+// voidIfNone names the return type of a function declared without one
+func voidIfNone(typ string) string {
+	if typ == "" {
+		return "Void"
+	}
+	return typ
+}
+
+// generateCall emits a call to a user-defined function or method and
+// returns the type of its result
+func (cg *CodeGenerator) generateCall(call *parser.CallExpression) string {
+	tok, function, args := call.Token, call.Function, call.Arguments
+	if call.Receiver != nil {
+		symbol, ok := cg.resolveMethod(call)
+		if !ok {
+			return "Int"
+		}
+		// A method gets the address of its receiver as an implicit first argument
+		function = symbol
+		args = append([]parser.Expression{call.Receiver}, args...)
+	} else if _, ok := cg.generics[function]; ok {
+		symbol, ok := cg.instanceOf[call]
+		if !ok {
+			// The type pass has reported it
+			return "Int"
+		}
+		function = symbol
+	}
+	callee, ok := cg.functions[function]
+	if !ok {
+		// semant has reported it
+		cg.poisoned = true
+		return "Int"
+	}
+	cg.referFunction(tok, callee)
+	if callee.Attributes.Has("interrupt") {
+		cg.errorAt(tok, ErrAttribute, "cannot call interrupt handler %s", function)
+		return "Int"
+	}
+	cg.output.WriteString(fmt.Sprintf("    # Call %s\n", function))
+
+	// A variadic function gets its extra arguments as a single slice, which
+	// follows the fixed ones
+	fixed, extra, variadic := args, []parser.Expression(nil), cg.variadicParameter(function)
+	if variadic != nil {
+		first := len(cg.functions[function].Parameters) - 1
+		if call.Receiver != nil {
+			first++
+		}
+		if len(args) >= first {
+			fixed, extra = args[:first], args[first:]
+		} else {
+			variadic = nil
+		}
+	}
+
+	// Evaluate every argument before loading any register, so nested calls
+	// can't clobber arguments that were already computed
+	for i, arg := range fixed {
+		typ := cg.generateExpression(arg)
+		if param := cg.parameter(function, call.Receiver != nil, i); param != nil {
+			cg.convert(typ, param.Type)
+		}
+		cg.output.WriteString(fmt.Sprintf("    push rax         # argument %d\n", i+1))
+	}
+	count := len(fixed)
+	if variadic != nil {
+		cg.generateVariadicSlice(variadic, extra)
+		count++
+		cg.output.WriteString(fmt.Sprintf("    push rax         # argument %d\n", count))
+	}
+
+	if count <= len(argumentRegisters) {
+		for i := count - 1; i >= 0; i-- {
+			cg.output.WriteString(fmt.Sprintf("    pop %s\n", argumentRegisters[i]))
+		}
+		cg.callFunction(function, callee)
+	} else {
+		// Arguments past the sixth go on the stack with the seventh on top.
+		// They were pushed in source order, so copy them again in reverse;
+		// each copy moves the next original two slots further from rsp.
+		last := count - 1
+		stackArgs := count - len(argumentRegisters)
+		for i := last; i >= len(argumentRegisters); i-- {
+			cg.output.WriteString(fmt.Sprintf("    push qword ptr [rsp + %d]    # argument %d\n", 16*(last-i), i+1))
+		}
+		for i := range argumentRegisters {
+			cg.output.WriteString(fmt.Sprintf("    mov %s, [rsp + %d]\n", argumentRegisters[i], 8*(stackArgs+last-i)))
+		}
+		cg.callFunction(function, callee)
+		cg.output.WriteString(fmt.Sprintf("    add rsp, %d        # drop arguments\n", 8*(count+stackArgs)))
+	}
+
+	// The result is in rax, typed by the callee's declared return type
+	if fn, ok := cg.functions[function]; ok {
+		return fn.ReturnType
+	}
+	return "String"
+}
+
+// callFunction emits the call to function once its arguments are loaded,
+// through the vtable for a method of an interface
+func (cg *CodeGenerator) callFunction(function string, callee *parser.FunctionStatement) {
+	if callee.Receiver != nil {
+		if it, ok := cg.interfaces[callee.Receiver.Type]; ok {
+			cg.dispatch(function, it, callee.Name)
+			return
+		}
 	}
+	cg.output.WriteString(fmt.Sprintf("    call %s\n", function))
+}
+
+// parameter returns the declared parameter that argument i of a call to
+// function is passed as, or nil for a receiver or an unknown function
+func (cg *CodeGenerator) parameter(function string, method bool, i int) *parser.Parameter {
+	callee, ok := cg.functions[function]
+	if method {
+		i--
+	}
+	if !ok || i < 0 || i >= len(callee.Parameters) {
+		return nil
+	}
+	return callee.Parameters[i]
+}
+
+// variadicParameter returns the last parameter of function if it is
+// variadic, and nil otherwise
+func (cg *CodeGenerator) variadicParameter(function string) *parser.Parameter {
+	callee, ok := cg.functions[function]
+	if !ok || len(callee.Parameters) == 0 {
+		return nil
+	}
+	if last := callee.Parameters[len(callee.Parameters)-1]; last.Variadic {
+		return last
+	}
+	return nil
+}
 
-	// Evaluate right operand
-	var rightValue int64
-	switch right := expr.Right.(type) {
+// generateExpression emits code leaving the value of expr in rax and returns its type
+func (cg *CodeGenerator) generateExpression(expr parser.Expression) string {
+	switch e := expr.(type) {
+	case *parser.StringLiteral:
+		label := cg.getStringLabel(e.Value)
+		cg.output.WriteString(fmt.Sprintf("    lea rax, [%s]\n", label))
+		return "String"
 	case *parser.IntegerLiteral:
-		rightValue = right.Value
+		cg.output.WriteString(fmt.Sprintf("    mov rax, %d\n", e.Value))
+		return "Int"
+	case *parser.FloatLiteral:
+		cg.generateFloatLiteral(e.Value, comment(e))
+		return "Float"
+	case *parser.CharLiteral:
+		cg.output.WriteString(fmt.Sprintf("    mov rax, %d    # %s\n", e.Value, comment(e)))
+		return "Char"
+	case *parser.NilLiteral:
+		cg.output.WriteString("    xor eax, eax     # nil\n")
+		return nilType
 	case *parser.Identifier:
-		// Look up variable value
-		if label, exists := variables[right.Value]; exists {
-			if content, found := cg.getStringFromLabel(label); found {
-				if val, err := strconv.ParseInt(content, 10, 64); err == nil {
-					rightValue = val
-				}
-			}
+		v, exists := cg.lookupVariable(e.Value)
+		if !exists {
+			// semant has reported it
+			cg.poisoned = true
+			return "Int"
 		}
+		cg.refer(e.Token, v)
+		if v.Constant != nil {
+			cg.generateConstant(e.Value, v)
+			return v.Type
+		}
+		if cg.isAggregate(v.Type) {
+			// Arrays and structs are only ever copied, from the address of their first slot
+			cg.output.WriteString(fmt.Sprintf("    lea rax, [%s]    # address of %s\n", v.address(), e.Value))
+			return v.Type
+		}
+		cg.output.WriteString(fmt.Sprintf("    mov rax, [%s]    # load %s\n", v.address(), e.Value))
+		if v.Unwrapped {
+			cg.output.WriteString("    mov rax, [rax]   # the value held\n")
+		}
+		return v.Type
+	case *parser.ArrayLiteral:
+		cg.errorAt(e.Token, ErrArrayLiteral, "array literal can only be assigned to a variable")
+		return "Int"
+	case *parser.StructLiteral:
+		cg.errorAt(e.Token, ErrTypeMismatch, "struct literal can only be assigned to a variable or field")
+		return "Int"
+	case *parser.TupleLiteral:
+		cg.errorAt(e.Token, ErrTypeMismatch, "tuple can only be assigned, destructured or returned")
+		return "Int"
+	case *parser.FieldExpression:
+		return cg.generateFieldExpression(e)
+	case *parser.IndexExpression:
+		return cg.generateIndexExpression(e)
+	case *parser.SliceExpression:
+		return cg.generateSliceExpression(e)
+	case *parser.TypeExpression:
+		cg.errorAt(e.Token, ErrTypeMismatch, "type %s is not a value", e.Name)
+		return "Int"
+	case *parser.PrefixExpression:
+		return cg.generatePrefixExpression(e)
+	case *parser.InfixExpression:
+		return cg.generateInfixExpression(e)
+	case *parser.CallExpression:
+		if typ, ok := cg.loadResult(e); ok {
+			return typ
+		}
+		if typ, ok := cg.generateFoldedCall(e); ok {
+			return typ
+		}
+		if typ, ok := cg.generateBuiltinCall(e); ok {
+			return typ
+		}
+		return cg.generateCall(e)
 	default:
-		// Unsupported right operand type
-		return ""
+		cg.output.WriteString("    mov rax, 0       # unsupported expression\n")
+		return "Int"
 	}
+}
 
-	// Perform the addition
-	result := leftValue + rightValue
+// generateBuiltinCall emits builtins usable as expressions; ok is false for user functions
+func (cg *CodeGenerator) generateBuiltinCall(expr *parser.CallExpression) (typ string, ok bool) {
+	if expr.Receiver != nil {
+		// A method may share its name with a builtin
+		return "", false
+	}
+	switch expr.Function {
+	case "Matches":
+		cg.generateMatches(expr.Arguments)
+		return "Int", true
+	case "Peek":
+		cg.generatePeek(expr)
+		return "Int", true
+	case "Poke":
+		cg.generatePoke(expr)
+		return "Void", true
+	case "SizeOf", "AlignOf":
+		cg.generateLayout(expr)
+		return "Int", true
+	case "Ord":
+		cg.generateOrd(expr)
+		return "Int", true
+	case "Chr":
+		cg.generateChr(expr)
+		return "Char", true
+	case "Append":
+		cg.generateAppend(expr)
+		return "Void", true
+	case "Len":
+		cg.generateLen(expr)
+		return "Int", true
+	case "Error":
+		cg.generateError(expr)
+		return errorType, true
+	case "ParseInt":
+		cg.generateParseInt(expr)
+		return "Int!", true
+	case "Syscall":
+		cg.generateSyscall(expr)
+		return "Int", true
+	case "Try":
+		return cg.generateTry(expr), true
+	case "Panic":
+		cg.generatePanic(expr)
+		return "Void", true
+	}
+	if isConversion(cg.aliased(expr.Function)) {
+		return cg.generateConversion(expr), true
+	}
+	return "", false
+}
 
-	// Convert result to string and store it
-	resultStr := fmt.Sprintf("%d", result)
-	return cg.getStringLabel(resultStr)
+// generateMatches emits Matches(pattern, text), a glob match yielding 1 or 0
+func (cg *CodeGenerator) generateMatches(args []parser.Expression) {
+	cg.output.WriteString("    # Matches(pattern, text)\n")
+	if len(args) != 2 {
+		cg.output.WriteString("    mov rax, 0       # Matches expects a pattern and a text\n")
+		return
+	}
+
+	cg.convert(cg.generateExpression(args[0]), "String")
+	cg.output.WriteString("    push rax         # pattern\n")
+	cg.convert(cg.generateExpression(args[1]), "String")
+	cg.output.WriteString("    mov rsi, rax     # text\n")
+	cg.output.WriteString("    pop rdi\n")
+	cg.requireRuntime("glob_match")
+	cg.output.WriteString("    call glob_match\n")
 }
 
-func (cg *CodeGenerator) processString(s string) string {
-	// Handle basic escape sequences
-	s = strings.ReplaceAll(s, "\\n", "\\n")
-	s = strings.ReplaceAll(s, "\\t", "\\t")
-	s = strings.ReplaceAll(s, "\\r", "\\r")
-	s = strings.ReplaceAll(s, "\\\\", "\\\\")
-	s = strings.ReplaceAll(s, "\\\"", "\\\"")
-	return s
+// memoryOperands are the sizes a Peek or Poke can access, with the matching
+// operand size and the part of rcx that holds a value of that size
+var memoryOperands = map[int64]struct{ size, register string }{
+	1: {"byte", "cl"},
+	2: {"word", "cx"},
+	4: {"dword", "ecx"},
+	8: {"qword", "rcx"},
 }
 
-func (cg *CodeGenerator) generateFunction(funcStmt *parser.FunctionStatement) {
-	if !funcStmt.IsEntry {
-		// Generate function label
-		cg.output.WriteString(fmt.Sprintf("%s:\n", funcStmt.Name))
+// generatePeek reads width bytes at an address, zero-extended: Peek(address)
+// or Peek(address, width). Each Peek is exactly one access, never removed or
+// merged, so it can read memory-mapped device registers.
+func (cg *CodeGenerator) generatePeek(expr *parser.CallExpression) {
+	if len(expr.Arguments) < 1 || len(expr.Arguments) > 2 {
+		cg.errorAt(expr.Token, ErrBuiltinArguments, "Peek expects an address and an optional width")
+		return
+	}
+	width := cg.memoryWidth(expr, expr.Arguments[1:])
+
+	cg.output.WriteString(fmt.Sprintf("    # %s\n", comment(expr)))
+	cg.generateAddress(expr, expr.Arguments[0])
+	switch width {
+	case 8:
+		cg.output.WriteString("    mov rax, qword ptr [rax]    # volatile read\n")
+	case 4:
+		// Writing eax clears the upper half of rax
+		cg.output.WriteString("    mov eax, dword ptr [rax]    # volatile read\n")
+	default:
+		cg.output.WriteString(fmt.Sprintf("    movzx eax, %s ptr [rax]    # volatile read\n", memoryOperands[width].size))
+	}
+}
 
-		// Set up stack frame for regular functions
-		cg.output.WriteString("    push rbp\n")
-		cg.output.WriteString("    mov rbp, rsp\n")
+// generatePoke writes the low width bytes of a value to an address:
+// Poke(address, value) or Poke(address, value, width). Like Peek, every Poke
+// is exactly one memory access.
+func (cg *CodeGenerator) generatePoke(expr *parser.CallExpression) {
+	if len(expr.Arguments) < 2 || len(expr.Arguments) > 3 {
+		cg.errorAt(expr.Token, ErrBuiltinArguments, "Poke expects an address, a value and an optional width")
+		return
 	}
+	width := cg.memoryWidth(expr, expr.Arguments[2:])
 
-	// Generate function body
-	cg.generateBlockStatementWithParams(funcStmt.Body, funcStmt.IsEntry, funcStmt.Parameters)
+	cg.output.WriteString(fmt.Sprintf("    # %s\n", comment(expr)))
+	cg.generateAddress(expr, expr.Arguments[0])
+	cg.output.WriteString("    push rax         # address\n")
+	if typ := cg.generateExpression(expr.Arguments[1]); !isInteger(typ) {
+		cg.errorAt(expr.Token, ErrTypeMismatch, "Poke value must be Int, got %s", typ)
+	}
+	cg.output.WriteString("    mov rcx, rax\n")
+	cg.output.WriteString("    pop rax\n")
+	operand := memoryOperands[width]
+	cg.output.WriteString(fmt.Sprintf("    mov %s ptr [rax], %s    # volatile write\n", operand.size, operand.register))
+}
 
-	if !funcStmt.IsEntry {
-		// Default return for regular functions
-		cg.output.WriteString("    # Default function return\n")
-		cg.output.WriteString("    mov rsp, rbp\n")
-		cg.output.WriteString("    pop rbp\n")
-		cg.output.WriteString("    ret\n")
-	} else {
-		// Default exit for Entry function
-		cg.output.WriteString("    # Default exit\n")
-		cg.output.WriteString("    mov rax, 60      # sys_exit\n")
-		cg.output.WriteString("    mov rdi, 0       # exit status\n")
-		cg.output.WriteString("    syscall\n")
+// generateAddress evaluates the address argument of Peek or Poke into rax
+func (cg *CodeGenerator) generateAddress(expr *parser.CallExpression, address parser.Expression) {
+	if typ := cg.generateExpression(address); !isInteger(typ) {
+		cg.errorAt(expr.Token, ErrTypeMismatch, "%s address must be Int, got %s", expr.Function, typ)
 	}
 }
 
-func (cg *CodeGenerator) generateBlockStatementWithParams(block *parser.BlockStatement, isEntry bool, params []*parser.Parameter) {
-	variables := make(map[string]string) // variable name -> label/register
+// memoryWidth returns the access width given by the optional argument of
+// Peek or Poke, which must be a constant 1, 2, 4 or 8; the default is 8
+func (cg *CodeGenerator) memoryWidth(expr *parser.CallExpression, args []parser.Expression) int64 {
+	if len(args) == 0 {
+		return 8
+	}
+	width, typ, ok := cg.evaluateConstant(args[0])
+	if _, valid := memoryOperands[width.Int]; !ok || typ != "Int" || !valid {
+		cg.errorAt(expr.Token, ErrBuiltinArguments, "%s width must be a constant 1, 2, 4 or 8", expr.Function)
+		return 8
+	}
+	return width.Int
+}
 
-	// Set up parameters as variables
-	// In x86-64 calling convention, first parameter is in rdi
-	for i, param := range params {
-		if i == 0 {
-			if param.Type == "Int" {
-				// Integer parameter: save value from rdi to r15 (callee-saved register)
-				cg.output.WriteString(fmt.Sprintf("    # Save integer parameter %s from rdi to r15\n", param.Name))
-				cg.output.WriteString("    mov r15, rdi     # save integer parameter in callee-saved register\n")
-				// Create a special marker to indicate this is an integer parameter in r15
-				variables[param.Name] = "INT_PARAM_R15"
-			} else {
-				// String parameter: address is in rdi register
-				paramLabel := fmt.Sprintf("param_%s", param.Name)
-				variables[param.Name] = paramLabel
-				cg.output.WriteString(fmt.Sprintf("    # String parameter %s address available in rdi\n", param.Name))
-			}
-		} else {
-			cg.output.WriteString(fmt.Sprintf("    # TODO: Multiple parameters not yet implemented (param %s)\n", param.Name))
+func (cg *CodeGenerator) generatePrefixExpression(expr *parser.PrefixExpression) string {
+	typ := cg.generateExpression(expr.Right)
+	if typ == "Char" {
+		cg.errorAt(expr.Token, ErrTypeMismatch, "cannot apply %s to Char", expr.Operator)
+		return "Int"
+	}
+	if typ == "Float" {
+		if expr.Operator != "-" {
+			cg.errorAt(expr.Token, ErrTypeMismatch, "cannot apply %s to Float", expr.Operator)
+			return "Int"
 		}
+		cg.output.WriteString("    btc rax, 63      # flip the sign bit\n")
+		return "Float"
 	}
 
-	for _, stmt := range block.Statements {
-		switch s := stmt.(type) {
-		case *parser.AssignStatement:
-			cg.generateAssignStatement(s, variables)
-		case *parser.CallStatement:
-			cg.generateCallStatement(s, variables, isEntry)
+	switch expr.Operator {
+	case "-":
+		cg.output.WriteString("    neg rax\n")
+		cg.wrapInteger(typ)
+		return typ
+	case "!":
+		// Logical not: 1 if the operand is zero, 0 otherwise
+		cg.output.WriteString("    xor ecx, ecx\n")
+		cg.output.WriteString("    test rax, rax\n")
+		cg.output.WriteString("    sete cl\n")
+		cg.output.WriteString("    mov rax, rcx\n")
+	}
+
+	return "Int"
+}
+
+// setInstructions maps comparison operators to the signed setcc instruction
+var setInstructions = map[string]string{
+	"==": "sete",
+	"!=": "setne",
+	"<":  "setl",
+	">":  "setg",
+	"<=": "setle",
+	">=": "setge",
+}
+
+func (cg *CodeGenerator) generateInfixExpression(expr *parser.InfixExpression) string {
+	if expr.Operator == "??" {
+		return cg.generateDefault(expr)
+	}
+	if cg.generateLowered(expr) {
+		return "Int"
+	}
+
+	// Evaluate left operand and keep it on the stack while the right one is computed
+	leftType := cg.generateExpression(expr.Left)
+	cg.output.WriteString("    push rax\n")
+	rightType := cg.generateExpression(expr.Right)
+	cg.output.WriteString("    mov rcx, rax\n")
+	cg.output.WriteString("    pop rax\n")
+
+	if cg.isAggregate(leftType) || cg.isAggregate(rightType) || isSlice(leftType) || isSlice(rightType) {
+		cg.errorAt(expr.Token, ErrTypeMismatch, "cannot apply %s to %s and %s", expr.Operator, leftType, rightType)
+		return "Int"
+	}
+	if isResult(leftType) {
+		cg.checkResult(expr.Token, expr.Left, leftType)
+		return "Int"
+	} else if isResult(rightType) {
+		cg.checkResult(expr.Token, expr.Right, rightType)
+		return "Int"
+	}
+	if isOptional(leftType) || isOptional(rightType) {
+		return cg.generateOptionalInfix(expr, leftType, rightType)
+	}
+	if leftType == "String" || rightType == "String" {
+		if expr.Operator == "+" {
+			leftType, rightType = cg.convertOperands(leftType, rightType, "String")
+		}
+		if expr.Operator != "+" || leftType != rightType {
+			cg.errorAt(expr.Token, ErrTypeMismatch, "cannot apply %s to %s and %s", expr.Operator, leftType, rightType)
+			return "Int"
 		}
+		// String concatenation builds a new heap string
+		cg.output.WriteString("    mov rdi, rax\n")
+		cg.output.WriteString("    mov rsi, rcx\n")
+		cg.requireRuntime("str_concat")
+		cg.output.WriteString("    call str_concat\n")
+		return "String"
 	}
+	if leftType == "Float" || rightType == "Float" {
+		if leftType != rightType || expr.Operator == "%" {
+			cg.errorAt(expr.Token, ErrTypeMismatch, "cannot apply %s to %s and %s", expr.Operator, leftType, rightType)
+			return "Int"
+		}
+		return cg.generateFloatInfix(expr.Token, expr.Operator)
+	}
+	if leftType == "Char" || rightType == "Char" {
+		if _, comparison := setInstructions[expr.Operator]; !comparison || leftType != rightType {
+			cg.errorAt(expr.Token, ErrTypeMismatch, "cannot apply %s to %s and %s", expr.Operator, leftType, rightType)
+			return "Int"
+		}
+	}
+
+	result := integerResult(leftType, rightType)
+	switch expr.Operator {
+	case "+":
+		cg.output.WriteString("    add rax, rcx\n")
+	case "-":
+		cg.output.WriteString("    sub rax, rcx\n")
+	case "*":
+		// The low 64 bits of a product are the same signed or unsigned
+		cg.output.WriteString("    imul rax, rcx\n")
+	case "/", "%":
+		if value, typ, ok := cg.evaluateConstant(expr.Right); ok && isInteger(typ) && value.Int == 0 {
+			cg.errorAt(expr.Token, ErrDivisionByZero, "division by zero")
+		}
+		cg.generateDivision(expr.Operator, result)
+	case "==", "!=", "<", ">", "<=", ">=":
+		// Comparisons produce 1 when true, 0 when false
+		set := setInstructions[expr.Operator]
+		if result == "UInt64" {
+			set = unsignedSetInstructions[expr.Operator]
+		}
+		cg.output.WriteString("    cmp rax, rcx\n")
+		cg.output.WriteString(fmt.Sprintf("    %s al\n", set))
+		cg.output.WriteString("    movzx rax, al\n")
+		return "Int"
+	}
+
+	cg.wrapInteger(result)
+	return result
 }
 
-func (cg *CodeGenerator) generateStrlenFunction() {
-	cg.output.WriteString("# strlen function - calculates length of null-terminated string\n")
-	cg.output.WriteString("# Input: rdi = string address\n")
-	cg.output.WriteString("# Output: rax = string length\n")
-	cg.output.WriteString("strlen:\n")
-	cg.output.WriteString("    push rbp\n")
-	cg.output.WriteString("    mov rbp, rsp\n")
-	cg.output.WriteString("    mov rax, 0       # length counter\n")
-	cg.output.WriteString("strlen_loop:\n")
-	cg.output.WriteString("    cmp byte ptr [rdi + rax], 0  # check for null terminator\n")
-	cg.output.WriteString("    je strlen_done   # if null, we're done\n")
-	cg.output.WriteString("    inc rax          # increment length\n")
-	cg.output.WriteString("    jmp strlen_loop  # continue loop\n")
-	cg.output.WriteString("strlen_done:\n")
-	cg.output.WriteString("    mov rsp, rbp\n")
-	cg.output.WriteString("    pop rbp\n")
-	cg.output.WriteString("    ret\n\n")
+// comment renders a node for use in a single-line assembly comment
+func comment(expr parser.Node) string {
+	return strings.ReplaceAll(expr.String(), "\n", "\\n")
+}
+
+func (cg *CodeGenerator) getStringLabel(literal string) string {
+	if label, exists := cg.stringConstants[literal]; exists {
+		return label
+	}
+
+	label := fmt.Sprintf("str_%d", cg.stringCounter)
+	cg.stringConstants[literal] = label
+	cg.stringLabels = append(cg.stringLabels, literal)
+	cg.stringCounter++
+	return label
 }
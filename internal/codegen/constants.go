@@ -0,0 +1,213 @@
+package codegen
+
+import (
+	"fmt"
+	"math"
+
+	"dreadlang/internal/parser"
+)
+
+// constant is the compile-time value of a Const name
+type constant struct {
+	Int    int64
+	Float  float64
+	String string
+}
+
+// defineConstant evaluates a Const statement and binds its name in scope,
+// which is the innermost block or, outside any function, the file scope
+func (cg *CodeGenerator) defineConstant(stmt *parser.ConstStatement, scope map[string]*variable) {
+	if _, exists := scope[stmt.Name]; exists {
+		cg.errorAt(stmt.Token, ErrAlreadyDeclared, "constant %s is already defined in this block", stmt.Name)
+		return
+	}
+	value, typ, ok := cg.evaluateConstant(stmt.Value)
+	if !ok && cg.dividesByZero(stmt.Value) {
+		cg.errorAt(stmt.Token, ErrDivisionByZero, "value of Const %s divides by zero", stmt.Name)
+		return
+	}
+	if !ok {
+		cg.errorAt(stmt.Token, ErrNotConstant, "value of Const %s must be known at compile time", stmt.Name)
+		return
+	}
+	scope[stmt.Name] = &variable{Type: typ, Constant: &value, Declaration: stmt.Token}
+	cg.refer(stmt.Token, scope[stmt.Name])
+}
+
+// dividesByZero reports whether expr divides an integer by a constant zero,
+// which evaluateConstant leaves unfolded
+func (cg *CodeGenerator) dividesByZero(expr parser.Expression) bool {
+	switch e := expr.(type) {
+	case *parser.PrefixExpression:
+		return cg.dividesByZero(e.Right)
+	case *parser.InfixExpression:
+		if e.Operator == "/" || e.Operator == "%" {
+			if value, typ, ok := cg.evaluateConstant(e.Right); ok && isInteger(typ) && value.Int == 0 {
+				return true
+			}
+		}
+		return cg.dividesByZero(e.Left) || cg.dividesByZero(e.Right)
+	}
+	return false
+}
+
+// evaluateConstant folds expressions built from literals and other constants
+func (cg *CodeGenerator) evaluateConstant(expr parser.Expression) (constant, string, bool) {
+	switch e := expr.(type) {
+	case *parser.IntegerLiteral:
+		return constant{Int: e.Value}, "Int", true
+	case *parser.FloatLiteral:
+		return constant{Float: e.Value}, "Float", true
+	case *parser.CharLiteral:
+		return constant{Int: int64(e.Value)}, "Char", true
+	case *parser.StringLiteral:
+		return constant{String: e.Value}, "String", true
+	case *parser.Identifier:
+		v, exists := cg.lookupFolded(e.Value)
+		if !exists || v.Constant == nil {
+			return constant{}, "", false
+		}
+		if !cg.inEvaluatedBody() {
+			cg.refer(e.Token, v)
+		}
+		return *v.Constant, v.Type, true
+	case *parser.PrefixExpression:
+		right, typ, ok := cg.evaluateConstant(e.Right)
+		if ok && typ == "Float" && e.Operator == "-" {
+			return constant{Float: -right.Float}, "Float", true
+		}
+		if !ok || !isInteger(typ) {
+			return constant{}, "", false
+		}
+		if e.Operator == "-" {
+			return constant{Int: wrapConstant(-right.Int, typ)}, typ, true
+		}
+		return constant{Int: boolInt(right.Int == 0)}, "Int", true
+	case *parser.InfixExpression:
+		left, leftType, ok := cg.evaluateConstant(e.Left)
+		if !ok {
+			return constant{}, "", false
+		}
+		right, rightType, ok := cg.evaluateConstant(e.Right)
+		if !ok {
+			return constant{}, "", false
+		}
+		if isInteger(leftType) && isInteger(rightType) {
+			return foldInfix(e.Operator, left.Int, right.Int, integerResult(leftType, rightType))
+		}
+		if e.Operator == "+" && (leftType == "String" || rightType == "String") {
+			left, leftType = constantString(left, leftType)
+			right, rightType = constantString(right, rightType)
+		}
+		if leftType != rightType || leftType == "Char" && (e.Operator == "+" || e.Operator == "-") {
+			return constant{}, "", false
+		}
+		if leftType == "String" {
+			if e.Operator != "+" {
+				return constant{}, "", false
+			}
+			return constant{String: left.String + right.String}, "String", true
+		}
+		if leftType == "Float" {
+			return foldFloatInfix(e.Operator, left.Float, right.Float)
+		}
+		return foldInfix(e.Operator, left.Int, right.Int, leftType)
+	case *parser.CallExpression:
+		if value, typ, ok := cg.evaluateCharConversion(e); ok {
+			return value, typ, true
+		}
+		if value, typ, ok := cg.evaluateConversion(e); ok {
+			return value, typ, true
+		}
+		if value, ok := cg.evaluateLen(e); ok {
+			return constant{Int: value}, "Int", true
+		}
+		if cg.evaluating != nil {
+			// Only in a call evaluateCall has started
+			if value, typ, ok := cg.evaluateCall(e); ok {
+				return value, typ, true
+			}
+		}
+		value, ok := cg.evaluateLayout(e)
+		return constant{Int: value}, "Int", ok
+	default:
+		return constant{}, "", false
+	}
+}
+
+// constantString converts a Char constant to a one-character String, the
+// way a Char is added to a String at run time
+func constantString(c constant, typ string) (constant, string) {
+	if typ != "Char" {
+		return c, typ
+	}
+	return constant{String: string([]byte{byte(c.Int)})}, "String"
+}
+
+// convertConstant converts a constant to want the way convert does at run
+// time, and returns its new type
+func convertConstant(c constant, typ string, want string) (constant, string) {
+	switch {
+	case typ == "Char" && want == "String":
+		return constantString(c, typ)
+	case typ != want && isInteger(typ) && isInteger(want):
+		return constant{Int: wrapConstant(c.Int, want)}, want
+	}
+	return c, typ
+}
+
+// foldInfix folds an operator on two integers, or Chars, whose arithmetic
+// gives typ
+func foldInfix(operator string, left, right int64, typ string) (constant, string, bool) {
+	if operator == "/" || operator == "%" {
+		return foldDivision(operator, left, right, typ)
+	}
+	if operator == "*" {
+		return constant{Int: wrapConstant(left*right, typ)}, typ, true
+	}
+	if typ == "UInt64" {
+		// Only the order of UInt64 values differs from that of Ints
+		left, right = left^math.MinInt64, right^math.MinInt64
+	}
+	switch operator {
+	case "+":
+		return constant{Int: wrapConstant(left+right, typ)}, typ, true
+	case "-":
+		return constant{Int: wrapConstant(left-right, typ)}, typ, true
+	case "==":
+		return constant{Int: boolInt(left == right)}, "Int", true
+	case "!=":
+		return constant{Int: boolInt(left != right)}, "Int", true
+	case "<":
+		return constant{Int: boolInt(left < right)}, "Int", true
+	case ">":
+		return constant{Int: boolInt(left > right)}, "Int", true
+	case "<=":
+		return constant{Int: boolInt(left <= right)}, "Int", true
+	case ">=":
+		return constant{Int: boolInt(left >= right)}, "Int", true
+	default:
+		return constant{}, "", false
+	}
+}
+
+// generateConstant loads a folded constant into rax
+func (cg *CodeGenerator) generateConstant(name string, v *variable) {
+	if v.Type == "String" {
+		label := cg.getStringLabel(v.Constant.String)
+		cg.output.WriteString(fmt.Sprintf("    lea rax, [%s]    # constant %s\n", label, name))
+		return
+	}
+	if v.Type == "Float" {
+		cg.generateFloatLiteral(v.Constant.Float, "constant "+name)
+		return
+	}
+	cg.output.WriteString(fmt.Sprintf("    mov rax, %d    # constant %s\n", v.Constant.Int, name))
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,291 @@
+package codegen
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"dreadlang/internal/parser"
+)
+
+// Conversions are written as a call of the type to convert to: Int(x),
+// Float(x), String(x), Char(x), or a sized integer type such as UInt8(x).
+// Integers convert to each other by wrapping, Floats to integers by
+// truncating toward zero, and Strings to integers by reading a decimal
+// number at their start. ParseInt(s) reads all of s strictly instead, as an
+// Int! that holds an error when s is not a decimal number in range.
+
+// isConversion reports whether a call of function converts to that type
+func isConversion(function string) bool {
+	return isInteger(function) || function == "Float" || function == "String" || function == "Char"
+}
+
+// generateConversion emits a conversion and returns the type converted to
+func (cg *CodeGenerator) generateConversion(expr *parser.CallExpression) string {
+	to := cg.aliased(expr.Function)
+	if len(expr.Arguments) != 1 {
+		cg.errorAt(expr.Token, ErrBuiltinArguments, "%s expects one value to convert", to)
+		return to
+	}
+	if value, typ, ok := cg.evaluateConstant(expr.Arguments[0]); ok && typ == "String" && isInteger(to) {
+		if _, err := parseIntConstant(value.String); err != nil {
+			cg.errorAt(expr.Token, ErrBuiltinArguments, "cannot convert %q to %s: %v", string(stringBytes(value.String)), to, err)
+			return to
+		}
+	}
+
+	from := cg.generateExpression(expr.Arguments[0])
+	switch {
+	case from == to:
+	case isInteger(to) && (isInteger(from) || from == "Char"):
+		cg.wrapInteger(to)
+	case isInteger(to) && from == "Float":
+		cg.sse(expr.Token, "movq", "xmm0", "rax")
+		cg.sse(expr.Token, "cvttsd2si", "rax", "xmm0") // truncates toward zero
+		cg.wrapInteger(to)
+	case isInteger(to) && from == "String":
+		cg.requireRuntime("parse_int")
+		cg.output.WriteString("    mov rdi, rax\n")
+		cg.output.WriteString("    call parse_int\n")
+		cg.wrapInteger(to)
+	case to == "Float" && isInteger(from):
+		cg.sse(expr.Token, "cvtsi2sd", "xmm0", "rax")
+		cg.sse(expr.Token, "movq", "rax", "xmm0")
+	case to == "String" && isInteger(from):
+		cg.requireRuntime("int_to_string")
+		cg.output.WriteString("    mov rdi, rax\n")
+		if from == "UInt64" {
+			cg.output.WriteString("    call uint_to_string\n")
+		} else {
+			cg.output.WriteString("    call int_to_string\n")
+		}
+	case to == "String" && from == "Float":
+		cg.requireRuntime("float_to_string")
+		cg.output.WriteString("    mov rdi, rax\n")
+		cg.output.WriteString("    call float_to_string\n")
+	case to == "String" && from == "Char":
+		cg.convert(from, to)
+	case to == "Char" && isInteger(from):
+		cg.output.WriteString("    movzx eax, al    # keep the low byte\n")
+	default:
+		cg.errorAt(expr.Token, ErrTypeMismatch, "cannot convert %s to %s", from, to)
+	}
+	return to
+}
+
+// generateParseInt emits ParseInt(text), an Int! holding the decimal number
+// text is made of, or an error when it is not one
+func (cg *CodeGenerator) generateParseInt(expr *parser.CallExpression) {
+	if len(expr.Arguments) != 1 {
+		cg.errorAt(expr.Token, ErrBuiltinArguments, "ParseInt expects one String to read")
+		return
+	}
+	cg.output.WriteString(fmt.Sprintf("    # %s\n", comment(expr)))
+	if typ := cg.convert(cg.generateExpression(expr.Arguments[0]), "String"); typ != "String" {
+		cg.errorAt(expr.Token, ErrTypeMismatch, "ParseInt expects a String, got %s", typ)
+	}
+	cg.requireRuntime("atoi")
+	cg.output.WriteString("    mov rdi, rax\n")
+	cg.output.WriteString("    call atoi\n")
+	cg.output.WriteString("    mov rdi, rdx     # the error's message, or 0\n")
+	cg.output.WriteString("    mov rsi, rax\n")
+	cg.makeResult()
+}
+
+// evaluateConversion folds a conversion of a constant; ok is false when the
+// call is not a conversion or the result is only known at run time
+func (cg *CodeGenerator) evaluateConversion(expr *parser.CallExpression) (constant, string, bool) {
+	to := cg.aliased(expr.Function)
+	if !isConversion(to) || expr.Receiver != nil || len(expr.Arguments) != 1 {
+		return constant{}, "", false
+	}
+	value, from, ok := cg.evaluateConstant(expr.Arguments[0])
+	switch {
+	case !ok:
+		return constant{}, "", false
+	case from == to:
+		return value, to, true
+	case isInteger(to) && (isInteger(from) || from == "Char"):
+		return constant{Int: wrapConstant(value.Int, to)}, to, true
+	case isInteger(to) && from == "Float":
+		return constant{Int: wrapConstant(truncate(value.Float), to)}, to, true
+	case isInteger(to) && from == "String":
+		n, err := parseIntConstant(value.String)
+		return constant{Int: wrapConstant(n, to)}, to, err == nil
+	case to == "Float" && isInteger(from) && from != "UInt64":
+		return constant{Float: float64(value.Int)}, to, true
+	case to == "String" && isInteger(from) && from != "UInt64":
+		return constant{String: strconv.FormatInt(value.Int, 10)}, to, true
+	case to == "String" && from == "Char":
+		c, typ := constantString(value, from)
+		return c, typ, true
+	case to == "Char" && isInteger(from):
+		return constant{Int: int64(byte(value.Int))}, to, true
+	}
+	return constant{}, "", false
+}
+
+// truncate converts f to an integer the way cvttsd2si does: toward zero, and
+// to the smallest Int when f is NaN or out of range
+func truncate(f float64) int64 {
+	if math.IsNaN(f) || f >= math.MaxInt64 || f < math.MinInt64 {
+		return math.MinInt64
+	}
+	return int64(f)
+}
+
+// parseIntConstant reads the text of a String constant converted to an
+// integer, which must be a decimal number with an optional sign
+func parseIntConstant(text string) (int64, error) {
+	n, err := strconv.ParseInt(string(stringBytes(text)), 10, 64)
+	if numErr, ok := err.(*strconv.NumError); ok {
+		return 0, numErr.Err
+	}
+	return n, err
+}
+
+func (cg *CodeGenerator) generateParseIntFunction() {
+	cg.output.WriteString("# parse_int function - reads a decimal integer at the start of a string\n")
+	cg.output.WriteString("# An optional sign and the digits up to the first other character count\n")
+	cg.output.WriteString("# Input: rdi = string address\n")
+	cg.output.WriteString("# Output: rax = the integer, 0 if the string starts with no digits\n")
+	cg.output.WriteString("parse_int:\n")
+	cg.output.WriteString("    push rbp\n")
+	cg.output.WriteString("    mov rbp, rsp\n")
+	cg.output.WriteString("    xor eax, eax\n")
+	cg.output.WriteString("    xor ecx, ecx     # 1 when negative\n")
+	cg.output.WriteString("    movzx edx, byte ptr [rdi]\n")
+	cg.output.WriteString("    cmp dl, 45       # '-'\n")
+	cg.output.WriteString("    jne parse_int_plus\n")
+	cg.output.WriteString("    mov ecx, 1\n")
+	cg.output.WriteString("    inc rdi\n")
+	cg.output.WriteString("    jmp parse_int_loop\n")
+	cg.output.WriteString("parse_int_plus:\n")
+	cg.output.WriteString("    cmp dl, 43       # '+'\n")
+	cg.output.WriteString("    jne parse_int_loop\n")
+	cg.output.WriteString("    inc rdi\n")
+	cg.output.WriteString("parse_int_loop:\n")
+	cg.output.WriteString("    movzx edx, byte ptr [rdi]\n")
+	cg.output.WriteString("    sub edx, 48      # digit value\n")
+	cg.output.WriteString("    cmp edx, 9\n")
+	cg.output.WriteString("    ja parse_int_done  # not a digit, or the terminator\n")
+	cg.output.WriteString("    imul rax, rax, 10\n")
+	cg.output.WriteString("    add rax, rdx\n")
+	cg.output.WriteString("    inc rdi\n")
+	cg.output.WriteString("    jmp parse_int_loop\n")
+	cg.output.WriteString("parse_int_done:\n")
+	cg.output.WriteString("    test ecx, ecx\n")
+	cg.output.WriteString("    jz parse_int_return\n")
+	cg.output.WriteString("    neg rax\n")
+	cg.output.WriteString("parse_int_return:\n")
+	cg.output.WriteString("    mov rsp, rbp\n")
+	cg.output.WriteString("    pop rbp\n")
+	cg.output.WriteString("    ret\n\n")
+}
+
+func (cg *CodeGenerator) generateAtoiFunction() {
+	invalid := cg.getStringLabel("not a decimal integer")
+	outOfRange := cg.getStringLabel("integer out of range")
+	cg.output.WriteString("# atoi function - reads a string that is a decimal integer and nothing else\n")
+	cg.output.WriteString("# An optional sign and at least one digit; the value is built negative, so\n")
+	cg.output.WriteString("# that the smallest Int can be read, and overflow is caught with jo\n")
+	cg.output.WriteString("# Input: rdi = string address\n")
+	cg.output.WriteString("# Output: rax = the integer; rdx = 0, or the error's message and rax = 0\n")
+	cg.output.WriteString("atoi:\n")
+	cg.output.WriteString("    push rbp\n")
+	cg.output.WriteString("    mov rbp, rsp\n")
+	cg.output.WriteString("    xor eax, eax\n")
+	cg.output.WriteString("    xor ecx, ecx     # 1 when negative\n")
+	cg.output.WriteString("    movzx edx, byte ptr [rdi]\n")
+	cg.output.WriteString("    cmp dl, 45       # '-'\n")
+	cg.output.WriteString("    jne atoi_plus\n")
+	cg.output.WriteString("    mov ecx, 1\n")
+	cg.output.WriteString("    inc rdi\n")
+	cg.output.WriteString("    jmp atoi_first\n")
+	cg.output.WriteString("atoi_plus:\n")
+	cg.output.WriteString("    cmp dl, 43       # '+'\n")
+	cg.output.WriteString("    jne atoi_first\n")
+	cg.output.WriteString("    inc rdi\n")
+	cg.output.WriteString("atoi_first:\n")
+	cg.output.WriteString("    movzx edx, byte ptr [rdi]\n")
+	cg.output.WriteString("    sub edx, 48      # digit value\n")
+	cg.output.WriteString("    cmp edx, 9\n")
+	cg.output.WriteString("    ja atoi_invalid  # no digits\n")
+	cg.output.WriteString("atoi_loop:\n")
+	cg.output.WriteString("    imul rax, rax, 10\n")
+	cg.output.WriteString("    jo atoi_range\n")
+	cg.output.WriteString("    sub rax, rdx\n")
+	cg.output.WriteString("    jo atoi_range\n")
+	cg.output.WriteString("    inc rdi\n")
+	cg.output.WriteString("    movzx edx, byte ptr [rdi]\n")
+	cg.output.WriteString("    test edx, edx\n")
+	cg.output.WriteString("    jz atoi_end\n")
+	cg.output.WriteString("    sub edx, 48\n")
+	cg.output.WriteString("    cmp edx, 9\n")
+	cg.output.WriteString("    ja atoi_invalid  # a character after the digits\n")
+	cg.output.WriteString("    jmp atoi_loop\n")
+	cg.output.WriteString("atoi_end:\n")
+	cg.output.WriteString("    xor edx, edx\n")
+	cg.output.WriteString("    test ecx, ecx\n")
+	cg.output.WriteString("    jnz atoi_return\n")
+	cg.output.WriteString("    neg rax\n")
+	cg.output.WriteString("    jo atoi_range    # the magnitude of the smallest Int\n")
+	cg.output.WriteString("    jmp atoi_return\n")
+	cg.output.WriteString("atoi_invalid:\n")
+	cg.output.WriteString(fmt.Sprintf("    lea rdx, [%s]\n", invalid))
+	cg.output.WriteString("    xor eax, eax\n")
+	cg.output.WriteString("    jmp atoi_return\n")
+	cg.output.WriteString("atoi_range:\n")
+	cg.output.WriteString(fmt.Sprintf("    lea rdx, [%s]\n", outOfRange))
+	cg.output.WriteString("    xor eax, eax\n")
+	cg.output.WriteString("atoi_return:\n")
+	cg.output.WriteString("    mov rsp, rbp\n")
+	cg.output.WriteString("    pop rbp\n")
+	cg.output.WriteString("    ret\n\n")
+}
+
+func (cg *CodeGenerator) generateIntToStringFunction() {
+	cg.output.WriteString("# int_to_string and uint_to_string functions - format an integer in decimal\n")
+	cg.output.WriteString("# Input: rdi = integer value, signed or unsigned\n")
+	cg.output.WriteString("# Output: rax = address of the newly allocated result\n")
+	cg.output.WriteString("int_to_string:\n")
+	cg.output.WriteString("    push rbp\n")
+	cg.output.WriteString("    mov rbp, rsp\n")
+	cg.output.WriteString("    xor r8d, r8d     # 1 when negative\n")
+	cg.output.WriteString("    test rdi, rdi\n")
+	cg.output.WriteString("    jns int_to_string_digits\n")
+	cg.output.WriteString("    neg rdi          # format the magnitude, sign added below\n")
+	cg.output.WriteString("    mov r8d, 1\n")
+	cg.output.WriteString("    jmp int_to_string_digits\n")
+	cg.output.WriteString("uint_to_string:\n")
+	cg.output.WriteString("    push rbp\n")
+	cg.output.WriteString("    mov rbp, rsp\n")
+	cg.output.WriteString("    xor r8d, r8d\n")
+	cg.output.WriteString("int_to_string_digits:\n")
+	cg.output.WriteString("    push rdi\n")
+	cg.output.WriteString("    push r8\n")
+	cg.output.WriteString("    mov rdi, 24      # sign, up to 20 digits and the terminator\n")
+	cg.output.WriteString("    call alloc\n")
+	cg.output.WriteString("    lea rsi, [rax + 23]\n")
+	cg.output.WriteString("    mov byte ptr [rsi], 0\n")
+	cg.output.WriteString("    pop r8\n")
+	cg.output.WriteString("    pop rax          # magnitude\n")
+	cg.output.WriteString("    mov rcx, 10\n")
+	cg.output.WriteString("int_to_string_loop:\n")
+	cg.output.WriteString("    dec rsi\n")
+	cg.output.WriteString("    xor edx, edx\n")
+	cg.output.WriteString("    div rcx          # rax = quotient, rdx = next digit\n")
+	cg.output.WriteString("    add dl, 48       # to ASCII\n")
+	cg.output.WriteString("    mov [rsi], dl\n")
+	cg.output.WriteString("    test rax, rax\n")
+	cg.output.WriteString("    jnz int_to_string_loop\n")
+	cg.output.WriteString("    test r8d, r8d\n")
+	cg.output.WriteString("    jz int_to_string_done\n")
+	cg.output.WriteString("    dec rsi\n")
+	cg.output.WriteString("    mov byte ptr [rsi], 45  # '-'\n")
+	cg.output.WriteString("int_to_string_done:\n")
+	cg.output.WriteString("    mov rax, rsi     # first character\n")
+	cg.output.WriteString("    mov rsp, rbp\n")
+	cg.output.WriteString("    pop rbp\n")
+	cg.output.WriteString("    ret\n\n")
+}
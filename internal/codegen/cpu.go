@@ -0,0 +1,100 @@
+package codegen
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"dreadlang/internal/lexer"
+)
+
+// CPU describes the instruction set extensions that generated code may use
+// beyond the x86-64 baseline, which includes SSE2. Feature names are those
+// Linux lists in /proc/cpuinfo.
+type CPU struct {
+	Name     string
+	features map[string]bool
+}
+
+// BaselineCPU is every x86-64 processor
+var BaselineCPU = &CPU{Name: "baseline"}
+
+// X86_64V3 is the x86-64-v3 microarchitecture level: Haswell, Zen and later
+var X86_64V3 = &CPU{
+	Name:     "x86-64-v3",
+	features: featureSet(cpuFeatures...),
+}
+
+// cpuFeatures are the features the code generator knows about, all part of
+// x86-64-v3
+var cpuFeatures = []string{"abm", "avx", "avx2", "bmi1", "bmi2", "fma", "movbe", "popcnt"}
+
+// cpus lists the CPUs selectable by name
+var cpus = map[string]*CPU{
+	BaselineCPU.Name: BaselineCPU,
+	X86_64V3.Name:    X86_64V3,
+}
+
+func featureSet(features ...string) map[string]bool {
+	set := make(map[string]bool)
+	for _, f := range features {
+		set[f] = true
+	}
+	return set
+}
+
+// LookupCPU returns the CPU with the given name, such as "x86-64-v3"
+func LookupCPU(name string) (*CPU, bool) {
+	c, ok := cpus[name]
+	return c, ok
+}
+
+// NativeCPU returns the CPU called name that has the known features among
+// flags, such as the flags /proc/cpuinfo lists for this machine
+func NativeCPU(name string, flags []string) *CPU {
+	c := &CPU{Name: name, features: make(map[string]bool)}
+	for _, flag := range flags {
+		for _, f := range cpuFeatures {
+			if flag == f {
+				c.features[f] = true
+			}
+		}
+	}
+	return c
+}
+
+// Has reports whether the CPU has feature
+func (c *CPU) Has(feature string) bool {
+	return c.features[feature]
+}
+
+// Features returns the CPU's features in alphabetical order
+func (c *CPU) Features() []string {
+	var features []string
+	for f := range c.features {
+		features = append(features, f)
+	}
+	sort.Strings(features)
+	return features
+}
+
+// String describes the CPU as "name" or "name (feature ...)", as recorded
+// in every program built for it
+func (c *CPU) String() string {
+	if len(c.features) == 0 {
+		return c.Name
+	}
+	return fmt.Sprintf("%s (%s)", c.Name, strings.Join(c.Features(), " "))
+}
+
+// extended writes an instruction beyond the x86-64 baseline, which needs
+// feature. Callers choose one only when the CPU has it, so one the CPU lacks
+// is a code generator bug, reported at tok as an internal error rather than
+// built into a program that dies with SIGILL.
+func (cg *CodeGenerator) extended(tok lexer.Token, feature string, instruction string) {
+	if cpu := cg.target.CPU(); !cpu.Has(feature) {
+		cg.errorAt(tok, ErrInternal, "internal compiler error: %s needs %s, which --cpu=%s lacks", instruction, feature, cpu.Name)
+		return
+	}
+	cg.output.WriteString("    " + instruction + "\n")
+}
@@ -0,0 +1,320 @@
+package codegen
+
+import (
+	"dreadlang/internal/lexer"
+	"dreadlang/internal/parser"
+)
+
+// At -O1 a call of a function whose arguments are constants is replaced by
+// its result when the function is pure: evaluateCall runs the body at
+// compile time over constants, the way evaluateConstant folds an
+// expression. The body may declare, assign and read its own variables,
+// branch, loop, and call other such functions, and reads no names but its
+// own and the file-scope constants. Anything else, such as a Print, a global
+// variable or an array, stops the evaluation, and the call is generated as
+// usual. Each statement run and each call spend fuel, so a loop that runs
+// too long, or never ends, stops it as well.
+
+// evaluationFuel is how many statements and calls evaluating one call may
+// run, counting those of the calls it makes
+const evaluationFuel = 10000
+
+// evaluation is the state of evaluating a call at compile time
+type evaluation struct {
+	fuel  int
+	frame *frame // the call whose body runs, nil for the arguments of the first
+}
+
+// frame holds the variables of a function evaluated at compile time
+type frame struct {
+	returnType string
+	result     constant
+	scopes     []map[string]*local // innermost block last
+}
+
+// local is a variable of a function evaluated at compile time
+type local struct {
+	typ      string
+	value    constant
+	declared bool // with Var or as a parameter, so its type is fixed
+	constant bool // with Const
+}
+
+// control is how running a statement at compile time ends
+type control int
+
+const (
+	proceed   control = iota // the next statement runs
+	returned                 // Return gave the frame its result
+	broke                    // a Break leaves the loop with the label
+	continued                // a Continue goes on with the loop with the label
+)
+
+// generateFoldedCall loads the result of a call evaluated at compile time
+// into rax; ok is false, having emitted nothing, when it cannot be
+func (cg *CodeGenerator) generateFoldedCall(expr *parser.CallExpression) (typ string, ok bool) {
+	if cg.optimization < 1 {
+		return "", false
+	}
+	diagnostics, references := len(cg.diagnostics), len(cg.references)
+	value, typ, ok := cg.evaluateCall(expr)
+	if !ok {
+		// Names in the arguments are referred to again when the call is generated
+		cg.diagnostics, cg.references = cg.diagnostics[:diagnostics], cg.references[:references]
+		return "", false
+	}
+	cg.referFunction(expr.Token, cg.functions[expr.Function])
+	cg.generateConstant(comment(expr), &variable{Type: typ, Constant: &value})
+	return typ, true
+}
+
+// evaluateCall evaluates a call of a pure function with constant arguments
+func (cg *CodeGenerator) evaluateCall(expr *parser.CallExpression) (constant, string, bool) {
+	fn, exists := cg.functions[expr.Function]
+	if expr.Receiver != nil || !exists || fn.IsEntry || fn.Receiver != nil || len(fn.Attributes) > 0 {
+		return constant{}, "", false
+	}
+	returnType := cg.aliased(fn.ReturnType)
+	if !isScalar(returnType) || len(expr.Arguments) != len(fn.Parameters) {
+		return constant{}, "", false
+	}
+	if cg.evaluating == nil {
+		cg.evaluating = &evaluation{fuel: evaluationFuel}
+		defer func() { cg.evaluating = nil }()
+	}
+	e := cg.evaluating
+	if !e.spend() {
+		return constant{}, "", false
+	}
+
+	parameters := make(map[string]*local)
+	for i, p := range fn.Parameters {
+		want := cg.aliased(p.Type)
+		value, typ, ok := cg.evaluateConstant(expr.Arguments[i])
+		if ok {
+			value, typ = convertConstant(value, typ, want)
+		}
+		if !ok || p.Variadic || typ != want || !isScalar(want) {
+			return constant{}, "", false
+		}
+		parameters[p.Name] = &local{typ: want, value: value, declared: true}
+	}
+
+	caller := e.frame
+	e.frame = &frame{returnType: returnType, scopes: []map[string]*local{parameters}}
+	defer func() { e.frame = caller }()
+	if c, _, ok := cg.evaluateBlock(fn.Body); !ok || c != returned {
+		return constant{}, "", false
+	}
+	return e.frame.result, returnType, true
+}
+
+// spend uses one unit of fuel, reporting false when there was none left
+func (e *evaluation) spend() bool {
+	e.fuel--
+	return e.fuel >= 0
+}
+
+// lookup finds a variable of f, innermost block first
+func (f *frame) lookup(name string) *local {
+	for i := len(f.scopes) - 1; i >= 0; i-- {
+		if l, exists := f.scopes[i][name]; exists {
+			return l
+		}
+	}
+	return nil
+}
+
+// lookupFolded finds a name evaluateConstant reads: in the body of a
+// function evaluated at compile time, one of its variables or a file-scope
+// name, and anywhere else what lookupVariable finds
+func (cg *CodeGenerator) lookupFolded(name string) (*variable, bool) {
+	if cg.evaluating == nil || cg.evaluating.frame == nil {
+		return cg.lookupVariable(name)
+	}
+	if l := cg.evaluating.frame.lookup(name); l != nil {
+		return &variable{Type: l.typ, Constant: &l.value}, true
+	}
+	v, exists := cg.globals[name]
+	return v, exists
+}
+
+// inEvaluatedBody reports whether evaluateConstant is reading the body of a
+// function evaluated at compile time, whose names are referred to when the
+// function is generated rather than here
+func (cg *CodeGenerator) inEvaluatedBody() bool {
+	return cg.evaluating != nil && cg.evaluating.frame != nil
+}
+
+// evaluateBlock runs a block in a scope of its own
+func (cg *CodeGenerator) evaluateBlock(block *parser.BlockStatement) (control, string, bool) {
+	f := cg.evaluating.frame
+	f.scopes = append(f.scopes, make(map[string]*local))
+	defer func() { f.scopes = f.scopes[:len(f.scopes)-1] }()
+	for _, stmt := range block.Statements {
+		c, label, ok := cg.evaluateStatement(stmt)
+		if !ok || c != proceed {
+			return c, label, ok
+		}
+	}
+	return proceed, "", true
+}
+
+// evaluateStatement runs one statement, and reports the label of a Break or
+// Continue
+func (cg *CodeGenerator) evaluateStatement(stmt parser.Statement) (control, string, bool) {
+	f := cg.evaluating.frame
+	if !cg.evaluating.spend() {
+		return proceed, "", false
+	}
+	switch s := stmt.(type) {
+	case *parser.VarStatement:
+		typ := cg.aliased(s.Type)
+		if _, exists := f.scopes[len(f.scopes)-1][s.Name]; exists || s.Length != nil || !isScalar(typ) {
+			return proceed, "", false
+		}
+		var value constant
+		if s.Value != nil {
+			var ok bool
+			if value, ok = cg.evaluateAs(s.Value, typ); !ok {
+				return proceed, "", false
+			}
+		}
+		f.scopes[len(f.scopes)-1][s.Name] = &local{typ: typ, value: value, declared: true}
+	case *parser.ConstStatement:
+		value, typ, ok := cg.evaluateConstant(s.Value)
+		if _, exists := f.scopes[len(f.scopes)-1][s.Name]; exists || !ok {
+			return proceed, "", false
+		}
+		f.scopes[len(f.scopes)-1][s.Name] = &local{typ: typ, value: value, constant: true}
+	case *parser.AssignStatement:
+		return proceed, "", cg.evaluateAssign(s)
+	case *parser.CallStatement:
+		if s.Receiver != nil || s.Function != "Return" || len(s.Arguments) != 1 {
+			return proceed, "", false
+		}
+		value, ok := cg.evaluateAs(s.Arguments[0], f.returnType)
+		f.result = value
+		return returned, "", ok
+	case *parser.BlockStatement:
+		return cg.evaluateBlock(s)
+	case *parser.IfStatement:
+		for _, b := range s.Branches {
+			taken, ok := cg.evaluateCondition(b.Condition)
+			if !ok {
+				return proceed, "", false
+			}
+			if taken {
+				return cg.evaluateBlock(b.Body)
+			}
+		}
+		if s.Else != nil {
+			return cg.evaluateBlock(s.Else)
+		}
+	case *parser.ForStatement:
+		return cg.evaluateFor(s)
+	case *parser.DoWhileStatement:
+		for {
+			c, label, ok := cg.evaluateBlock(s.Body)
+			if !ok || c == returned || (c == broke || c == continued) && label != "" && label != s.Label {
+				return c, label, ok
+			}
+			if c == broke {
+				return proceed, "", true
+			}
+			again, ok := cg.evaluateCondition(s.Condition)
+			if !ok || !again {
+				return proceed, "", ok
+			}
+			if !cg.evaluating.spend() {
+				return proceed, "", false
+			}
+		}
+	case *parser.BranchStatement:
+		if s.Token.Type == lexer.BREAK {
+			return broke, s.Label, true
+		}
+		return continued, s.Label, true
+	default:
+		return proceed, "", false
+	}
+	return proceed, "", true
+}
+
+// evaluateFor runs a For loop, whose Init is in a scope of its own
+func (cg *CodeGenerator) evaluateFor(s *parser.ForStatement) (control, string, bool) {
+	f := cg.evaluating.frame
+	f.scopes = append(f.scopes, make(map[string]*local))
+	defer func() { f.scopes = f.scopes[:len(f.scopes)-1] }()
+	if s.Init != nil {
+		if _, _, ok := cg.evaluateStatement(s.Init); !ok {
+			return proceed, "", false
+		}
+	}
+	for {
+		if s.Condition != nil {
+			again, ok := cg.evaluateCondition(s.Condition)
+			if !ok || !again {
+				return proceed, "", ok
+			}
+		}
+		c, label, ok := cg.evaluateBlock(s.Body)
+		if !ok || c == returned || (c == broke || c == continued) && label != "" && label != s.Label {
+			return c, label, ok
+		}
+		if c == broke {
+			return proceed, "", true
+		}
+		if s.Post != nil {
+			if _, _, ok := cg.evaluateStatement(s.Post); !ok {
+				return proceed, "", false
+			}
+		}
+		if !cg.evaluating.spend() {
+			return proceed, "", false
+		}
+	}
+}
+
+// evaluateAssign assigns to a variable of the frame, declaring it on first
+// use like assignVariable; a global is not the frame's to change
+func (cg *CodeGenerator) evaluateAssign(s *parser.AssignStatement) bool {
+	if s.Field != nil || s.Index != nil {
+		return false
+	}
+	value, typ, ok := cg.evaluateConstant(s.Value)
+	if !ok || s.Name == "_" {
+		return ok
+	}
+	f := cg.evaluating.frame
+	l := f.lookup(s.Name)
+	if l == nil {
+		if _, global := cg.globals[s.Name]; global {
+			return false
+		}
+		f.scopes[len(f.scopes)-1][s.Name] = &local{typ: typ, value: value}
+		return true
+	}
+	value, typ = convertConstant(value, typ, l.typ)
+	if l.constant || l.declared && typ != l.typ {
+		return false
+	}
+	l.typ, l.value = typ, value
+	return true
+}
+
+// evaluateAs evaluates expr converted to typ
+func (cg *CodeGenerator) evaluateAs(expr parser.Expression, typ string) (constant, bool) {
+	value, valueType, ok := cg.evaluateConstant(expr)
+	if !ok {
+		return constant{}, false
+	}
+	value, valueType = convertConstant(value, valueType, typ)
+	return value, valueType == typ
+}
+
+// evaluateCondition evaluates the condition of an If or a loop
+func (cg *CodeGenerator) evaluateCondition(expr parser.Expression) (bool, bool) {
+	value, typ, ok := cg.evaluateConstant(expr)
+	return value.Int != 0, ok && isInteger(typ)
+}
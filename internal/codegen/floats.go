@@ -0,0 +1,251 @@
+package codegen
+
+import (
+	"fmt"
+	"math"
+
+	"dreadlang/internal/lexer"
+)
+
+// Floats are IEEE-754 doubles. Like every other scalar they travel in rax
+// and live in 8-byte slots, as their bit pattern; arithmetic moves them into
+// xmm0 and xmm1 for the SSE2 instructions, or their AVX forms when the CPU
+// has AVX, and the result back into rax. Int and Float never mix implicitly.
+
+// floatBits returns the bit pattern of f as an immediate operand
+func floatBits(f float64) string {
+	return fmt.Sprintf("0x%X", math.Float64bits(f))
+}
+
+// generateFloatLiteral loads a Float into rax
+func (cg *CodeGenerator) generateFloatLiteral(value float64, name string) {
+	cg.output.WriteString(fmt.Sprintf("    mov rax, %s    # %s\n", floatBits(value), name))
+}
+
+// floatSetInstructions maps comparison operators to the setcc that follows
+// ucomisd. Only the "above" conditions are false when either operand is
+// NaN, so < and <= compare the operands the other way round.
+var floatSetInstructions = map[string]string{
+	"<":  "seta",
+	">":  "seta",
+	"<=": "setae",
+	">=": "setae",
+}
+
+// sse emits an SSE2 instruction on Floats, or its AVX form when the CPU has
+// AVX: arithmetic then takes the destination as a separate first operand,
+// which also spares cvtsi2sd waiting on the old value of its destination
+func (cg *CodeGenerator) sse(tok lexer.Token, mnemonic string, dst string, src string) {
+	switch {
+	case !cg.target.CPU().Has("avx"):
+		cg.output.WriteString(fmt.Sprintf("    %s %s, %s\n", mnemonic, dst, src))
+	case mnemonic == "addsd" || mnemonic == "subsd" || mnemonic == "mulsd" || mnemonic == "divsd" || mnemonic == "cvtsi2sd":
+		cg.extended(tok, "avx", fmt.Sprintf("v%s %s, %s, %s", mnemonic, dst, dst, src))
+	default:
+		cg.extended(tok, "avx", fmt.Sprintf("v%s %s, %s", mnemonic, dst, src))
+	}
+}
+
+// generateFloatInfix applies operator, at tok, to the Floats in rax (left)
+// and rcx (right), leaving a Float, or an Int for comparisons, in rax
+func (cg *CodeGenerator) generateFloatInfix(tok lexer.Token, operator string) string {
+	cg.sse(tok, "movq", "xmm0", "rax")
+	cg.sse(tok, "movq", "xmm1", "rcx")
+	switch operator {
+	case "+":
+		cg.sse(tok, "addsd", "xmm0", "xmm1")
+	case "-":
+		cg.sse(tok, "subsd", "xmm0", "xmm1")
+	case "*":
+		cg.sse(tok, "mulsd", "xmm0", "xmm1")
+	case "/":
+		// Dividing by zero gives an infinity, or NaN for 0.0 / 0.0
+		cg.sse(tok, "divsd", "xmm0", "xmm1")
+	case "==":
+		// Unordered (NaN) operands set ZF too, and PF tells them apart
+		cg.sse(tok, "ucomisd", "xmm0", "xmm1")
+		cg.output.WriteString("    sete al\n")
+		cg.output.WriteString("    setnp cl\n")
+		cg.output.WriteString("    and al, cl\n")
+		cg.output.WriteString("    movzx rax, al\n")
+		return "Int"
+	case "!=":
+		cg.sse(tok, "ucomisd", "xmm0", "xmm1")
+		cg.output.WriteString("    setne al\n")
+		cg.output.WriteString("    setp cl\n")
+		cg.output.WriteString("    or al, cl\n")
+		cg.output.WriteString("    movzx rax, al\n")
+		return "Int"
+	case "<", "<=":
+		cg.sse(tok, "ucomisd", "xmm1", "xmm0")
+		cg.output.WriteString(fmt.Sprintf("    %s al\n", floatSetInstructions[operator]))
+		cg.output.WriteString("    movzx rax, al\n")
+		return "Int"
+	case ">", ">=":
+		cg.sse(tok, "ucomisd", "xmm0", "xmm1")
+		cg.output.WriteString(fmt.Sprintf("    %s al\n", floatSetInstructions[operator]))
+		cg.output.WriteString("    movzx rax, al\n")
+		return "Int"
+	}
+	cg.sse(tok, "movq", "rax", "xmm0")
+	return "Float"
+}
+
+func foldFloatInfix(operator string, left, right float64) (constant, string, bool) {
+	switch operator {
+	case "+":
+		return constant{Float: left + right}, "Float", true
+	case "-":
+		return constant{Float: left - right}, "Float", true
+	case "*":
+		return constant{Float: left * right}, "Float", true
+	case "/":
+		return constant{Float: left / right}, "Float", true
+	case "==":
+		return constant{Int: boolInt(left == right)}, "Int", true
+	case "!=":
+		return constant{Int: boolInt(left != right)}, "Int", true
+	case "<":
+		return constant{Int: boolInt(left < right)}, "Int", true
+	case ">":
+		return constant{Int: boolInt(left > right)}, "Int", true
+	case "<=":
+		return constant{Int: boolInt(left <= right)}, "Int", true
+	case ">=":
+		return constant{Int: boolInt(left >= right)}, "Int", true
+	default:
+		return constant{}, "", false
+	}
+}
+
+// floatFractionDigits is how many digits float_to_string writes after the
+// point, before trailing zeros are dropped
+const floatFractionDigits = 6
+
+func (cg *CodeGenerator) generateFloatToStringFunction() {
+	cg.output.WriteString("# float_to_string function - formats a Float in decimal\n")
+	cg.output.WriteString(fmt.Sprintf("# Rounds to %d digits after the point and drops trailing zeros, keeping one;\n", floatFractionDigits))
+	cg.output.WriteString("# magnitudes from 1e18 up are written as d.ddde+N, and NaN as NaN and +Inf/-Inf\n")
+	cg.output.WriteString("# Input: rdi = bit pattern of the Float\n")
+	cg.output.WriteString("# Output: rax = address of the newly allocated result\n")
+	cg.output.WriteString("float_to_string:\n")
+	cg.output.WriteString("    push rbp\n")
+	cg.output.WriteString("    mov rbp, rsp\n")
+	cg.output.WriteString("    push rbx\n")
+	cg.output.WriteString("    push r12\n")
+	cg.output.WriteString("    push r13\n")
+	cg.output.WriteString("    push r14\n")
+	cg.output.WriteString("    mov rbx, rdi     # bit pattern\n")
+	cg.output.WriteString("    mov rdi, 48      # sign, 18 digits, point, fraction, exponent, terminator\n")
+	cg.output.WriteString("    call alloc\n")
+	cg.output.WriteString("    mov r12, rax     # result\n")
+	cg.output.WriteString("    mov rdi, rax     # write position\n")
+	cg.output.WriteString("    mov rax, rbx\n")
+	cg.output.WriteString("    btr rax, 63      # magnitude; CF = sign\n")
+	cg.output.WriteString("    jnc float_to_string_positive\n")
+	cg.output.WriteString("    mov byte ptr [rdi], 45  # '-'\n")
+	cg.output.WriteString("    inc rdi\n")
+	cg.output.WriteString("float_to_string_positive:\n")
+	cg.output.WriteString(fmt.Sprintf("    mov rcx, %s  # exponent bits all set\n", floatBits(math.Inf(1))))
+	cg.output.WriteString("    cmp rax, rcx\n")
+	cg.output.WriteString("    jae float_to_string_special\n")
+	cg.output.WriteString("    movq xmm0, rax\n")
+	cg.output.WriteString("    xor r13d, r13d   # decimal exponent\n")
+	cg.output.WriteString(fmt.Sprintf("    mov rax, %s  # 1e18\n", floatBits(1e18)))
+	cg.output.WriteString("    movq xmm1, rax\n")
+	cg.output.WriteString(fmt.Sprintf("    mov rax, %s  # 10.0\n", floatBits(10)))
+	cg.output.WriteString("    movq xmm2, rax\n")
+	cg.output.WriteString("    ucomisd xmm0, xmm1\n")
+	cg.output.WriteString("    jb float_to_string_split\n")
+	cg.output.WriteString("float_to_string_scale:\n")
+	cg.output.WriteString("    divsd xmm0, xmm2 # too large for an integer part: scale to [1, 10)\n")
+	cg.output.WriteString("    inc r13\n")
+	cg.output.WriteString("    ucomisd xmm0, xmm2\n")
+	cg.output.WriteString("    jae float_to_string_scale\n")
+	cg.output.WriteString("float_to_string_split:\n")
+	cg.output.WriteString("    cvttsd2si r14, xmm0  # integer part\n")
+	cg.output.WriteString("    cvtsi2sd xmm1, r14\n")
+	cg.output.WriteString("    subsd xmm0, xmm1 # fraction\n")
+	cg.output.WriteString(fmt.Sprintf("    mov rax, %s  # 1e%d\n", floatBits(math.Pow10(floatFractionDigits)), floatFractionDigits))
+	cg.output.WriteString("    movq xmm1, rax\n")
+	cg.output.WriteString("    mulsd xmm0, xmm1\n")
+	cg.output.WriteString("    cvtsd2si rbx, xmm0  # fraction digits, rounded to nearest\n")
+	cg.output.WriteString(fmt.Sprintf("    cmp rbx, %d\n", int64(math.Pow10(floatFractionDigits))))
+	cg.output.WriteString("    jb float_to_string_integer\n")
+	cg.output.WriteString("    inc r14          # the rounding carried into the integer part\n")
+	cg.output.WriteString(fmt.Sprintf("    sub rbx, %d\n", int64(math.Pow10(floatFractionDigits))))
+	cg.output.WriteString("float_to_string_integer:\n")
+	cg.output.WriteString("    mov rax, r14\n")
+	cg.output.WriteString("    call float_to_string_digits\n")
+	cg.output.WriteString("    mov byte ptr [rdi], 46  # '.'\n")
+	cg.output.WriteString("    inc rdi\n")
+	cg.output.WriteString("    mov rax, rbx\n")
+	cg.output.WriteString("    mov rcx, 10\n")
+	cg.output.WriteString(fmt.Sprintf("    mov r8d, %d\n", floatFractionDigits))
+	cg.output.WriteString("float_to_string_fraction:\n")
+	cg.output.WriteString("    xor edx, edx\n")
+	cg.output.WriteString("    div rcx          # rax = quotient, rdx = next digit\n")
+	cg.output.WriteString("    add dl, 48       # to ASCII\n")
+	cg.output.WriteString("    mov [rdi + r8 - 1], dl  # leading zeros included\n")
+	cg.output.WriteString("    dec r8\n")
+	cg.output.WriteString("    jnz float_to_string_fraction\n")
+	cg.output.WriteString(fmt.Sprintf("    add rdi, %d\n", floatFractionDigits))
+	cg.output.WriteString("float_to_string_trim:\n")
+	cg.output.WriteString("    cmp byte ptr [rdi - 2], 46  # keep one digit after the '.'\n")
+	cg.output.WriteString("    je float_to_string_exponent\n")
+	cg.output.WriteString("    cmp byte ptr [rdi - 1], 48  # '0'\n")
+	cg.output.WriteString("    jne float_to_string_exponent\n")
+	cg.output.WriteString("    dec rdi\n")
+	cg.output.WriteString("    jmp float_to_string_trim\n")
+	cg.output.WriteString("float_to_string_exponent:\n")
+	cg.output.WriteString("    test r13, r13\n")
+	cg.output.WriteString("    jz float_to_string_done\n")
+	cg.output.WriteString("    mov word ptr [rdi], 0x2B65  # 'e+'\n")
+	cg.output.WriteString("    add rdi, 2\n")
+	cg.output.WriteString("    mov rax, r13\n")
+	cg.output.WriteString("    call float_to_string_digits\n")
+	cg.output.WriteString("    jmp float_to_string_done\n")
+	cg.output.WriteString("float_to_string_special:\n")
+	cg.output.WriteString("    je float_to_string_infinity\n")
+	cg.output.WriteString("    mov rdi, r12     # NaN has no sign\n")
+	cg.output.WriteString("    mov dword ptr [rdi], 0x004E614E  # 'NaN' and the terminator\n")
+	cg.output.WriteString("    jmp float_to_string_return\n")
+	cg.output.WriteString("float_to_string_infinity:\n")
+	cg.output.WriteString("    cmp rdi, r12\n")
+	cg.output.WriteString("    jne float_to_string_inf\n")
+	cg.output.WriteString("    mov byte ptr [rdi], 43  # '+'\n")
+	cg.output.WriteString("    inc rdi\n")
+	cg.output.WriteString("float_to_string_inf:\n")
+	cg.output.WriteString("    mov dword ptr [rdi], 0x00666E49  # 'Inf' and the terminator\n")
+	cg.output.WriteString("    jmp float_to_string_return\n")
+	cg.output.WriteString("float_to_string_done:\n")
+	cg.output.WriteString("    mov byte ptr [rdi], 0\n")
+	cg.output.WriteString("float_to_string_return:\n")
+	cg.output.WriteString("    mov rax, r12\n")
+	cg.output.WriteString("    pop r14\n")
+	cg.output.WriteString("    pop r13\n")
+	cg.output.WriteString("    pop r12\n")
+	cg.output.WriteString("    pop rbx\n")
+	cg.output.WriteString("    mov rsp, rbp\n")
+	cg.output.WriteString("    pop rbp\n")
+	cg.output.WriteString("    ret\n")
+	cg.output.WriteString("# Writes the unsigned integer in rax in decimal at rdi, advancing rdi\n")
+	cg.output.WriteString("float_to_string_digits:\n")
+	cg.output.WriteString("    mov rcx, 10\n")
+	cg.output.WriteString("    xor r8d, r8d     # digits on the stack, last one on top\n")
+	cg.output.WriteString("float_to_string_divide:\n")
+	cg.output.WriteString("    xor edx, edx\n")
+	cg.output.WriteString("    div rcx\n")
+	cg.output.WriteString("    add dl, 48\n")
+	cg.output.WriteString("    push rdx\n")
+	cg.output.WriteString("    inc r8\n")
+	cg.output.WriteString("    test rax, rax\n")
+	cg.output.WriteString("    jnz float_to_string_divide\n")
+	cg.output.WriteString("float_to_string_write:\n")
+	cg.output.WriteString("    pop rax\n")
+	cg.output.WriteString("    mov [rdi], al\n")
+	cg.output.WriteString("    inc rdi\n")
+	cg.output.WriteString("    dec r8\n")
+	cg.output.WriteString("    jnz float_to_string_write\n")
+	cg.output.WriteString("    ret\n\n")
+}
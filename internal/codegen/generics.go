@@ -0,0 +1,173 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+
+	"dreadlang/internal/lexer"
+	"dreadlang/internal/parser"
+)
+
+// A generic function, such as Function Max[T](a T, b T) T, is compiled once
+// for every list of type arguments it is called with. A call infers them
+// from the types of its arguments, and each instance gets a symbol of its
+// own: the name followed by the type arguments, as in Max..Int or
+// Pair..Int..String. The dots keep them apart from methods, which have one.
+// A generic function that is never called is never generated, so its body
+// is only checked for the types it is used with, and an error in it names
+// the instance and the call that needed it, since it may be an error for
+// some type arguments only.
+
+// typeSeparator joins a generic function's name and type arguments into the
+// symbol of an instance
+const typeSeparator = ".."
+
+// instance is a generic function instantiated for some type arguments
+type instance struct {
+	fn        *parser.FunctionStatement
+	arguments map[string]string // type parameter name to type
+	call      lexer.Token       // the call that first needed it
+}
+
+// isGeneric reports whether fn has type parameters
+func isGeneric(fn *parser.FunctionStatement) bool {
+	return len(fn.TypeParameters) > 0
+}
+
+// instantiate returns the symbol of the instance of generic that call needs,
+// queuing it for generation the first time. It reports type parameters that
+// the arguments bind to different types, or to none.
+func (cg *CodeGenerator) instantiate(call *parser.CallExpression, generic *parser.FunctionStatement) (string, bool) {
+	arguments := make(map[string]string)
+	ok := true
+	bind := func(param string, typ string) {
+		if !ok {
+			return
+		}
+		for _, name := range generic.TypeParameters {
+			var element string
+			switch {
+			case param == name:
+				element = typ
+			case param == name+"[]" && isSlice(typ):
+				element = strings.TrimSuffix(typ, "[]")
+			default:
+				continue
+			}
+			if !isScalar(element) {
+				cg.errorAt(call.Token, ErrTypeMismatch, "type parameter %s of %s cannot be %s", name, generic.Name, element)
+				ok = false
+			} else if bound, exists := arguments[name]; exists && bound != element {
+				cg.errorAt(call.Token, ErrTypeMismatch, "type parameter %s of %s is both %s and %s", name, generic.Name, bound, element)
+				ok = false
+			}
+			arguments[name] = element
+			return
+		}
+	}
+	params := generic.Parameters
+	for i, arg := range call.Arguments {
+		switch {
+		case i < len(params)-1 || i == len(params)-1 && !params[i].Variadic:
+			bind(params[i].Type, cg.types[arg])
+		case len(params) > 0 && params[len(params)-1].Variadic:
+			bind(strings.TrimSuffix(params[len(params)-1].Type, "[]"), cg.types[arg])
+		}
+	}
+	if !ok {
+		return "", false
+	}
+
+	symbol := generic.Name
+	for _, name := range generic.TypeParameters {
+		typ, bound := arguments[name]
+		if !bound {
+			cg.errorAt(call.Token, ErrTypeMismatch, "cannot infer type parameter %s of %s", name, generic.Name)
+			return "", false
+		}
+		symbol += typeSeparator + typ
+	}
+	if _, exists := cg.functions[symbol]; exists {
+		return symbol, true
+	}
+
+	fn := *generic
+	fn.Name = symbol
+	fn.TypeParameters = nil
+	fn.Parameters = make([]*parser.Parameter, len(generic.Parameters))
+	for i, param := range generic.Parameters {
+		p := *param
+		p.Type = substituteType(param.Type, arguments)
+		fn.Parameters[i] = &p
+	}
+	fn.ReturnType = substituteType(generic.ReturnType, arguments)
+	cg.functions[symbol] = &fn
+	cg.instances = append(cg.instances, instance{fn: &fn, arguments: arguments, call: call.Token})
+	return symbol, true
+}
+
+// generateInstances generates every queued instance of a generic function,
+// including those the instances themselves call for
+func (cg *CodeGenerator) generateInstances() {
+	for len(cg.instances) > 0 {
+		next := cg.instances[0]
+		cg.instances = cg.instances[1:]
+		cg.typeArguments = next.arguments
+		cg.instantiating = &next
+		cg.generateFunction(next.fn)
+		cg.typeArguments = nil
+		cg.instantiating = nil
+	}
+}
+
+// note tells which instance an error in a generic function's
+// body was found in, and where it was called with those type arguments
+func (i *instance) note() string {
+	position := fmt.Sprintf("%d:%d", i.call.Line, i.call.Column)
+	if i.call.File != "" {
+		position = i.call.File + ":" + position
+	}
+	return fmt.Sprintf(" (in instantiation of %s at %s)", functionName(i.fn.Name), position)
+}
+
+// substituteType replaces the type parameters named in typ, which may be
+// part of a slice, optional or tuple type, with their type arguments
+func substituteType(typ string, arguments map[string]string) string {
+	if len(arguments) == 0 {
+		return typ
+	}
+	var out strings.Builder
+	for i := 0; i < len(typ); {
+		j := i
+		for j < len(typ) && isNameByte(typ[j]) {
+			j++
+		}
+		if j == i {
+			out.WriteByte(typ[i])
+			i++
+			continue
+		}
+		if argument, ok := arguments[typ[i:j]]; ok {
+			out.WriteString(argument)
+		} else {
+			out.WriteString(typ[i:j])
+		}
+		i = j
+	}
+	return out.String()
+}
+
+func isNameByte(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// isIdentifier reports whether typ is a plain name, not a slice, optional,
+// array or tuple type
+func isIdentifier(typ string) bool {
+	for i := 0; i < len(typ); i++ {
+		if !isNameByte(typ[i]) {
+			return false
+		}
+	}
+	return typ != ""
+}
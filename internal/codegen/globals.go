@@ -0,0 +1,277 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+
+	"dreadlang/internal/parser"
+)
+
+// defineGlobal allocates a file-scope Var. Its initial value is folded like a
+// Const and stored in .data; Int globals without one are zeroed in .bss.
+// Arrays and structs are laid out the same way, one .quad per slot.
+func (cg *CodeGenerator) defineGlobal(stmt *parser.VarStatement) {
+	if _, exists := cg.globals[stmt.Name]; exists {
+		cg.errorAt(stmt.Token, ErrAlreadyDeclared, "variable %s is already defined in this block", stmt.Name)
+		return
+	}
+
+	stmt.Attributes = cg.foldAttributes(stmt.Attributes)
+	cg.poisoned = false
+	declared, ok := cg.resolveType(stmt)
+	if !ok {
+		bindPoisoned(cg.globals, stmt)
+		return
+	}
+
+	// Exported globals keep their own name so other objects can refer to them
+	label := "global_" + stmt.Name
+	if stmt.Attributes.Has("export") {
+		label = stmt.Name
+	}
+	// The global has its declared type even if its initial value is wrong
+	global := &variable{Type: declared, Global: label, Declared: true, Declaration: stmt.Token}
+	var quads []string
+	if stmt.Value != nil {
+		folded, typ, ok := cg.foldInitializer(stmt, stmt.Value, declared)
+		if ok && typ != declared {
+			cg.errorAt(stmt.Token, ErrAssignMismatch, "cannot assign %s to %s variable %s", typ, declared, stmt.Name)
+		}
+		if !ok || typ != declared {
+			cg.globals[stmt.Name] = global
+			return
+		}
+		quads = folded
+	}
+	cg.globals[stmt.Name] = global
+	cg.refer(stmt.Token, global)
+
+	definition := symbolDirectives(label, stmt.Attributes, false)
+	zeroed := false
+	switch {
+	case stmt.Value == nil && cg.allInt(declared):
+		definition += fmt.Sprintf("%s: .zero %d\n", label, cg.sizeOf(declared))
+		zeroed = true
+	case stmt.Value == nil:
+		definition += fmt.Sprintf("%s: .quad %s\n", label, strings.Join(cg.zeroQuads(declared), ", "))
+	default:
+		definition += fmt.Sprintf("%s: .quad %s\n", label, strings.Join(quads, ", "))
+	}
+
+	switch section := stmt.Attributes.Lookup("section"); {
+	case section != nil:
+		// Each global with its own section is emitted on its own, from .data
+		definition = pushSection(section, "aw", zeroed) + "    .balign 8\n" + definition + ".popsection\n"
+		cg.globalData = append(cg.globalData, definition)
+	case zeroed:
+		cg.globalBSS = append(cg.globalBSS, definition)
+	default:
+		cg.globalData = append(cg.globalData, definition)
+	}
+}
+
+// foldInitializer folds the initial value of a global into one .quad operand
+// per slot: a constant, or an array, struct or tuple literal of constants. It
+// converts the value to want where a run-time assignment would, and reports
+// why it can't fold it.
+func (cg *CodeGenerator) foldInitializer(stmt *parser.VarStatement, expr parser.Expression, want string) ([]string, string, bool) {
+	switch e := expr.(type) {
+	case *parser.ArrayLiteral:
+		if len(e.Elements) == 0 {
+			cg.errorAt(e.Token, ErrArrayLiteral, "array literal must have at least one element")
+			return nil, "", false
+		}
+		var quads []string
+		var element string
+		wantElement, _, _ := arrayType(want)
+		for _, el := range e.Elements {
+			folded, typ, ok := cg.foldInitializer(stmt, el, wantElement)
+			if !ok {
+				return nil, "", false
+			}
+			if !isScalar(typ) {
+				cg.errorAt(e.Token, ErrTypeMismatch, "array elements must be Int, Float, Char or String, got %s", typ)
+				return nil, "", false
+			}
+			if element != "" && typ != element {
+				cg.errorAt(e.Token, ErrTypeMismatch, "array elements must all have the same type, got %s and %s", element, typ)
+				return nil, "", false
+			}
+			element = typ
+			quads = append(quads, folded...)
+		}
+		return quads, fmt.Sprintf("%s[%d]", element, len(e.Elements)), true
+	case *parser.StructLiteral:
+		s, ok := cg.structs[cg.aliased(e.Name)]
+		if !ok {
+			cg.undefinedName(e.Token, ErrUndefinedType, "type", e.Name, cg.typeNames())
+			return nil, "", false
+		}
+		values, ok := cg.fieldValues(s, e)
+		if !ok {
+			return nil, "", false
+		}
+		var quads []string
+		for _, f := range s.Fields {
+			value, given := values[f.Name]
+			if !given {
+				quads = append(quads, cg.zeroQuads(f.Type)...)
+				continue
+			}
+			folded, typ, ok := cg.foldInitializer(stmt, value.Value, f.Type)
+			if !ok {
+				return nil, "", false
+			}
+			if typ != f.Type {
+				cg.errorAt(value.Token, ErrAssignMismatch, "cannot assign %s to %s field %s of %s", typ, f.Type, f.Name, s.Name)
+				return nil, "", false
+			}
+			quads = append(quads, folded...)
+		}
+		return quads, s.Name, true
+	case *parser.TupleLiteral:
+		wantElements, _ := tupleType(want)
+		if len(wantElements) != len(e.Elements) {
+			wantElements = make([]string, len(e.Elements))
+		}
+		var quads []string
+		types := make([]string, len(e.Elements))
+		for i, el := range e.Elements {
+			folded, typ, ok := cg.foldInitializer(stmt, el, wantElements[i])
+			if !ok {
+				return nil, "", false
+			}
+			types[i] = typ
+			quads = append(quads, folded...)
+		}
+		return quads, "(" + strings.Join(types, ", ") + ")", true
+	}
+
+	if isResult(want) {
+		cg.errorAt(stmt.Token, ErrNotConstant, "result global %s cannot have an initial value; assign it in a function", stmt.Name)
+		return nil, "", false
+	}
+	if isOptional(want) {
+		// A value would need a cell allocated at run time
+		if _, isNil := expr.(*parser.NilLiteral); !isNil {
+			cg.errorAt(stmt.Token, ErrNotConstant, "initial value of optional global %s must be nil", stmt.Name)
+			return nil, "", false
+		}
+		return []string{"0"}, want, true
+	}
+	value, typ, ok := cg.evaluateConstant(expr)
+	if !ok && cg.dividesByZero(expr) {
+		cg.errorAt(stmt.Token, ErrDivisionByZero, "initial value of global %s divides by zero", stmt.Name)
+		return nil, "", false
+	}
+	if !ok {
+		cg.errorAt(stmt.Token, ErrNotConstant, "initial value of global %s must be known at compile time", stmt.Name)
+		return nil, "", false
+	}
+	value, typ = convertConstant(value, typ, want)
+	switch typ {
+	case "String":
+		return []string{cg.getStringLabel(value.String)}, typ, true
+	case "Float":
+		return []string{floatBits(value.Float)}, typ, true
+	}
+	return []string{fmt.Sprint(value.Int)}, typ, true
+}
+
+// zeroQuads returns the .quad operands of the zero value of type typ
+func (cg *CodeGenerator) zeroQuads(typ string) []string {
+	var quads []string
+	for _, s := range cg.flatten("", typ) {
+		if s.typ == "String" {
+			quads = append(quads, cg.getStringLabel(""))
+		} else {
+			quads = append(quads, "0")
+		}
+	}
+	return quads
+}
+
+// allInt reports whether every slot of type typ holds an Int or a Float, so
+// its zero value is all zero bytes
+func (cg *CodeGenerator) allInt(typ string) bool {
+	for _, s := range cg.flatten("", typ) {
+		if s.typ == "String" {
+			return false
+		}
+	}
+	return true
+}
+
+// foldAttributes folds the arguments of @align and @section, which may be
+// constant expressions such as @align(SizeOf(Int[2])), into literals. It
+// returns the attributes without those whose argument is invalid.
+func (cg *CodeGenerator) foldAttributes(attributes parser.Attributes) parser.Attributes {
+	var folded parser.Attributes
+	for _, a := range attributes {
+		if a.Name != "align" && a.Name != "section" {
+			folded = append(folded, a)
+			continue
+		}
+		value, typ, ok := cg.evaluateConstant(a.Arguments[0])
+		switch {
+		case !ok:
+			cg.errorAt(a.Token, ErrNotConstant, "argument of @%s must be known at compile time", a.Name)
+		case a.Name == "align" && (typ != "Int" || !parser.PowerOfTwo(value.Int)):
+			cg.errorAt(a.Token, ErrAttribute, "@align expects a power of two")
+		case a.Name == "section" && (typ != "String" || !parser.ValidSectionName(value.String)):
+			cg.errorAt(a.Token, ErrAttribute, "@section expects a name such as '.text.boot'")
+		case a.Name == "align":
+			a.Arguments[0] = &parser.IntegerLiteral{Value: value.Int}
+			folded = append(folded, a)
+		default:
+			a.Arguments[0] = &parser.StringLiteral{Value: value.String}
+			folded = append(folded, a)
+		}
+	}
+	return folded
+}
+
+// pushSection switches to the section named by a @section attribute. GNU as
+// only knows the flags of standard sections, so they are always given: flags
+// are "ax" for code and "aw" for data, and zeroed data under a .bss name
+// takes no space in the file.
+func pushSection(section *parser.Attribute, flags string, zeroed bool) string {
+	name := section.Arguments[0].(*parser.StringLiteral).Value
+	kind := "@progbits"
+	if zeroed && (name == ".bss" || strings.HasPrefix(name, ".bss.")) {
+		kind = "@nobits"
+	}
+	return fmt.Sprintf(".pushsection %s, \"%s\", %s\n", name, flags, kind)
+}
+
+// symbolDirectives returns the directives that @align and @export (or
+// global, when the symbol must be exported anyway) ask for ahead of label
+func symbolDirectives(label string, attributes parser.Attributes, global bool) string {
+	var directives string
+	if a := attributes.Lookup("align"); a != nil {
+		directives += fmt.Sprintf("    .balign %d\n", a.Arguments[0].(*parser.IntegerLiteral).Value)
+	}
+	if global || attributes.Has("export") {
+		directives += fmt.Sprintf(".global %s\n", label)
+	}
+	return directives
+}
+
+// writeGlobals emits the storage of the global variables, in declaration order
+func (cg *CodeGenerator) writeGlobals() {
+	if len(cg.globalData) > 0 {
+		cg.output.WriteString("    .balign 8\n")
+		for _, definition := range cg.globalData {
+			cg.output.WriteString(definition)
+		}
+		cg.output.WriteString("\n")
+	}
+	if len(cg.globalBSS) > 0 {
+		cg.output.WriteString(".section .bss\n")
+		cg.output.WriteString("    .balign 8\n")
+		for _, definition := range cg.globalBSS {
+			cg.output.WriteString(definition)
+		}
+		cg.output.WriteString("\n")
+	}
+}
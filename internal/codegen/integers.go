@@ -0,0 +1,176 @@
+package codegen
+
+import "fmt"
+
+// Sized integers (Int8 ... Int64, UInt8 ... UInt64) take a whole slot like
+// Int, but their value is kept wrapped to their width: sign-extended for the
+// signed types and zero-extended for the unsigned ones, so 64-bit
+// instructions compare and print them correctly. Integer types convert to
+// each other implicitly, wrapping where the value does not fit, and UInt64
+// values compare unsigned.
+
+// integerWidth describes a sized integer type
+type integerWidth struct {
+	bits   int
+	signed bool
+}
+
+// integerTypes are the sized integer types; Int itself is a signed 64-bit
+// integer like Int64
+var integerTypes = map[string]integerWidth{
+	"Int8":   {8, true},
+	"Int16":  {16, true},
+	"Int32":  {32, true},
+	"Int64":  {64, true},
+	"UInt8":  {8, false},
+	"UInt16": {16, false},
+	"UInt32": {32, false},
+	"UInt64": {64, false},
+}
+
+// extendInstructions wraps the value in rax to a narrow integer type
+var extendInstructions = map[integerWidth]string{
+	{8, true}:   "movsx rax, al",
+	{16, true}:  "movsx rax, ax",
+	{32, true}:  "movsxd rax, eax",
+	{8, false}:  "movzx eax, al",
+	{16, false}: "movzx eax, ax",
+	{32, false}: "mov eax, eax",
+}
+
+// unsignedSetInstructions maps comparison operators to the setcc instruction
+// for UInt64, the one type whose values don't all fit in a signed Int
+var unsignedSetInstructions = map[string]string{
+	"==": "sete",
+	"!=": "setne",
+	"<":  "setb",
+	">":  "seta",
+	"<=": "setbe",
+	">=": "setae",
+}
+
+// isInteger reports whether typ is Int or one of the sized integer types
+func isInteger(typ string) bool {
+	_, sized := integerTypes[typ]
+	return typ == "Int" || sized
+}
+
+// wrapInteger emits the instruction that wraps the value in rax to the width
+// of typ; 64-bit types need none
+func (cg *CodeGenerator) wrapInteger(typ string) {
+	if instruction, ok := extendInstructions[integerTypes[typ]]; ok {
+		cg.output.WriteString(fmt.Sprintf("    %s    # wrap to %s\n", instruction, typ))
+	}
+}
+
+// wrapConstant is wrapInteger for a value known at compile time
+func wrapConstant(value int64, typ string) int64 {
+	switch integerTypes[typ] {
+	case integerWidth{8, true}:
+		return int64(int8(value))
+	case integerWidth{16, true}:
+		return int64(int16(value))
+	case integerWidth{32, true}:
+		return int64(int32(value))
+	case integerWidth{8, false}:
+		return int64(uint8(value))
+	case integerWidth{16, false}:
+		return int64(uint16(value))
+	case integerWidth{32, false}:
+		return int64(uint32(value))
+	}
+	return value
+}
+
+// integerResult is the type of arithmetic on two integers: the type they
+// share or, when they differ, UInt64 if either is one and Int otherwise
+func integerResult(leftType string, rightType string) string {
+	switch {
+	case leftType == rightType:
+		return leftType
+	case leftType == "UInt64" || rightType == "UInt64":
+		return "UInt64"
+	}
+	return "Int"
+}
+
+// generateDivision divides rax by rcx, both of the integer type typ, leaving
+// the quotient for / or the remainder for % in rax. Division truncates toward
+// zero, so the remainder takes the sign of the dividend. Dividing by zero
+// ends the program with an error; the most negative Int divided by -1, which
+// makes idiv fault, gives itself, as the negation wraps around.
+func (cg *CodeGenerator) generateDivision(operator string, typ string) {
+	cg.requireRuntime("division_by_zero")
+	cg.output.WriteString("    test rcx, rcx\n")
+	cg.output.WriteString("    jz division_by_zero\n")
+	if typ == "UInt64" {
+		cg.output.WriteString("    xor edx, edx\n")
+		cg.output.WriteString("    div rcx\n")
+	} else {
+		divide := cg.newLabel("divide")
+		done := cg.newLabel("divide_done")
+		cg.output.WriteString("    cmp rcx, -1\n")
+		cg.output.WriteString(fmt.Sprintf("    jne %s\n", divide))
+		cg.output.WriteString("    neg rax          # x / -1, which idiv faults on for the most negative Int\n")
+		cg.output.WriteString("    xor edx, edx     # x % -1 is 0\n")
+		cg.output.WriteString(fmt.Sprintf("    jmp %s\n", done))
+		cg.output.WriteString(fmt.Sprintf("%s:\n", divide))
+		cg.output.WriteString("    cqo\n")
+		cg.output.WriteString("    idiv rcx\n")
+		cg.output.WriteString(fmt.Sprintf("%s:\n", done))
+	}
+	if operator == "%" {
+		cg.output.WriteString("    mov rax, rdx     # remainder\n")
+	}
+}
+
+// foldDivision is generateDivision for values known at compile time; a zero
+// divisor is left to fail at run time
+func foldDivision(operator string, left, right int64, typ string) (constant, string, bool) {
+	var value int64
+	switch {
+	case right == 0:
+		return constant{}, "", false
+	case typ == "UInt64" && operator == "/":
+		value = int64(uint64(left) / uint64(right))
+	case typ == "UInt64":
+		value = int64(uint64(left) % uint64(right))
+	case right == -1 && operator == "/":
+		value = -left
+	case right == -1:
+		value = 0
+	case operator == "/":
+		value = left / right
+	default:
+		value = left % right
+	}
+	return constant{Int: wrapConstant(value, typ)}, typ, true
+}
+
+func (cg *CodeGenerator) generatePrintUintFunction() {
+	cg.output.WriteString("# print_uint function - writes an unsigned integer to stdout in decimal\n")
+	cg.output.WriteString("# Input: rdi = integer value\n")
+	cg.output.WriteString("print_uint:\n")
+	cg.output.WriteString("    push rbp\n")
+	cg.output.WriteString("    mov rbp, rsp\n")
+	cg.output.WriteString("    sub rsp, 32      # digit buffer, filled backwards from rbp\n")
+	cg.output.WriteString("    mov rax, rdi\n")
+	cg.output.WriteString("    lea rsi, [rbp - 1]\n")
+	cg.output.WriteString("    mov rcx, 10\n")
+	cg.output.WriteString("print_uint_loop:\n")
+	cg.output.WriteString("    xor edx, edx\n")
+	cg.output.WriteString("    div rcx          # rax = quotient, rdx = next digit\n")
+	cg.output.WriteString("    add dl, 48       # to ASCII\n")
+	cg.output.WriteString("    mov [rsi], dl\n")
+	cg.output.WriteString("    dec rsi\n")
+	cg.output.WriteString("    test rax, rax\n")
+	cg.output.WriteString("    jnz print_uint_loop\n")
+	cg.output.WriteString("    inc rsi          # first character\n")
+	cg.output.WriteString("    mov rdx, rbp\n")
+	cg.output.WriteString("    sub rdx, rsi     # length\n")
+	cg.output.WriteString("    mov rdi, 1       # stdout\n")
+	cg.syscall("write")
+	cg.output.WriteString("    mov rsp, rbp\n")
+	cg.output.WriteString("    pop rbp\n")
+	cg.output.WriteString("    ret\n\n")
+}
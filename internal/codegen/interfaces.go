@@ -0,0 +1,159 @@
+package codegen
+
+import (
+	"fmt"
+
+	"dreadlang/internal/lexer"
+	"dreadlang/internal/parser"
+)
+
+// An interface names methods that structs may have. A struct with every
+// one of them, taking the same parameters and returning the same type,
+// converts implicitly to the interface. An interface value takes one slot,
+// like an optional: the address of a heap cell holding the address of the
+// struct's vtable followed by a copy of the struct. The vtable lists the
+// struct's methods in the order the interface declares them, so a call
+// through the interface loads the method from it and passes the copy as the
+// receiver. The zero value, 0, holds no struct; calling a method on it
+// reports the error and exits.
+
+// interfaceType is an Interface declaration, whose methods are also in
+// cg.functions as Writer.Write, without a body
+type interfaceType struct {
+	Token   lexer.Token // the name where it was declared
+	Name    string
+	Methods []*parser.InterfaceMethod
+}
+
+// methodIndex returns the position of the method called name in the
+// interface's vtables
+func (it *interfaceType) methodIndex(name string) int {
+	for i, m := range it.Methods {
+		if m.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// defineInterface records an interface and a function declaration for each
+// of its methods, so that calls through it are checked like any other
+func (cg *CodeGenerator) defineInterface(stmt *parser.InterfaceStatement) {
+	if _, exists := cg.structs[stmt.Name]; exists || cg.interfaces[stmt.Name] != nil || cg.aliases[stmt.Name] != "" {
+		cg.errorAt(stmt.Token, ErrAlreadyDeclared, "type %s is already defined", stmt.Name)
+		return
+	}
+	it := &interfaceType{Token: stmt.Token, Name: stmt.Name}
+	for _, m := range stmt.Methods {
+		if it.methodIndex(m.Name) >= 0 {
+			cg.errorAt(m.Token, ErrAlreadyDeclared, "method %s is already defined in interface %s", m.Name, stmt.Name)
+			continue
+		}
+		for _, param := range m.Parameters {
+			param.Type = cg.aliased(param.Type)
+		}
+		m.ReturnType = cg.aliased(m.ReturnType)
+		it.Methods = append(it.Methods, m)
+		cg.functions[stmt.Name+"."+m.Name] = &parser.FunctionStatement{
+			Token:      m.Token,
+			Receiver:   &parser.Parameter{Token: stmt.Token, Type: stmt.Name},
+			NameToken:  m.Token,
+			Name:       m.Name,
+			Parameters: m.Parameters,
+			ReturnType: m.ReturnType,
+		}
+	}
+	cg.interfaces[stmt.Name] = it
+}
+
+// implements reports whether the struct called name has every method of it
+func (cg *CodeGenerator) implements(name string, it *interfaceType) bool {
+	for _, m := range it.Methods {
+		fn, ok := cg.functions[name+"."+m.Name]
+		if !ok || fn.ReturnType != m.ReturnType || len(fn.Parameters) != len(m.Parameters) {
+			return false
+		}
+		for i, param := range fn.Parameters {
+			if param.Type != m.Parameters[i].Type || param.Variadic != m.Parameters[i].Variadic {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// toInterface makes the struct of type typ an interface value of it. The
+// struct's address is in rax, or its slots are on the stack when onStack
+// is set; the interface value is left in rax.
+func (cg *CodeGenerator) toInterface(typ string, it *interfaceType, onStack bool) {
+	slots := cg.flatten(typ, typ)
+	vtable := cg.vtable(typ, it)
+	if !onStack {
+		cg.output.WriteString("    push rax         # the struct\n")
+	}
+	cg.requireRuntime("alloc")
+	cg.output.WriteString(fmt.Sprintf("    mov rdi, %d\n", 8*(len(slots)+1)))
+	cg.output.WriteString(fmt.Sprintf("    call alloc       # cell for %s as %s\n", typ, it.Name))
+	cg.output.WriteString(fmt.Sprintf("    lea rcx, [%s]\n", vtable))
+	cg.output.WriteString("    mov [rax], rcx\n")
+	if onStack {
+		// The first slot was pushed first, so it is the deepest
+		for i, s := range slots {
+			cg.output.WriteString(fmt.Sprintf("    mov rcx, [rsp + %d]\n", 8*(len(slots)-1-i)))
+			cg.output.WriteString(fmt.Sprintf("    mov [rax + %d], rcx    # %s\n", 8*(i+1), s.name))
+		}
+		cg.output.WriteString(fmt.Sprintf("    add rsp, %d\n", 8*len(slots)))
+		return
+	}
+	cg.output.WriteString("    pop rdx\n")
+	for i, s := range slots {
+		cg.output.WriteString(fmt.Sprintf("    mov rcx, [rdx + %d]\n", 8*i))
+		cg.output.WriteString(fmt.Sprintf("    mov [rax + %d], rcx    # %s\n", 8*(i+1), s.name))
+	}
+}
+
+// vtable returns the label of the vtable of the struct called name as it,
+// defining it the first time
+func (cg *CodeGenerator) vtable(name string, it *interfaceType) string {
+	label := fmt.Sprintf("vtable.%s.%s", name, it.Name)
+	if cg.vtables[label] {
+		return label
+	}
+	cg.vtables[label] = true
+	definition := fmt.Sprintf("%s:\n", label)
+	for _, m := range it.Methods {
+		definition += fmt.Sprintf("    .quad %s.%s\n", name, m.Name)
+	}
+	cg.globalData = append(cg.globalData, definition)
+	return label
+}
+
+// dispatch calls the method function of an interface, with the interface
+// value loaded as the first argument
+func (cg *CodeGenerator) dispatch(function string, it *interfaceType, method string) {
+	cg.requireRuntime("empty_interface")
+	cg.output.WriteString("    test rdi, rdi\n")
+	cg.output.WriteString("    jz empty_interface\n")
+	cg.output.WriteString("    mov rax, [rdi]   # vtable\n")
+	cg.output.WriteString("    add rdi, 8       # the struct it holds is the receiver\n")
+	cg.output.WriteString(fmt.Sprintf("    call qword ptr [rax + %d]    # %s\n", 8*it.methodIndex(method), function))
+}
+
+// interfaceErrorMessage is written to stderr, with a newline, when a method
+// is called on an interface value that holds no struct
+const interfaceErrorMessage = "method call on an empty interface"
+
+func (cg *CodeGenerator) generateEmptyInterfaceFunction() {
+	label := cg.getStringLabel(interfaceErrorMessage + "\n")
+	cg.output.WriteString("# empty_interface - jumped to when a method is called on an empty interface\n")
+	cg.output.WriteString("# Reports the error on stderr and exits; never returns\n")
+	cg.output.WriteString("empty_interface:\n")
+	cg.output.WriteString("    and rsp, -16     # the jump may come from any stack depth\n")
+	cg.output.WriteString("    mov rdi, 2       # stderr\n")
+	cg.output.WriteString(fmt.Sprintf("    lea rsi, [%s]\n", label))
+	cg.output.WriteString(fmt.Sprintf("    mov rdx, %d\n", len(interfaceErrorMessage)+1))
+	cg.syscall("write")
+	cg.output.WriteString("    mov rdi, 35      # exit status: method call on an empty interface\n")
+	cg.syscall("exit")
+	cg.output.WriteString("\n")
+}
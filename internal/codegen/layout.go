@@ -0,0 +1,65 @@
+package codegen
+
+import (
+	"fmt"
+
+	"dreadlang/internal/parser"
+)
+
+// Every value is kept in 8-byte slots: integers by value, strings as the
+// address of their bytes, arrays as one slot per element and structs as the
+// slots of their fields.
+
+// sizeOf returns the number of bytes a value of type typ occupies
+func (cg *CodeGenerator) sizeOf(typ string) int64 {
+	return 8 * int64(cg.slots(typ))
+}
+
+// alignOf returns the alignment in bytes of a value of type typ
+func alignOf(typ string) int64 {
+	return 8
+}
+
+// evaluateLayout folds SizeOf(Type) or AlignOf(Type); ok is false when the
+// call is not one of them with a single type argument
+func (cg *CodeGenerator) evaluateLayout(expr *parser.CallExpression) (value int64, ok bool) {
+	if expr.Function != "SizeOf" && expr.Function != "AlignOf" || expr.Receiver != nil || len(expr.Arguments) != 1 {
+		return 0, false
+	}
+	var typ string
+	switch arg := expr.Arguments[0].(type) {
+	case *parser.TypeExpression:
+		typ = arg.Name
+		if arg.Length != nil {
+			length, ok := cg.foldLength(arg.Length)
+			if !ok || length < 1 {
+				return 0, false
+			}
+			typ = fmt.Sprintf("%s[%d]", arg.Name, length)
+		}
+	case *parser.Identifier:
+		// A struct type or an alias is written as its plain name:
+		// SizeOf(Point)
+		typ = cg.aliased(arg.Value)
+		if _, isStruct := cg.structs[typ]; !isStruct && !isScalar(typ) && !isArray(typ) {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+	if expr.Function == "SizeOf" {
+		return cg.sizeOf(typ), true
+	}
+	return alignOf(typ), true
+}
+
+// generateLayout emits SizeOf(Type) or AlignOf(Type), which are known at
+// compile time
+func (cg *CodeGenerator) generateLayout(expr *parser.CallExpression) {
+	value, ok := cg.evaluateLayout(expr)
+	if !ok {
+		cg.errorAt(expr.Token, ErrBuiltinArguments, "%s expects a type such as Int, Int[4] or a struct name", expr.Function)
+		return
+	}
+	cg.output.WriteString(fmt.Sprintf("    mov rax, %d    # %s\n", value, comment(expr)))
+}
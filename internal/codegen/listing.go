@@ -0,0 +1,249 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FormatAssembly lays out what Generate returned for reading, as
+// --emit=asm prints it: the instructions in columns of mnemonics, operands
+// and comments, a banner above each function and runtime helper, and an
+// index of the symbols at the top with the line each is defined on. Only
+// comments and spaces change, so the listing assembles to the same program.
+
+// Columns of an instruction line: a mnemonic or operands longer than these
+// push what follows them to the right instead of widening every line
+const (
+	maxMnemonicWidth = 10
+	maxOperandWidth  = 28
+)
+
+// bannerRule is the line above and below the name in a banner
+var bannerRule = "# " + strings.Repeat("=", 62)
+
+// indexEntry is a symbol of the index
+type indexEntry struct {
+	section string
+	name    string
+	kind    string
+	line    int // index in the body
+}
+
+// FormatAssembly returns assembly laid out as a listing
+func (cg *CodeGenerator) FormatAssembly(assembly string) string {
+	lines := strings.Split(strings.TrimSuffix(assembly, "\n"), "\n")
+	kinds := cg.symbolKinds()
+	mnemonicWidth, operandWidth := columnWidths(lines)
+
+	var body []string
+	var entries []indexEntry
+	sections := []string{""}
+	for _, line := range lines {
+		section := sections[len(sections)-1]
+		switch fields := strings.Fields(line); {
+		case len(fields) == 0:
+		case fields[0] == ".section" && len(fields) > 1:
+			sections[len(sections)-1] = strings.TrimSuffix(fields[1], ",")
+		case fields[0] == ".pushsection" && len(fields) > 1:
+			sections = append(sections, strings.TrimSuffix(fields[1], ","))
+		case fields[0] == ".popsection" && len(sections) > 1:
+			sections = sections[:len(sections)-1]
+		case fields[0] == ".text" || fields[0] == ".data" || fields[0] == ".bss":
+			sections[len(sections)-1] = fields[0]
+		}
+
+		if name, ok := definedSymbol(line); ok && section != ".comment" {
+			kind, known := kinds[name]
+			switch {
+			case kind == "entry" || kind == "function" || kind == "runtime" || kind == "hook":
+				var start, added int
+				body, start, added = insertBanner(body, kind+" "+name)
+				for i := range entries {
+					if entries[i].line >= start {
+						entries[i].line += added
+					}
+				}
+			case !known && strings.HasPrefix(section, ".text"):
+				// A label inside a function
+				body = append(body, line)
+				continue
+			case !known:
+				kind = "data"
+			}
+			entries = append(entries, indexEntry{section, name, kind, len(body)})
+			body = append(body, line)
+			continue
+		}
+		body = append(body, formatInstruction(line, mnemonicWidth, operandWidth))
+	}
+
+	header := symbolIndex(entries)
+	var out strings.Builder
+	for _, line := range header {
+		out.WriteString(line + "\n")
+	}
+	for _, line := range body {
+		out.WriteString(line + "\n")
+	}
+	return out.String()
+}
+
+// symbolKinds names what each symbol cg defined is, by its label
+func (cg *CodeGenerator) symbolKinds() map[string]string {
+	kinds := make(map[string]string)
+	for _, label := range cg.stringConstants {
+		kinds[label] = "string"
+	}
+	for _, v := range cg.globals {
+		if v.Global != "" {
+			kinds[v.Global] = "global"
+		}
+	}
+	for label := range cg.vtables {
+		kinds[label] = "vtable"
+	}
+	for _, name := range append([]string{"strlen", "print_string", "print_int"}, cg.runtimeUsed...) {
+		kinds[name] = "runtime"
+	}
+	if cg.target.defaultHooks {
+		for _, hook := range cg.target.syscallFunctions {
+			kinds[hook] = "hook"
+		}
+	}
+	for symbol, fn := range cg.functions {
+		if !fn.IsEntry {
+			kinds[symbol] = "function"
+		}
+	}
+	kinds[cg.target.entrySymbol] = "entry"
+	return kinds
+}
+
+// definedSymbol returns the symbol a line defines, as a label or with =
+func definedSymbol(line string) (string, bool) {
+	if line == "" || line[0] == ' ' || line[0] == '.' || line[0] == '#' {
+		return "", false
+	}
+	if name, _, ok := strings.Cut(line, ":"); ok && !strings.ContainsAny(name, " \t") {
+		return name, true
+	}
+	if name, _, ok := strings.Cut(line, " = "); ok && !strings.ContainsAny(name, " \t") {
+		return name, true
+	}
+	return "", false
+}
+
+// columnWidths measures the mnemonic column and the operand column of the
+// instructions with a comment
+func columnWidths(lines []string) (mnemonicWidth, operandWidth int) {
+	for _, line := range lines {
+		mnemonic, operands, comment, ok := splitInstruction(line)
+		if !ok {
+			continue
+		}
+		if n := len(mnemonic); n > mnemonicWidth && n <= maxMnemonicWidth {
+			mnemonicWidth = n
+		}
+		if n := len(operands); comment != "" && n > operandWidth && n <= maxOperandWidth {
+			operandWidth = n
+		}
+	}
+	return mnemonicWidth, operandWidth
+}
+
+// splitInstruction splits an indented instruction line; ok is false for
+// any other line, such as a comment or a directive
+func splitInstruction(line string) (mnemonic, operands, comment string, ok bool) {
+	if !strings.HasPrefix(line, "    ") {
+		return "", "", "", false
+	}
+	code := strings.TrimSpace(line)
+	if code == "" || code[0] == '#' || code[0] == '.' {
+		return "", "", "", false
+	}
+	if i := strings.Index(code, "#"); i >= 0 {
+		code, comment = strings.TrimSpace(code[:i]), strings.TrimSpace(code[i+1:])
+	}
+	mnemonic, operands, _ = strings.Cut(code, " ")
+	return mnemonic, strings.TrimSpace(operands), comment, true
+}
+
+// formatInstruction lays out an instruction line in the columns, and
+// returns any other line as it is
+func formatInstruction(line string, mnemonicWidth, operandWidth int) string {
+	mnemonic, operands, comment, ok := splitInstruction(line)
+	if !ok {
+		return line
+	}
+	code := "    " + mnemonic
+	if operands != "" || comment != "" {
+		code = fmt.Sprintf("    %-*s %s", mnemonicWidth, mnemonic, operands)
+	}
+	if comment == "" {
+		return strings.TrimRight(code, " ")
+	}
+	return fmt.Sprintf("%-*s  # %s", 4+mnemonicWidth+1+operandWidth, code, comment)
+}
+
+// insertBanner adds a banner naming a function before the lines that
+// introduce its label, after a blank line, and returns where it went and
+// how many lines it took
+func insertBanner(body []string, title string) ([]string, int, int) {
+	start := len(body)
+	for start > 0 && introduces(body[start-1]) {
+		start--
+	}
+	banner := []string{bannerRule, "# " + title, bannerRule}
+	if start > 0 && body[start-1] != "" {
+		banner = append([]string{""}, banner...)
+	}
+	return append(body[:start], append(banner, body[start:]...)...), start, len(banner)
+}
+
+// introduces reports whether line belongs to the label after it: a comment
+// describing it, a directive other than a switch of the section, or the
+// data a runtime helper keeps next to its code
+func introduces(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	switch {
+	case trimmed == "":
+		return false
+	case strings.HasPrefix(line, "#"):
+		return true
+	case trimmed[0] == '.':
+		return !strings.HasPrefix(trimmed, ".section") && trimmed != ".text" && trimmed != ".data" && trimmed != ".bss"
+	}
+	_, definition, ok := strings.Cut(line, ": ")
+	return ok && strings.HasPrefix(definition, ".")
+}
+
+// symbolIndex renders the index of entries, by section in the order they
+// first appear, with the line of the listing each is defined on
+func symbolIndex(entries []indexEntry) []string {
+	var sections []string
+	bySection := make(map[string][]indexEntry)
+	nameWidth := 0
+	for _, e := range entries {
+		if _, seen := bySection[e.section]; !seen {
+			sections = append(sections, e.section)
+		}
+		bySection[e.section] = append(bySection[e.section], e)
+		if len(e.name) > nameWidth {
+			nameWidth = len(e.name)
+		}
+	}
+	// Two lines above the sections, one per section and one below
+	lines := 2 + len(sections) + len(entries) + 1
+	header := []string{"# Symbol index", "#"}
+	for _, section := range sections {
+		name := section
+		if name == "" {
+			name = "(no section)"
+		}
+		header = append(header, "# "+name)
+		for _, e := range bySection[section] {
+			header = append(header, fmt.Sprintf("#   %-*s  %-8s  line %d", nameWidth, e.name, e.kind, lines+e.line+1))
+		}
+	}
+	return append(header, "")
+}
@@ -0,0 +1,103 @@
+package codegen
+
+import (
+	"fmt"
+
+	"dreadlang/internal/ir"
+	"dreadlang/internal/lexer"
+	"dreadlang/internal/parser"
+)
+
+// Arithmetic and comparisons of Int values go through the IR
+// (internal/ir): lower translates a tree of them into a block of
+// three-address code, the passes run on a copy of it, and the block's
+// x86-64 backend keeps the operands in registers instead of pushing the
+// left one while the right one is computed. An expression the IR does not
+// cover, or that needs more registers than the backend has, takes the
+// direct path of generateInfixExpression.
+
+// lowering is the state of lowering one expression
+type lowering struct {
+	block ir.Block
+	names []loweredName // the names it reads, in source order
+}
+
+// loweredName is a variable or constant read by a lowered expression
+type loweredName struct {
+	token    lexer.Token
+	variable *variable
+}
+
+// generateLowered generates expr through the IR, which is an experiment
+// limited to Int expressions. It reports false, having emitted at most a
+// comment, when the IR does not cover expr.
+func (cg *CodeGenerator) generateLowered(expr *parser.InfixExpression) bool {
+	l := &lowering{}
+	result, ok := cg.lower(l, expr)
+	if !ok {
+		return false
+	}
+	l.block.Result = result
+	l.block.Label = fmt.Sprintf("%d:%d", expr.Token.Line, expr.Token.Column)
+	optimized := l.block.Clone()
+	if err := cg.Passes().Run(optimized); err != nil {
+		cg.errorAt(expr.Token, ErrInternal, "internal compiler error: %v", err)
+		return false
+	}
+	assembly, ok := optimized.AMD64()
+	if !ok {
+		cg.output.WriteString(fmt.Sprintf("    # %s: not lowered, needs more than %d registers\n", l.block.Label, ir.ScratchRegisters))
+		return false
+	}
+	for _, name := range l.names {
+		cg.refer(name.token, name.variable)
+	}
+	cg.current.lowered = append(cg.current.lowered, &l.block)
+	cg.output.WriteString(assembly)
+	return true
+}
+
+// IR returns the IR of the expressions Generate lowered, in the functions
+// that contain them, as it was before the passes ran on it. Only Int
+// arithmetic and comparisons are lowered; the rest of the program has none.
+func (cg *CodeGenerator) IR() *ir.Program {
+	return &cg.lowered
+}
+
+// lower appends the instructions computing expr, an Int, to l and returns
+// the operand holding its value
+func (cg *CodeGenerator) lower(l *lowering, expr parser.Expression) (ir.Operand, bool) {
+	switch e := expr.(type) {
+	case *parser.IntegerLiteral:
+		return ir.Int(e.Value), true
+	case *parser.Identifier:
+		v, exists := cg.lookupVariable(e.Value)
+		if !exists || v.Type != "Int" || v.Unwrapped {
+			return ir.Operand{}, false
+		}
+		l.names = append(l.names, loweredName{e.Token, v})
+		if v.Constant != nil {
+			return ir.Int(v.Constant.Int), true
+		}
+		if v.Global != "" {
+			return ir.Global(e.Value, v.Global), true
+		}
+		// An Int takes one slot, so its offset is a whole number of them
+		return ir.Slot(e.Value, v.Offset/8), true
+	case *parser.InfixExpression:
+		op, ok := ir.Operators[e.Operator]
+		if !ok {
+			return ir.Operand{}, false
+		}
+		x, ok := cg.lower(l, e.Left)
+		if !ok {
+			return ir.Operand{}, false
+		}
+		y, ok := cg.lower(l, e.Right)
+		if !ok {
+			return ir.Operand{}, false
+		}
+		return l.block.Apply(op, x, y), true
+	}
+	return ir.Operand{}, false
+}
@@ -0,0 +1,136 @@
+package codegen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"dreadlang/internal/ir"
+	"dreadlang/internal/parser"
+)
+
+// Optimizations are off by default and enabled by level with SetOptimization:
+//
+//	1  consecutive Prints of constants become one write of their joined text,
+//	   Prints of integers known to be in 0..255 write their digits from a
+//	   table rather than dividing, the IR passes of level 1 run on the
+//	   lowered expressions, and calls of pure functions with constant
+//	   arguments are evaluated at compile time (evaluate.go)
+
+// SetOptimization sets the optimization level of the generated code
+func (cg *CodeGenerator) SetOptimization(level int) {
+	cg.optimization = level
+}
+
+// SetPasses sets the passes that run on the IR of lowered expressions, in
+// place of those of the optimization level
+func (cg *CodeGenerator) SetPasses(pm *ir.PassManager) {
+	cg.passes = pm
+}
+
+// Passes returns the pass manager that runs on the IR
+func (cg *CodeGenerator) Passes() *ir.PassManager {
+	if cg.passes == nil {
+		// Every level's passes exist, so there is nothing to fail
+		cg.passes, _ = ir.NewPassManager(cg.optimization, "")
+	}
+	return cg.passes
+}
+
+// fusePrints generates the run of Prints of constants that stmts starts with
+// as one write and returns how many statements it covered, or 0 when there
+// are fewer than two of them
+func (cg *CodeGenerator) fusePrints(stmts []parser.Statement) int {
+	var text []byte
+	n := 0
+	for ; n < len(stmts); n++ {
+		bytes, ok := cg.printedConstant(stmts[n])
+		if !ok {
+			break
+		}
+		text = append(text, bytes...)
+	}
+	if n < 2 {
+		return 0
+	}
+
+	for _, stmt := range stmts[:n] {
+		cg.output.WriteString(fmt.Sprintf("    # %s (fused)\n", comment(stmt)))
+	}
+	cg.generatePrintConstant(string(text))
+	return n
+}
+
+// printedConstant returns the bytes stmt writes if it is a Print of a
+// String, Int or Char constant
+func (cg *CodeGenerator) printedConstant(stmt parser.Statement) ([]byte, bool) {
+	call, ok := stmt.(*parser.CallStatement)
+	if !ok || call.Function != "Print" || len(call.Arguments) == 0 {
+		return nil, false
+	}
+	value, typ, ok := cg.evaluateConstant(call.Arguments[0])
+	switch {
+	case !ok:
+		return nil, false
+	case typ == "String":
+		return stringBytes(value.String), true
+	case typ == "UInt64":
+		return strconv.AppendUint(nil, uint64(value.Int), 10), true
+	case isInteger(typ):
+		return strconv.AppendInt(nil, value.Int, 10), true
+	case typ == "Char" && value.Int != 0:
+		// A zero byte would end the joined text early
+		return []byte{byte(value.Int)}, true
+	}
+	return nil, false
+}
+
+// isSmallInteger reports whether expr, an integer of type typ, is known to be
+// in 0..255 without running the program: a UInt8, the code from Ord, or a
+// constant in that range
+func (cg *CodeGenerator) isSmallInteger(expr parser.Expression, typ string) bool {
+	if typ == "UInt8" {
+		return true
+	}
+	if call, ok := expr.(*parser.CallExpression); ok && call.Function == "Ord" && call.Receiver == nil {
+		return true
+	}
+	value, _, ok := cg.evaluateConstant(expr)
+	return ok && value.Int >= 0 && value.Int <= 255
+}
+
+func (cg *CodeGenerator) generatePrintSmallIntFunction() {
+	cg.output.WriteString("# print_small_int function - writes an integer in 0..255 to stdout\n")
+	cg.output.WriteString("# Each table entry is the length of the decimal text and its up to 3 digits\n")
+	cg.output.WriteString("# Input: rdi = integer value\n")
+	cg.output.WriteString("    .pushsection .rodata\n")
+	cg.output.WriteString("small_int_digits:\n")
+	for row := 0; row < 256; row += 8 {
+		var entries []string
+		for n := row; n < row+8; n++ {
+			digits := strconv.Itoa(n)
+			entry := []string{strconv.Itoa(len(digits))}
+			for i := 0; i < 3; i++ {
+				if i < len(digits) {
+					entry = append(entry, strconv.Itoa(int(digits[i])))
+				} else {
+					entry = append(entry, "0")
+				}
+			}
+			entries = append(entries, strings.Join(entry, ", "))
+		}
+		cg.output.WriteString(fmt.Sprintf("    .byte %s    # %d..%d\n", strings.Join(entries, ", "), row, row+7))
+	}
+	cg.output.WriteString("    .popsection\n")
+	cg.output.WriteString("print_small_int:\n")
+	cg.output.WriteString("    push rbp\n")
+	cg.output.WriteString("    mov rbp, rsp\n")
+	cg.output.WriteString("    lea rsi, [small_int_digits + rdi*4]\n")
+	cg.output.WriteString("    movzx edx, byte ptr [rsi]    # length\n")
+	cg.output.WriteString("    inc rsi          # first digit\n")
+	cg.output.WriteString("    mov rdi, 1       # stdout\n")
+	cg.syscall("write")
+	cg.output.WriteString("    mov rsp, rbp\n")
+	cg.output.WriteString("    pop rbp\n")
+	cg.output.WriteString("    ret\n\n")
+}
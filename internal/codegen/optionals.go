@@ -0,0 +1,162 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+
+	"dreadlang/internal/lexer"
+	"dreadlang/internal/parser"
+)
+
+// Optional types are written with a ?, as in Int? or String?, and hold either
+// a value of their base type or nil. An optional is the address of a heap
+// cell holding the value, and nil is 0, so it takes one slot like any other
+// scalar. Values of the base type, and nil, convert to the optional
+// implicitly; the other way, the value must first be checked: inside
+// If (x != nil), or after If (x == nil) in the rest of the chain, x has its
+// base type, and a ?? b gives the value of a or, when a is nil, b.
+
+// nilType is the type of the nil literal, which converts to every optional
+const nilType = "nil"
+
+// optionalBase returns the base type of an optional type such as Int?
+func optionalBase(typ string) (string, bool) {
+	return strings.CutSuffix(typ, "?")
+}
+
+// isOptional reports whether typ is an optional type or the type of nil
+func isOptional(typ string) bool {
+	_, ok := optionalBase(typ)
+	return ok || typ == nilType
+}
+
+// box stores the value in rax in a new cell and leaves its address in rax
+func (cg *CodeGenerator) box() {
+	cg.requireRuntime("box")
+	cg.output.WriteString("    mov rdi, rax\n")
+	cg.output.WriteString("    call box\n")
+}
+
+// checkUnwrapped reports the use of expr, of type typ, as a plain value when
+// it is optional or a result, and returns whether it is not
+func (cg *CodeGenerator) checkUnwrapped(tok lexer.Token, expr parser.Expression, typ string) bool {
+	if !cg.checkResult(tok, expr, typ) {
+		return false
+	}
+	if typ == nilType {
+		cg.errorAt(tok, ErrUncheckedOptional, "nil can only be used as an optional value")
+		return false
+	}
+	if isOptional(typ) {
+		if ident, ok := expr.(*parser.Identifier); ok {
+			if v, exists := cg.lookupVariable(ident.Value); exists && v.Global != "" {
+				cg.errorAt(tok, ErrUncheckedOptional, "%s is a global %s and may be nil: copy it to a local variable to check it, or give a default with ??", comment(expr), typ)
+				return false
+			}
+		}
+		cg.errorAt(tok, ErrUncheckedOptional, "%s is %s and may be nil: compare it with nil in an If or give a default with ??", comment(expr), typ)
+		return false
+	}
+	return true
+}
+
+// nilCheck returns the variable an If condition compares with nil, and
+// whether the comparison is == rather than !=
+func nilCheck(condition parser.Expression) (name string, isNil bool, ok bool) {
+	infix, ok := condition.(*parser.InfixExpression)
+	if !ok || infix.Operator != "==" && infix.Operator != "!=" {
+		return "", false, false
+	}
+	ident, ok := infix.Left.(*parser.Identifier)
+	other := infix.Right
+	if !ok {
+		ident, ok = infix.Right.(*parser.Identifier)
+		other = infix.Left
+	}
+	if _, isNilLiteral := other.(*parser.NilLiteral); !ok || !isNilLiteral {
+		return "", false, false
+	}
+	return ident.Value, infix.Operator == "==", true
+}
+
+// narrow makes the optional variable name hold its base type in a new
+// innermost scope, which the caller pops when the check no longer holds.
+// Only locals and parameters are narrowed: any call in the branch may set
+// a global back to nil.
+func (cg *CodeGenerator) narrow(name string) {
+	cg.pushScope()
+	v, exists := cg.lookupVariable(name)
+	if !exists || v.Constant != nil || v.Global != "" {
+		return
+	}
+	base, ok := optionalBase(v.Type)
+	if !ok {
+		return
+	}
+	cg.current.scopes[len(cg.current.scopes)-1][name] = &variable{Type: base, Offset: v.Offset, Global: v.Global, Declared: true, Unwrapped: true, Parameter: v.Parameter, Declaration: v.Declaration}
+}
+
+// generateOptionalInfix compares an optional with nil; its operands are in
+// rax and rcx. Any other operator on an optional is reported.
+func (cg *CodeGenerator) generateOptionalInfix(expr *parser.InfixExpression, leftType string, rightType string) string {
+	if expr.Operator == "==" || expr.Operator == "!=" {
+		if leftType == nilType && isOptional(rightType) || rightType == nilType && isOptional(leftType) {
+			cg.output.WriteString("    cmp rax, rcx\n")
+			cg.output.WriteString(fmt.Sprintf("    %s al\n", setInstructions[expr.Operator]))
+			cg.output.WriteString("    movzx rax, al\n")
+			return "Int"
+		}
+	}
+	if leftType != nilType && isOptional(leftType) {
+		cg.checkUnwrapped(expr.Token, expr.Left, leftType)
+	} else if rightType != nilType && isOptional(rightType) {
+		cg.checkUnwrapped(expr.Token, expr.Right, rightType)
+	} else {
+		cg.errorAt(expr.Token, ErrTypeMismatch, "cannot apply %s to %s and %s", expr.Operator, leftType, rightType)
+	}
+	return "Int"
+}
+
+// generateDefault emits a ?? b: the value of the optional a if it holds one,
+// or else b, which is only evaluated then
+func (cg *CodeGenerator) generateDefault(expr *parser.InfixExpression) string {
+	valueLabel := cg.newLabel("default_value")
+	endLabel := cg.newLabel("default_end")
+
+	typ := cg.generateExpression(expr.Left)
+	if isResult(typ) && typ != errorType {
+		return cg.generateResultDefault(expr, typ)
+	}
+	base, ok := optionalBase(typ)
+	if !ok {
+		cg.errorAt(expr.Token, ErrTypeMismatch, "left side of ?? must be optional, got %s", typ)
+		return typ
+	}
+	cg.output.WriteString("    test rax, rax\n")
+	cg.output.WriteString(fmt.Sprintf("    jne %s\n", valueLabel))
+	if rightType := cg.convert(cg.generateExpression(expr.Right), base); rightType != base {
+		cg.errorAt(expr.Token, ErrTypeMismatch, "default for %s must be %s, got %s", comment(expr.Left), base, rightType)
+	}
+	cg.output.WriteString(fmt.Sprintf("    jmp %s\n", endLabel))
+	cg.output.WriteString(fmt.Sprintf("%s:\n", valueLabel))
+	cg.output.WriteString("    mov rax, [rax]   # the value held\n")
+	cg.output.WriteString(fmt.Sprintf("%s:\n", endLabel))
+	return base
+}
+
+func (cg *CodeGenerator) generateBoxFunction() {
+	cg.output.WriteString("# box function - stores a value in a new cell, making it an optional\n")
+	cg.output.WriteString("# Input: rdi = the value\n")
+	cg.output.WriteString("# Output: rax = address of the cell\n")
+	cg.output.WriteString("box:\n")
+	cg.output.WriteString("    push rbp\n")
+	cg.output.WriteString("    mov rbp, rsp\n")
+	cg.output.WriteString("    push rdi\n")
+	cg.output.WriteString("    mov rdi, 8\n")
+	cg.output.WriteString("    call alloc\n")
+	cg.output.WriteString("    pop rcx\n")
+	cg.output.WriteString("    mov [rax], rcx\n")
+	cg.output.WriteString("    mov rsp, rbp\n")
+	cg.output.WriteString("    pop rbp\n")
+	cg.output.WriteString("    ret\n\n")
+}
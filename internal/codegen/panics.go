@@ -0,0 +1,88 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+
+	"dreadlang/internal/parser"
+)
+
+// Panic('message') stops the program: it writes the message to stderr,
+// followed by the name of the function that panicked, and exits with
+// panicStatus. The compiler embeds each function's name as a string in the
+// data section, and the call site passes its address to the runtime along
+// with the message, so a panic needs no symbol table at run time:
+//
+//	panic: out of stock
+//	    in restock
+
+// panicStatus is the exit status of a program stopped by Panic
+const panicStatus = 37
+
+// functionName returns the name a panic reports for the function with the
+// given symbol: methods are Type.Method, and instances of generic functions
+// are written with their type arguments, as in Max[Int]
+func functionName(symbol string) string {
+	name, arguments, ok := strings.Cut(symbol, typeSeparator)
+	if !ok {
+		return symbol
+	}
+	return name + "[" + strings.ReplaceAll(arguments, typeSeparator, ", ") + "]"
+}
+
+// generatePanic emits Panic(message), which never returns
+func (cg *CodeGenerator) generatePanic(expr *parser.CallExpression) {
+	if len(expr.Arguments) != 1 {
+		cg.errorAt(expr.Token, ErrBuiltinArguments, "Panic expects a String message")
+		return
+	}
+	cg.output.WriteString(fmt.Sprintf("    # %s\n", comment(expr)))
+	if typ := cg.convert(cg.generateExpression(expr.Arguments[0]), "String"); typ != "String" {
+		cg.errorAt(expr.Token, ErrTypeMismatch, "Panic expects a String message, got %s", typ)
+	}
+	cg.requireRuntime("panic")
+	cg.output.WriteString("    mov rdi, rax     # the message\n")
+	cg.output.WriteString(fmt.Sprintf("    lea rsi, [%s]    # the function panicking: %s\n", cg.getStringLabel(cg.current.name), cg.current.name))
+	cg.output.WriteString("    jmp panic\n")
+}
+
+func (cg *CodeGenerator) generatePanicFunction() {
+	prefix := cg.getStringLabel("panic: ")
+	location := cg.getStringLabel("\n    in ")
+	newline := cg.getStringLabel("\n")
+	cg.output.WriteString("# panic - jumped to by Panic(message)\n")
+	cg.output.WriteString("# Input: rdi = the message, rsi = the name of the function panicking\n")
+	cg.output.WriteString("# Writes both on stderr and exits; never returns\n")
+	cg.output.WriteString("panic:\n")
+	cg.output.WriteString("    and rsp, -16     # the jump may come from any stack depth\n")
+	cg.output.WriteString("    push rsi\n")
+	cg.output.WriteString("    push rdi\n")
+	cg.writeStderr(prefix, len("panic: "))
+	cg.output.WriteString("    pop rdi\n")
+	cg.writeStderrString()
+	cg.writeStderr(location, len("\n    in "))
+	cg.output.WriteString("    pop rdi\n")
+	cg.writeStderrString()
+	cg.writeStderr(newline, 1)
+	cg.output.WriteString(fmt.Sprintf("    mov rdi, %d      # exit status: panic\n", panicStatus))
+	cg.syscall("exit")
+	cg.output.WriteString("\n")
+}
+
+// writeStderr writes length bytes at label to stderr
+func (cg *CodeGenerator) writeStderr(label string, length int) {
+	cg.output.WriteString("    mov rdi, 2       # stderr\n")
+	cg.output.WriteString(fmt.Sprintf("    lea rsi, [%s]\n", label))
+	cg.output.WriteString(fmt.Sprintf("    mov rdx, %d\n", length))
+	cg.syscall("write")
+}
+
+// writeStderrString writes the null-terminated string in rdi to stderr
+func (cg *CodeGenerator) writeStderrString() {
+	cg.output.WriteString("    push rdi\n")
+	cg.output.WriteString("    call strlen\n")
+	cg.output.WriteString("    mov rdx, rax     # length\n")
+	cg.output.WriteString("    pop rsi\n")
+	cg.output.WriteString("    mov rdi, 2       # stderr\n")
+	cg.syscall("write")
+}
@@ -0,0 +1,64 @@
+package codegen
+
+import (
+	"strings"
+
+	"dreadlang/internal/lexer"
+	"dreadlang/internal/parser"
+)
+
+// Pragmas apply to the file that holds them. The program reaches the code
+// generator as one list of statements, so each is keyed by the file of its
+// token, which every declaration's tokens share:
+//
+//   - #pragma strict makes assigning to a variable that was never declared
+//     an error, where it would otherwise declare it. A For's loop variable
+//     is still declared by its first assignment.
+//   - #pragma target('linux') stops the file from compiling for any other
+//     target. The argument names a target, such as 'amd64-linux', or its
+//     operating system, the part after the -.
+
+// collectPragmas records the strict files of program and checks that the
+// target is one every file allows
+func (cg *CodeGenerator) collectPragmas(program *parser.Program) {
+	for _, pr := range program.Pragmas {
+		switch pr.Name {
+		case "strict":
+			cg.strict[pr.Token.File] = true
+		case "target":
+			// The parser only records a target with one String literal
+			name := pr.Arguments[0].(*parser.StringLiteral)
+			if !knownTarget(name.Value) {
+				cg.errorAt(pr.Token, ErrWrongTarget, "unknown target '%s'", name.Value)
+			} else if !cg.target.matches(name.Value) {
+				cg.errorAt(pr.Token, ErrWrongTarget, "file only compiles for target '%s', not %s", name.Value, cg.target.Name)
+			}
+		}
+	}
+}
+
+// matches reports whether name is the target's name or its operating system
+func (t *Target) matches(name string) bool {
+	_, system, _ := strings.Cut(t.Name, "-")
+	return name == t.Name || name == system
+}
+
+// knownTarget reports whether name is a target or an operating system one
+// of them is for
+func knownTarget(name string) bool {
+	for _, t := range targets {
+		if t.matches(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkStrict reports the first assignment to name, at tok, when it is in a
+// strict file. The variable is declared all the same, so that its uses are
+// not reported as well.
+func (cg *CodeGenerator) checkStrict(tok lexer.Token, name string) {
+	if cg.strict[tok.File] {
+		cg.errorAt(tok, ErrUndefinedVariable, "variable %s is not declared: #pragma strict requires Var %s Type before assigning it", name, name)
+	}
+}
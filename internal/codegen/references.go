@@ -0,0 +1,71 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+
+	"dreadlang/internal/lexer"
+	"dreadlang/internal/parser"
+)
+
+// Reference records what a name in the source refers to, for tools that
+// ask about a position, such as the type of the name under the cursor. The
+// code generator records one wherever it resolves a variable, constant or
+// function, and wherever one is declared.
+type Reference struct {
+	Token       lexer.Token // the name
+	Kind        string      // "variable", "constant" or "function"
+	Scope       string      // "parameter", "local" or "global"; "method" for a function with a receiver
+	Type        string      // a function's is its signature: sum(values Int...) Int
+	Declaration lexer.Token // the name where it was declared
+}
+
+// References returns the references recorded by Generate, in the order the
+// names were generated
+func (cg *CodeGenerator) References() []Reference {
+	return cg.references
+}
+
+// refer records that tok names the variable or constant v
+func (cg *CodeGenerator) refer(tok lexer.Token, v *variable) {
+	kind := "variable"
+	if v.Constant != nil {
+		kind = "constant"
+	}
+	scope := "local"
+	switch {
+	case v.Parameter:
+		scope = "parameter"
+	case v.Global != "" || cg.globals[v.Declaration.Literal] == v:
+		scope = "global"
+	}
+	cg.checkVisible(tok, v.Declaration, kind)
+	cg.references = append(cg.references, Reference{Token: tok, Kind: kind, Scope: scope, Type: v.Type, Declaration: v.Declaration})
+}
+
+// referFunction records that tok names the function or method fn
+func (cg *CodeGenerator) referFunction(tok lexer.Token, fn *parser.FunctionStatement) {
+	scope := "global"
+	if fn.Receiver != nil {
+		scope = "method"
+	}
+	cg.checkVisible(tok, fn.NameToken, "function")
+	cg.references = append(cg.references, Reference{Token: tok, Kind: "function", Scope: scope, Type: Signature(fn), Declaration: fn.NameToken})
+}
+
+// Signature renders how fn is called: its name, parameters and result
+func Signature(fn *parser.FunctionStatement) string {
+	params := make([]string, len(fn.Parameters))
+	for i, param := range fn.Parameters {
+		params[i] = param.String()
+	}
+	result := ""
+	if fn.ReturnType != "" && fn.ReturnType != "Void" {
+		result = " " + fn.ReturnType
+	}
+	name := fn.Name
+	if fn.Receiver != nil {
+		name = fmt.Sprintf("(%s) %s", fn.Receiver.String(), fn.Name)
+	}
+	return fmt.Sprintf("%s(%s)%s", name, strings.Join(params, ", "), result)
+}
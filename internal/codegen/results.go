@@ -0,0 +1,204 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+
+	"dreadlang/internal/lexer"
+	"dreadlang/internal/parser"
+)
+
+// Result types are written with a !, as in Int! or Void!, and hold either a
+// value of their base type or an error, made by Error('message'). A result
+// is 0 for a success holding the zero value, or else the address of a heap
+// cell holding the error's message, or 0, followed by the value, so it takes
+// one slot like an optional. Values of the base type, and errors, convert to
+// the result implicitly. Try(r) gives the value of r; when r holds an error
+// it jumps to the Catch of the enclosing Try block, or returns the error
+// from the function, which must return a result itself. In Entry, an error
+// that nothing catches stops the program.
+
+// errorType is the type of Error('message'), which converts to every result
+const errorType = "error"
+
+// resultBase returns the base type of a result type such as Int!
+func resultBase(typ string) (string, bool) {
+	return strings.CutSuffix(typ, "!")
+}
+
+// isResult reports whether typ is a result type or the type of an error
+func isResult(typ string) bool {
+	_, ok := resultBase(typ)
+	return ok || typ == errorType
+}
+
+// makeResult stores the message in rdi and the value in rsi in a new
+// result cell, leaving its address in rax
+func (cg *CodeGenerator) makeResult() {
+	cg.requireRuntime("make_result")
+	cg.output.WriteString("    call make_result\n")
+}
+
+// generateError emits Error(message), a result holding an error
+func (cg *CodeGenerator) generateError(expr *parser.CallExpression) {
+	if len(expr.Arguments) != 1 {
+		cg.errorAt(expr.Token, ErrBuiltinArguments, "Error expects a String message")
+		return
+	}
+	cg.output.WriteString(fmt.Sprintf("    # %s\n", comment(expr)))
+	if typ := cg.convert(cg.generateExpression(expr.Arguments[0]), "String"); typ != "String" {
+		cg.errorAt(expr.Token, ErrTypeMismatch, "Error expects a String message, got %s", typ)
+	}
+	cg.output.WriteString("    mov rdi, rax     # the message\n")
+	cg.output.WriteString("    xor esi, esi\n")
+	cg.makeResult()
+}
+
+// generateTry emits Try(result), leaving the value the result holds in rax
+// and returning its type. An error goes to the innermost Catch, or is
+// returned as the result of the current function.
+func (cg *CodeGenerator) generateTry(expr *parser.CallExpression) string {
+	if len(expr.Arguments) != 1 {
+		cg.errorAt(expr.Token, ErrBuiltinArguments, "Try expects a result")
+		return "Int"
+	}
+	typ := cg.generateExpression(expr.Arguments[0])
+	base, ok := resultBase(typ)
+	if !ok {
+		cg.errorAt(expr.Token, ErrTypeMismatch, "Try expects a result, got %s", typ)
+		return typ
+	}
+	okLabel := cg.newLabel("try_ok")
+	cg.output.WriteString(fmt.Sprintf("    # %s\n", comment(expr)))
+	cg.output.WriteString("    test rax, rax    # 0 is a success holding the zero value\n")
+	cg.output.WriteString(fmt.Sprintf("    jz %s\n", okLabel))
+	cg.output.WriteString("    mov rcx, [rax]   # the error's message, or 0\n")
+	cg.output.WriteString("    test rcx, rcx\n")
+	switch {
+	case len(cg.current.catches) > 0:
+		cg.output.WriteString(fmt.Sprintf("    jnz %s\n", cg.current.catches[len(cg.current.catches)-1]))
+	case cg.current.isEntry:
+		cg.requireRuntime("uncaught_error")
+		cg.output.WriteString("    jnz uncaught_error\n")
+	case isResult(cg.current.returnType):
+		// The cell is returned as it is: only the value's type differs
+		valueLabel := cg.newLabel("try_value")
+		cg.output.WriteString(fmt.Sprintf("    jz %s\n", valueLabel))
+		cg.generateEpilogue()
+		cg.output.WriteString(fmt.Sprintf("%s:\n", valueLabel))
+	default:
+		cg.errorAt(expr.Token, ErrTypeMismatch, "Try outside a Try block needs a function returning a result, not %s", cg.current.returnType)
+	}
+	cg.output.WriteString("    mov rax, [rax + 8]    # the value held\n")
+	cg.output.WriteString(fmt.Sprintf("%s:\n", okLabel))
+	return base
+}
+
+// generateTryStatement runs the Try block, and the Catch block with the
+// error's message when a Try(result) in the first one holds an error. The
+// stack pointer is saved first, since the error may come from the middle of
+// an expression that has pushed values.
+func (cg *CodeGenerator) generateTryStatement(stmt *parser.TryStatement) {
+	catchLabel := cg.newLabel("catch")
+	endLabel := cg.newLabel("try_end")
+	cg.current.frameSize += 8
+	saved := fmt.Sprintf("rbp - %d", cg.current.frameSize)
+
+	cg.output.WriteString("    # Try\n")
+	cg.output.WriteString(fmt.Sprintf("    mov [%s], rsp    # where Catch resumes\n", saved))
+	cg.current.catches = append(cg.current.catches, catchLabel)
+	cg.generateScopedBlock(stmt.Body)
+	cg.current.catches = cg.current.catches[:len(cg.current.catches)-1]
+	cg.output.WriteString(fmt.Sprintf("    jmp %s\n", endLabel))
+
+	cg.output.WriteString(fmt.Sprintf("%s:\n", catchLabel))
+	cg.output.WriteString(fmt.Sprintf("    mov rsp, [%s]\n", saved))
+	cg.pushScope()
+	if name := stmt.ErrorName; name != nil {
+		v := cg.allocateVariable(name.Value, "String")
+		v.Declared = true
+		v.Declaration = name.Token
+		cg.refer(name.Token, v)
+		cg.output.WriteString(fmt.Sprintf("    mov [%s], rcx    # %s\n", v.address(), name.Value))
+	}
+	cg.generateBlockStatement(stmt.Catch)
+	cg.popScope()
+	cg.output.WriteString(fmt.Sprintf("%s:\n", endLabel))
+}
+
+// generateResultDefault emits a ?? b for a result a, whose value is in rax:
+// the value it holds or, when it holds an error, b
+func (cg *CodeGenerator) generateResultDefault(expr *parser.InfixExpression, typ string) string {
+	base, _ := resultBase(typ)
+	defaultLabel := cg.newLabel("default_error")
+	endLabel := cg.newLabel("default_end")
+	cg.output.WriteString("    test rax, rax\n")
+	cg.output.WriteString(fmt.Sprintf("    jz %s\n", endLabel))
+	cg.output.WriteString("    cmp qword ptr [rax], 0    # the error's message, or 0\n")
+	cg.output.WriteString(fmt.Sprintf("    jne %s\n", defaultLabel))
+	cg.output.WriteString("    mov rax, [rax + 8]    # the value held\n")
+	cg.output.WriteString(fmt.Sprintf("    jmp %s\n", endLabel))
+	cg.output.WriteString(fmt.Sprintf("%s:\n", defaultLabel))
+	if rightType := cg.convert(cg.generateExpression(expr.Right), base); rightType != base {
+		cg.errorAt(expr.Token, ErrTypeMismatch, "default for %s must be %s, got %s", comment(expr.Left), base, rightType)
+	}
+	cg.output.WriteString(fmt.Sprintf("%s:\n", endLabel))
+	return base
+}
+
+// checkResult reports the use of expr, of type typ, as a plain value when it
+// is a result, and returns whether it is not
+func (cg *CodeGenerator) checkResult(tok lexer.Token, expr parser.Expression, typ string) bool {
+	if typ == errorType {
+		cg.errorAt(tok, ErrUncheckedOptional, "Error can only be used as a result")
+		return false
+	}
+	if isResult(typ) {
+		cg.errorAt(tok, ErrUncheckedOptional, "%s is %s and may hold an error: unwrap it with Try or give a default with ??", comment(expr), typ)
+		return false
+	}
+	return true
+}
+
+func (cg *CodeGenerator) generateMakeResultFunction() {
+	cg.output.WriteString("# make_result function - stores an error and a value in a new result cell\n")
+	cg.output.WriteString("# Input: rdi = the error's message, or 0; rsi = the value\n")
+	cg.output.WriteString("# Output: rax = address of the cell\n")
+	cg.output.WriteString("make_result:\n")
+	cg.output.WriteString("    push rbp\n")
+	cg.output.WriteString("    mov rbp, rsp\n")
+	cg.output.WriteString("    push rdi\n")
+	cg.output.WriteString("    push rsi\n")
+	cg.output.WriteString("    mov rdi, 16\n")
+	cg.output.WriteString("    call alloc\n")
+	cg.output.WriteString("    pop rsi\n")
+	cg.output.WriteString("    pop rdi\n")
+	cg.output.WriteString("    mov [rax], rdi\n")
+	cg.output.WriteString("    mov [rax + 8], rsi\n")
+	cg.output.WriteString("    mov rsp, rbp\n")
+	cg.output.WriteString("    pop rbp\n")
+	cg.output.WriteString("    ret\n\n")
+}
+
+func (cg *CodeGenerator) generateUncaughtErrorFunction() {
+	newline := cg.getStringLabel("\n")
+	cg.output.WriteString("# uncaught_error - jumped to when Try in Entry gets an error outside any Try block\n")
+	cg.output.WriteString("# Input: rcx = the error's message. Writes it on stderr and exits; never returns\n")
+	cg.output.WriteString("uncaught_error:\n")
+	cg.output.WriteString("    and rsp, -16     # the jump may come from any stack depth\n")
+	cg.output.WriteString("    push rcx\n")
+	cg.output.WriteString("    push rcx\n")
+	cg.output.WriteString("    mov rdi, rcx\n")
+	cg.output.WriteString("    call strlen\n")
+	cg.output.WriteString("    mov rdx, rax     # length\n")
+	cg.output.WriteString("    pop rsi\n")
+	cg.output.WriteString("    mov rdi, 2       # stderr\n")
+	cg.syscall("write")
+	cg.output.WriteString("    mov rdi, 2\n")
+	cg.output.WriteString(fmt.Sprintf("    lea rsi, [%s]\n", newline))
+	cg.output.WriteString("    mov rdx, 1\n")
+	cg.syscall("write")
+	cg.output.WriteString("    mov rdi, 36      # exit status: uncaught error\n")
+	cg.syscall("exit")
+	cg.output.WriteString("\n")
+}
@@ -0,0 +1,415 @@
+package codegen
+
+import "fmt"
+
+// runtimeFunctions are helpers emitted only when generated code calls them
+var runtimeFunctions = map[string]func(cg *CodeGenerator){
+	"glob_match": (*CodeGenerator).generateGlobMatchFunction,
+	"alloc":      (*CodeGenerator).generateAllocFunction,
+	"str_concat": (*CodeGenerator).generateStrConcatFunction,
+	"str_index":  (*CodeGenerator).generateStrIndexFunction,
+	"str_slice":  (*CodeGenerator).generateStrSliceFunction,
+
+	"float_to_string": (*CodeGenerator).generateFloatToStringFunction,
+	"print_char":      (*CodeGenerator).generatePrintCharFunction,
+	"char_to_string":  (*CodeGenerator).generateCharToStringFunction,
+	"print_uint":      (*CodeGenerator).generatePrintUintFunction,
+	"parse_int":       (*CodeGenerator).generateParseIntFunction,
+	"atoi":            (*CodeGenerator).generateAtoiFunction,
+	"int_to_string":   (*CodeGenerator).generateIntToStringFunction,
+	"print_small_int": (*CodeGenerator).generatePrintSmallIntFunction,
+	"box":             (*CodeGenerator).generateBoxFunction,
+	"make_result":     (*CodeGenerator).generateMakeResultFunction,
+	"slice_append":    (*CodeGenerator).generateSliceAppendFunction,
+
+	"index_out_of_range": (*CodeGenerator).generateIndexOutOfRangeFunction,
+	"division_by_zero":   (*CodeGenerator).generateDivisionByZeroFunction,
+	"empty_interface":    (*CodeGenerator).generateEmptyInterfaceFunction,
+	"uncaught_error":     (*CodeGenerator).generateUncaughtErrorFunction,
+	"panic":              (*CodeGenerator).generatePanicFunction,
+}
+
+// runtimeDependencies lists the optional helpers each runtime helper calls
+var runtimeDependencies = map[string][]string{
+	"str_concat": {"alloc"},
+	"str_index":  {"index_out_of_range"},
+	"str_slice":  {"alloc", "index_out_of_range"},
+
+	"float_to_string": {"alloc"},
+	"char_to_string":  {"alloc"},
+	"int_to_string":   {"alloc"},
+	"box":             {"alloc"},
+	"make_result":     {"alloc"},
+	"slice_append":    {"alloc"},
+}
+
+// requireRuntime records that generated code calls the named runtime helper
+func (cg *CodeGenerator) requireRuntime(name string) {
+	for _, used := range cg.runtimeUsed {
+		if used == name {
+			return
+		}
+	}
+	cg.runtimeUsed = append(cg.runtimeUsed, name)
+	for _, dependency := range runtimeDependencies[name] {
+		cg.requireRuntime(dependency)
+	}
+}
+
+func (cg *CodeGenerator) writeRuntimeFunctions() {
+	for _, name := range cg.runtimeUsed {
+		if s, ok := syscallWrapper(name); ok {
+			cg.generateSyscallWrapper(s)
+			continue
+		}
+		generate, ok := runtimeFunctions[name]
+		if !ok {
+			panic(fmt.Sprintf("codegen: unknown runtime function %s", name))
+		}
+		generate(cg)
+	}
+}
+
+func (cg *CodeGenerator) generateStrlenFunction() {
+	cg.output.WriteString("# strlen function - calculates length of null-terminated string\n")
+	cg.output.WriteString("# Input: rdi = string address\n")
+	cg.output.WriteString("# Output: rax = string length\n")
+	cg.output.WriteString("strlen:\n")
+	cg.output.WriteString("    push rbp\n")
+	cg.output.WriteString("    mov rbp, rsp\n")
+	cg.output.WriteString("    mov rax, 0       # length counter\n")
+	cg.output.WriteString("strlen_loop:\n")
+	cg.output.WriteString("    cmp byte ptr [rdi + rax], 0  # check for null terminator\n")
+	cg.output.WriteString("    je strlen_done   # if null, we're done\n")
+	cg.output.WriteString("    inc rax          # increment length\n")
+	cg.output.WriteString("    jmp strlen_loop  # continue loop\n")
+	cg.output.WriteString("strlen_done:\n")
+	cg.output.WriteString("    mov rsp, rbp\n")
+	cg.output.WriteString("    pop rbp\n")
+	cg.output.WriteString("    ret\n\n")
+}
+
+func (cg *CodeGenerator) generatePrintStringFunction() {
+	cg.output.WriteString("# print_string function - writes a null-terminated string to stdout\n")
+	cg.output.WriteString("# Input: rdi = string address\n")
+	cg.output.WriteString("print_string:\n")
+	cg.output.WriteString("    push rbp\n")
+	cg.output.WriteString("    mov rbp, rsp\n")
+	cg.output.WriteString("    mov rsi, rdi     # string address\n")
+	cg.output.WriteString("    call strlen      # calculate length, result in rax\n")
+	cg.output.WriteString("    mov rdx, rax     # string length\n")
+	cg.output.WriteString("    mov rdi, 1       # stdout\n")
+	cg.syscall("write")
+	cg.output.WriteString("    mov rsp, rbp\n")
+	cg.output.WriteString("    pop rbp\n")
+	cg.output.WriteString("    ret\n\n")
+}
+
+func (cg *CodeGenerator) generatePrintIntFunction() {
+	cg.output.WriteString("# print_int function - writes a signed integer to stdout in decimal\n")
+	cg.output.WriteString("# Input: rdi = integer value\n")
+	cg.output.WriteString("print_int:\n")
+	cg.output.WriteString("    push rbp\n")
+	cg.output.WriteString("    mov rbp, rsp\n")
+	cg.output.WriteString("    sub rsp, 32      # digit buffer, filled backwards from rbp\n")
+	cg.output.WriteString("    mov rax, rdi\n")
+	cg.output.WriteString("    lea rsi, [rbp - 1]\n")
+	cg.output.WriteString("    mov rcx, 10\n")
+	cg.output.WriteString("    test rax, rax\n")
+	cg.output.WriteString("    jns print_int_loop\n")
+	cg.output.WriteString("    neg rax          # print magnitude, sign added below\n")
+	cg.output.WriteString("print_int_loop:\n")
+	cg.output.WriteString("    xor edx, edx\n")
+	cg.output.WriteString("    div rcx          # rax = quotient, rdx = next digit\n")
+	cg.output.WriteString("    add dl, 48       # to ASCII\n")
+	cg.output.WriteString("    mov [rsi], dl\n")
+	cg.output.WriteString("    dec rsi\n")
+	cg.output.WriteString("    test rax, rax\n")
+	cg.output.WriteString("    jnz print_int_loop\n")
+	cg.output.WriteString("    test rdi, rdi\n")
+	cg.output.WriteString("    jns print_int_write\n")
+	cg.output.WriteString("    mov byte ptr [rsi], 45  # '-'\n")
+	cg.output.WriteString("    dec rsi\n")
+	cg.output.WriteString("print_int_write:\n")
+	cg.output.WriteString("    inc rsi          # first character\n")
+	cg.output.WriteString("    mov rdx, rbp\n")
+	cg.output.WriteString("    sub rdx, rsi     # length\n")
+	cg.output.WriteString("    mov rdi, 1       # stdout\n")
+	cg.syscall("write")
+	cg.output.WriteString("    mov rsp, rbp\n")
+	cg.output.WriteString("    pop rbp\n")
+	cg.output.WriteString("    ret\n\n")
+}
+
+func (cg *CodeGenerator) generateGlobMatchFunction() {
+	cg.output.WriteString("# glob_match function - matches text against a glob pattern\n")
+	cg.output.WriteString("# '*' matches any run of characters, '?' matches exactly one\n")
+	cg.output.WriteString("# Input: rdi = pattern address, rsi = text address\n")
+	cg.output.WriteString("# Output: rax = 1 on match, 0 otherwise\n")
+	cg.output.WriteString("glob_match:\n")
+	cg.output.WriteString("    push rbp\n")
+	cg.output.WriteString("    mov rbp, rsp\n")
+	cg.output.WriteString("    xor r8, r8       # pattern position after the last '*' (0 = none yet)\n")
+	cg.output.WriteString("    xor r9, r9       # text position the last '*' is matched up to\n")
+	cg.output.WriteString("glob_match_loop:\n")
+	cg.output.WriteString("    mov al, [rsi]\n")
+	cg.output.WriteString("    test al, al\n")
+	cg.output.WriteString("    jz glob_match_text_done\n")
+	cg.output.WriteString("    mov dl, [rdi]\n")
+	cg.output.WriteString("    cmp dl, 42       # '*'\n")
+	cg.output.WriteString("    je glob_match_star\n")
+	cg.output.WriteString("    cmp dl, 63       # '?'\n")
+	cg.output.WriteString("    je glob_match_advance\n")
+	cg.output.WriteString("    cmp dl, al\n")
+	cg.output.WriteString("    je glob_match_advance\n")
+	cg.output.WriteString("    # Mismatch: let the last '*' swallow one more character and retry\n")
+	cg.output.WriteString("    test r8, r8\n")
+	cg.output.WriteString("    jz glob_match_fail\n")
+	cg.output.WriteString("    mov rdi, r8\n")
+	cg.output.WriteString("    inc r9\n")
+	cg.output.WriteString("    mov rsi, r9\n")
+	cg.output.WriteString("    jmp glob_match_loop\n")
+	cg.output.WriteString("glob_match_advance:\n")
+	cg.output.WriteString("    inc rdi\n")
+	cg.output.WriteString("    inc rsi\n")
+	cg.output.WriteString("    jmp glob_match_loop\n")
+	cg.output.WriteString("glob_match_star:\n")
+	cg.output.WriteString("    inc rdi\n")
+	cg.output.WriteString("    mov r8, rdi      # resume pattern after the '*'\n")
+	cg.output.WriteString("    mov r9, rsi      # '*' initially matches nothing\n")
+	cg.output.WriteString("    jmp glob_match_loop\n")
+	cg.output.WriteString("glob_match_text_done:\n")
+	cg.output.WriteString("    # Text consumed: only trailing '*' may remain in the pattern\n")
+	cg.output.WriteString("    cmp byte ptr [rdi], 42\n")
+	cg.output.WriteString("    jne glob_match_check_end\n")
+	cg.output.WriteString("    inc rdi\n")
+	cg.output.WriteString("    jmp glob_match_text_done\n")
+	cg.output.WriteString("glob_match_check_end:\n")
+	cg.output.WriteString("    xor eax, eax\n")
+	cg.output.WriteString("    cmp byte ptr [rdi], 0\n")
+	cg.output.WriteString("    sete al\n")
+	cg.output.WriteString("    jmp glob_match_done\n")
+	cg.output.WriteString("glob_match_fail:\n")
+	cg.output.WriteString("    xor eax, eax\n")
+	cg.output.WriteString("glob_match_done:\n")
+	cg.output.WriteString("    mov rsp, rbp\n")
+	cg.output.WriteString("    pop rbp\n")
+	cg.output.WriteString("    ret\n\n")
+}
+
+func (cg *CodeGenerator) generateAllocFunction() {
+	switch cg.target.heap {
+	case "mmap":
+		cg.generateMmapAllocFunction()
+		return
+	case "arena":
+		cg.generateArenaAllocFunction()
+		return
+	}
+	cg.output.WriteString("# alloc function - bump allocator on top of the program break\n")
+	cg.output.WriteString("# Memory is never freed; the break grows in page-sized steps as needed\n")
+	cg.output.WriteString("# Input: rdi = size in bytes\n")
+	cg.output.WriteString("# Output: rax = address of a 16-byte aligned block\n")
+	cg.output.WriteString("    .pushsection .bss\n")
+	cg.output.WriteString("    .balign 8\n")
+	cg.output.WriteString("heap_next: .zero 8\n")
+	cg.output.WriteString("heap_end: .zero 8\n")
+	cg.output.WriteString("    .popsection\n")
+	cg.output.WriteString("alloc:\n")
+	cg.output.WriteString("    push rbp\n")
+	cg.output.WriteString("    mov rbp, rsp\n")
+	cg.output.WriteString("    add rdi, 15\n")
+	cg.output.WriteString("    and rdi, -16     # round size up to keep blocks aligned\n")
+	cg.output.WriteString("    mov r8, [heap_next]\n")
+	cg.output.WriteString("    test r8, r8\n")
+	cg.output.WriteString("    jnz alloc_check\n")
+	cg.output.WriteString("    # First allocation: the heap starts at the current break\n")
+	cg.output.WriteString("    mov r9, rdi\n")
+	cg.output.WriteString("    xor edi, edi     # brk(0) returns the current break\n")
+	cg.syscall("brk")
+	cg.output.WriteString("    mov rdi, r9\n")
+	cg.output.WriteString("    mov r8, rax\n")
+	cg.output.WriteString("    mov [heap_end], rax\n")
+	cg.output.WriteString("alloc_check:\n")
+	cg.output.WriteString("    lea r9, [r8 + rdi]  # end of the new block\n")
+	cg.output.WriteString("    cmp r9, [heap_end]\n")
+	cg.output.WriteString("    jbe alloc_done\n")
+	cg.output.WriteString("    lea rdi, [r9 + 65535]\n")
+	cg.output.WriteString("    and rdi, -4096   # grow with headroom, page aligned\n")
+	cg.syscall("brk")
+	cg.output.WriteString("    cmp rax, rdi     # the kernel returns the old break on failure\n")
+	cg.output.WriteString("    jb alloc_fail\n")
+	cg.output.WriteString("    mov [heap_end], rax\n")
+	cg.output.WriteString("alloc_done:\n")
+	cg.output.WriteString("    mov [heap_next], r9\n")
+	cg.output.WriteString("    mov rax, r8\n")
+	cg.output.WriteString("    mov rsp, rbp\n")
+	cg.output.WriteString("    pop rbp\n")
+	cg.output.WriteString("    ret\n")
+	cg.output.WriteString("alloc_fail:\n")
+	cg.output.WriteString("    mov rdi, 12      # exit status: out of memory (ENOMEM)\n")
+	cg.syscall("exit")
+	cg.output.WriteString("\n")
+}
+
+func (cg *CodeGenerator) generateMmapAllocFunction() {
+	cg.output.WriteString("# alloc function - bump allocator over anonymous memory mappings\n")
+	cg.output.WriteString("# Memory is never freed; when a block does not fit, a new chunk of at least\n")
+	cg.output.WriteString("# 64 KiB is mapped and the rest of the old one is abandoned\n")
+	cg.output.WriteString("# Input: rdi = size in bytes\n")
+	cg.output.WriteString("# Output: rax = address of a 16-byte aligned block\n")
+	cg.output.WriteString("    .pushsection .bss\n")
+	cg.output.WriteString("    .balign 8\n")
+	cg.output.WriteString("heap_next: .zero 8\n")
+	cg.output.WriteString("heap_end: .zero 8\n")
+	cg.output.WriteString("    .popsection\n")
+	cg.output.WriteString("alloc:\n")
+	cg.output.WriteString("    push rbp\n")
+	cg.output.WriteString("    mov rbp, rsp\n")
+	cg.output.WriteString("    sub rsp, 16      # size and chunk length survive the syscall here\n")
+	cg.output.WriteString("    add rdi, 15\n")
+	cg.output.WriteString("    and rdi, -16     # round size up to keep blocks aligned\n")
+	cg.output.WriteString("    mov r8, [heap_next]\n")
+	cg.output.WriteString("    test r8, r8\n")
+	cg.output.WriteString("    jz alloc_grow    # no chunk mapped yet\n")
+	cg.output.WriteString("    lea r9, [r8 + rdi]  # end of the new block\n")
+	cg.output.WriteString("    cmp r9, [heap_end]\n")
+	cg.output.WriteString("    jbe alloc_done\n")
+	cg.output.WriteString("alloc_grow:\n")
+	cg.output.WriteString("    mov [rbp - 8], rdi\n")
+	cg.output.WriteString("    lea rsi, [rdi + 65535]\n")
+	cg.output.WriteString("    and rsi, -4096   # chunk length, page aligned\n")
+	cg.output.WriteString("    mov [rbp - 16], rsi\n")
+	cg.output.WriteString("    xor edi, edi     # let the kernel choose the address\n")
+	cg.output.WriteString("    mov edx, 3       # PROT_READ | PROT_WRITE\n")
+	cg.output.WriteString(fmt.Sprintf("    mov %s, 0x1002  # MAP_PRIVATE | MAP_ANON\n", cg.target.argumentRegister(3)))
+	cg.output.WriteString("    mov r8, -1       # no file\n")
+	cg.output.WriteString("    xor r9d, r9d     # offset\n")
+	cg.syscall("mmap")
+	cg.jumpIfSyscallFailed("alloc_fail")
+	cg.output.WriteString("    mov r8, rax      # the block starts the new chunk\n")
+	cg.output.WriteString("    mov rsi, [rbp - 16]\n")
+	cg.output.WriteString("    add rax, rsi\n")
+	cg.output.WriteString("    mov [heap_end], rax\n")
+	cg.output.WriteString("    mov rdi, [rbp - 8]\n")
+	cg.output.WriteString("    lea r9, [r8 + rdi]\n")
+	cg.output.WriteString("alloc_done:\n")
+	cg.output.WriteString("    mov [heap_next], r9\n")
+	cg.output.WriteString("    mov rax, r8\n")
+	cg.output.WriteString("    mov rsp, rbp\n")
+	cg.output.WriteString("    pop rbp\n")
+	cg.output.WriteString("    ret\n")
+	cg.output.WriteString("alloc_fail:\n")
+	cg.output.WriteString("    mov rdi, 12      # exit status: out of memory (ENOMEM)\n")
+	cg.syscall("exit")
+	cg.output.WriteString("\n")
+}
+
+// arenaSize is the heap of freestanding programs, reserved in .bss
+const arenaSize = 1 << 20
+
+func (cg *CodeGenerator) generateArenaAllocFunction() {
+	cg.output.WriteString("# alloc function - bump allocator over a fixed arena in .bss\n")
+	cg.output.WriteString("# Memory is never freed; exits with status 12 once the arena is used up\n")
+	cg.output.WriteString("# Input: rdi = size in bytes\n")
+	cg.output.WriteString("# Output: rax = address of a 16-byte aligned block\n")
+	cg.output.WriteString("    .pushsection .bss\n")
+	cg.output.WriteString("    .balign 16\n")
+	cg.output.WriteString(fmt.Sprintf("heap_arena: .zero %d\n", arenaSize))
+	cg.output.WriteString("heap_used: .zero 8\n")
+	cg.output.WriteString("    .popsection\n")
+	cg.output.WriteString("alloc:\n")
+	cg.output.WriteString("    push rbp\n")
+	cg.output.WriteString("    mov rbp, rsp\n")
+	cg.output.WriteString("    add rdi, 15\n")
+	cg.output.WriteString("    and rdi, -16     # round size up to keep blocks aligned\n")
+	cg.output.WriteString("    mov rax, [heap_used]\n")
+	cg.output.WriteString("    lea r8, [rax + rdi]\n")
+	cg.output.WriteString(fmt.Sprintf("    cmp r8, %d\n", arenaSize))
+	cg.output.WriteString("    ja alloc_fail\n")
+	cg.output.WriteString("    mov [heap_used], r8\n")
+	cg.output.WriteString("    lea rcx, [heap_arena]\n")
+	cg.output.WriteString("    add rax, rcx\n")
+	cg.output.WriteString("    mov rsp, rbp\n")
+	cg.output.WriteString("    pop rbp\n")
+	cg.output.WriteString("    ret\n")
+	cg.output.WriteString("alloc_fail:\n")
+	cg.output.WriteString("    mov rdi, 12      # exit status: out of memory (ENOMEM)\n")
+	cg.syscall("exit")
+	cg.output.WriteString("\n")
+}
+
+func (cg *CodeGenerator) generateStrConcatFunction() {
+	cg.output.WriteString("# str_concat function - joins two null-terminated strings into a new one\n")
+	cg.output.WriteString("# Input: rdi = left string address, rsi = right string address\n")
+	cg.output.WriteString("# Output: rax = address of the newly allocated result\n")
+	cg.output.WriteString("str_concat:\n")
+	cg.output.WriteString("    push rbp\n")
+	cg.output.WriteString("    mov rbp, rsp\n")
+	cg.output.WriteString("    push rbx\n")
+	cg.output.WriteString("    push r12\n")
+	cg.output.WriteString("    push r13\n")
+	cg.output.WriteString("    push r14\n")
+	cg.output.WriteString("    mov r12, rdi     # left\n")
+	cg.output.WriteString("    mov r13, rsi     # right\n")
+	cg.output.WriteString("    call strlen\n")
+	cg.output.WriteString("    mov rbx, rax     # left length\n")
+	cg.output.WriteString("    mov rdi, r13\n")
+	cg.output.WriteString("    call strlen\n")
+	cg.output.WriteString("    mov r14, rax     # right length\n")
+	cg.output.WriteString("    lea rdi, [rbx + r14 + 1]  # room for both plus the terminator\n")
+	cg.output.WriteString("    call alloc\n")
+	cg.output.WriteString("    mov rdi, rax     # copy destination\n")
+	cg.output.WriteString("    mov rsi, r12\n")
+	cg.output.WriteString("    mov rcx, rbx\n")
+	cg.output.WriteString("    rep movsb        # copy left\n")
+	cg.output.WriteString("    mov rsi, r13\n")
+	cg.output.WriteString("    mov rcx, r14\n")
+	cg.output.WriteString("    rep movsb        # copy right\n")
+	cg.output.WriteString("    mov byte ptr [rdi], 0\n")
+	cg.output.WriteString("    pop r14\n")
+	cg.output.WriteString("    pop r13\n")
+	cg.output.WriteString("    pop r12\n")
+	cg.output.WriteString("    pop rbx\n")
+	cg.output.WriteString("    mov rsp, rbp\n")
+	cg.output.WriteString("    pop rbp\n")
+	cg.output.WriteString("    ret\n\n")
+}
+
+// indexErrorMessage is written to stderr, with a newline, when an array
+// index is out of range
+const indexErrorMessage = "index out of range"
+
+func (cg *CodeGenerator) generateIndexOutOfRangeFunction() {
+	label := cg.getStringLabel(indexErrorMessage + "\n")
+	cg.output.WriteString("# index_out_of_range - jumped to when an array index is out of range\n")
+	cg.output.WriteString("# Reports the error on stderr and exits; never returns\n")
+	cg.output.WriteString("index_out_of_range:\n")
+	cg.output.WriteString("    and rsp, -16     # the jump may come from any stack depth\n")
+	cg.output.WriteString("    mov rdi, 2       # stderr\n")
+	cg.output.WriteString(fmt.Sprintf("    lea rsi, [%s]\n", label))
+	cg.output.WriteString(fmt.Sprintf("    mov rdx, %d\n", len(indexErrorMessage)+1))
+	cg.syscall("write")
+	cg.output.WriteString("    mov rdi, 34      # exit status: index out of range (ERANGE)\n")
+	cg.syscall("exit")
+	cg.output.WriteString("\n")
+}
+
+// divisionErrorMessage is written to stderr, with a newline, when an integer
+// is divided by zero
+const divisionErrorMessage = "division by zero"
+
+func (cg *CodeGenerator) generateDivisionByZeroFunction() {
+	label := cg.getStringLabel(divisionErrorMessage + "\n")
+	cg.output.WriteString("# division_by_zero - jumped to when an integer is divided by zero\n")
+	cg.output.WriteString("# Reports the error on stderr and exits; never returns\n")
+	cg.output.WriteString("division_by_zero:\n")
+	cg.output.WriteString("    and rsp, -16     # the jump may come from any stack depth\n")
+	cg.output.WriteString("    mov rdi, 2       # stderr\n")
+	cg.output.WriteString(fmt.Sprintf("    lea rsi, [%s]\n", label))
+	cg.output.WriteString(fmt.Sprintf("    mov rdx, %d\n", len(divisionErrorMessage)+1))
+	cg.syscall("write")
+	cg.output.WriteString("    mov rdi, 33      # exit status: division by zero (EDOM)\n")
+	cg.syscall("exit")
+	cg.output.WriteString("\n")
+}
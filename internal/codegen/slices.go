@@ -0,0 +1,260 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+
+	"dreadlang/internal/lexer"
+	"dreadlang/internal/parser"
+)
+
+// Slices grow as elements are appended; their type is written with empty
+// brackets, as in Int[]. A slice takes one slot, which holds 0 while the
+// slice is empty and otherwise the address of a header on the heap:
+// {length, capacity, address of the elements}. Append stores the value past
+// the last element, moving the elements to a block twice the size when they
+// fill it, so slices share their header once they have one.
+
+// sliceElement returns the element type of a slice type such as Int[]
+func sliceElement(typ string) (string, bool) {
+	return strings.CutSuffix(typ, "[]")
+}
+
+// isSlice reports whether typ is a slice type
+func isSlice(typ string) bool {
+	_, ok := sliceElement(typ)
+	return ok
+}
+
+// resolveSliceType checks the element type of the slice type typ
+func (cg *CodeGenerator) resolveSliceType(tok lexer.Token, typ string) (string, bool) {
+	element, _ := sliceElement(typ)
+	if _, isStruct := cg.structs[element]; !isScalar(element) && !isStruct {
+		cg.undefinedName(tok, ErrUndefinedType, "type", element, cg.typeNames())
+		return "", false
+	}
+	if !isScalar(element) {
+		cg.errorAt(tok, ErrTypeMismatch, "slice elements must be Int, Float, Char or String, got %s", element)
+		return "", false
+	}
+	return typ, true
+}
+
+// generateVariadicSlice leaves in rax a new slice holding the extra
+// arguments of a call to a variadic function, or 0 if there are none. The
+// header and the elements share one block: the header is followed by
+// exactly as many elements as fit.
+func (cg *CodeGenerator) generateVariadicSlice(param *parser.Parameter, values []parser.Expression) {
+	if len(values) == 0 {
+		cg.output.WriteString(fmt.Sprintf("    xor eax, eax     # no %s\n", param.Name))
+		return
+	}
+	element, _ := sliceElement(param.Type)
+	for _, value := range values {
+		cg.convert(cg.generateExpression(value), element)
+		cg.output.WriteString(fmt.Sprintf("    push rax         # %s\n", param.Name))
+	}
+	cg.requireRuntime("alloc")
+	cg.output.WriteString(fmt.Sprintf("    mov rdi, %d\n", 24+8*len(values)))
+	cg.output.WriteString("    call alloc\n")
+	cg.output.WriteString(fmt.Sprintf("    mov qword ptr [rax], %d    # length\n", len(values)))
+	cg.output.WriteString(fmt.Sprintf("    mov qword ptr [rax + 8], %d    # capacity\n", len(values)))
+	cg.output.WriteString("    lea rcx, [rax + 24]\n")
+	cg.output.WriteString("    mov [rax + 16], rcx    # elements\n")
+	for i := len(values) - 1; i >= 0; i-- {
+		cg.output.WriteString("    pop rcx\n")
+		cg.output.WriteString(fmt.Sprintf("    mov [rax + %d], rcx\n", 24+8*i))
+	}
+}
+
+// generateSliceElementOperand checks the index in rcx against the length of
+// the slice whose header is in rdx, and returns the memory operand of the
+// element. An empty slice has no header, and no elements either.
+func (cg *CodeGenerator) generateSliceElementOperand() string {
+	cg.requireRuntime("index_out_of_range")
+	cg.output.WriteString("    test rdx, rdx\n")
+	cg.output.WriteString("    jz index_out_of_range\n")
+	cg.output.WriteString("    cmp rcx, [rdx]   # length\n")
+	cg.output.WriteString("    jae index_out_of_range\n")
+	cg.output.WriteString("    mov rdx, [rdx + 16]  # elements\n")
+	return "rdx + rcx*8"
+}
+
+// generateSliceIndex loads one element of a slice: xs[i]
+func (cg *CodeGenerator) generateSliceIndex(expr *parser.IndexExpression, typ string) string {
+	element, _ := sliceElement(typ)
+	cg.output.WriteString(fmt.Sprintf("    # %s\n", comment(expr)))
+	cg.generateExpression(expr.Array)
+	cg.output.WriteString("    push rax         # slice\n")
+	if typ := cg.generateExpression(expr.Index); !isInteger(typ) {
+		cg.errorAt(expr.Token, ErrTypeMismatch, "slice index must be Int, got %s", typ)
+	}
+	cg.output.WriteString("    mov rcx, rax\n")
+	cg.output.WriteString("    pop rdx\n")
+	operand := cg.generateSliceElementOperand()
+	cg.output.WriteString(fmt.Sprintf("    mov rax, [%s]    # load %s\n", operand, comment(expr)))
+	return element
+}
+
+// generateSliceElementAssign stores the value in rax, of type typ, into one
+// element of a slice: xs[i] = value
+func (cg *CodeGenerator) generateSliceElementAssign(stmt *parser.AssignStatement, typ string, sliceType string) {
+	target := stmt.Target()
+	element, _ := sliceElement(sliceType)
+	if typ = cg.convert(typ, element); typ != element {
+		// The type pass has reported it
+		return
+	}
+
+	cg.output.WriteString("    push rax\n")
+	cg.generateExpression(target)
+	cg.output.WriteString("    push rax         # slice\n")
+	if typ := cg.generateExpression(stmt.Index); !isInteger(typ) {
+		cg.errorAt(stmt.Token, ErrTypeMismatch, "slice index must be Int, got %s", typ)
+	}
+	cg.output.WriteString("    mov rcx, rax\n")
+	cg.output.WriteString("    pop rdx\n")
+	operand := cg.generateSliceElementOperand()
+	cg.output.WriteString("    pop rax\n")
+	cg.output.WriteString(fmt.Sprintf("    mov [%s], rax    # store %s[%s]\n", operand, comment(target), comment(stmt.Index)))
+}
+
+// generateAppend emits Append(xs, value), which adds value to the end of the
+// slice xs. xs must be a variable or field, since appending to an empty
+// slice gives it a header.
+func (cg *CodeGenerator) generateAppend(expr *parser.CallExpression) {
+	if len(expr.Arguments) != 2 {
+		cg.errorAt(expr.Token, ErrBuiltinArguments, "Append expects a slice and a value")
+		return
+	}
+	slice := expr.Arguments[0]
+	switch e := slice.(type) {
+	case *parser.Identifier:
+		if v, exists := cg.lookupVariable(e.Value); exists && v.Constant != nil {
+			cg.errorAt(expr.Token, ErrAssignConstant, "cannot assign to constant %s", e.Value)
+			return
+		}
+	case *parser.FieldExpression:
+	default:
+		cg.errorAt(expr.Token, ErrTypeMismatch, "Append needs a slice variable or field, got %s", comment(slice))
+		return
+	}
+	p, ok := cg.resolvePlace(slice)
+	if !ok {
+		return
+	}
+	element, ok := sliceElement(p.typ)
+	if !ok {
+		cg.errorAt(expr.Token, ErrTypeMismatch, "cannot Append to %s variable %s", p.typ, comment(slice))
+		return
+	}
+
+	cg.output.WriteString(fmt.Sprintf("    # %s\n", comment(expr)))
+	if typ := cg.convert(cg.generateExpression(expr.Arguments[1]), element); typ != element {
+		cg.errorAt(expr.Token, ErrTypeMismatch, "cannot Append %s to %s", typ, p.typ)
+	}
+	cg.output.WriteString("    mov rsi, rax     # value\n")
+	cg.output.WriteString(fmt.Sprintf("    mov rdi, [%s]    # %s\n", p.slot(0), comment(slice)))
+	cg.requireRuntime("slice_append")
+	cg.output.WriteString("    call slice_append\n")
+	cg.output.WriteString(fmt.Sprintf("    mov [%s], rax    # store %s\n", p.slot(0), comment(slice)))
+}
+
+// evaluateLen folds Len of a constant String, or of an array variable, whose
+// length is part of its type; ok is false for anything else
+func (cg *CodeGenerator) evaluateLen(expr *parser.CallExpression) (value int64, ok bool) {
+	if expr.Function != "Len" || expr.Receiver != nil || len(expr.Arguments) != 1 {
+		return 0, false
+	}
+	if value, typ, ok := cg.evaluateConstant(expr.Arguments[0]); ok {
+		return int64(len(stringBytes(value.String))), typ == "String"
+	}
+	if id, ok := expr.Arguments[0].(*parser.Identifier); ok {
+		if v, exists := cg.lookupFolded(id.Value); exists {
+			if _, length, ok := arrayType(v.Type); ok {
+				if !cg.inEvaluatedBody() {
+					cg.refer(id.Token, v)
+				}
+				return length, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// generateLen emits Len(x), the number of elements of a slice or array, or
+// of bytes in a String
+func (cg *CodeGenerator) generateLen(expr *parser.CallExpression) {
+	if len(expr.Arguments) != 1 {
+		cg.errorAt(expr.Token, ErrBuiltinArguments, "Len expects a String, an array or a slice")
+		return
+	}
+	cg.output.WriteString(fmt.Sprintf("    # %s\n", comment(expr)))
+	typ := cg.generateExpression(expr.Arguments[0])
+	if _, length, ok := arrayType(typ); ok {
+		cg.output.WriteString(fmt.Sprintf("    mov rax, %d\n", length))
+		return
+	}
+	switch {
+	case isSlice(typ):
+		done := cg.newLabel("len_done")
+		cg.output.WriteString("    test rax, rax    # an empty slice has length 0\n")
+		cg.output.WriteString(fmt.Sprintf("    jz %s\n", done))
+		cg.output.WriteString("    mov rax, [rax]   # length\n")
+		cg.output.WriteString(fmt.Sprintf("%s:\n", done))
+	case typ == "String":
+		cg.output.WriteString("    mov rdi, rax\n")
+		cg.output.WriteString("    call strlen\n")
+	default:
+		cg.errorAt(expr.Token, ErrTypeMismatch, "Len expects a String, an array or a slice, got %s", typ)
+	}
+}
+
+func (cg *CodeGenerator) generateSliceAppendFunction() {
+	cg.output.WriteString("# slice_append function - adds a value to the end of a slice\n")
+	cg.output.WriteString("# Full slices move their elements to a block twice the size, at least 4\n")
+	cg.output.WriteString("# Input: rdi = slice header, or 0 for an empty slice, rsi = value\n")
+	cg.output.WriteString("# Output: rax = slice header, a new one if rdi was 0\n")
+	cg.output.WriteString("slice_append:\n")
+	cg.output.WriteString("    push rbp\n")
+	cg.output.WriteString("    mov rbp, rsp\n")
+	cg.output.WriteString("    push rbx\n")
+	cg.output.WriteString("    push r12\n")
+	cg.output.WriteString("    mov rbx, rdi     # header\n")
+	cg.output.WriteString("    mov r12, rsi     # value\n")
+	cg.output.WriteString("    test rbx, rbx\n")
+	cg.output.WriteString("    jnz slice_append_check\n")
+	cg.output.WriteString("    mov rdi, 24\n")
+	cg.output.WriteString("    call alloc\n")
+	cg.output.WriteString("    mov rbx, rax\n")
+	cg.output.WriteString("    mov qword ptr [rbx], 0       # length\n")
+	cg.output.WriteString("    mov qword ptr [rbx + 8], 0   # capacity\n")
+	cg.output.WriteString("    mov qword ptr [rbx + 16], 0  # elements\n")
+	cg.output.WriteString("slice_append_check:\n")
+	cg.output.WriteString("    mov rax, [rbx]\n")
+	cg.output.WriteString("    cmp rax, [rbx + 8]\n")
+	cg.output.WriteString("    jb slice_append_store\n")
+	cg.output.WriteString("    mov rdi, [rbx + 8]\n")
+	cg.output.WriteString("    shl rdi, 1       # double the capacity\n")
+	cg.output.WriteString("    mov eax, 4\n")
+	cg.output.WriteString("    cmp rdi, rax\n")
+	cg.output.WriteString("    cmovb rdi, rax\n")
+	cg.output.WriteString("    mov [rbx + 8], rdi\n")
+	cg.output.WriteString("    shl rdi, 3\n")
+	cg.output.WriteString("    call alloc\n")
+	cg.output.WriteString("    mov rsi, [rbx + 16]  # copy the elements over\n")
+	cg.output.WriteString("    mov rdi, rax\n")
+	cg.output.WriteString("    mov rcx, [rbx]\n")
+	cg.output.WriteString("    rep movsq\n")
+	cg.output.WriteString("    mov [rbx + 16], rax\n")
+	cg.output.WriteString("slice_append_store:\n")
+	cg.output.WriteString("    mov rax, [rbx]\n")
+	cg.output.WriteString("    mov rcx, [rbx + 16]\n")
+	cg.output.WriteString("    mov [rcx + rax*8], r12\n")
+	cg.output.WriteString("    inc qword ptr [rbx]\n")
+	cg.output.WriteString("    mov rax, rbx\n")
+	cg.output.WriteString("    pop r12\n")
+	cg.output.WriteString("    pop rbx\n")
+	cg.output.WriteString("    pop rbp\n")
+	cg.output.WriteString("    ret\n\n")
+}
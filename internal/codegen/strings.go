@@ -0,0 +1,185 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+
+	"dreadlang/internal/parser"
+)
+
+// Strings are null-terminated and immutable: indexing reads one byte and
+// slicing copies the bytes into a new string on the heap. Both find the
+// length with strlen and stop the program on an index out of range.
+
+// generateStringIndex reads the byte at an index of a string as an Int
+func (cg *CodeGenerator) generateStringIndex(expr *parser.IndexExpression) string {
+	cg.output.WriteString(fmt.Sprintf("    # %s\n", comment(expr)))
+	cg.generateExpression(expr.Array)
+	cg.output.WriteString("    push rax         # string\n")
+	if typ := cg.generateExpression(expr.Index); !isInteger(typ) {
+		cg.errorAt(expr.Token, ErrTypeMismatch, "string index must be Int, got %s", typ)
+	}
+	cg.output.WriteString("    mov rsi, rax     # index\n")
+	cg.output.WriteString("    pop rdi\n")
+	cg.requireRuntime("str_index")
+	cg.output.WriteString("    call str_index\n")
+	return "Int"
+}
+
+// generateSliceExpression copies part of a string: name[start:end]
+func (cg *CodeGenerator) generateSliceExpression(expr *parser.SliceExpression) string {
+	p, ok := cg.resolvePlace(expr.Array)
+	if !ok {
+		return "String"
+	}
+	if p.typ != "String" {
+		cg.errorAt(placeToken(expr.Array), ErrTypeMismatch, "cannot slice %s variable %s", p.typ, comment(expr.Array))
+		return "String"
+	}
+
+	cg.output.WriteString(fmt.Sprintf("    # %s\n", comment(expr)))
+	cg.generateExpression(expr.Array)
+	cg.output.WriteString("    push rax         # string\n")
+	for _, bound := range []parser.Expression{expr.Start, expr.End} {
+		if bound == nil {
+			continue
+		}
+		if typ := cg.generateExpression(bound); !isInteger(typ) {
+			cg.errorAt(expr.Token, ErrTypeMismatch, "string index must be Int, got %s", typ)
+		}
+		cg.output.WriteString("    push rax\n")
+	}
+
+	if expr.End != nil {
+		cg.output.WriteString("    pop rdx          # end\n")
+	}
+	if expr.Start != nil {
+		cg.output.WriteString("    pop rsi          # start\n")
+	} else {
+		cg.output.WriteString("    xor esi, esi     # start\n")
+	}
+	cg.output.WriteString("    pop rdi\n")
+	if expr.End == nil {
+		cg.output.WriteString("    call strlen\n")
+		cg.output.WriteString("    mov rdx, rax     # end\n")
+	}
+	cg.requireRuntime("str_slice")
+	cg.output.WriteString("    call str_slice\n")
+	return "String"
+}
+
+// generatePrintConstant writes a String known at compile time straight to
+// stdout; its length is known too, so print_string's strlen is not needed
+func (cg *CodeGenerator) generatePrintConstant(text string) {
+	cg.output.WriteString(fmt.Sprintf("    lea rsi, [%s]\n", cg.getStringLabel(text)))
+	cg.output.WriteString(fmt.Sprintf("    mov rdx, %d       # length\n", len(stringBytes(text))))
+	cg.output.WriteString("    mov rdi, 1       # stdout\n")
+	cg.syscall("write")
+}
+
+// writeStringConstants emits the null-terminated string constants. A string
+// whose bytes end another one, or repeat an earlier one, is not emitted
+// again: its label points into the other string's bytes.
+func (cg *CodeGenerator) writeStringConstants() {
+	bytes := make([][]byte, len(cg.stringLabels))
+	for i, literal := range cg.stringLabels {
+		bytes[i] = stringBytes(literal)
+	}
+
+	merged, saved := 0, 0
+	for i, literal := range cg.stringLabels {
+		label := cg.stringConstants[literal]
+		if host := suffixHost(bytes, i); host != i {
+			offset := len(bytes[host]) - len(bytes[i])
+			cg.output.WriteString(fmt.Sprintf("%s = %s + %d\n", label, cg.stringConstants[cg.stringLabels[host]], offset))
+			merged++
+			saved += len(bytes[i]) + 1
+			continue
+		}
+		cg.output.WriteString(fmt.Sprintf("%s: .asciz \"%s\"\n", label, ascizText(literal)))
+	}
+	if merged > 0 {
+		cg.output.WriteString(fmt.Sprintf("# string pool: %d of %d strings share the bytes of another, saving %d bytes\n", merged, len(bytes), saved))
+	}
+}
+
+// suffixHost returns the index of the string whose bytes hold those of
+// string i at their end: the longest such string, the earliest of equal
+// ones, which may be i itself. Hosts are never merged into another string.
+func suffixHost(bytes [][]byte, i int) int {
+	host := i
+	for j, candidate := range bytes {
+		if len(candidate) < len(bytes[host]) || len(candidate) == len(bytes[host]) && j >= host {
+			continue
+		}
+		if string(candidate[len(candidate)-len(bytes[i]):]) == string(bytes[i]) {
+			host = j
+		}
+	}
+	return host
+}
+
+// stringBytes returns the bytes strlen finds in a string: those before its
+// first zero byte
+func stringBytes(value string) []byte {
+	if end := strings.IndexByte(value, 0); end >= 0 {
+		value = value[:end]
+	}
+	return []byte(value)
+}
+
+// ascizText returns a string as it is written in a .asciz directive
+func ascizText(value string) string {
+	var text strings.Builder
+	for i := 0; i < len(value); i++ {
+		text.WriteString(charText(value[i]))
+	}
+	return text.String()
+}
+
+func (cg *CodeGenerator) generateStrIndexFunction() {
+	cg.output.WriteString("# str_index function - reads one byte of a null-terminated string\n")
+	cg.output.WriteString("# Input: rdi = string address, rsi = index\n")
+	cg.output.WriteString("# Output: rax = the byte, zero-extended\n")
+	cg.output.WriteString("str_index:\n")
+	cg.output.WriteString("    push rbp\n")
+	cg.output.WriteString("    mov rbp, rsp\n")
+	cg.output.WriteString("    call strlen\n")
+	cg.output.WriteString("    cmp rsi, rax     # unsigned, so negative indices fail too\n")
+	cg.output.WriteString("    jae index_out_of_range\n")
+	cg.output.WriteString("    movzx eax, byte ptr [rdi + rsi]\n")
+	cg.output.WriteString("    mov rsp, rbp\n")
+	cg.output.WriteString("    pop rbp\n")
+	cg.output.WriteString("    ret\n\n")
+}
+
+func (cg *CodeGenerator) generateStrSliceFunction() {
+	cg.output.WriteString("# str_slice function - copies the bytes from start up to end into a new string\n")
+	cg.output.WriteString("# Input: rdi = string address, rsi = start, rdx = end\n")
+	cg.output.WriteString("# Output: rax = address of the newly allocated result\n")
+	cg.output.WriteString("str_slice:\n")
+	cg.output.WriteString("    push rbp\n")
+	cg.output.WriteString("    mov rbp, rsp\n")
+	cg.output.WriteString("    push r12\n")
+	cg.output.WriteString("    push r13\n")
+	cg.output.WriteString("    call strlen\n")
+	cg.output.WriteString("    cmp rdx, rax     # unsigned, so negative bounds fail too\n")
+	cg.output.WriteString("    ja index_out_of_range\n")
+	cg.output.WriteString("    cmp rsi, rdx\n")
+	cg.output.WriteString("    ja index_out_of_range\n")
+	cg.output.WriteString("    lea r12, [rdi + rsi]  # first byte\n")
+	cg.output.WriteString("    mov r13, rdx\n")
+	cg.output.WriteString("    sub r13, rsi     # length\n")
+	cg.output.WriteString("    lea rdi, [r13 + 1]  # room for the terminator\n")
+	cg.output.WriteString("    call alloc\n")
+	cg.output.WriteString("    mov rdi, rax     # copy destination\n")
+	cg.output.WriteString("    mov rsi, r12\n")
+	cg.output.WriteString("    mov rcx, r13\n")
+	cg.output.WriteString("    rep movsb\n")
+	cg.output.WriteString("    mov byte ptr [rdi], 0\n")
+	cg.output.WriteString("    pop r13\n")
+	cg.output.WriteString("    pop r12\n")
+	cg.output.WriteString("    mov rsp, rbp\n")
+	cg.output.WriteString("    pop rbp\n")
+	cg.output.WriteString("    ret\n\n")
+}
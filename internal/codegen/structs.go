@@ -0,0 +1,335 @@
+package codegen
+
+import (
+	"fmt"
+
+	"dreadlang/internal/lexer"
+	"dreadlang/internal/parser"
+)
+
+// Structs group named fields, laid out in declaration order like the
+// elements of an array: the first field at the lowest address, each in its
+// own 8-byte slots. A field is therefore at a fixed offset from the start
+// of the struct, whether the struct lives on the stack or in .data.
+
+// structType is the layout the compiler computed for a Struct declaration
+type structType struct {
+	Token  lexer.Token // the name where it was declared
+	Name   string
+	Fields []structField
+	Size   int64 // bytes, a multiple of 8
+}
+
+// structField is one field of a struct, Offset bytes from its start
+type structField struct {
+	Name   string
+	Type   string
+	Offset int64
+}
+
+// field finds the field called name
+func (s *structType) field(name string) (structField, bool) {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return structField{}, false
+}
+
+// defineStruct computes the layout of a struct declaration. Field types may
+// use constants and structs declared before it, so a struct never contains
+// itself.
+func (cg *CodeGenerator) defineStruct(stmt *parser.StructStatement) {
+	if _, exists := cg.structs[stmt.Name]; exists {
+		cg.errorAt(stmt.Token, ErrAlreadyDeclared, "struct %s is already defined", stmt.Name)
+		return
+	}
+	if _, isAlias := cg.aliases[stmt.Name]; isAlias || cg.interfaces[stmt.Name] != nil {
+		cg.errorAt(stmt.Token, ErrAlreadyDeclared, "type %s is already defined", stmt.Name)
+		return
+	}
+
+	s := &structType{Token: stmt.Token, Name: stmt.Name}
+	for _, f := range stmt.Fields {
+		if _, exists := s.field(f.Name); exists {
+			cg.errorAt(f.Token, ErrAlreadyDeclared, "field %s is already defined in struct %s", f.Name, stmt.Name)
+			continue
+		}
+		typ, ok := cg.resolveTypeName(f.Token, f.Name, f.Type, f.Length)
+		if !ok {
+			continue
+		}
+		s.Fields = append(s.Fields, structField{Name: f.Name, Type: typ, Offset: s.Size})
+		s.Size += cg.sizeOf(typ)
+	}
+	cg.structs[stmt.Name] = s
+}
+
+// isAggregate reports whether values of type typ take more than a register:
+// arrays and structs, which are only ever copied slot by slot
+func (cg *CodeGenerator) isAggregate(typ string) bool {
+	_, isStruct := cg.structs[typ]
+	_, isTuple := tupleType(typ)
+	return isStruct || isArray(typ) || isTuple
+}
+
+// slot is one 8-byte slot of a value: the scalar type it holds, and how to
+// name it in comments
+type slot struct {
+	name string
+	typ  string
+}
+
+// flatten lists the slots of a value of type typ called name, in address
+// order, naming them like the source would: a[1], p.x
+func (cg *CodeGenerator) flatten(name string, typ string) []slot {
+	if s, ok := cg.structs[typ]; ok {
+		var slots []slot
+		for _, f := range s.Fields {
+			slots = append(slots, cg.flatten(name+"."+f.Name, f.Type)...)
+		}
+		return slots
+	}
+	if elements, ok := tupleType(typ); ok {
+		var slots []slot
+		for i, element := range elements {
+			slots = append(slots, cg.flatten(fmt.Sprintf("%s.%d", name, i), element)...)
+		}
+		return slots
+	}
+	if element, length, ok := arrayType(typ); ok {
+		slots := make([]slot, length)
+		for i := range slots {
+			slots[i] = slot{fmt.Sprintf("%s[%d]", name, i), element}
+		}
+		return slots
+	}
+	return []slot{{name, typ}}
+}
+
+// place is where a value lives: a variable, or a field inside one, offset
+// bytes from the variable's start
+type place struct {
+	variable *variable
+	offset   int64
+	typ      string
+}
+
+// place returns where the whole of v lives
+func (v *variable) place() place {
+	return place{variable: v, typ: v.Type}
+}
+
+// slot returns the memory operand of the i-th slot of the value at p
+func (p place) slot(i int64) string {
+	v := p.variable
+	if v.Global != "" {
+		if p.offset+8*i == 0 {
+			return v.Global
+		}
+		return fmt.Sprintf("%s + %d", v.Global, p.offset+8*i)
+	}
+	return fmt.Sprintf("rbp - %d", int64(v.Offset)-p.offset-8*i)
+}
+
+// indexed returns the memory operand of the slot of p whose index is in register
+func (p place) indexed(register string) string {
+	v := p.variable
+	if v.Global != "" {
+		if p.offset == 0 {
+			return fmt.Sprintf("%s + %s*8", v.Global, register)
+		}
+		return fmt.Sprintf("%s + %d + %s*8", v.Global, p.offset, register)
+	}
+	return fmt.Sprintf("rbp + %s*8 - %d", register, int64(v.Offset)-p.offset)
+}
+
+// placeToken returns the token to report errors about a place at
+func placeToken(expr parser.Expression) lexer.Token {
+	switch e := expr.(type) {
+	case *parser.FieldExpression:
+		return e.Token
+	case *parser.CallExpression:
+		return e.Token
+	}
+	return expr.(*parser.Identifier).Token
+}
+
+// resolvePlace finds where a variable or one of its fields lives. Field
+// offsets are known at compile time, so this emits no code, except to make
+// a call whose result is used in place.
+func (cg *CodeGenerator) resolvePlace(expr parser.Expression) (place, bool) {
+	switch e := expr.(type) {
+	case *parser.Identifier:
+		v, exists := cg.lookupVariable(e.Value)
+		if !exists {
+			// semant has reported it
+			return place{}, false
+		}
+		cg.refer(e.Token, v)
+		return v.place(), true
+	case *parser.FieldExpression:
+		p, ok := cg.resolvePlace(e.Struct)
+		if !ok {
+			return place{}, false
+		}
+		s, ok := cg.structs[p.typ]
+		if !ok {
+			cg.errorAt(e.Token, ErrTypeMismatch, "cannot access field %s of %s %s", e.Field, p.typ, comment(e.Struct))
+			return place{}, false
+		}
+		f, ok := s.field(e.Field)
+		if !ok {
+			cg.errorAt(e.Token, ErrUnknownField, "struct %s has no field %s", s.Name, e.Field)
+			return place{}, false
+		}
+		return place{variable: p.variable, offset: p.offset + f.Offset, typ: f.Type}, true
+	case *parser.CallExpression:
+		return cg.resultPlace(e)
+	default:
+		panic(fmt.Sprintf("resolvePlace: unexpected %T", expr))
+	}
+}
+
+// generateFieldExpression loads a field, or leaves its address in rax when
+// it is itself an array or a struct
+func (cg *CodeGenerator) generateFieldExpression(expr *parser.FieldExpression) string {
+	p, ok := cg.resolvePlace(expr)
+	if !ok {
+		return "Int"
+	}
+	if cg.isAggregate(p.typ) {
+		cg.output.WriteString(fmt.Sprintf("    lea rax, [%s]    # address of %s\n", p.slot(0), comment(expr)))
+		return p.typ
+	}
+	cg.output.WriteString(fmt.Sprintf("    mov rax, [%s]    # load %s\n", p.slot(0), comment(expr)))
+	return p.typ
+}
+
+// generateFieldAssign stores a value into a field: name.field = value
+func (cg *CodeGenerator) generateFieldAssign(stmt *parser.AssignStatement) {
+	cg.output.WriteString(fmt.Sprintf("    # %s\n", comment(stmt)))
+	typ, literal := cg.generateValue(stmt.Value, "")
+	if v, exists := cg.lookupVariable(stmt.Name); exists && v.Constant != nil {
+		cg.errorAt(stmt.Token, ErrAssignConstant, "cannot assign to constant %s", stmt.Name)
+		return
+	}
+	p, ok := cg.resolvePlace(stmt.Field)
+	if !ok {
+		return
+	}
+	if typ = cg.convert(typ, p.typ); typ != p.typ {
+		// The type pass has reported it
+		return
+	}
+	cg.storeValue(comment(stmt.Field), p, literal)
+}
+
+// resolveMethod returns the symbol of the method a call names on its
+// receiver, such as Point.Length for p.Length()
+func (cg *CodeGenerator) resolveMethod(call *parser.CallExpression) (string, bool) {
+	p, ok := cg.resolvePlace(call.Receiver)
+	if !ok {
+		return "", false
+	}
+	if _, isInterface := cg.interfaces[p.typ]; isInterface {
+		symbol := p.typ + "." + call.Function
+		if _, exists := cg.functions[symbol]; !exists {
+			cg.errorAt(call.Token, ErrUnknownField, "interface %s has no method %s", p.typ, call.Function)
+			return "", false
+		}
+		return symbol, true
+	}
+	if _, isStruct := cg.structs[p.typ]; !isStruct {
+		cg.errorAt(call.Token, ErrTypeMismatch, "cannot call method %s on %s %s", call.Function, p.typ, comment(call.Receiver))
+		return "", false
+	}
+	symbol := p.typ + "." + call.Function
+	if _, exists := cg.functions[symbol]; !exists {
+		cg.errorAt(call.Token, ErrUnknownField, "struct %s has no method %s", p.typ, call.Function)
+		return "", false
+	}
+	return symbol, true
+}
+
+// generateStructLiteral pushes the slots of a struct literal in address
+// order, filling in the zero value of every field it leaves out, and
+// returns the struct's type
+func (cg *CodeGenerator) generateStructLiteral(literal *parser.StructLiteral) string {
+	s, ok := cg.structs[cg.aliased(literal.Name)]
+	if !ok {
+		cg.undefinedName(literal.Token, ErrUndefinedType, "type", literal.Name, cg.typeNames())
+		return "Int"
+	}
+	if _, isAlias := cg.aliases[literal.Name]; isAlias {
+		cg.checkTypeVisible(literal.Token, literal.Name)
+	} else {
+		cg.checkVisible(literal.Token, s.Token, "struct")
+	}
+	values, ok := cg.fieldValues(s, literal)
+	if !ok {
+		return s.Name
+	}
+
+	for _, f := range s.Fields {
+		value, given := values[f.Name]
+		if !given {
+			cg.pushZero(literal.Name+"."+f.Name, f.Type)
+			continue
+		}
+		// The type pass checks the value against the field
+		cg.pushValue(value.Value, f.Type)
+	}
+	return s.Name
+}
+
+// fieldValues indexes the fields set by a struct literal by name, reporting
+// unknown fields and fields set twice
+func (cg *CodeGenerator) fieldValues(s *structType, literal *parser.StructLiteral) (map[string]*parser.FieldValue, bool) {
+	values := make(map[string]*parser.FieldValue)
+	ok := true
+	for _, value := range literal.Fields {
+		if _, exists := s.field(value.Name); !exists {
+			cg.errorAt(value.Token, ErrUnknownField, "struct %s has no field %s", s.Name, value.Name)
+			ok = false
+		} else if _, exists := values[value.Name]; exists {
+			cg.errorAt(value.Token, ErrAlreadyDeclared, "field %s of %s is set twice", value.Name, s.Name)
+			ok = false
+		}
+		values[value.Name] = value
+	}
+	return values, ok
+}
+
+// pushValue evaluates expr, converted to want where that is implicit, and
+// pushes its slots in address order, so the last slot ends up on top
+func (cg *CodeGenerator) pushValue(expr parser.Expression, want string) string {
+	typ, literal := cg.generateValue(expr, want)
+	if !literal {
+		typ = cg.convert(typ, want)
+	}
+	switch {
+	case literal:
+		// Already on the stack
+	case cg.isAggregate(typ):
+		for i := range cg.flatten("", typ) {
+			cg.output.WriteString(fmt.Sprintf("    push qword ptr [rax + %d]\n", 8*i))
+		}
+	default:
+		cg.output.WriteString(fmt.Sprintf("    push rax         # %s\n", comment(expr)))
+	}
+	return typ
+}
+
+// pushZero pushes the zero value of every slot of a value of type typ
+func (cg *CodeGenerator) pushZero(name string, typ string) {
+	for _, s := range cg.flatten(name, typ) {
+		if s.typ == "String" {
+			cg.output.WriteString(fmt.Sprintf("    lea rax, [%s]\n", cg.getStringLabel("")))
+			cg.output.WriteString(fmt.Sprintf("    push rax         # %s = ''\n", s.name))
+		} else {
+			cg.output.WriteString(fmt.Sprintf("    push 0           # %s = 0\n", s.name))
+		}
+	}
+}
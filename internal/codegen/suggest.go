@@ -0,0 +1,40 @@
+package codegen
+
+import (
+	"dreadlang/internal/lexer"
+	"dreadlang/internal/semant"
+)
+
+// Undefined variables and functions are reported by semant, before code is
+// generated; types are resolved here, and an undefined one is reported with
+// the closest defined type, as semant.Suggest does for the others:
+//
+//	undefined type Pont, did you mean Point?
+
+// undefinedName reports the name of tok, of the given kind, as undefined,
+// suggesting the closest of candidates. The suggestion is attached as a fix
+// when tok is the name itself.
+func (cg *CodeGenerator) undefinedName(tok lexer.Token, code string, kind string, name string, candidates []string) {
+	d := semant.Suggest(tok, code, kind, name, candidates)
+	cg.errorAt(tok, code, "%s", d.Message)
+	cg.diagnostics[len(cg.diagnostics)-1].Fix = d.Fix
+}
+
+// typeNames returns the names of the scalar types and declared structs and
+// interfaces
+func (cg *CodeGenerator) typeNames() []string {
+	names := []string{"Float", "Char", "String"}
+	for name := range integerTypes {
+		names = append(names, name)
+	}
+	for name := range cg.structs {
+		names = append(names, name)
+	}
+	for name := range cg.interfaces {
+		names = append(names, name)
+	}
+	for name := range cg.aliases {
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,320 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+
+	"dreadlang/internal/parser"
+)
+
+// The syscalls the compiler knows are declared once, in syscallTable: the
+// number of each on every operating system that has it, the libc function
+// that makes it, and the kinds of its arguments. The targets take their
+// syscall numbers and libc wrappers from the table, and the Syscall builtin
+// calls a wrapper function, sys_NAME, generated from its row the first time
+// a program makes the syscall. A new target names its system in
+// syscallNumbers and so gets every wrapper the table gives numbers for.
+
+// argumentKind is what a syscall argument is, and which Dread values it takes
+type argumentKind int
+
+const (
+	integerArgument argumentKind = iota // a number: any integer
+	addressArgument                     // memory: an Int address, or a String's text
+	pathArgument                        // a file name: a String, whose text ends in a NUL
+)
+
+var argumentKindNames = [...]string{
+	integerArgument: "Int",
+	addressArgument: "Address",
+	pathArgument:    "String",
+}
+
+// argumentKindDescriptions say what an argument of each kind must be
+var argumentKindDescriptions = [...]string{
+	integerArgument: "an integer",
+	addressArgument: "an Int address or a String",
+	pathArgument:    "a String",
+}
+
+func (k argumentKind) String() string {
+	return argumentKindNames[k]
+}
+
+// syscallArgument is an argument of a syscall, named as the manual pages do
+type syscallArgument struct {
+	name string
+	kind argumentKind
+}
+
+// syscallSpec is a row of the table
+type syscallSpec struct {
+	name      string
+	numbers   map[string]int // by operating system, the part of a target's name after the -
+	libc      string         // the libc function, "" when libc has none
+	arguments []syscallArgument
+}
+
+// syscallTable lists the syscalls, in the order Syscall's messages name them
+var syscallTable = []syscallSpec{
+	{
+		name:      "read",
+		numbers:   map[string]int{"linux": 0, "freebsd": 3},
+		libc:      "read",
+		arguments: []syscallArgument{{"fd", integerArgument}, {"buffer", addressArgument}, {"length", integerArgument}},
+	},
+	{
+		name:      "write",
+		numbers:   map[string]int{"linux": 1, "freebsd": 4},
+		libc:      "write",
+		arguments: []syscallArgument{{"fd", integerArgument}, {"buffer", addressArgument}, {"length", integerArgument}},
+	},
+	{
+		name:      "open",
+		numbers:   map[string]int{"linux": 2, "freebsd": 5},
+		libc:      "open",
+		arguments: []syscallArgument{{"path", pathArgument}, {"flags", integerArgument}, {"mode", integerArgument}},
+	},
+	{
+		name:      "close",
+		numbers:   map[string]int{"linux": 3, "freebsd": 6},
+		libc:      "close",
+		arguments: []syscallArgument{{"fd", integerArgument}},
+	},
+	{
+		name:      "lseek",
+		numbers:   map[string]int{"linux": 8, "freebsd": 478},
+		libc:      "lseek",
+		arguments: []syscallArgument{{"fd", integerArgument}, {"offset", integerArgument}, {"whence", integerArgument}},
+	},
+	{
+		name:    "mmap",
+		numbers: map[string]int{"linux": 9, "freebsd": 477},
+		libc:    "mmap",
+		arguments: []syscallArgument{
+			{"address", addressArgument}, {"length", integerArgument}, {"protection", integerArgument},
+			{"flags", integerArgument}, {"fd", integerArgument}, {"offset", integerArgument},
+		},
+	},
+	{
+		name:      "munmap",
+		numbers:   map[string]int{"linux": 11, "freebsd": 73},
+		libc:      "munmap",
+		arguments: []syscallArgument{{"address", addressArgument}, {"length", integerArgument}},
+	},
+	{
+		// Only Linux can ask for the current break, which alloc needs
+		name:      "brk",
+		numbers:   map[string]int{"linux": 12},
+		arguments: []syscallArgument{{"address", addressArgument}},
+	},
+	{
+		name:    "getpid",
+		numbers: map[string]int{"linux": 39, "freebsd": 20},
+		libc:    "getpid",
+	},
+	{
+		name:      "socket",
+		numbers:   map[string]int{"linux": 41, "freebsd": 97},
+		libc:      "socket",
+		arguments: []syscallArgument{{"domain", integerArgument}, {"type", integerArgument}, {"protocol", integerArgument}},
+	},
+	{
+		name:      "accept",
+		numbers:   map[string]int{"linux": 43, "freebsd": 30},
+		libc:      "accept",
+		arguments: []syscallArgument{{"fd", integerArgument}, {"address", addressArgument}, {"length", addressArgument}},
+	},
+	{
+		name:      "bind",
+		numbers:   map[string]int{"linux": 49, "freebsd": 104},
+		libc:      "bind",
+		arguments: []syscallArgument{{"fd", integerArgument}, {"address", addressArgument}, {"length", integerArgument}},
+	},
+	{
+		name:      "listen",
+		numbers:   map[string]int{"linux": 50, "freebsd": 106},
+		libc:      "listen",
+		arguments: []syscallArgument{{"fd", integerArgument}, {"backlog", integerArgument}},
+	},
+	{
+		name:      "unlink",
+		numbers:   map[string]int{"linux": 87, "freebsd": 10},
+		libc:      "unlink",
+		arguments: []syscallArgument{{"path", pathArgument}},
+	},
+	{
+		// libc's exit would run atexit handlers and flush stdio first
+		name:      "exit",
+		numbers:   map[string]int{"linux": 60, "freebsd": 1},
+		libc:      "_exit",
+		arguments: []syscallArgument{{"status", integerArgument}},
+	},
+	{
+		name:      "clock_gettime",
+		numbers:   map[string]int{"linux": 228, "freebsd": 232},
+		libc:      "clock_gettime",
+		arguments: []syscallArgument{{"clock", integerArgument}, {"time", addressArgument}},
+	},
+}
+
+// syscallNumbers returns the syscalls of an operating system by name, for a
+// target that traps into its kernel
+func syscallNumbers(system string) map[string]int {
+	numbers := make(map[string]int)
+	for _, s := range syscallTable {
+		if number, ok := s.numbers[system]; ok {
+			numbers[s.name] = number
+		}
+	}
+	return numbers
+}
+
+// libcFunctions returns the libc function making each syscall, for a target
+// that goes through libc
+func libcFunctions() map[string]string {
+	functions := make(map[string]string)
+	for _, s := range syscallTable {
+		if s.libc != "" {
+			functions[s.name] = s.libc
+		}
+	}
+	return functions
+}
+
+// lookupSyscall finds the row of the table for a syscall
+func lookupSyscall(name string) (*syscallSpec, bool) {
+	for i := range syscallTable {
+		if syscallTable[i].name == name {
+			return &syscallTable[i], true
+		}
+	}
+	return nil, false
+}
+
+// hasSyscall reports whether programs for the target can make the syscall
+func (t *Target) hasSyscall(name string) bool {
+	if t.syscallFunctions != nil {
+		_, ok := t.syscallFunctions[name]
+		return ok
+	}
+	_, ok := t.syscalls[name]
+	return ok
+}
+
+// Syscalls returns the names of the syscalls programs for the target can
+// make with Syscall, in the order of the table
+func (t *Target) Syscalls() []string {
+	var names []string
+	for _, s := range syscallTable {
+		if t.hasSyscall(s.name) {
+			names = append(names, s.name)
+		}
+	}
+	return names
+}
+
+// signature renders how Syscall is called for s, as messages show it
+func (s *syscallSpec) signature() string {
+	parts := []string{"'" + s.name + "'"}
+	for _, a := range s.arguments {
+		parts = append(parts, a.name+" "+a.kind.String())
+	}
+	return "Syscall(" + strings.Join(parts, ", ") + ")"
+}
+
+// generateSyscall emits Syscall(name, arguments...), a call of the wrapper
+// of the named syscall that leaves its result in rax
+func (cg *CodeGenerator) generateSyscall(expr *parser.CallExpression) {
+	if len(expr.Arguments) == 0 {
+		cg.errorAt(expr.Token, ErrBuiltinArguments, "Syscall expects the name of a syscall and its arguments")
+		return
+	}
+	value, typ, ok := cg.evaluateConstant(expr.Arguments[0])
+	if !ok || typ != "String" {
+		cg.errorAt(expr.Token, ErrBuiltinArguments, "Syscall expects the name of a syscall as a constant String")
+		return
+	}
+	s, known := lookupSyscall(value.String)
+	if !known {
+		names := make([]string, len(syscallTable))
+		for i, s := range syscallTable {
+			names[i] = s.name
+		}
+		cg.errorAt(expr.Token, ErrBuiltinArguments, "unknown syscall '%s': the syscalls are %s", value.String, strings.Join(names, ", "))
+		return
+	}
+	if !cg.target.hasSyscall(s.name) {
+		cg.errorAt(expr.Token, ErrWrongTarget, "syscall '%s' is not available on %s", s.name, cg.target.Name)
+		return
+	}
+	args := expr.Arguments[1:]
+	if len(args) != len(s.arguments) {
+		cg.errorAt(expr.Token, ErrBuiltinArguments, "wrong number of arguments to syscall '%s', which is called as %s", s.name, s.signature())
+		return
+	}
+
+	cg.output.WriteString(fmt.Sprintf("    # %s\n", comment(expr)))
+	for i, arg := range args {
+		a := s.arguments[i]
+		typ := cg.generateExpression(arg)
+		switch a.kind {
+		case integerArgument:
+			ok = isInteger(typ)
+		case addressArgument:
+			ok = isInteger(typ) || cg.convert(typ, "String") == "String"
+		case pathArgument:
+			ok = cg.convert(typ, "String") == "String"
+		}
+		if !ok {
+			cg.errorAt(expr.Token, ErrTypeMismatch, "argument %s of syscall '%s' must be %s, got %s", a.name, s.name, argumentKindDescriptions[a.kind], typ)
+		}
+		cg.output.WriteString(fmt.Sprintf("    push rax         # %s\n", a.name))
+	}
+	for i := len(args) - 1; i >= 0; i-- {
+		cg.output.WriteString(fmt.Sprintf("    pop %s\n", argumentRegisters[i]))
+	}
+	wrapper := "sys_" + s.name
+	cg.requireRuntime(wrapper)
+	cg.output.WriteString(fmt.Sprintf("    call %s\n", wrapper))
+}
+
+// syscallWrapper returns the row of the table a runtime helper named
+// sys_NAME wraps
+func syscallWrapper(helper string) (*syscallSpec, bool) {
+	name, ok := strings.CutPrefix(helper, "sys_")
+	if !ok {
+		return nil, false
+	}
+	return lookupSyscall(name)
+}
+
+// generateSyscallWrapper emits sys_NAME, which takes the arguments of a
+// syscall in the registers of a function call, makes it, and returns its
+// result with a failure as a negative number, however the target reports one
+func (cg *CodeGenerator) generateSyscallWrapper(s *syscallSpec) {
+	label := "sys_" + s.name
+	inputs := make([]string, len(s.arguments))
+	for i, a := range s.arguments {
+		inputs[i] = fmt.Sprintf("%s = %s", argumentRegisters[i], a.name)
+	}
+	cg.output.WriteString(fmt.Sprintf("# %s function - makes the %s syscall for Syscall\n", label, s.name))
+	if len(inputs) > 0 {
+		cg.output.WriteString(fmt.Sprintf("# Input: %s\n", strings.Join(inputs, ", ")))
+	}
+	cg.output.WriteString("# Output: rax = the result, negative when the syscall failed\n")
+	cg.output.WriteString(fmt.Sprintf("%s:\n", label))
+	cg.output.WriteString("    push rbp\n")
+	cg.output.WriteString("    mov rbp, rsp\n")
+	if len(s.arguments) > 3 && cg.target.argumentRegister(3) != "rcx" {
+		cg.output.WriteString(fmt.Sprintf("    mov %s, rcx     # the syscall instruction overwrites rcx\n", cg.target.argumentRegister(3)))
+	}
+	cg.syscall(s.name)
+	if cg.target.errorInCarry && cg.target.syscallFunctions == nil {
+		cg.output.WriteString(fmt.Sprintf("    jnc %s_done\n", label))
+		cg.output.WriteString("    neg rax          # the kernel gives errno with the carry flag set\n")
+		cg.output.WriteString(fmt.Sprintf("%s_done:\n", label))
+	}
+	cg.output.WriteString("    pop rbp\n")
+	cg.output.WriteString("    ret\n\n")
+}
@@ -0,0 +1,227 @@
+package codegen
+
+import "fmt"
+
+// Target describes how generated programs talk to the operating system,
+// and which CPU they run on. Instruction selection is x86-64 throughout,
+// using the extensions of the CPU where they help.
+type Target struct {
+	Name string
+
+	// cpu is the processor programs run on; nil means BaselineCPU
+	cpu *CPU
+
+	// syscalls maps the portable names used by the code generator to the
+	// target's syscall numbers, as syscallNumbers reads them from the table
+	syscalls map[string]int
+
+	// syscallFunctions, when set, replaces raw syscalls with calls to these
+	// functions: libc wrappers, or the I/O hooks of a freestanding program
+	syscallFunctions map[string]string
+
+	// defaultHooks emits weak fallbacks for the syscall functions, so that a
+	// freestanding program links on its own until the user supplies them
+	defaultHooks bool
+
+	// syscallRegister receives the syscall number
+	syscallRegister string
+
+	// syscallInstruction traps into the kernel
+	syscallInstruction string
+
+	// errorInCarry is set when a failed syscall sets the carry flag instead
+	// of returning -errno
+	errorInCarry bool
+
+	// entrySymbol is where execution starts: _start, or main when libc's
+	// startup code runs first
+	entrySymbol string
+
+	// monotonicClock is the clock_gettime clock that never jumps, which
+	// benchmarks are timed with
+	monotonicClock int
+
+	// heap selects how alloc obtains memory: "brk" grows the program break,
+	// "mmap" maps anonymous chunks, "arena" hands out a fixed .bss block
+	heap string
+
+	// abiNote, when set, is the vendor name of the ELF note that brands
+	// executables for this system
+	abiNote        string
+	abiNoteSection string
+	abiNoteVersion int
+}
+
+// LinuxAMD64 is the default target: Linux on x86-64
+var LinuxAMD64 = &Target{
+	Name:               "amd64-linux",
+	syscalls:           syscallNumbers("linux"),
+	syscallRegister:    "rax",
+	syscallInstruction: "syscall",
+	entrySymbol:        "_start",
+	monotonicClock:     1,
+	heap:               "brk",
+}
+
+// FreeBSDAMD64 is FreeBSD on x86-64. Its break syscall cannot report the
+// current break, so the heap is built from mmap'd chunks instead.
+var FreeBSDAMD64 = &Target{
+	Name:               "amd64-freebsd",
+	syscalls:           syscallNumbers("freebsd"),
+	syscallRegister:    "rax",
+	syscallInstruction: "syscall",
+	errorInCarry:       true,
+	entrySymbol:        "_start",
+	monotonicClock:     4,
+	heap:               "mmap",
+	abiNote:            "FreeBSD",
+	abiNoteSection:     ".note.tag",
+	abiNoteVersion:     1300000,
+}
+
+// OpenBSDAMD64 is OpenBSD on x86-64. The kernel only accepts syscalls made
+// from libc, so programs call the libc wrappers and start at main.
+var OpenBSDAMD64 = &Target{
+	Name:             "amd64-openbsd",
+	syscallFunctions: libcFunctions(),
+	entrySymbol:      "main",
+	monotonicClock:   3,
+	heap:             "mmap",
+	abiNote:          "OpenBSD",
+	abiNoteSection:   ".note.openbsd.ident",
+	abiNoteVersion:   0,
+}
+
+// Freestanding is x86-64 without an operating system, for kernels and boot
+// loaders. Output goes through the hooks dread_write(fd, buffer, length) and
+// dread_exit(status), which the user links in; the heap is a fixed arena.
+var Freestanding = &Target{
+	Name: "amd64-none",
+	syscallFunctions: map[string]string{
+		"write": "dread_write",
+		"exit":  "dread_exit",
+	},
+	defaultHooks: true,
+	entrySymbol:  "dread_main",
+	heap:         "arena",
+}
+
+// targets lists every target the code generator supports, by name
+var targets = map[string]*Target{
+	LinuxAMD64.Name:   LinuxAMD64,
+	FreeBSDAMD64.Name: FreeBSDAMD64,
+	OpenBSDAMD64.Name: OpenBSDAMD64,
+	Freestanding.Name: Freestanding,
+}
+
+// LookupTarget returns the target with the given name, such as "amd64-linux"
+func LookupTarget(name string) (*Target, bool) {
+	t, ok := targets[name]
+	return t, ok
+}
+
+// WithEntry returns a copy of the target whose programs start at symbol
+func (t *Target) WithEntry(symbol string) *Target {
+	c := *t
+	c.entrySymbol = symbol
+	return &c
+}
+
+// WithCPU returns a copy of the target whose programs may use the
+// instructions of cpu
+func (t *Target) WithCPU(cpu *CPU) *Target {
+	c := *t
+	c.cpu = cpu
+	return &c
+}
+
+// CPU returns the processor programs for the target run on
+func (t *Target) CPU() *CPU {
+	if t.cpu == nil {
+		return BaselineCPU
+	}
+	return t.cpu
+}
+
+// EntrySymbol returns the symbol where programs for the target start
+func (t *Target) EntrySymbol() string {
+	return t.entrySymbol
+}
+
+// argumentRegister returns the register holding the i-th (zero-based)
+// argument of a syscall. Raw syscalls take the fourth in r10 because the
+// syscall instruction overwrites rcx; libc wrappers use the usual rcx.
+func (t *Target) argumentRegister(i int) string {
+	if i == 3 && t.syscallFunctions == nil {
+		return "r10"
+	}
+	return argumentRegisters[i]
+}
+
+// syscall emits the invocation of the named syscall. The caller loads the
+// arguments first; the result is left in rax and every caller-saved register
+// must be treated as clobbered.
+func (cg *CodeGenerator) syscall(name string) {
+	if cg.target.syscallFunctions != nil {
+		function, ok := cg.target.syscallFunctions[name]
+		if !ok {
+			panic(fmt.Sprintf("codegen: syscall %s not available on %s", name, cg.target.Name))
+		}
+		cg.output.WriteString(fmt.Sprintf("    call %-11s# sys_%s\n", function, name))
+		return
+	}
+
+	number, ok := cg.target.syscalls[name]
+	if !ok {
+		panic(fmt.Sprintf("codegen: syscall %s not available on %s", name, cg.target.Name))
+	}
+	cg.output.WriteString(fmt.Sprintf("    mov %s, %-8d# sys_%s\n", cg.target.syscallRegister, number, name))
+	cg.output.WriteString(fmt.Sprintf("    %s\n", cg.target.syscallInstruction))
+}
+
+// jumpIfSyscallFailed branches to label when the last syscall failed
+func (cg *CodeGenerator) jumpIfSyscallFailed(label string) {
+	if cg.target.errorInCarry {
+		cg.output.WriteString(fmt.Sprintf("    jc %s\n", label))
+		return
+	}
+	// -errno and libc's -1 both fall in the last page of the address space
+	cg.output.WriteString("    cmp rax, -4096\n")
+	cg.output.WriteString(fmt.Sprintf("    ja %s\n", label))
+}
+
+// writeABINote brands the executable for the target system; the BSD kernels
+// use the note to choose the syscall table
+func (cg *CodeGenerator) writeABINote() {
+	if cg.target.abiNote == "" {
+		return
+	}
+	cg.output.WriteString(fmt.Sprintf(".pushsection %s, \"a\", @note\n", cg.target.abiNoteSection))
+	cg.output.WriteString("    .balign 4\n")
+	cg.output.WriteString(fmt.Sprintf("    .long %d        # name size\n", len(cg.target.abiNote)+1))
+	cg.output.WriteString("    .long 4        # description size\n")
+	cg.output.WriteString("    .long 1        # note type: ABI tag\n")
+	cg.output.WriteString(fmt.Sprintf("    .asciz \"%s\"\n", cg.target.abiNote))
+	cg.output.WriteString("    .balign 4\n")
+	cg.output.WriteString(fmt.Sprintf("    .long %d       # ABI version\n", cg.target.abiNoteVersion))
+	cg.output.WriteString(".popsection\n\n")
+}
+
+// writeDefaultHooks emits weak versions of the freestanding I/O hooks: output
+// is discarded and exiting halts the CPU. A strong definition linked in by the
+// user replaces each of them.
+func (cg *CodeGenerator) writeDefaultHooks() {
+	if !cg.target.defaultHooks {
+		return
+	}
+	cg.output.WriteString("# Default I/O hooks, overridden by the user's own definitions\n")
+	cg.output.WriteString(fmt.Sprintf(".weak %s\n", cg.target.syscallFunctions["write"]))
+	cg.output.WriteString(fmt.Sprintf("%s:\n", cg.target.syscallFunctions["write"]))
+	cg.output.WriteString("    mov rax, rdx     # report everything as written\n")
+	cg.output.WriteString("    ret\n")
+	cg.output.WriteString(fmt.Sprintf(".weak %s\n", cg.target.syscallFunctions["exit"]))
+	cg.output.WriteString(fmt.Sprintf("%s:\n", cg.target.syscallFunctions["exit"]))
+	cg.output.WriteString("    cli\n")
+	cg.output.WriteString("    hlt\n")
+	cg.output.WriteString(fmt.Sprintf("    jmp %s\n\n", cg.target.syscallFunctions["exit"]))
+}
@@ -0,0 +1,46 @@
+package codegen
+
+import (
+	"fmt"
+
+	"dreadlang/internal/parser"
+)
+
+// The result of a call can be used in place, as in box(1).Get(), name()[0]
+// or load().count: the first time the call is needed as a place, it is made
+// and its result stored in a temporary, stack slots that no name refers to.
+// Generating the same call again loads the temporary instead, so the call is
+// made once however many times its place is looked at. Each temporary gets
+// slots of its own, so nested results never overwrite each other.
+
+// resultPlace makes call and stores its result in a temporary
+func (cg *CodeGenerator) resultPlace(call *parser.CallExpression) (place, bool) {
+	if v, ok := cg.current.results[call]; ok {
+		return v.place(), true
+	}
+	typ := cg.generateExpression(call)
+	if typ == "Void" {
+		cg.errorAt(call.Token, ErrTypeMismatch, "%s has no result to use", comment(call))
+		return place{}, false
+	}
+	cg.current.frameSize += 8 * cg.slots(typ)
+	v := &variable{Type: typ, Offset: cg.current.frameSize}
+	cg.storeValue(comment(call), v.place(), false)
+	cg.current.results[call] = v
+	return v.place(), true
+}
+
+// loadResult loads the temporary holding the result of call, or its address
+// for an array or a struct; ok is false if the call was not made in place
+func (cg *CodeGenerator) loadResult(call *parser.CallExpression) (typ string, ok bool) {
+	v, ok := cg.current.results[call]
+	if !ok {
+		return "", false
+	}
+	if cg.isAggregate(v.Type) {
+		cg.output.WriteString(fmt.Sprintf("    lea rax, [%s]    # address of %s\n", v.address(), comment(call)))
+	} else {
+		cg.output.WriteString(fmt.Sprintf("    mov rax, [%s]    # load %s\n", v.address(), comment(call)))
+	}
+	return v.Type, true
+}
@@ -0,0 +1,127 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+
+	"dreadlang/internal/lexer"
+	"dreadlang/internal/parser"
+)
+
+// Tuples are anonymous aggregates written (1, 'a'), whose type lists the
+// types of their elements: (Int, String). Like structs they are laid out as
+// the slots of their elements in order and only ever copied slot by slot. A
+// function returning a tuple copies it to the heap and returns its address,
+// which the caller copies out of like any other aggregate.
+
+// tupleType returns the element types of a tuple type such as (Int, String)
+func tupleType(typ string) ([]string, bool) {
+	inner, ok := strings.CutPrefix(typ, "(")
+	if !ok {
+		return nil, false
+	}
+	inner, ok = strings.CutSuffix(inner, ")")
+	if !ok {
+		return nil, false
+	}
+	// Split at the commas outside any nested tuple
+	var elements []string
+	depth, start := 0, 0
+	for i := 0; i < len(inner); i++ {
+		switch inner[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				elements = append(elements, inner[start:i])
+				start = i + 2 // past ", "
+			}
+		}
+	}
+	return append(elements, inner[start:]), true
+}
+
+// resolveTupleType checks every element type of the tuple type typ
+func (cg *CodeGenerator) resolveTupleType(tok lexer.Token, name string, typ string) (string, bool) {
+	elements, _ := tupleType(typ)
+	for _, element := range elements {
+		if _, ok := cg.resolveTypeName(tok, name, element, nil); !ok {
+			return "", false
+		}
+	}
+	return typ, true
+}
+
+// generateTupleLiteral pushes the slots of every element of a tuple literal
+// in order, converting each to the matching element type of want, and
+// returns the tuple's type
+func (cg *CodeGenerator) generateTupleLiteral(tuple *parser.TupleLiteral, want string) string {
+	wantElements, _ := tupleType(want)
+	if len(wantElements) != len(tuple.Elements) {
+		wantElements = make([]string, len(tuple.Elements))
+	}
+	types := make([]string, len(tuple.Elements))
+	for i, element := range tuple.Elements {
+		types[i] = cg.pushValue(element, wantElements[i])
+		if types[i] == nilType {
+			cg.errorAt(tuple.Token, ErrTypeMismatch, "tuple element %d is nil, which needs an optional type", i)
+		}
+	}
+	return "(" + strings.Join(types, ", ") + ")"
+}
+
+// generateDestructureStatement assigns the elements of a tuple to variables.
+// Every slot of the tuple is pushed before any is stored, so (a, b) = (b, a)
+// swaps them.
+func (cg *CodeGenerator) generateDestructureStatement(stmt *parser.DestructureStatement) {
+	cg.output.WriteString(fmt.Sprintf("    # %s\n", comment(stmt)))
+	typ, literal := cg.generateValue(stmt.Value, "")
+	elements, ok := tupleType(typ)
+	if !ok {
+		cg.errorAt(stmt.Token, ErrTypeMismatch, "cannot destructure %s, which is not a tuple", typ)
+		return
+	}
+	if len(elements) != len(stmt.Names) {
+		// The type pass has reported it
+		return
+	}
+	if !literal {
+		for i := range cg.flatten("", typ) {
+			cg.output.WriteString(fmt.Sprintf("    push qword ptr [rax + %d]\n", 8*i))
+		}
+	}
+
+	// The last element is on top of the stack
+	for i := len(elements) - 1; i >= 0; i-- {
+		name, element := stmt.Names[i], elements[i]
+		switch {
+		case name == "_":
+			cg.output.WriteString(fmt.Sprintf("    add rsp, %d        # skip element %d\n", 8*cg.slots(element), i))
+		case cg.isAggregate(element):
+			cg.assignVariable(stmt.Token, name, element, true)
+		default:
+			cg.output.WriteString("    pop rax\n")
+			cg.assignVariable(stmt.Token, name, element, false)
+		}
+	}
+}
+
+// generateReturnAggregate returns a tuple, which is copied to the heap so it
+// outlives the function's frame
+func (cg *CodeGenerator) generateReturnAggregate(tok lexer.Token, value parser.Expression) {
+	typ := cg.current.returnType
+	if got := cg.pushValue(value, typ); got != typ {
+		// The type pass has reported it
+		return
+	}
+	slots := cg.flatten("", typ)
+	cg.requireRuntime("alloc")
+	cg.output.WriteString(fmt.Sprintf("    mov rdi, %d\n", 8*len(slots)))
+	cg.output.WriteString("    call alloc\n")
+	for i := len(slots) - 1; i >= 0; i-- {
+		cg.output.WriteString("    pop rcx\n")
+		cg.output.WriteString(fmt.Sprintf("    mov [rax + %d], rcx\n", 8*i))
+	}
+}
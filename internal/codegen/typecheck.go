@@ -0,0 +1,819 @@
+package codegen
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"dreadlang/internal/lexer"
+	"dreadlang/internal/parser"
+)
+
+// Type checking is a pass of its own over every function, run just before
+// the function is generated. It walks the body with scopes of its own, the
+// way generating it will, records the type of every expression in
+// cg.types, and reports the assignments, arguments and returns whose types
+// do not match. It also infers the type arguments of the calls of generic
+// functions, recording the instance each one needs in cg.instanceOf, which
+// the generator reads rather than working them out again. The rest of the
+// type errors, such as an operator applied to the wrong types, concern the
+// code emitted for them and are reported as it is generated; the errors of
+// a function are put back in source order once both have run.
+//
+// A declaration whose type or initializer is wrong still binds its name, so
+// the error is reported once, where it was made, and not again as an
+// undefined variable at every use. A Var whose initializer is wrong keeps
+// its declared type; one whose type cannot be resolved gets poisonType, and
+// the type errors of any statement reading or assigning it are dropped.
+
+// poisonType is the type of a variable whose declared type was an error
+const poisonType = "<error>"
+
+// bindPoisoned declares name with poisonType in scope, whose declared type
+// has been reported
+func bindPoisoned(scope map[string]*variable, stmt *parser.VarStatement) {
+	scope[stmt.Name] = &variable{Type: poisonType, Declared: true, Declaration: stmt.Token}
+}
+
+// isTypeError reports whether code is one of the errors a poisoned variable
+// causes in the statement using it
+func isTypeError(code string) bool {
+	switch code {
+	case ErrTypeMismatch, ErrAssignMismatch, ErrUnknownField, ErrUncheckedOptional:
+		return true
+	}
+	return false
+}
+
+// inSourceOrder sorts the diagnostics of one function by position
+func inSourceOrder(diagnostics []parser.Diagnostic) {
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i], diagnostics[j]
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+}
+
+// silently runs f, a step of the type pass that shares code with the
+// generator, and drops the diagnostics and references it records, which
+// the generator records when it generates the same declaration
+func (cg *CodeGenerator) silently(f func()) {
+	diagnostics, references := len(cg.diagnostics), len(cg.references)
+	f()
+	cg.diagnostics, cg.references = cg.diagnostics[:diagnostics], cg.references[:references]
+}
+
+// callOf returns the call a call statement makes, the same node every time,
+// so the types recorded for it are found again
+func (cg *CodeGenerator) callOf(stmt *parser.CallStatement) *parser.CallExpression {
+	if call, ok := cg.statementCalls[stmt]; ok {
+		return call
+	}
+	call := &parser.CallExpression{Token: stmt.Token, Receiver: stmt.Receiver, Function: stmt.Function, Arguments: stmt.Arguments}
+	cg.statementCalls[stmt] = call
+	return call
+}
+
+// checkFunction type checks the body of fn, which is generated next
+func (cg *CodeGenerator) checkFunction(fn *parser.FunctionStatement) {
+	cg.types = make(map[parser.Expression]string)
+	cg.instanceOf = make(map[*parser.CallExpression]string)
+	cg.current = &functionContext{
+		isEntry:    fn.IsEntry,
+		returnType: fn.ReturnType,
+		scopes:     []map[string]*variable{make(map[string]*variable)},
+		results:    make(map[*parser.CallExpression]*variable),
+	}
+	for _, param := range fn.Parameters {
+		v := cg.declareVariable(param.Name, param.Type)
+		v.Parameter = true
+	}
+	if r := fn.Receiver; r != nil {
+		v := cg.declareVariable(r.Name, r.Type)
+		v.Declared = true
+		v.Parameter = true
+	}
+	cg.checkBlock(fn.Body)
+	cg.current = nil
+	cg.poisoned = false
+}
+
+// checkBlock checks the statements of a block in the current scope
+func (cg *CodeGenerator) checkBlock(block *parser.BlockStatement) {
+	for _, stmt := range block.Statements {
+		cg.poisoned = false
+		switch s := stmt.(type) {
+		case *parser.AssignStatement:
+			cg.checkAssign(s)
+		case *parser.DestructureStatement:
+			cg.checkDestructure(s)
+		case *parser.VarStatement:
+			cg.checkVar(s)
+		case *parser.ConstStatement:
+			cg.silently(func() {
+				cg.defineConstant(s, cg.current.scopes[len(cg.current.scopes)-1])
+			})
+		case *parser.CallStatement:
+			cg.checkCallStatement(s)
+		case *parser.ForStatement:
+			cg.checkFor(s)
+		case *parser.IfStatement:
+			cg.checkIf(s)
+		case *parser.DoWhileStatement:
+			cg.checkScopedBlock(s.Body)
+			cg.checkExpression(s.Condition)
+		case *parser.TryStatement:
+			cg.checkTry(s)
+		case *parser.MatchStatement:
+			cg.checkExpression(s.Value)
+			for _, c := range s.Cases {
+				cg.checkScopedBlock(c.Body)
+			}
+			if s.Default != nil {
+				cg.checkScopedBlock(s.Default)
+			}
+		case *parser.BlockStatement:
+			cg.checkScopedBlock(s)
+		}
+	}
+}
+
+// checkScopedBlock checks a nested block whose variables are local to it
+func (cg *CodeGenerator) checkScopedBlock(block *parser.BlockStatement) {
+	cg.pushScope()
+	cg.checkBlock(block)
+	cg.popScope()
+}
+
+// checkFor checks a loop, whose variables are only visible inside it
+func (cg *CodeGenerator) checkFor(stmt *parser.ForStatement) {
+	cg.pushScope()
+	if init, ok := stmt.Init.(*parser.AssignStatement); ok && (init.Index != nil || init.Field != nil) {
+		cg.checkAssign(init)
+	} else if ok {
+		// The loop variable always gets its own slot
+		typ, _ := cg.checkValue(init.Value, "")
+		cg.allocateVariable(init.Name, typ)
+	}
+	if stmt.Condition != nil {
+		cg.checkExpression(stmt.Condition)
+	}
+	cg.checkScopedBlock(stmt.Body)
+	if post, ok := stmt.Post.(*parser.AssignStatement); ok {
+		cg.checkAssign(post)
+	}
+	cg.popScope()
+}
+
+// checkIf checks the branches of an If chain, narrowing the optionals their
+// conditions compare with nil as generateIfStatement does
+func (cg *CodeGenerator) checkIf(stmt *parser.IfStatement) {
+	narrowed := 0
+	for _, branch := range stmt.Branches {
+		cg.checkExpression(branch.Condition)
+		name, isNil, checked := nilCheck(branch.Condition)
+		if checked && !isNil {
+			cg.narrow(name)
+			cg.checkScopedBlock(branch.Body)
+			cg.popScope()
+		} else {
+			cg.checkScopedBlock(branch.Body)
+		}
+		if checked && isNil {
+			cg.narrow(name)
+			narrowed++
+		}
+	}
+	if stmt.Else != nil {
+		cg.checkScopedBlock(stmt.Else)
+	}
+	for ; narrowed > 0; narrowed-- {
+		cg.popScope()
+	}
+}
+
+// checkTry checks a Try block, and its Catch block with the error's message
+func (cg *CodeGenerator) checkTry(stmt *parser.TryStatement) {
+	cg.checkScopedBlock(stmt.Body)
+	cg.pushScope()
+	if name := stmt.ErrorName; name != nil {
+		v := cg.allocateVariable(name.Value, "String")
+		v.Declared = true
+	}
+	cg.checkBlock(stmt.Catch)
+	cg.popScope()
+}
+
+// checkVar checks the value of a Var against its declared type
+func (cg *CodeGenerator) checkVar(stmt *parser.VarStatement) {
+	scope := cg.current.scopes[len(cg.current.scopes)-1]
+	if _, exists := scope[stmt.Name]; exists {
+		return
+	}
+	var declared string
+	var ok bool
+	cg.silently(func() {
+		declared, ok = cg.resolveType(stmt)
+	})
+	if !ok {
+		bindPoisoned(scope, stmt)
+		return
+	}
+
+	typ := declared
+	if stmt.Value != nil {
+		typ, _ = cg.checkValue(stmt.Value, declared)
+		typ = cg.converted(typ, declared)
+	}
+	// The variable has its declared type even if the value is wrong
+	v := cg.allocateVariable(stmt.Name, declared)
+	v.Declared = true
+	if typ != declared {
+		cg.errorAt(stmt.Token, ErrAssignMismatch, "cannot assign %s to %s variable %s", typ, declared, stmt.Name)
+	}
+}
+
+// checkAssign checks an assignment to a variable, an element or a field
+func (cg *CodeGenerator) checkAssign(stmt *parser.AssignStatement) {
+	switch {
+	case stmt.Index != nil:
+		cg.checkElementAssign(stmt)
+	case stmt.Field != nil:
+		cg.checkFieldAssign(stmt)
+	case stmt.Name == "_":
+		cg.checkValue(stmt.Value, "")
+	default:
+		want := ""
+		if v, exists := cg.lookupVariable(stmt.Name); exists {
+			want = v.Type
+		}
+		typ, _ := cg.checkValue(stmt.Value, want)
+		cg.checkAssignVariable(stmt.Token, stmt.Name, typ)
+	}
+}
+
+// checkAssignVariable checks assigning a value of type typ to the variable
+// name, declaring it with that type on first use like assignVariable
+func (cg *CodeGenerator) checkAssignVariable(tok lexer.Token, name string, typ string) {
+	v, exists := cg.lookupVariable(name)
+	if exists && v.Constant != nil {
+		return
+	} else if exists {
+		typ = cg.converted(typ, v.Type)
+	}
+	switch {
+	case exists && v.Type != typ && (v.Declared || cg.isAggregate(v.Type) || cg.isAggregate(typ)):
+		// Storage of arrays and structs is sized for their type, so only scalars change type
+		cg.errorAt(tok, ErrAssignMismatch, "cannot assign %s to %s variable %s", typ, v.Type, name)
+	case typ == nilType:
+		cg.errorAt(tok, ErrAssignMismatch, "cannot assign nil to %s without an optional type; declare it with Var %s Type?", name, name)
+	case typ == errorType:
+		cg.errorAt(tok, ErrAssignMismatch, "cannot assign an Error to %s without a result type; declare it with Var %s Type!", name, name)
+	default:
+		cg.declareVariable(name, typ)
+	}
+}
+
+// checkElementAssign checks a value stored into an element of an array or
+// a slice: name[index] = value
+func (cg *CodeGenerator) checkElementAssign(stmt *parser.AssignStatement) {
+	typ := cg.checkExpression(stmt.Value)
+	cg.checkExpression(stmt.Index)
+	if v, exists := cg.lookupVariable(stmt.Name); exists && v.Constant != nil {
+		return
+	}
+	target := stmt.Target()
+	container, ok := cg.checkPlace(target)
+	if !ok {
+		return
+	}
+	element, ok := sliceElement(container)
+	if !ok {
+		if element, _, ok = arrayType(container); !ok {
+			return
+		}
+	}
+	if typ = cg.converted(typ, element); typ != element {
+		cg.errorAt(placeToken(target), ErrAssignMismatch, "cannot assign %s to %s element of %s", typ, element, comment(target))
+	}
+}
+
+// checkFieldAssign checks a value stored into a field: name.field = value
+func (cg *CodeGenerator) checkFieldAssign(stmt *parser.AssignStatement) {
+	typ, _ := cg.checkValue(stmt.Value, "")
+	if v, exists := cg.lookupVariable(stmt.Name); exists && v.Constant != nil {
+		return
+	}
+	field, ok := cg.checkPlace(stmt.Field)
+	if !ok {
+		return
+	}
+	if typ = cg.converted(typ, field); typ != field {
+		cg.errorAt(stmt.Field.Token, ErrAssignMismatch, "cannot assign %s to %s field %s", typ, field, comment(stmt.Field))
+	}
+}
+
+// checkDestructure checks assigning the elements of a tuple to variables
+func (cg *CodeGenerator) checkDestructure(stmt *parser.DestructureStatement) {
+	typ, _ := cg.checkValue(stmt.Value, "")
+	elements, ok := tupleType(typ)
+	if !ok {
+		return
+	}
+	if len(elements) != len(stmt.Names) {
+		cg.errorAt(stmt.Token, ErrAssignMismatch, "cannot assign %s to %d variables", typ, len(stmt.Names))
+		return
+	}
+	// The last element is stored first
+	for i := len(elements) - 1; i >= 0; i-- {
+		if stmt.Names[i] != "_" {
+			cg.checkAssignVariable(stmt.Token, stmt.Names[i], elements[i])
+		}
+	}
+}
+
+// checkCallStatement checks a call made for what it does
+func (cg *CodeGenerator) checkCallStatement(stmt *parser.CallStatement) {
+	switch stmt.Function {
+	case "Print":
+		if len(stmt.Arguments) > 0 {
+			cg.checkExpression(stmt.Arguments[0])
+		}
+	case "Return":
+		cg.checkReturn(stmt.Token, stmt.Arguments)
+	default:
+		call := cg.callOf(stmt)
+		if _, ok := cg.checkBuiltinCall(call); !ok {
+			cg.checkCall(call)
+		}
+	}
+}
+
+// checkReturn checks the value returned against the current function's
+// return type
+func (cg *CodeGenerator) checkReturn(tok lexer.Token, args []parser.Expression) {
+	want := cg.current.returnType
+	switch {
+	case cg.current.isEntry:
+		// The exit status; Return('0') gives its digits as text
+		if len(args) > 0 {
+			cg.checkExpression(args[0])
+		}
+	case len(args) > 0 && cg.isAggregate(want):
+		if got := cg.checkPushed(args[0], want); got != want {
+			cg.errorAt(tok, ErrTypeMismatch, "cannot return %s from a function returning %s", got, want)
+		}
+	case len(args) > 0:
+		typ := cg.converted(cg.checkExpression(args[0]), want)
+		if !isOptional(want) && !isResult(want) && !cg.checkUnwrapped(tok, args[0], typ) {
+			// Already reported
+		} else if typ != want && !cg.isUndefinedType(want) {
+			cg.errorAt(tok, ErrTypeMismatch, "cannot return %s from a function returning %s", typ, voidIfNone(want))
+		}
+	case !isResult(want) && voidIfNone(want) != "Void":
+		cg.errorAt(tok, ErrTypeMismatch, "Return without a value in a function returning %s", want)
+	}
+}
+
+// checkCall checks the arguments of a call of a user-defined function or
+// method against its parameters, and returns the type of its result
+func (cg *CodeGenerator) checkCall(call *parser.CallExpression) string {
+	tok, function, args := call.Token, call.Function, call.Arguments
+	if call.Receiver != nil {
+		symbol, ok := cg.checkMethod(call)
+		if !ok {
+			return "Int"
+		}
+		function = symbol
+		args = append([]parser.Expression{call.Receiver}, args...)
+	} else if generic, ok := cg.generics[function]; ok {
+		// The types of the arguments give the type arguments
+		for _, arg := range args {
+			cg.checkExpression(arg)
+		}
+		symbol, ok := cg.instantiate(call, generic)
+		if !ok {
+			return "Int"
+		}
+		cg.instanceOf[call] = symbol
+		function = symbol
+	}
+	callee, ok := cg.functions[function]
+	if !ok {
+		// semant has reported it
+		cg.poisoned = true
+		return "Int"
+	}
+	if callee.Attributes.Has("interrupt") {
+		return "Int"
+	}
+
+	fixed, extra, variadic := args, []parser.Expression(nil), cg.variadicParameter(function)
+	if variadic != nil {
+		first := len(callee.Parameters) - 1
+		if call.Receiver != nil {
+			first++
+		}
+		if len(args) >= first {
+			fixed, extra = args[:first], args[first:]
+		} else {
+			variadic = nil
+		}
+	}
+	for i, arg := range fixed {
+		typ := cg.checkExpression(arg)
+		param := cg.parameter(function, call.Receiver != nil, i)
+		if param != nil {
+			typ = cg.converted(typ, param.Type)
+		}
+		unwrapped := true
+		if param == nil || !isOptional(param.Type) && !isResult(param.Type) {
+			unwrapped = cg.checkUnwrapped(tok, arg, typ)
+		}
+		if cg.isAggregate(typ) && (call.Receiver == nil || i > 0) {
+			cg.errorAt(tok, ErrTypeMismatch, "cannot pass %s to %s", typ, function)
+		} else if param != nil && unwrapped && typ != param.Type {
+			cg.errorAt(tok, ErrTypeMismatch, "cannot pass %s as %s parameter %s of %s", typ, param.Type, param.Name, function)
+		}
+	}
+	if variadic != nil {
+		element, _ := sliceElement(variadic.Type)
+		for _, value := range extra {
+			typ := cg.converted(cg.checkExpression(value), element)
+			if cg.checkUnwrapped(tok, value, typ) && typ != element {
+				cg.errorAt(tok, ErrTypeMismatch, "cannot pass %s as %s to %s", typ, element, function)
+			}
+		}
+	}
+	return callee.ReturnType
+}
+
+// checkMethod returns the symbol of the method a call names on its
+// receiver, like resolveMethod, which reports what is wrong with it
+func (cg *CodeGenerator) checkMethod(call *parser.CallExpression) (string, bool) {
+	typ, ok := cg.checkPlace(call.Receiver)
+	if !ok {
+		return "", false
+	}
+	_, isInterface := cg.interfaces[typ]
+	_, isStruct := cg.structs[typ]
+	_, exists := cg.functions[typ+"."+call.Function]
+	return typ + "." + call.Function, (isInterface || isStruct) && exists
+}
+
+// checkBuiltinCall returns the type of a builtin call, checking the
+// arguments it generates; ok is false for user functions. The builtins
+// report their own errors as they are generated.
+func (cg *CodeGenerator) checkBuiltinCall(call *parser.CallExpression) (typ string, ok bool) {
+	if call.Receiver != nil {
+		return "", false
+	}
+	args := call.Arguments
+	switch call.Function {
+	case "SizeOf", "AlignOf":
+		// The argument is a type
+		return "Int", true
+	case "Append":
+		if len(args) == 2 {
+			cg.checkPlace(args[0])
+			cg.checkExpression(args[1])
+		}
+		return "Void", true
+	case "Syscall":
+		for i := 1; i < len(args); i++ {
+			cg.checkExpression(args[i])
+		}
+		return "Int", true
+	case "Try":
+		if len(args) != 1 {
+			return "Int", true
+		}
+		typ := cg.checkExpression(args[0])
+		if base, ok := resultBase(typ); ok {
+			return base, true
+		}
+		return typ, true
+	}
+
+	// Generating the call evaluates these arguments, when it is given as
+	// many as it takes
+	var generated []parser.Expression
+	switch call.Function {
+	case "Matches":
+		typ = "Int"
+		if len(args) == 2 {
+			generated = args
+		}
+	case "Peek":
+		// The width is a constant
+		typ = "Int"
+		if len(args) == 1 || len(args) == 2 {
+			generated = args[:1]
+		}
+	case "Poke":
+		typ = "Void"
+		if len(args) == 2 || len(args) == 3 {
+			generated = args[:2]
+		}
+	default:
+		switch call.Function {
+		case "Ord", "Len":
+			typ = "Int"
+		case "Chr":
+			typ = "Char"
+		case "Error":
+			typ = errorType
+		case "ParseInt":
+			typ = "Int!"
+		case "Panic":
+			typ = "Void"
+		default:
+			if !isConversion(cg.aliased(call.Function)) {
+				return "", false
+			}
+			typ = cg.aliased(call.Function)
+		}
+		if len(args) == 1 {
+			generated = args
+		}
+	}
+	for _, arg := range generated {
+		cg.checkExpression(arg)
+	}
+	return typ, true
+}
+
+// checkValue returns the type of the value of an assignment or Var, as
+// generateValue does, and whether it is an array, struct or tuple literal
+func (cg *CodeGenerator) checkValue(expr parser.Expression, want string) (typ string, literal bool) {
+	switch e := expr.(type) {
+	case *parser.ArrayLiteral:
+		typ = cg.checkArrayLiteral(e, want)
+	case *parser.StructLiteral:
+		typ = cg.checkStructLiteral(e)
+		if it, ok := cg.interfaces[want]; ok && cg.structs[typ] != nil && cg.implements(typ, it) {
+			cg.types[expr] = want
+			return want, false
+		}
+	case *parser.TupleLiteral:
+		types := make([]string, len(e.Elements))
+		wantElements, _ := tupleType(want)
+		if len(wantElements) != len(e.Elements) {
+			wantElements = make([]string, len(e.Elements))
+		}
+		for i, element := range e.Elements {
+			types[i] = cg.checkPushed(element, wantElements[i])
+		}
+		typ = "(" + strings.Join(types, ", ") + ")"
+	default:
+		return cg.checkExpression(expr), false
+	}
+	cg.types[expr] = typ
+	return typ, true
+}
+
+// checkPushed returns the type of the value pushValue pushes for expr
+func (cg *CodeGenerator) checkPushed(expr parser.Expression, want string) string {
+	typ, literal := cg.checkValue(expr, want)
+	if !literal {
+		typ = cg.converted(typ, want)
+	}
+	return typ
+}
+
+// checkArrayLiteral returns the type of an array literal, which is taken
+// from its elements
+func (cg *CodeGenerator) checkArrayLiteral(array *parser.ArrayLiteral, want string) string {
+	if len(array.Elements) == 0 {
+		return "Int"
+	}
+	element := ""
+	wantElement, _, _ := arrayType(want)
+	for _, e := range array.Elements {
+		if typ := cg.converted(cg.checkExpression(e), wantElement); element == "" && isScalar(typ) {
+			element = typ
+		}
+	}
+	if element == "" {
+		element = "Int"
+	}
+	return fmt.Sprintf("%s[%d]", element, len(array.Elements))
+}
+
+// checkStructLiteral checks the value given for each field of a struct
+// literal against the field's type, and returns the struct's type
+func (cg *CodeGenerator) checkStructLiteral(literal *parser.StructLiteral) string {
+	s, ok := cg.structs[cg.aliased(literal.Name)]
+	if !ok {
+		return "Int"
+	}
+	var values map[string]*parser.FieldValue
+	cg.silently(func() {
+		values, ok = cg.fieldValues(s, literal)
+	})
+	if !ok {
+		return s.Name
+	}
+	for _, f := range s.Fields {
+		value, given := values[f.Name]
+		if !given {
+			continue
+		}
+		if typ := cg.checkPushed(value.Value, f.Type); typ != f.Type {
+			cg.errorAt(value.Token, ErrAssignMismatch, "cannot assign %s to %s field %s of %s", typ, f.Type, f.Name, s.Name)
+		}
+	}
+	return s.Name
+}
+
+// checkPlace returns the type of a variable, a field or the result of a
+// call used in place, as resolvePlace finds it, which reports what is
+// wrong with it
+func (cg *CodeGenerator) checkPlace(expr parser.Expression) (string, bool) {
+	switch e := expr.(type) {
+	case *parser.Identifier:
+		v, exists := cg.lookupVariable(e.Value)
+		if !exists {
+			return "", false
+		}
+		return v.Type, true
+	case *parser.FieldExpression:
+		typ, ok := cg.checkPlace(e.Struct)
+		if !ok {
+			return "", false
+		}
+		s, ok := cg.structs[typ]
+		if !ok {
+			return "", false
+		}
+		f, ok := s.field(e.Field)
+		return f.Type, ok
+	case *parser.CallExpression:
+		typ := cg.checkExpression(e)
+		return typ, typ != "Void"
+	}
+	return "", false
+}
+
+// checkExpression returns the type of expr, which generating it will leave
+// in rax, and records it. Each expression is only checked once: a call used
+// in place is made once, however many times its place is looked at.
+func (cg *CodeGenerator) checkExpression(expr parser.Expression) string {
+	if typ, checked := cg.types[expr]; checked {
+		return typ
+	}
+	typ := cg.expressionType(expr)
+	cg.types[expr] = typ
+	return typ
+}
+
+// expressionType works out the type of expr for checkExpression
+func (cg *CodeGenerator) expressionType(expr parser.Expression) string {
+	switch e := expr.(type) {
+	case *parser.StringLiteral:
+		return "String"
+	case *parser.IntegerLiteral:
+		return "Int"
+	case *parser.FloatLiteral:
+		return "Float"
+	case *parser.CharLiteral:
+		return "Char"
+	case *parser.NilLiteral:
+		return nilType
+	case *parser.Identifier:
+		v, exists := cg.lookupVariable(e.Value)
+		if !exists {
+			// semant has reported it
+			cg.poisoned = true
+			return "Int"
+		}
+		return v.Type
+	case *parser.FieldExpression:
+		if typ, ok := cg.checkPlace(e); ok {
+			return typ
+		}
+	case *parser.IndexExpression:
+		return cg.checkIndexExpression(e)
+	case *parser.SliceExpression:
+		cg.checkPlace(e.Array)
+		for _, bound := range []parser.Expression{e.Start, e.End} {
+			if bound != nil {
+				cg.checkExpression(bound)
+			}
+		}
+		return "String"
+	case *parser.PrefixExpression:
+		return cg.checkPrefixExpression(e)
+	case *parser.InfixExpression:
+		return cg.checkInfixExpression(e)
+	case *parser.CallExpression:
+		if typ, ok := cg.checkBuiltinCall(e); ok {
+			return typ
+		}
+		return cg.checkCall(e)
+	}
+	// Literals that are not values here, and places that are not there,
+	// are reported as they are generated
+	return "Int"
+}
+
+// checkIndexExpression returns the type of an element of an array or a
+// slice, or of a byte of a String
+func (cg *CodeGenerator) checkIndexExpression(expr *parser.IndexExpression) string {
+	typ, ok := cg.checkPlace(expr.Array)
+	if !ok {
+		return "Int"
+	}
+	cg.checkExpression(expr.Index)
+	if element, ok := sliceElement(typ); ok {
+		return element
+	}
+	if element, _, ok := arrayType(typ); ok {
+		return element
+	}
+	return "Int"
+}
+
+// checkPrefixExpression returns the type of a prefix operator's result
+func (cg *CodeGenerator) checkPrefixExpression(expr *parser.PrefixExpression) string {
+	switch typ := cg.checkExpression(expr.Right); {
+	case typ == "Char":
+		return "Int"
+	case typ == "Float" && expr.Operator == "-":
+		return "Float"
+	case typ != "Float" && expr.Operator == "-":
+		return typ
+	}
+	return "Int"
+}
+
+// checkInfixExpression returns the type of an infix operator's result, as
+// generateInfixExpression gives it
+func (cg *CodeGenerator) checkInfixExpression(expr *parser.InfixExpression) string {
+	if expr.Operator == "??" {
+		return cg.checkDefault(expr)
+	}
+	leftType := cg.checkExpression(expr.Left)
+	rightType := cg.checkExpression(expr.Right)
+	_, comparison := setInstructions[expr.Operator]
+
+	switch {
+	case cg.isAggregate(leftType) || cg.isAggregate(rightType) || isSlice(leftType) || isSlice(rightType):
+		return "Int"
+	case isResult(leftType) || isResult(rightType) || isOptional(leftType) || isOptional(rightType):
+		return "Int"
+	case leftType == "String" || rightType == "String":
+		if expr.Operator == "+" && cg.converted(leftType, "String") == "String" && cg.converted(rightType, "String") == "String" {
+			return "String"
+		}
+		return "Int"
+	case leftType == "Float" || rightType == "Float":
+		if leftType != rightType || comparison || expr.Operator == "%" {
+			return "Int"
+		}
+		return "Float"
+	case leftType == "Char" || rightType == "Char":
+		// Chars only compare
+		return "Int"
+	case comparison:
+		return "Int"
+	}
+	return integerResult(leftType, rightType)
+}
+
+// checkDefault returns the type of a ?? b: that of the value a holds
+func (cg *CodeGenerator) checkDefault(expr *parser.InfixExpression) string {
+	typ := cg.checkExpression(expr.Left)
+	base, ok := resultBase(typ)
+	if !ok || typ == errorType {
+		if base, ok = optionalBase(typ); !ok {
+			return typ
+		}
+	}
+	cg.checkExpression(expr.Right)
+	return base
+}
+
+// converted returns the type convert gives a value of type typ where one
+// of type want is expected
+func (cg *CodeGenerator) converted(typ string, want string) string {
+	switch {
+	case typ == "Char" && want == "String":
+		return "String"
+	case typ != want && isInteger(typ) && isInteger(want):
+		return want
+	case typ == nilType && isOptional(want):
+		return want
+	case typ == errorType && isResult(want):
+		return want
+	}
+	if it, ok := cg.interfaces[want]; ok && cg.structs[typ] != nil && cg.implements(typ, it) {
+		return want
+	}
+	if base, ok := optionalBase(want); ok && typ != want && cg.converted(typ, base) == base {
+		return want
+	}
+	if base, ok := resultBase(want); ok && typ != want && base != "Void" && cg.converted(typ, base) == base {
+		return want
+	}
+	return typ
+}
@@ -0,0 +1,86 @@
+package codegen
+
+import (
+	"fmt"
+
+	"dreadlang/internal/lexer"
+)
+
+// Every local variable and parameter lives in stack slots of its function,
+// below rbp: allocateVariable hands out the next 8-byte slots of the frame
+// as each is declared or first assigned, and generatePrologue reserves the
+// frame once the body is generated and its size is known, rounded up so
+// calls keep rsp 16-byte aligned. Loads and stores address a slot as
+// [rbp - Offset], so each call of a recursive function, and each iteration
+// of a loop, reads and writes its own values. A block's variables are
+// looked up in the scope it pushes, and their slots are not reused when it
+// ends. Only file-scope Var globals are addressed by a label, and Const
+// names have no storage at all.
+
+// variable is a local value living in a stack slot of the current function,
+// a global one in the data section, or a Const whose value is folded into
+// every use
+type variable struct {
+	Type      string    // "Int", "String", an array type such as "Int[3]" or a struct name
+	Offset    int       // distance below rbp of the value, or of the first slot of an array or struct
+	Global    string    // label of a global variable, which has no stack slot
+	Declared  bool      // declared with Var, so its type is fixed
+	Constant  *constant // set for Const names, which have no stack slot
+	Unwrapped bool      // an optional checked to hold a value, which is loaded from its cell
+	Parameter bool      // a parameter or receiver of the current function
+
+	Declaration lexer.Token // the name where it was declared or first assigned
+}
+
+// address returns the memory operand holding the variable
+func (v *variable) address() string {
+	if v.Global != "" {
+		return v.Global
+	}
+	return fmt.Sprintf("rbp - %d", v.Offset)
+}
+
+// declareVariable returns the stack slot for name, allocating one in the
+// innermost block on first use
+func (cg *CodeGenerator) declareVariable(name string, typ string) *variable {
+	if v, exists := cg.lookupVariable(name); exists {
+		v.Type = typ
+		return v
+	}
+
+	return cg.allocateVariable(name, typ)
+}
+
+// allocateVariable always gives name fresh stack slots in the innermost
+// block, shadowing any variable of an enclosing one
+func (cg *CodeGenerator) allocateVariable(name string, typ string) *variable {
+	cg.current.frameSize += 8 * cg.slots(typ)
+	v := &variable{Type: typ, Offset: cg.current.frameSize}
+	cg.current.scopes[len(cg.current.scopes)-1][name] = v
+	return v
+}
+
+// lookupVariable finds the innermost visible variable called name, falling
+// back to the file-scope constants and globals
+func (cg *CodeGenerator) lookupVariable(name string) (*variable, bool) {
+	if cg.current != nil {
+		for i := len(cg.current.scopes) - 1; i >= 0; i-- {
+			if v, exists := cg.current.scopes[i][name]; exists {
+				cg.poisoned = cg.poisoned || v.Type == poisonType
+				return v, true
+			}
+		}
+	}
+	v, exists := cg.globals[name]
+	cg.poisoned = cg.poisoned || exists && v.Type == poisonType
+	return v, exists
+}
+
+func (cg *CodeGenerator) pushScope() {
+	cg.current.scopes = append(cg.current.scopes, make(map[string]*variable))
+}
+
+// popScope ends the innermost block; its slots are not reused
+func (cg *CodeGenerator) popScope() {
+	cg.current.scopes = cg.current.scopes[:len(cg.current.scopes)-1]
+}
@@ -0,0 +1,113 @@
+package codegen
+
+import (
+	"path/filepath"
+
+	"dreadlang/internal/lexer"
+	"dreadlang/internal/parser"
+)
+
+// A declaration written after Private may only be used in the file that
+// declares it. The program reaches the code generator as one list of
+// statements, but every token still carries its file, so a use is checked
+// against the declaration wherever a name is resolved: in refer and
+// referFunction, for structs at their literals, and for the names of
+// structs, interfaces and aliases wherever a type is written.
+
+// collectPrivate records the names of the private declarations of program
+func (cg *CodeGenerator) collectPrivate(program *parser.Program) {
+	for _, stmt := range program.Statements {
+		switch s := stmt.(type) {
+		case *parser.FunctionStatement:
+			if s.Private {
+				cg.private[s.NameToken] = true
+			}
+		case *parser.StructStatement:
+			if s.Private {
+				cg.private[s.Token] = true
+				cg.privateTypes[s.Name] = s.Token
+			}
+		case *parser.InterfaceStatement:
+			// Its methods can only be called in its file
+			for _, m := range s.Methods {
+				if s.Private {
+					cg.private[m.Token] = true
+				}
+			}
+			if s.Private {
+				cg.private[s.Token] = true
+				cg.privateTypes[s.Name] = s.Token
+			}
+		case *parser.TypeAliasStatement:
+			if s.Private {
+				cg.private[s.Token] = true
+				cg.privateTypes[s.Name] = s.Token
+			}
+		case *parser.ConstStatement:
+			if s.Private {
+				cg.private[s.Token] = true
+			}
+		case *parser.VarStatement:
+			if s.Private {
+				cg.private[s.Token] = true
+			}
+		}
+	}
+}
+
+// checkVisible reports tok, a use of the kind of thing declared at
+// declaration, when that is private to another file
+func (cg *CodeGenerator) checkVisible(tok lexer.Token, declaration lexer.Token, kind string) {
+	if !cg.private[declaration] || tok.File == declaration.File {
+		return
+	}
+	file := "the main file"
+	if declaration.File != "" {
+		file = filepath.Base(declaration.File)
+	}
+	cg.errorAt(tok, ErrPrivate, "%s %s is private to %s", kind, declaration.Literal, file)
+}
+
+// checkTypeVisible reports the private structs, interfaces and aliases of
+// other files named in typ, a type written at tok
+func (cg *CodeGenerator) checkTypeVisible(tok lexer.Token, typ string) {
+	for i := 0; i < len(typ); {
+		j := i
+		for j < len(typ) && isNameByte(typ[j]) {
+			j++
+		}
+		if j == i {
+			i++
+			continue
+		}
+		if declaration, ok := cg.privateTypes[typ[i:j]]; ok {
+			kind := "struct"
+			if _, isAlias := cg.aliases[typ[i:j]]; isAlias {
+				kind = "type"
+			} else if cg.interfaces[typ[i:j]] != nil {
+				kind = "interface"
+			}
+			cg.checkVisible(tok, declaration, kind)
+		}
+		i = j
+	}
+}
+
+// checkSignatures checks that the receivers, parameters and results of the
+// program's functions only name types visible in their files. It runs
+// before resolveSignatures replaces the aliases they name.
+func (cg *CodeGenerator) checkSignatures(program *parser.Program) {
+	for _, stmt := range program.Statements {
+		fn, ok := stmt.(*parser.FunctionStatement)
+		if !ok {
+			continue
+		}
+		if fn.Receiver != nil {
+			cg.checkTypeVisible(fn.Receiver.Token, fn.Receiver.Type)
+		}
+		for _, param := range fn.Parameters {
+			cg.checkTypeVisible(param.Token, param.Type)
+		}
+		cg.checkTypeVisible(fn.NameToken, fn.ReturnType)
+	}
+}
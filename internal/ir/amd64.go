@@ -0,0 +1,176 @@
+package ir
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// The x86-64 backend gives each virtual register one of the scratch
+// registers while it is live. A virtual register is used once, so it dies at
+// its use, and an instruction can take over the machine register of its
+// first operand: the two-address form add rax, rcx computes %3 = add %1, %2
+// in the register of %1. An operand that is a constant or a variable is used
+// in place, as an immediate or a memory operand: frame slot n is the 8 bytes
+// at rbp - 8n, below the saved frame pointer, and a global is addressed by
+// its label.
+
+// scratch are the machine registers virtual registers are given, in the
+// order they are taken. The code generator keeps nothing in either while it
+// evaluates an expression.
+var scratch = []string{"rax", "rcx"}
+
+// ScratchRegisters is how many machine registers a block can use at once
+var ScratchRegisters = len(scratch)
+
+// lowBytes are the low bytes of the scratch registers, which setcc writes
+var lowBytes = map[string]string{"rax": "al", "rcx": "cl"}
+
+// arithmetic maps the arithmetic operators to their instruction; the low 64
+// bits of a product are the same signed or unsigned
+var arithmetic = map[Op]string{Add: "add", Sub: "sub", Mul: "imul"}
+
+// setInstructions maps the comparisons to the setcc instruction of their
+// signed form
+var setInstructions = map[Op]string{
+	Eq: "sete",
+	Ne: "setne",
+	Lt: "setl",
+	Gt: "setg",
+	Le: "setle",
+	Ge: "setge",
+}
+
+// allocation is the state of writing one block for x86-64
+type allocation struct {
+	assigned map[int]string // the machine register of each live virtual register
+	free     []string       // the scratch registers no virtual register holds
+	out      strings.Builder
+}
+
+// AMD64 returns the x86-64 instructions, in Intel syntax, that leave the
+// value of the block in rax. ok is false when the block needs more registers
+// than the scratch registers, and the caller has to evaluate the expression
+// some other way.
+func (b *Block) AMD64() (assembly string, ok bool) {
+	a := &allocation{assigned: make(map[int]string), free: append([]string(nil), scratch...)}
+	used := b.used()
+	for _, instr := range b.Instrs {
+		if !a.instr(instr) {
+			return "", false
+		}
+		if !used[instr.Dest] {
+			// Nothing reads it, as in a block written by hand
+			a.release(a.assigned[instr.Dest])
+			delete(a.assigned, instr.Dest)
+		}
+	}
+	if b.Result.Kind == Register {
+		if r := a.assigned[b.Result.Reg]; r != "rax" {
+			a.write(fmt.Sprintf("mov rax, %s", r), "")
+		}
+	} else {
+		a.move("rax", b.Result)
+	}
+	return a.out.String(), true
+}
+
+// instr writes one instruction, reporting false when it runs out of
+// registers
+func (a *allocation) instr(i Instr) bool {
+	op, x, y := i.Op, i.A, i.B
+	if op != Move && op != Sub && x.Kind != Register && y.Kind == Register {
+		// Take over the register of the second operand instead
+		x, y = y, x
+		if m, ok := mirrored[op]; ok {
+			op = m
+		}
+	}
+
+	var r string
+	if x.Kind == Register {
+		r = a.assigned[x.Reg]
+		delete(a.assigned, x.Reg)
+	} else {
+		var ok bool
+		if r, ok = a.take(); !ok {
+			return false
+		}
+		a.move(r, x)
+	}
+	a.assigned[i.Dest] = r
+	if op == Move {
+		return true
+	}
+
+	source, note := a.source(y), y.Name
+	switch {
+	case y.Kind == Register:
+		source = a.assigned[y.Reg]
+		delete(a.assigned, y.Reg)
+		defer a.release(source)
+	case y.Kind == Constant && (y.Value < math.MinInt32 || y.Value > math.MaxInt32):
+		// Only mov takes a 64-bit immediate
+		temp, ok := a.take()
+		if !ok {
+			return false
+		}
+		a.move(temp, y)
+		source = temp
+		defer a.release(temp)
+	}
+
+	if instruction, ok := arithmetic[op]; ok {
+		a.write(fmt.Sprintf("%s %s, %s", instruction, r, source), note)
+		return true
+	}
+	a.write(fmt.Sprintf("cmp %s, %s", r, source), note)
+	a.write(fmt.Sprintf("%s %s", setInstructions[op], lowBytes[r]), "")
+	a.write(fmt.Sprintf("movzx %s, %s", r, lowBytes[r]), "")
+	return true
+}
+
+// move loads an operand that is not a virtual register into r
+func (a *allocation) move(r string, o Operand) {
+	note := ""
+	if o.Kind == Memory {
+		note = "load " + o.Name
+	}
+	a.write(fmt.Sprintf("mov %s, %s", r, a.source(o)), note)
+}
+
+// source renders an operand that is not a virtual register as an
+// instruction operand
+func (a *allocation) source(o Operand) string {
+	switch {
+	case o.Kind == Memory && o.Global != "":
+		return fmt.Sprintf("[%s]", o.Global)
+	case o.Kind == Memory:
+		return fmt.Sprintf("[rbp - %d]", 8*o.Slot)
+	}
+	return fmt.Sprint(o.Value)
+}
+
+// take returns a free scratch register, rax first
+func (a *allocation) take() (string, bool) {
+	if len(a.free) == 0 {
+		return "", false
+	}
+	r := a.free[0]
+	a.free = a.free[1:]
+	return r, true
+}
+
+// release frees r for another virtual register
+func (a *allocation) release(r string) {
+	a.free = append(a.free, r)
+}
+
+// write adds one instruction with an optional comment
+func (a *allocation) write(instruction string, note string) {
+	if note != "" {
+		a.out.WriteString(fmt.Sprintf("    %s    # %s\n", instruction, note))
+		return
+	}
+	a.out.WriteString(fmt.Sprintf("    %s\n", instruction))
+}
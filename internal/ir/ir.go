@@ -0,0 +1,276 @@
+// Package ir is the intermediate representation the code generator lowers
+// expressions to before writing assembly: three-address code, in which each
+// instruction applies one operator to at most two operands and defines a new
+// virtual register with the result. Operands are virtual registers defined
+// earlier, integer constants, or the memory of a variable, so a variable is
+// read where it is used rather than loaded by an instruction of its own. A
+// local variable is named by its 8-byte slot in the frame of its function,
+// counted from 1, and a global by its label; only a backend knows where the
+// slots are. Each virtual register is defined once and, since expressions are
+// trees, used once.
+//
+// A Block is the code of one expression, and a Function the blocks lowered
+// in one function. Backends turn a block into machine code; AMD64 (amd64.go)
+// gives the virtual registers the scratch registers of the code generator.
+// Programs have a textual form, which String writes and Parse (parse.go)
+// reads back:
+//
+//	function main
+//	block 6:13
+//	    %1 = mul y[slot 2], 2
+//	    %2 = sub x[slot 1], %1
+//	    result %2
+//
+// Each block is labeled with the position of the operator at the root of
+// the expression it computes.
+package ir
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Op is the operator of an instruction
+type Op int
+
+const (
+	Move Op = iota // the first operand
+	Add
+	Sub
+	Mul
+	Eq // comparisons give 1 when true, 0 when false
+	Ne
+	Lt
+	Gt
+	Le
+	Ge
+)
+
+var opNames = [...]string{
+	Move: "move",
+	Add:  "add",
+	Sub:  "sub",
+	Mul:  "mul",
+	Eq:   "eq",
+	Ne:   "ne",
+	Lt:   "lt",
+	Gt:   "gt",
+	Le:   "le",
+	Ge:   "ge",
+}
+
+func (op Op) String() string {
+	return opNames[op]
+}
+
+// Operators maps the Dread operators the IR covers to their Op
+var Operators = map[string]Op{
+	"+":  Add,
+	"-":  Sub,
+	"*":  Mul,
+	"==": Eq,
+	"!=": Ne,
+	"<":  Lt,
+	">":  Gt,
+	"<=": Le,
+	">=": Ge,
+}
+
+// mirrored is the comparison that gives the same result with its operands
+// swapped
+var mirrored = map[Op]Op{Eq: Eq, Ne: Ne, Lt: Gt, Gt: Lt, Le: Ge, Ge: Le}
+
+// Kind is what an operand is
+type Kind int
+
+const (
+	Register Kind = iota // a virtual register
+	Constant             // an integer known at compile time
+	Memory               // the slot of a local variable or the label of a global
+)
+
+// Operand is a value an instruction reads
+type Operand struct {
+	Kind   Kind
+	Reg    int    // Register: its number
+	Value  int64  // Constant
+	Slot   int    // Memory: the frame slot of a local variable, from 1
+	Global string // Memory: the label of a global variable, which has no slot
+	Name   string // Memory: the variable, for reading the code
+}
+
+// Int returns the constant operand value
+func Int(value int64) Operand {
+	return Operand{Kind: Constant, Value: value}
+}
+
+// Slot returns the operand reading the local variable name in frame slot
+// slot
+func Slot(name string, slot int) Operand {
+	return Operand{Kind: Memory, Name: name, Slot: slot}
+}
+
+// Global returns the operand reading the global variable name at label
+func Global(name string, label string) Operand {
+	return Operand{Kind: Memory, Name: name, Global: label}
+}
+
+func (o Operand) String() string {
+	switch o.Kind {
+	case Register:
+		return fmt.Sprintf("%%%d", o.Reg)
+	case Constant:
+		return fmt.Sprint(o.Value)
+	}
+	if o.Global != "" {
+		return fmt.Sprintf("%s[%s]", o.Name, o.Global)
+	}
+	return fmt.Sprintf("%s[slot %d]", o.Name, o.Slot)
+}
+
+// Instr is one instruction: Dest = Op A, B
+type Instr struct {
+	Op   Op
+	Dest int // the virtual register it defines
+	A, B Operand
+}
+
+func (i Instr) String() string {
+	if i.Op == Move {
+		return fmt.Sprintf("%%%d = %s %s", i.Dest, i.Op, i.A)
+	}
+	return fmt.Sprintf("%%%d = %s %s, %s", i.Dest, i.Op, i.A, i.B)
+}
+
+// operands returns the operands the instruction reads
+func (i Instr) operands() []Operand {
+	if i.Op == Move {
+		return []Operand{i.A}
+	}
+	return []Operand{i.A, i.B}
+}
+
+// Block is the straight-line code of one expression, whose value is Result
+type Block struct {
+	Label  string // the line:column of the operator at the root of the expression
+	Instrs []Instr
+	Result Operand
+}
+
+// Apply appends the instruction applying op to x and y and returns the
+// virtual register holding its result
+func (b *Block) Apply(op Op, x, y Operand) Operand {
+	dest := Operand{Kind: Register, Reg: 1}
+	for _, instr := range b.Instrs {
+		if instr.Dest >= dest.Reg {
+			dest.Reg = instr.Dest + 1
+		}
+	}
+	b.Instrs = append(b.Instrs, Instr{Op: op, Dest: dest.Reg, A: x, B: y})
+	return dest
+}
+
+// Clone returns a copy of b that passes can change without changing b
+func (b *Block) Clone() *Block {
+	clone := *b
+	clone.Instrs = append([]Instr(nil), b.Instrs...)
+	return &clone
+}
+
+// Verify reports the first way in which b is not well formed: a virtual
+// register defined twice, or used before it is defined or a second time
+func (b *Block) Verify() error {
+	defined := make(map[int]bool)
+	used := make(map[int]bool)
+	use := func(o Operand) error {
+		switch {
+		case o.Kind != Register:
+			return nil
+		case !defined[o.Reg]:
+			return fmt.Errorf("%s is used before it is defined", o)
+		case used[o.Reg]:
+			return fmt.Errorf("%s is used twice", o)
+		}
+		used[o.Reg] = true
+		return nil
+	}
+	for _, instr := range b.Instrs {
+		if err := use(instr.A); err != nil {
+			return err
+		}
+		if instr.Op != Move {
+			if err := use(instr.B); err != nil {
+				return err
+			}
+		}
+		if defined[instr.Dest] {
+			return fmt.Errorf("%%%d is defined twice", instr.Dest)
+		}
+		defined[instr.Dest] = true
+	}
+	return use(b.Result)
+}
+
+// used returns the virtual registers an instruction or the result reads
+func (b *Block) used() map[int]bool {
+	used := make(map[int]bool)
+	mark := func(o Operand) {
+		if o.Kind == Register {
+			used[o.Reg] = true
+		}
+	}
+	for _, instr := range b.Instrs {
+		mark(instr.A)
+		if instr.Op != Move {
+			mark(instr.B)
+		}
+	}
+	mark(b.Result)
+	return used
+}
+
+// String renders the block in the textual form of the IR
+func (b *Block) String() string {
+	var out strings.Builder
+	if b.Label == "" {
+		out.WriteString("block\n")
+	} else {
+		out.WriteString(fmt.Sprintf("block %s\n", b.Label))
+	}
+	for _, instr := range b.Instrs {
+		out.WriteString(fmt.Sprintf("    %s\n", instr))
+	}
+	out.WriteString(fmt.Sprintf("    result %s\n", b.Result))
+	return out.String()
+}
+
+// Function is the blocks lowered in one function, in the order of the
+// expressions in its body
+type Function struct {
+	Name   string
+	Blocks []*Block
+}
+
+func (f *Function) String() string {
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("function %s\n", f.Name))
+	for _, b := range f.Blocks {
+		out.WriteString(b.String())
+	}
+	return out.String()
+}
+
+// Program is the functions of a program that have lowered blocks
+type Program struct {
+	Functions []*Function
+}
+
+// String renders the program in the textual form of the IR, with a blank
+// line between functions
+func (p *Program) String() string {
+	texts := make([]string, len(p.Functions))
+	for i, f := range p.Functions {
+		texts[i] = f.String()
+	}
+	return strings.Join(texts, "\n")
+}
@@ -0,0 +1,207 @@
+package ir
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIRBlock(t *testing.T) {
+	// 2 - x * y + n, with the constant on the left of the non-commutative sub
+	var block Block
+	product := block.Apply(Mul, Slot("x", 1), Slot("y", 2))
+	difference := block.Apply(Sub, Int(2), product)
+	block.Result = block.Apply(Add, difference, Global("n", "global_n"))
+
+	if got, want := block.String(), "block\n    %1 = mul x[slot 1], y[slot 2]\n    %2 = sub 2, %1\n    %3 = add %2, n[global_n]\n    result %3\n"; got != want {
+		t.Errorf("block renders as\n%s\nwant\n%s", got, want)
+	}
+	assembly, ok := block.AMD64()
+	if !ok {
+		t.Fatal("two registers were not enough")
+	}
+	want := `    mov rax, [rbp - 8]    # load x
+    imul rax, [rbp - 16]    # y
+    mov rcx, 2
+    sub rcx, rax
+    add rcx, [global_n]    # n
+    mov rax, rcx
+`
+	if assembly != want {
+		t.Errorf("assembly is\n%s\nwant\n%s", assembly, want)
+	}
+}
+
+func TestIRParse(t *testing.T) {
+	text := `function main
+block 4:13
+    %1 = mul y[slot 2], -3
+    %2 = lt x[slot 1], %1
+    result %2
+
+function Point.Length
+block 9:20
+    %1 = move 5000000000
+    %2 = add %1, count[global_count]
+    result %2
+`
+	program, err := Parse(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := program.String(); got != text {
+		t.Errorf("the program reads back as\n%s\nwant\n%s", got, text)
+	}
+	if b := program.Functions[0].Blocks[0]; b.Instrs[0].B != Int(-3) || b.Instrs[1].A != Slot("x", 1) || program.Functions[1].Blocks[0].Instrs[1].B != Global("count", "global_count") {
+		t.Errorf("operands read as %v and %v", b.Instrs[0].B, b.Instrs[1].A)
+	}
+
+	for _, tt := range []struct {
+		text string
+		want string
+	}{
+		{"block\n    result 1\n", "line 1: block outside a function"},
+		{"function f\nblock 1:1\n    %1 = add 1, 2\n", "block 1:1 has no result"},
+		{"function f\nblock\n    %1 = add %2, 1\n    result %1\n", "line 4: %2 is used before it is defined"},
+		{"function f\nblock\n    %1 = add 1, 2\n    %2 = mul %1, %1\n    result %2\n", "line 5: %1 is used twice"},
+		{"function f\nblock\n    %1 = shl 1, 2\n", "line 3: unknown operator \"shl\""},
+		{"function f\nblock\n    %1 = add 1\n", "line 3: add takes 2 operands, got 1"},
+		{"function f\nblock\n    %1 = add x[slot 0], 1\n", "line 3: bad frame slot \"x[slot 0]\""},
+	} {
+		if _, err := Parse(tt.text); err == nil || err.Error() != tt.want {
+			t.Errorf("Parse(%q) = %v, want %s", tt.text, err, tt.want)
+		}
+	}
+}
+
+func TestIRPasses(t *testing.T) {
+	for _, tt := range []struct {
+		passes string
+		in     string
+		want   string
+	}{
+		{"constfold", `
+			%1 = mul 6, 7
+			%2 = sub %1, 2
+			%3 = lt %2, x[slot 1]
+			result %3`, `
+			%3 = lt 40, x[slot 1]
+			result %3`},
+		{"constfold", `
+			%1 = mul 9223372036854775807, 2
+			%2 = ge %1, -2
+			result %2`, `
+			result 1`},
+		{"simplify", `
+			%1 = add x[slot 1], 0
+			%2 = mul 1, %1
+			%3 = mul y[slot 2], 0
+			%4 = sub %2, %3
+			result %4`, `
+			%1 = move x[slot 1]
+			%2 = move %1
+			%3 = move 0
+			%4 = sub %2, %3
+			result %4`},
+		{"simplify", `
+			%1 = add x[slot 1], 1
+			%2 = mul %1, y[slot 2]
+			%3 = mul 0, %2
+			%4 = add %3, z[slot 3]
+			result %4`, `
+			%3 = move 0
+			%4 = add %3, z[slot 3]
+			result %4`},
+	} {
+		program, err := Parse("function f\nblock\n" + tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pm, err := NewPassManager(0, tt.passes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := pm.RunProgram(program); err != nil {
+			t.Fatal(err)
+		}
+		want, err := Parse("function f\nblock\n" + tt.want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if program.String() != want.String() {
+			t.Errorf("--passes=%s leaves\n%s\nwant\n%s", tt.passes, program, want)
+		}
+		if _, ok := program.Functions[0].Blocks[0].AMD64(); !ok {
+			t.Errorf("--passes=%s leaves a block the backend cannot generate", tt.passes)
+		}
+	}
+}
+
+func TestPassManager(t *testing.T) {
+	for _, tt := range []struct {
+		level int
+		spec  string
+		want  string
+	}{
+		{0, "", "verify"},
+		{1, "", "constfold,simplify,verify"},
+		{0, "simplify, constfold", "constfold,simplify,verify"},
+		{1, "-simplify,-verify", "constfold"},
+	} {
+		pm, err := NewPassManager(tt.level, tt.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(pm.Enabled(), ","); got != tt.want {
+			t.Errorf("-O%d --passes=%q runs %s, want %s", tt.level, tt.spec, got, tt.want)
+		}
+	}
+
+	_, err := NewPassManager(1, "constfold,-inline")
+	if want := "unknown pass inline: the passes are constfold, simplify, verify"; err == nil || err.Error() != want {
+		t.Errorf("an unknown pass gives %v, want %s", err, want)
+	}
+	pm, _ := NewPassManager(1, "")
+	if err := pm.PrintAfter("cse", &strings.Builder{}); err == nil {
+		t.Error("--print-after accepts an unknown pass")
+	}
+
+	malformed := &Block{Label: "2:7", Result: Operand{Kind: Register, Reg: 3}}
+	want := "block 2:7 is malformed: %3 is used before it is defined"
+	if err := pm.Run(malformed); err == nil || err.Error() != want {
+		t.Errorf("verify gives %v, want %s", err, want)
+	}
+}
+
+func TestPrintAfter(t *testing.T) {
+	program, err := Parse(`function main
+block 3:11
+    %1 = add 2, 3
+    %2 = mul x[slot 1], %1
+    %3 = mul %2, 1
+    result %3
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm, _ := NewPassManager(1, "")
+	var trace strings.Builder
+	if err := pm.PrintAfter("constfold", &trace); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.RunProgram(program); err != nil {
+		t.Fatal(err)
+	}
+	want := `# IR after constfold
+function main
+block 3:11
+    %2 = mul x[slot 1], 5
+    %3 = mul %2, 1
+    result %3
+`
+	if trace.String() != want {
+		t.Errorf("--print-after=constfold wrote\n%s\nwant\n%s", trace.String(), want)
+	}
+	if got := program.String(); !strings.HasSuffix(got, "block 3:11\n    %2 = mul x[slot 1], 5\n    %3 = move %2\n    result %3\n") {
+		t.Errorf("the passes leave\n%s", got)
+	}
+}
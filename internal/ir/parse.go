@@ -0,0 +1,179 @@
+package ir
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Parse reads a program in the textual form String writes, so a test can
+// write the IR a pass starts from and compare what it leaves with the text
+// it expects. Indentation is free, blank lines are skipped, and a # starts
+// a comment that runs to the end of the line. Every block is verified.
+func Parse(text string) (*Program, error) {
+	p := &Program{}
+	var function *Function
+	var block *Block
+	done := false // the block has its result
+	for i, line := range strings.Split(text, "\n") {
+		if comment := strings.Index(line, "#"); comment >= 0 {
+			line = line[:comment]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		fail := func(format string, args ...interface{}) error {
+			return fmt.Errorf("line %d: %s", i+1, fmt.Sprintf(format, args...))
+		}
+
+		keyword, rest, _ := strings.Cut(line, " ")
+		rest = strings.TrimSpace(rest)
+		if block != nil && !done && (keyword == "function" || keyword == "block") {
+			return nil, fail("block %s has no result", block.Label)
+		}
+		switch {
+		case keyword == "function":
+			if rest == "" {
+				return nil, fail("function without a name")
+			}
+			function = &Function{Name: rest}
+			p.Functions = append(p.Functions, function)
+			block = nil
+		case keyword == "block":
+			if function == nil {
+				return nil, fail("block outside a function")
+			}
+			block = &Block{Label: rest}
+			function.Blocks = append(function.Blocks, block)
+			done = false
+		case block == nil || done:
+			return nil, fail("%s outside a block", keyword)
+		case keyword == "result":
+			result, err := parseOperand(rest)
+			if err != nil {
+				return nil, fail("%v", err)
+			}
+			block.Result = result
+			if err := block.Verify(); err != nil {
+				return nil, fail("%v", err)
+			}
+			done = true
+		default:
+			instr, err := parseInstr(line)
+			if err != nil {
+				return nil, fail("%v", err)
+			}
+			block.Instrs = append(block.Instrs, instr)
+		}
+	}
+	if block != nil && !done {
+		return nil, fmt.Errorf("block %s has no result", block.Label)
+	}
+	return p, nil
+}
+
+// parseInstr reads one instruction: %3 = add %1, x[slot 1]
+func parseInstr(line string) (Instr, error) {
+	dest, rest, ok := strings.Cut(line, "=")
+	if !ok {
+		return Instr{}, fmt.Errorf("expected an instruction, got %q", line)
+	}
+	d, err := parseOperand(strings.TrimSpace(dest))
+	if err != nil || d.Kind != Register {
+		return Instr{}, fmt.Errorf("an instruction must define a virtual register, got %q", strings.TrimSpace(dest))
+	}
+	name, operands, _ := strings.Cut(strings.TrimSpace(rest), " ")
+	op, ok := lookupOp(name)
+	if !ok {
+		return Instr{}, fmt.Errorf("unknown operator %q", name)
+	}
+	instr := Instr{Op: op, Dest: d.Reg}
+
+	var texts []string
+	for _, text := range splitOperands(operands) {
+		texts = append(texts, strings.TrimSpace(text))
+	}
+	want := 2
+	if op == Move {
+		want = 1
+	}
+	if len(texts) != want {
+		return Instr{}, fmt.Errorf("%s takes %d operands, got %d", op, want, len(texts))
+	}
+	if instr.A, err = parseOperand(texts[0]); err != nil {
+		return Instr{}, err
+	}
+	if want == 2 {
+		if instr.B, err = parseOperand(texts[1]); err != nil {
+			return Instr{}, err
+		}
+	}
+	return instr, nil
+}
+
+// splitOperands splits the operands of an instruction at the commas outside
+// the brackets of a memory operand
+func splitOperands(text string) []string {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	var operands []string
+	depth, start := 0, 0
+	for i, c := range text {
+		switch c {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				operands = append(operands, text[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(operands, text[start:])
+}
+
+// parseOperand reads %2, 42, x[slot 1] or the global g[counter]
+func parseOperand(text string) (Operand, error) {
+	switch {
+	case strings.HasPrefix(text, "%"):
+		n, err := strconv.Atoi(text[1:])
+		if err != nil || n < 1 {
+			return Operand{}, fmt.Errorf("bad virtual register %q", text)
+		}
+		return Operand{Kind: Register, Reg: n}, nil
+	case strings.HasSuffix(text, "]"):
+		open := strings.Index(text, "[")
+		if open <= 0 {
+			return Operand{}, fmt.Errorf("a memory operand needs the variable's name before its slot, got %q", text)
+		}
+		name, inside := text[:open], text[open+1:len(text)-1]
+		number, isSlot := strings.CutPrefix(inside, "slot ")
+		if !isSlot {
+			return Global(name, inside), nil
+		}
+		slot, err := strconv.Atoi(strings.TrimSpace(number))
+		if err != nil || slot < 1 {
+			return Operand{}, fmt.Errorf("bad frame slot %q", text)
+		}
+		return Slot(name, slot), nil
+	}
+	value, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return Operand{}, fmt.Errorf("bad operand %q", text)
+	}
+	return Int(value), nil
+}
+
+// lookupOp finds the operator String names name
+func lookupOp(name string) (Op, bool) {
+	for op, n := range opNames {
+		if n == name {
+			return Op(op), true
+		}
+	}
+	return 0, false
+}
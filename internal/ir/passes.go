@@ -0,0 +1,264 @@
+package ir
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Passes improve or check a block in place. The pass manager runs those it
+// is told to in the order they are registered in passes, whatever order
+// --passes names them in. Each pass removes the instructions it leaves
+// unused and leaves a block the backend can generate on its own, so any
+// selection of them is correct. A block is one expression tree, whose every
+// virtual register is used once, so an instruction a pass stops reading is
+// dead, and so is everything that only it read.
+
+// Pass is a transformation or an analysis of a block. An error means the
+// block is not well formed, which is a bug in an earlier pass.
+type Pass struct {
+	Name  string
+	About string
+	Level int // the lowest -O level that runs it unless told otherwise
+	Run   func(b *Block) error
+}
+
+// passes are the registered passes, in the order they run
+var passes = []Pass{
+	{"constfold", "compute instructions whose operands are constants", 1, constFold},
+	{"simplify", "replace x + 0, x - 0, x * 1 and x * 0 by what they give", 1, simplify},
+	{"verify", "check that every virtual register is defined once, before its one use", 0, verify},
+}
+
+// Registered returns the registered passes, in the order they run
+func Registered() []Pass {
+	return passes
+}
+
+// PassManager runs a selection of the passes
+type PassManager struct {
+	enabled    map[string]bool
+	printAfter string
+	trace      io.Writer
+}
+
+// NewPassManager returns the pass manager running the passes of
+// optimization level, changed by spec: a comma-separated list of pass
+// names, each to run as well or, after a -, not to run
+func NewPassManager(level int, spec string) (*PassManager, error) {
+	pm := &PassManager{enabled: make(map[string]bool)}
+	for _, p := range passes {
+		pm.enabled[p.Name] = level >= p.Level
+	}
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		enable := !strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(name, "-")
+		if _, known := pm.enabled[name]; !known {
+			return nil, unknownPass(name)
+		}
+		pm.enabled[name] = enable
+	}
+	return pm, nil
+}
+
+// PrintAfter makes RunProgram write the program to w after the pass called
+// name has run on it, whether or not the pass is enabled
+func (pm *PassManager) PrintAfter(name string, w io.Writer) error {
+	if _, known := pm.enabled[name]; !known {
+		return unknownPass(name)
+	}
+	pm.printAfter, pm.trace = name, w
+	return nil
+}
+
+// Enabled returns the names of the passes pm runs, in order
+func (pm *PassManager) Enabled() []string {
+	var names []string
+	for _, p := range passes {
+		if pm.enabled[p.Name] {
+			names = append(names, p.Name)
+		}
+	}
+	return names
+}
+
+// Run runs the enabled passes on b, stopping at the first that fails
+func (pm *PassManager) Run(b *Block) error {
+	for _, p := range passes {
+		if pm.enabled[p.Name] {
+			if err := p.Run(b); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RunProgram runs the enabled passes on every block of prog, one pass
+// over the whole program at a time, printing it after the pass PrintAfter
+// names. It stops at the first pass that fails.
+func (pm *PassManager) RunProgram(prog *Program) error {
+	for _, p := range passes {
+		if pm.enabled[p.Name] {
+			for _, f := range prog.Functions {
+				for _, b := range f.Blocks {
+					if err := p.Run(b); err != nil {
+						return fmt.Errorf("function %s: %v", f.Name, err)
+					}
+				}
+			}
+		}
+		if p.Name == pm.printAfter {
+			fmt.Fprintf(pm.trace, "# IR after %s\n%s", p.Name, prog)
+		}
+	}
+	return nil
+}
+
+func unknownPass(name string) error {
+	names := make([]string, len(passes))
+	for i, p := range passes {
+		names[i] = p.Name
+	}
+	return fmt.Errorf("unknown pass %s: the passes are %s", name, strings.Join(names, ", "))
+}
+
+// constFold replaces the uses of an instruction whose operands are
+// constants by the value it computes, which wraps like the machine's, and
+// removes the instruction
+func constFold(b *Block) error {
+	values := make(map[int]Operand)
+	substitute := func(o Operand) Operand {
+		if value, ok := values[o.Reg]; ok && o.Kind == Register {
+			return value
+		}
+		return o
+	}
+	for i := range b.Instrs {
+		in := &b.Instrs[i]
+		in.A = substitute(in.A)
+		if in.Op != Move {
+			in.B = substitute(in.B)
+		}
+		if value, ok := fold(*in); ok {
+			values[in.Dest] = Int(value)
+		}
+	}
+	b.Result = substitute(b.Result)
+	b.remove(func(in Instr) bool {
+		_, folded := values[in.Dest]
+		return folded
+	})
+	return nil
+}
+
+// fold computes an instruction whose operands are constants
+func fold(in Instr) (int64, bool) {
+	if in.A.Kind != Constant || in.Op != Move && in.B.Kind != Constant {
+		return 0, false
+	}
+	a, b := in.A.Value, in.B.Value
+	switch in.Op {
+	case Move:
+		return a, true
+	case Add:
+		return a + b, true
+	case Sub:
+		return a - b, true
+	case Mul:
+		return a * b, true
+	case Eq:
+		return boolInt(a == b), true
+	case Ne:
+		return boolInt(a != b), true
+	case Lt:
+		return boolInt(a < b), true
+	case Gt:
+		return boolInt(a > b), true
+	case Le:
+		return boolInt(a <= b), true
+	case Ge:
+		return boolInt(a >= b), true
+	}
+	return 0, false
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// simplify turns an instruction that adds or subtracts 0 or multiplies by
+// 1 into a move of its other operand, and one multiplying by 0 into a move
+// of 0, removing the instructions computing the operand that multiplication
+// no longer reads. A move of a virtual register costs no instruction: the
+// backend gives the result the same machine register. Reading a variable
+// has no effect, so nothing is lost by not reading it.
+func simplify(b *Block) error {
+	dead := make(map[int]bool)
+	for i, in := range b.Instrs {
+		operand, ok := identity(in)
+		if !ok {
+			continue
+		}
+		for _, o := range in.operands() {
+			if o.Kind == Register && o != operand {
+				dead[o.Reg] = true
+			}
+		}
+		b.Instrs[i] = Instr{Op: Move, Dest: in.Dest, A: operand}
+	}
+	// Walking back, the operands of a dead instruction die with it
+	for i := len(b.Instrs) - 1; i >= 0; i-- {
+		if in := b.Instrs[i]; dead[in.Dest] {
+			for _, o := range in.operands() {
+				if o.Kind == Register {
+					dead[o.Reg] = true
+				}
+			}
+		}
+	}
+	b.remove(func(in Instr) bool { return dead[in.Dest] })
+	return nil
+}
+
+// identity returns the operand an instruction always gives, if it does
+func identity(in Instr) (Operand, bool) {
+	is := func(o Operand, value int64) bool {
+		return o.Kind == Constant && o.Value == value
+	}
+	switch {
+	case in.Op == Add && is(in.B, 0), in.Op == Sub && is(in.B, 0), in.Op == Mul && is(in.B, 1):
+		return in.A, true
+	case in.Op == Add && is(in.A, 0), in.Op == Mul && is(in.A, 1):
+		return in.B, true
+	case in.Op == Mul && (is(in.A, 0) || is(in.B, 0)):
+		return Int(0), true
+	}
+	return Operand{}, false
+}
+
+// verify reports a block that is not well formed, which a pass made so
+func verify(b *Block) error {
+	if err := b.Verify(); err != nil {
+		return fmt.Errorf("block %s is malformed: %v", b.Label, err)
+	}
+	return nil
+}
+
+// remove deletes the instructions dead reports
+func (b *Block) remove(dead func(in Instr) bool) {
+	kept := b.Instrs[:0]
+	for _, in := range b.Instrs {
+		if !dead(in) {
+			kept = append(kept, in)
+		}
+	}
+	b.Instrs = kept
+}
@@ -1,5 +1,10 @@
 package lexer
 
+import (
+	"fmt"
+	"strings"
+)
+
 type TokenType int
 
 const (
@@ -9,43 +14,123 @@ const (
 
 	// Identifiers and literals
 	IDENT  // variable names
-	STRING // 'hello world'
+	STRING // 'hello world' or "hello world"
+	CHAR   // 'a'
 	INT    // 123
+	FLOAT  // 3.14
+	NIL    // nil, the value of an optional that holds none
 
 	// Keywords
 	ENTRY       // Entry
 	FUNCTION    // Function
 	PRINT       // Print
 	RETURN      // Return
-	INT_TYPE    // Int
+	INT_TYPE    // Int, or a sized integer type such as Int8 or UInt32
+	FLOAT_TYPE  // Float
+	CHAR_TYPE   // Char
 	STRING_TYPE // String
 	VOID_TYPE   // Void
+	FOR         // For
+	MATCH       // Match
+	CASE        // Case
+	DEFAULT     // Default
+	VAR         // Var
+	CONST       // Const
+	IF          // If
+	ELSE        // Else
+	DO          // Do
+	WHILE       // While
+	BREAK       // Break
+	CONTINUE    // Continue
+	STRUCT      // Struct
+	ARRAY       // Array
+	MODULE      // Module
+	IMPORT      // Import
+	PUBLIC      // Public
+	PRIVATE     // Private
+	INTERFACE   // Interface
+	TRY         // Try
+	CATCH       // Catch
+	TYPE        // Type
 
 	// Delimiters
-	LPAREN // (
-	RPAREN // )
-	LBRACE // {
-	RBRACE // }
-	COMMA  // ,
+	LPAREN    // (
+	RPAREN    // )
+	LBRACE    // {
+	RBRACE    // }
+	LBRACKET  // [
+	RBRACKET  // ]
+	COMMA     // ,
+	SEMICOLON // ;
+	AT        // @
+	HASH      // # starting a pragma
+	COLON     // :
+	DOT       // .
+	ELLIPSIS  // ... after a parameter's type, making it variadic
+	QUESTION  // ? after a type, making it optional
 
 	// Operators
-	ASSIGN // =
-	MINUS  // -
-	PLUS   // +
+	ASSIGN     // =
+	MINUS      // -
+	PLUS       // +
+	ASTERISK   // *
+	SLASH      // /
+	PERCENT    // %
+	BANG       // !
+	LT         // <
+	GT         // >
+	LT_EQ      // <=
+	GT_EQ      // >=
+	EQ         // ==
+	NOT_EQ     // !=
+	DEFAULT_OR // ??
 
 	// Comments (we'll skip these in parsing)
 	COMMENT
 )
 
 var keywords = map[string]TokenType{
-	"START":    ENTRY,
-	"Entry":    ENTRY,
-	"Function": FUNCTION,
-	"Print":    PRINT,
-	"Return":   RETURN,
-	"Int":      INT_TYPE,
-	"String":   STRING_TYPE,
-	"Void":     VOID_TYPE,
+	"START":     ENTRY,
+	"Entry":     ENTRY,
+	"Function":  FUNCTION,
+	"Print":     PRINT,
+	"Return":    RETURN,
+	"Int":       INT_TYPE,
+	"Int8":      INT_TYPE,
+	"Int16":     INT_TYPE,
+	"Int32":     INT_TYPE,
+	"Int64":     INT_TYPE,
+	"UInt8":     INT_TYPE,
+	"UInt16":    INT_TYPE,
+	"UInt32":    INT_TYPE,
+	"UInt64":    INT_TYPE,
+	"Float":     FLOAT_TYPE,
+	"Char":      CHAR_TYPE,
+	"String":    STRING_TYPE,
+	"Void":      VOID_TYPE,
+	"For":       FOR,
+	"Match":     MATCH,
+	"Case":      CASE,
+	"Default":   DEFAULT,
+	"Var":       VAR,
+	"Const":     CONST,
+	"If":        IF,
+	"Else":      ELSE,
+	"Do":        DO,
+	"While":     WHILE,
+	"Break":     BREAK,
+	"Continue":  CONTINUE,
+	"Struct":    STRUCT,
+	"Array":     ARRAY,
+	"Module":    MODULE,
+	"Import":    IMPORT,
+	"Public":    PUBLIC,
+	"Private":   PRIVATE,
+	"Interface": INTERFACE,
+	"Try":       TRY,
+	"Catch":     CATCH,
+	"Type":      TYPE,
+	"nil":       NIL,
 }
 
 type Token struct {
@@ -53,6 +138,8 @@ type Token struct {
 	Literal string
 	Line    int
 	Column  int
+	End     int    // column just past the token's last character
+	File    string // the file the token was read from, when the lexer knows it
 }
 
 type Lexer struct {
@@ -62,6 +149,9 @@ type Lexer struct {
 	ch           byte // current char under examination
 	line         int
 	column       int
+	file         string
+	comments     []Token   // the block comments skipped so far
+	unclosed     *Unclosed // the comment the input ended in, if any
 }
 
 func New(input string) *Lexer {
@@ -74,6 +164,14 @@ func New(input string) *Lexer {
 	return l
 }
 
+// NewFile creates a lexer for input read from file, which every token
+// records
+func NewFile(input string, file string) *Lexer {
+	l := New(input)
+	l.file = file
+	return l
+}
+
 func (l *Lexer) readChar() {
 	if l.readPosition >= len(l.input) {
 		l.ch = 0 // ASCII NUL character represents "EOF"
@@ -98,18 +196,72 @@ func (l *Lexer) peekChar() byte {
 	return l.input[l.readPosition]
 }
 
+// Comments returns the block comments skipped so far, in order. Each is a
+// COMMENT token whose End is the column just past its */, on the line its
+// Literal ends on.
+func (l *Lexer) Comments() []Token {
+	return l.comments
+}
+
+// Unclosed is a block comment that the end of the input left open
+type Unclosed struct {
+	Comment Token // where it starts
+	Depth   int   // how many */ it still needs, one more for each nested /*
+}
+
+// UnclosedComment returns the block comment the input ended inside of, if
+// any; there is at most one, since it runs to the end of the input
+func (l *Lexer) UnclosedComment() (Unclosed, bool) {
+	if l.unclosed == nil {
+		return Unclosed{}, false
+	}
+	return *l.unclosed, true
+}
+
 func (l *Lexer) NextToken() Token {
+	tok := l.nextToken()
+	// The lexer stopped on the character after the token, which may start
+	// the next line
+	end := min(l.position, len(l.input))
+	tok.End = end - strings.LastIndexByte(l.input[:end], '\n')
+	tok.File = l.file
+	return tok
+}
+
+func (l *Lexer) nextToken() Token {
 	var tok Token
 
 	l.skipWhitespace()
 
 	switch l.ch {
 	case '=':
-		tok = Token{Type: ASSIGN, Literal: string(l.ch), Line: l.line, Column: l.column}
+		if l.peekChar() == '=' {
+			tok = l.makeTwoCharToken(EQ)
+		} else {
+			tok = Token{Type: ASSIGN, Literal: string(l.ch), Line: l.line, Column: l.column}
+		}
 	case '-':
 		tok = Token{Type: MINUS, Literal: string(l.ch), Line: l.line, Column: l.column}
 	case '+':
 		tok = Token{Type: PLUS, Literal: string(l.ch), Line: l.line, Column: l.column}
+	case '!':
+		if l.peekChar() == '=' {
+			tok = l.makeTwoCharToken(NOT_EQ)
+		} else {
+			tok = Token{Type: BANG, Literal: string(l.ch), Line: l.line, Column: l.column}
+		}
+	case '<':
+		if l.peekChar() == '=' {
+			tok = l.makeTwoCharToken(LT_EQ)
+		} else {
+			tok = Token{Type: LT, Literal: string(l.ch), Line: l.line, Column: l.column}
+		}
+	case '>':
+		if l.peekChar() == '=' {
+			tok = l.makeTwoCharToken(GT_EQ)
+		} else {
+			tok = Token{Type: GT, Literal: string(l.ch), Line: l.line, Column: l.column}
+		}
 	case '(':
 		tok = Token{Type: LPAREN, Literal: string(l.ch), Line: l.line, Column: l.column}
 	case ')':
@@ -118,13 +270,45 @@ func (l *Lexer) NextToken() Token {
 		tok = Token{Type: LBRACE, Literal: string(l.ch), Line: l.line, Column: l.column}
 	case '}':
 		tok = Token{Type: RBRACE, Literal: string(l.ch), Line: l.line, Column: l.column}
+	case '[':
+		tok = Token{Type: LBRACKET, Literal: string(l.ch), Line: l.line, Column: l.column}
+	case ']':
+		tok = Token{Type: RBRACKET, Literal: string(l.ch), Line: l.line, Column: l.column}
 	case ',':
 		tok = Token{Type: COMMA, Literal: string(l.ch), Line: l.line, Column: l.column}
-	case '\'':
+	case ';':
+		tok = Token{Type: SEMICOLON, Literal: string(l.ch), Line: l.line, Column: l.column}
+	case '@':
+		tok = Token{Type: AT, Literal: string(l.ch), Line: l.line, Column: l.column}
+	case '#':
+		tok = Token{Type: HASH, Literal: string(l.ch), Line: l.line, Column: l.column}
+	case ':':
+		tok = Token{Type: COLON, Literal: string(l.ch), Line: l.line, Column: l.column}
+	case '.':
+		if l.peekChar() == '.' && l.readPosition+1 < len(l.input) && l.input[l.readPosition+1] == '.' {
+			tok = Token{Type: ELLIPSIS, Literal: "...", Line: l.line, Column: l.column}
+			l.readChar()
+			l.readChar()
+		} else {
+			tok = Token{Type: DOT, Literal: string(l.ch), Line: l.line, Column: l.column}
+		}
+	case '?':
+		if l.peekChar() == '?' {
+			tok = l.makeTwoCharToken(DEFAULT_OR)
+		} else {
+			tok = Token{Type: QUESTION, Literal: string(l.ch), Line: l.line, Column: l.column}
+		}
+	case '\'', '"':
 		tok.Type = STRING
-		tok.Literal = l.readString()
 		tok.Line = l.line
 		tok.Column = l.column
+		quote := l.ch
+		tok.Literal = l.readString(quote)
+		// A single character in single quotes is a Char; double quotes
+		// always make a String
+		if quote == '\'' && len(tok.Literal) == 1 {
+			tok.Type = CHAR
+		}
 		l.readChar() // Skip the closing quote
 		return tok
 	case '/':
@@ -135,7 +319,11 @@ func (l *Lexer) NextToken() Token {
 			l.skipBlockComment()
 			return l.NextToken() // Skip comment and get next token
 		}
-		tok = Token{Type: ILLEGAL, Literal: string(l.ch), Line: l.line, Column: l.column}
+		tok = Token{Type: SLASH, Literal: string(l.ch), Line: l.line, Column: l.column}
+	case '*':
+		tok = Token{Type: ASTERISK, Literal: string(l.ch), Line: l.line, Column: l.column}
+	case '%':
+		tok = Token{Type: PERCENT, Literal: string(l.ch), Line: l.line, Column: l.column}
 	case 0:
 		tok.Literal = ""
 		tok.Type = EOF
@@ -150,9 +338,15 @@ func (l *Lexer) NextToken() Token {
 			return tok
 		} else if isDigit(l.ch) {
 			tok.Type = INT
-			tok.Literal = l.readNumber()
 			tok.Line = l.line
 			tok.Column = l.column
+			tok.Literal = l.readNumber()
+			// A dot followed by a digit continues the number as a Float
+			if l.ch == '.' && isDigit(l.peekChar()) {
+				l.readChar()
+				tok.Type = FLOAT
+				tok.Literal += "." + l.readNumber()
+			}
 			return tok
 		} else {
 			tok = Token{Type: ILLEGAL, Literal: string(l.ch), Line: l.line, Column: l.column}
@@ -163,6 +357,15 @@ func (l *Lexer) NextToken() Token {
 	return tok
 }
 
+// makeTwoCharToken builds a token from the current and next character, leaving
+// the lexer on the second one
+func (l *Lexer) makeTwoCharToken(t TokenType) Token {
+	line, column := l.line, l.column
+	ch := l.ch
+	l.readChar()
+	return Token{Type: t, Literal: string(ch) + string(l.ch), Line: line, Column: column}
+}
+
 func (l *Lexer) skipWhitespace() {
 	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
 		l.readChar()
@@ -185,20 +388,89 @@ func (l *Lexer) readNumber() string {
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) readString() string {
-	position := l.position + 1 // skip opening quote
+// readString reads a string literal up to its closing quote and returns its
+// value, the bytes it stands for once its escape sequences are decoded
+func (l *Lexer) readString(quote byte) string {
+	var value strings.Builder
 	for {
 		l.readChar()
-		if l.ch == '\'' || l.ch == 0 {
-			break
+		if l.ch == quote || l.ch == 0 {
+			return value.String()
 		}
-		// Handle basic escape sequences
 		if l.ch == '\\' && l.peekChar() != 0 {
-			l.readChar() // Skip the escaped character
+			l.readChar()
+			value.WriteByte(l.readEscape())
+			continue
 		}
+		value.WriteByte(l.ch)
 	}
-	str := l.input[position:l.position]
-	return str
+}
+
+// escapes maps the letter of each single-letter escape sequence to the byte
+// it stands for
+var escapes = map[byte]byte{
+	'n': '\n',
+	't': '\t',
+	'r': '\r',
+	'b': '\b',
+	'f': '\f',
+}
+
+// readEscape decodes the escape sequence whose first character after the
+// backslash is l.ch, leaving l.ch on its last character. Besides the
+// letters in escapes, there are \0 and up to three octal digits, as in \101,
+// and \x with one or two hex digits; a backslash before any other
+// character, such as \\, \' or \", stands for that character.
+func (l *Lexer) readEscape() byte {
+	switch {
+	case isOctalDigit(l.ch):
+		value := l.ch - '0'
+		for i := 1; i < 3 && isOctalDigit(l.peekChar()); i++ {
+			l.readChar()
+			value = value*8 + l.ch - '0'
+		}
+		return value
+	case l.ch == 'x' && isHexDigit(l.peekChar()):
+		l.readChar()
+		value := hexValue(l.ch)
+		if isHexDigit(l.peekChar()) {
+			l.readChar()
+			value = value*16 + hexValue(l.ch)
+		}
+		return value
+	}
+	if b, ok := escapes[l.ch]; ok {
+		return b
+	}
+	return l.ch
+}
+
+// Quote returns the literal in single quotes that stands for value, with
+// the bytes that need it escaped
+func Quote(value string) string {
+	var quoted strings.Builder
+	quoted.WriteByte('\'')
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case c == '\'' || c == '\\':
+			quoted.WriteByte('\\')
+			quoted.WriteByte(c)
+		case c == '\n':
+			quoted.WriteString(`\n`)
+		case c == '\t':
+			quoted.WriteString(`\t`)
+		case c == '\r':
+			quoted.WriteString(`\r`)
+		case c == 0 && (i+1 == len(value) || !isOctalDigit(value[i+1])):
+			quoted.WriteString(`\0`)
+		case c < ' ' || c > '~':
+			fmt.Fprintf(&quoted, `\x%02x`, c)
+		default:
+			quoted.WriteByte(c)
+		}
+	}
+	quoted.WriteByte('\'')
+	return quoted.String()
 }
 
 func (l *Lexer) readLineComment() string {
@@ -234,21 +506,34 @@ func (l *Lexer) skipLineComment() {
 	}
 }
 
+// skipBlockComment skips a /* */ comment, recording it for Comments.
+// Comments nest: each /* inside one needs its own */, so that code holding
+// a comment can itself be commented out.
 func (l *Lexer) skipBlockComment() {
+	comment := Token{Type: COMMENT, Line: l.line, Column: l.column, File: l.file}
+	start := l.position
 	l.readChar() // skip '/'
 	l.readChar() // skip '*'
 
-	for {
-		if l.ch == 0 {
-			break
-		}
-		if l.ch == '*' && l.peekChar() == '/' {
-			l.readChar() // skip '*'
-			l.readChar() // skip '/'
-			break
+	depth := 1
+	for depth > 0 && l.ch != 0 {
+		switch {
+		case l.ch == '/' && l.peekChar() == '*':
+			depth++
+			l.readChar()
+		case l.ch == '*' && l.peekChar() == '/':
+			depth--
+			l.readChar()
 		}
 		l.readChar()
 	}
+	if depth > 0 {
+		l.unclosed = &Unclosed{Comment: comment, Depth: depth}
+	}
+	end := min(l.position, len(l.input))
+	comment.Literal = l.input[start:end]
+	comment.End = end - strings.LastIndexByte(l.input[:end], '\n')
+	l.comments = append(l.comments, comment)
 }
 
 func isLetter(ch byte) bool {
@@ -259,6 +544,26 @@ func isDigit(ch byte) bool {
 	return '0' <= ch && ch <= '9'
 }
 
+func isOctalDigit(ch byte) bool {
+	return '0' <= ch && ch <= '7'
+}
+
+func isHexDigit(ch byte) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+// hexValue returns the value of a hex digit
+func hexValue(ch byte) byte {
+	switch {
+	case isDigit(ch):
+		return ch - '0'
+	case ch >= 'a':
+		return ch - 'a' + 10
+	default:
+		return ch - 'A' + 10
+	}
+}
+
 func lookupIdent(ident string) TokenType {
 	if tok, ok := keywords[ident]; ok {
 		return tok
@@ -266,6 +571,17 @@ func lookupIdent(ident string) TokenType {
 	return IDENT
 }
 
+// FoldKeyword returns the keyword spelled like ident apart from case, such
+// as Int for int, and its token type
+func FoldKeyword(ident string) (string, TokenType, bool) {
+	for keyword, tok := range keywords {
+		if strings.EqualFold(keyword, ident) && keyword != ident {
+			return keyword, tok, true
+		}
+	}
+	return "", IDENT, false
+}
+
 func (t TokenType) String() string {
 	switch t {
 	case ILLEGAL:
@@ -276,8 +592,14 @@ func (t TokenType) String() string {
 		return "IDENT"
 	case STRING:
 		return "STRING"
+	case CHAR:
+		return "CHAR"
 	case INT:
 		return "INT"
+	case FLOAT:
+		return "FLOAT"
+	case NIL:
+		return "NIL"
 	case ENTRY:
 		return "ENTRY"
 	case FUNCTION:
@@ -288,10 +610,58 @@ func (t TokenType) String() string {
 		return "RETURN"
 	case INT_TYPE:
 		return "INT_TYPE"
+	case FLOAT_TYPE:
+		return "FLOAT_TYPE"
+	case CHAR_TYPE:
+		return "CHAR_TYPE"
 	case STRING_TYPE:
 		return "STRING_TYPE"
 	case VOID_TYPE:
 		return "VOID_TYPE"
+	case FOR:
+		return "FOR"
+	case MATCH:
+		return "MATCH"
+	case CASE:
+		return "CASE"
+	case DEFAULT:
+		return "DEFAULT"
+	case VAR:
+		return "VAR"
+	case CONST:
+		return "CONST"
+	case IF:
+		return "IF"
+	case ELSE:
+		return "ELSE"
+	case DO:
+		return "DO"
+	case WHILE:
+		return "WHILE"
+	case BREAK:
+		return "BREAK"
+	case CONTINUE:
+		return "CONTINUE"
+	case STRUCT:
+		return "STRUCT"
+	case ARRAY:
+		return "ARRAY"
+	case MODULE:
+		return "MODULE"
+	case IMPORT:
+		return "IMPORT"
+	case PUBLIC:
+		return "PUBLIC"
+	case PRIVATE:
+		return "PRIVATE"
+	case INTERFACE:
+		return "INTERFACE"
+	case TRY:
+		return "TRY"
+	case CATCH:
+		return "CATCH"
+	case TYPE:
+		return "TYPE"
 	case LPAREN:
 		return "LPAREN"
 	case RPAREN:
@@ -300,14 +670,54 @@ func (t TokenType) String() string {
 		return "LBRACE"
 	case RBRACE:
 		return "RBRACE"
+	case LBRACKET:
+		return "LBRACKET"
+	case RBRACKET:
+		return "RBRACKET"
 	case COMMA:
 		return "COMMA"
+	case SEMICOLON:
+		return "SEMICOLON"
+	case AT:
+		return "AT"
+	case HASH:
+		return "HASH"
+	case COLON:
+		return "COLON"
+	case DOT:
+		return "DOT"
+	case ELLIPSIS:
+		return "ELLIPSIS"
+	case QUESTION:
+		return "QUESTION"
 	case ASSIGN:
 		return "ASSIGN"
 	case MINUS:
 		return "MINUS"
 	case PLUS:
 		return "PLUS"
+	case ASTERISK:
+		return "ASTERISK"
+	case SLASH:
+		return "SLASH"
+	case PERCENT:
+		return "PERCENT"
+	case BANG:
+		return "BANG"
+	case LT:
+		return "LT"
+	case GT:
+		return "GT"
+	case LT_EQ:
+		return "LT_EQ"
+	case GT_EQ:
+		return "GT_EQ"
+	case EQ:
+		return "EQ"
+	case NOT_EQ:
+		return "NOT_EQ"
+	case DEFAULT_OR:
+		return "DEFAULT_OR"
 	case COMMENT:
 		return "COMMENT"
 	default:
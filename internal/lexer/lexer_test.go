@@ -0,0 +1,74 @@
+package lexer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestNestedComments(t *testing.T) {
+	source := `/* outer
+   /* inner */ still outer
+   /* /* deeper */ */
+*/ Var x /* one line */ Int
+/*
+ * Function f() { /* disabled */ }
+ */
+Entry main() {}
+`
+	l := New(source)
+	var got []string
+	for tok := l.NextToken(); tok.Type != EOF; tok = l.NextToken() {
+		got = append(got, fmt.Sprintf("%s %d:%d-%d", tok.Literal, tok.Line, tok.Column, tok.End))
+	}
+	want := []string{
+		"Var 4:4-7", "x 4:8-9", "Int 4:25-28",
+		"Entry 8:1-6", "main 8:7-11", "( 8:11-12", ") 8:12-13", "{ 8:14-15", "} 8:15-16",
+	}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("tokens:\n got %s\nwant %s", strings.Join(got, ", "), strings.Join(want, ", "))
+	}
+
+	var comments []string
+	for _, c := range l.Comments() {
+		comments = append(comments, fmt.Sprintf("%d:%d lines %d, ends at column %d", c.Line, c.Column, strings.Count(c.Literal, "\n")+1, c.End))
+	}
+	wantComments := []string{
+		"1:1 lines 4, ends at column 3",
+		"4:10 lines 1, ends at column 24",
+		"5:1 lines 3, ends at column 4",
+	}
+	if strings.Join(comments, "\n") != strings.Join(wantComments, "\n") {
+		t.Errorf("comments:\n got %s\nwant %s", strings.Join(comments, "\n    "), strings.Join(wantComments, "\n    "))
+	}
+	if _, ok := l.UnclosedComment(); ok {
+		t.Error("every comment is closed, but one is reported open")
+	}
+}
+
+func TestUnclosedComment(t *testing.T) {
+	tests := []struct {
+		source string
+		line   int
+		column int
+		depth  int
+	}{
+		{"Var x Int\n  /* never closed\n", 2, 3, 1},
+		{"/* a /* b */\nVar x Int\n", 1, 1, 1},
+		{"/* a /* b /* c */\n", 1, 1, 2},
+	}
+	for _, tt := range tests {
+		l := New(tt.source)
+		for tok := l.NextToken(); tok.Type != EOF; tok = l.NextToken() {
+		}
+		c, ok := l.UnclosedComment()
+		if !ok {
+			t.Errorf("%q: no unclosed comment reported", tt.source)
+			continue
+		}
+		if c.Comment.Line != tt.line || c.Comment.Column != tt.column || c.Depth != tt.depth {
+			t.Errorf("%q: got comment at %d:%d needing %d */, want %d:%d needing %d",
+				tt.source, c.Comment.Line, c.Comment.Column, c.Depth, tt.line, tt.column, tt.depth)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+// Package module loads a program that spans several files: one or more main
+// files and the modules they import, directly or through other modules. Each
+// module is a file in the directory of the file importing it, and all of
+// them are joined into one program for the code generator.
+package module
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"dreadlang/internal/codegen"
+	"dreadlang/internal/lexer"
+	"dreadlang/internal/parser"
+)
+
+// Extension ends the name of every Dread source file. The module imported
+// as geometry is the file geometry.dread.
+const Extension = ".dread"
+
+// module is one file of a program
+type module struct {
+	name    string
+	file    string
+	dir     string // where the modules it imports are found
+	main    bool   // given to the compiler rather than imported
+	program *parser.Program
+	loaded  bool // false while its own imports are being loaded
+}
+
+// loader reads the modules of a program
+type loader struct {
+	modules     map[string]*module
+	loading     []*module // the chain of imports being loaded, main file first
+	order       []*module // every module after those it imports
+	diagnostics []parser.Diagnostic
+}
+
+// Load parses source, the main file of a program read from file, and the
+// modules it imports, and returns them joined into one program in which
+// every module's declarations come before those of the modules importing
+// it. file is "" for a source that was not read from a file, whose modules
+// are found in the working directory. Diagnostics in the main file carry
+// no file name; those in a module carry its path.
+func Load(file string, source string) (*parser.Program, []parser.Diagnostic) {
+	l := &loader{modules: make(map[string]*module)}
+	name := strings.TrimSuffix(filepath.Base(file), Extension)
+	if file == "" {
+		name = ""
+	}
+	l.load(&module{name: name, dir: filepath.Dir(file), main: true}, parser.New(lexer.New(source)))
+	return l.join()
+}
+
+// LoadFiles is Load for a program whose main part is spread over several
+// files, as dreadc a.dread b.dread compiles it: their declarations share one
+// namespace, as if they were modules importing each other, and any of them
+// may hold the Entry function. A file another one imports is loaded as a
+// module. Every diagnostic carries the path of its file.
+func LoadFiles(files []string, sources []string) (*parser.Program, []parser.Diagnostic) {
+	l := &loader{modules: make(map[string]*module)}
+	for i, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), Extension)
+		if m, ok := l.modules[name]; ok && m.file == filepath.Clean(file) {
+			continue
+		}
+		l.load(&module{name: name, file: file, dir: filepath.Dir(file), main: true}, parser.New(lexer.NewFile(sources[i], file)))
+	}
+	return l.join()
+}
+
+// join checks the declarations of the loaded modules and joins them into one
+// program, each after the modules it imports
+func (l *loader) join() (*parser.Program, []parser.Diagnostic) {
+	if len(l.diagnostics) > 0 {
+		return nil, l.diagnostics
+	}
+	l.checkDeclarations()
+	if len(l.diagnostics) > 0 {
+		return nil, l.diagnostics
+	}
+
+	program := &parser.Program{}
+	for _, m := range l.order {
+		program.Pragmas = append(program.Pragmas, m.program.Pragmas...)
+		program.Statements = append(program.Statements, m.program.Statements...)
+	}
+	return program, nil
+}
+
+// load parses module m and loads every module it imports before recording
+// it in the program's order
+func (l *loader) load(m *module, p *parser.Parser) {
+	m.program = p.ParseProgram()
+	l.diagnostics = append(l.diagnostics, p.Diagnostics()...)
+	if declared := declaredName(m.program); declared != nil {
+		if m.main {
+			// A main file may call itself anything
+			m.name = declared.Name
+		} else if declared.Name != m.name {
+			l.errorAt(declared.Token, "file declares Module %s but is imported as %s", declared.Name, m.name)
+		}
+	}
+	if m.name != "" {
+		l.modules[m.name] = m
+	}
+
+	l.loading = append(l.loading, m)
+	for _, stmt := range m.program.Statements {
+		switch s := stmt.(type) {
+		case *parser.ImportStatement:
+			l.importModule(m, s)
+		case *parser.FunctionStatement:
+			if s.IsEntry && !m.main {
+				l.errorAt(s.Token, "module %s cannot have an Entry function", m.name)
+			}
+		}
+	}
+	l.loading = l.loading[:len(l.loading)-1]
+
+	m.loaded = true
+	l.order = append(l.order, m)
+}
+
+// importModule loads the module an Import in importer names, unless it
+// already has been. A module that is still loading its own imports imports
+// itself through them, which is a cycle.
+func (l *loader) importModule(importer *module, imp *parser.ImportStatement) {
+	if m, ok := l.modules[imp.Name]; ok {
+		if !m.loaded {
+			l.errorAt(imp.Token, "import cycle: %s", l.cycle(m))
+		}
+		return
+	}
+	file := filepath.Join(importer.dir, imp.Name+Extension)
+	source, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		l.errorAt(imp.Token, "cannot find module %s: there is no %s", imp.Name, file)
+		return
+	}
+	if err != nil {
+		l.errorAt(imp.Token, "cannot read module %s: %v", imp.Name, err)
+		return
+	}
+	l.load(&module{name: imp.Name, file: file, dir: filepath.Dir(file)}, parser.New(lexer.NewFile(string(source), file)))
+}
+
+// cycle describes the chain of imports from m back to itself, as
+// "a imports b imports a"
+func (l *loader) cycle(m *module) string {
+	var names []string
+	for i := len(l.loading) - 1; i >= 0; i-- {
+		names = append([]string{l.loading[i].name}, names...)
+		if l.loading[i] == m {
+			break
+		}
+	}
+	return strings.Join(append(names, m.name), " imports ")
+}
+
+// checkDeclarations reports a name declared at file scope by two modules:
+// they share one namespace, like the symbols they become. Of the main
+// files, only one may have an Entry function.
+func (l *loader) checkDeclarations() {
+	declared := make(map[string]*module)
+	var entry *parser.FunctionStatement
+	var entryModule *module
+	for _, m := range l.order {
+		for _, stmt := range m.program.Statements {
+			if fn, ok := stmt.(*parser.FunctionStatement); ok && fn.IsEntry {
+				if entryModule != nil && entryModule != m {
+					l.diagnostics = append(l.diagnostics, parser.Diagnostic{
+						File:    fn.Token.File,
+						Line:    fn.Token.Line,
+						Column:  fn.Token.Column,
+						Code:    parser.ErrMultipleEntry,
+						Message: fmt.Sprintf("multiple Entry functions: %s in %s and %s in %s", entry.Name, describe(entryModule), fn.Name, describe(m)),
+					})
+				} else if entryModule == nil {
+					entry, entryModule = fn, m
+				}
+			}
+			name, tok, ok := declaration(stmt)
+			if !ok {
+				continue
+			}
+			if other, exists := declared[name]; exists && other != m {
+				l.diagnostics = append(l.diagnostics, parser.Diagnostic{
+					File:    tok.File,
+					Line:    tok.Line,
+					Column:  tok.Column,
+					Code:    codegen.ErrAlreadyDeclared,
+					Message: fmt.Sprintf("%s is declared by both %s and %s", name, describe(other), describe(m)),
+				})
+				continue
+			}
+			declared[name] = m
+		}
+	}
+}
+
+// declaration returns the name a file-scope statement declares and the
+// token to report it at
+func declaration(stmt parser.Statement) (string, lexer.Token, bool) {
+	switch s := stmt.(type) {
+	case *parser.FunctionStatement:
+		if s.IsEntry {
+			return "", lexer.Token{}, false
+		}
+		return s.Symbol(), s.NameToken, true
+	case *parser.StructStatement:
+		return s.Name, s.Token, true
+	case *parser.InterfaceStatement:
+		return s.Name, s.Token, true
+	case *parser.TypeAliasStatement:
+		return s.Name, s.Token, true
+	case *parser.ConstStatement:
+		return s.Name, s.Token, true
+	case *parser.VarStatement:
+		return s.Name, s.Token, true
+	}
+	return "", lexer.Token{}, false
+}
+
+// describe names a module in a diagnostic
+func describe(m *module) string {
+	switch {
+	case m.file == "":
+		return "the main file"
+	case m.main:
+		return m.file
+	}
+	return "module " + m.name
+}
+
+// declaredName returns the file's Module declaration, if it has one
+func declaredName(program *parser.Program) *parser.ModuleStatement {
+	for _, stmt := range program.Statements {
+		if m, ok := stmt.(*parser.ModuleStatement); ok {
+			return m
+		}
+	}
+	return nil
+}
+
+// errorAt records a module error at the position of tok
+func (l *loader) errorAt(tok lexer.Token, format string, args ...interface{}) {
+	l.diagnostics = append(l.diagnostics, parser.Diagnostic{
+		File:    tok.File,
+		Line:    tok.Line,
+		Column:  tok.Column,
+		Code:    parser.ErrModule,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
@@ -0,0 +1,35 @@
+package parser
+
+import "dreadlang/internal/lexer"
+
+// TypeAliasStatement gives a type a second name at file scope:
+// Type UserId = Int. The alias is the type it names, not a new one, so
+// values of either are used wherever the other is expected.
+type TypeAliasStatement struct {
+	Token   lexer.Token // the alias name
+	Name    string
+	Type    string     // the element type of an array
+	Length  Expression // nil unless the type is an array
+	Private bool
+}
+
+func (ts *TypeAliasStatement) statementNode() {}
+func (ts *TypeAliasStatement) String() string {
+	return visibilityPrefix(ts.Private) + "Type " + ts.Name + " = " + typeString(ts.Type, ts.Length)
+}
+
+// parseTypeAliasStatement parses Type Name = Type, where the type is
+// written as after Var
+func (p *Parser) parseTypeAliasStatement() Statement {
+	if !p.expectPeek(lexer.IDENT) {
+		return nil
+	}
+	stmt := &TypeAliasStatement{Token: p.curToken, Name: p.curToken.Literal}
+	if !p.expectPeek(lexer.ASSIGN) {
+		return nil
+	}
+	if !p.parseType("Type "+stmt.Name+" =", &stmt.Type, &stmt.Length) {
+		return nil
+	}
+	return stmt
+}
@@ -0,0 +1,222 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"dreadlang/internal/lexer"
+)
+
+// Attribute is an annotation such as @align(16) written before a declaration
+type Attribute struct {
+	Token     lexer.Token // the attribute name
+	Name      string
+	Arguments []Expression
+}
+
+func (a *Attribute) String() string {
+	if a.Arguments == nil {
+		return "@" + a.Name
+	}
+	args := make([]string, len(a.Arguments))
+	for i, arg := range a.Arguments {
+		args[i] = arg.String()
+	}
+	return fmt.Sprintf("@%s(%s)", a.Name, strings.Join(args, ", "))
+}
+
+// Attributes are the annotations of one declaration, in source order
+type Attributes []*Attribute
+
+// Lookup returns the attribute called name, or nil
+func (as Attributes) Lookup(name string) *Attribute {
+	for _, a := range as {
+		if a.Name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// Has reports whether the declaration carries @name
+func (as Attributes) Has(name string) bool {
+	return as.Lookup(name) != nil
+}
+
+// prefix renders the attributes ahead of their declaration
+func (as Attributes) prefix() string {
+	var b strings.Builder
+	for _, a := range as {
+		b.WriteString(a.String() + " ")
+	}
+	return b.String()
+}
+
+// attributeKind says what an attribute can annotate and which argument it takes
+type attributeKind struct {
+	functions bool
+	variables bool
+	argument  lexer.TokenType // STRING or INT when one argument is required
+}
+
+// attributeKinds lists the attributes the compiler understands
+var attributeKinds = map[string]attributeKind{
+	"naked":     {functions: true},                                          // no stack frame: no prologue or epilogue
+	"interrupt": {functions: true},                                          // saves the interrupted code's registers and returns with iretq
+	"inline":    {functions: true},                                          // hint: calls should be inlined
+	"noinline":  {functions: true},                                          // calls must not be inlined
+	"export":    {functions: true, variables: true},                         // visible to the linker under its own name
+	"section":   {functions: true, variables: true, argument: lexer.STRING}, // placed in the named section
+	"align":     {functions: true, variables: true, argument: lexer.INT},    // aligned to a power of two
+}
+
+// parseAnnotatedStatement parses a Function or global Var preceded by
+// attributes such as @naked or @section('.boot')
+func (p *Parser) parseAnnotatedStatement() Statement {
+	var attributes Attributes
+	for p.curToken.Type == lexer.AT {
+		attribute := p.parseAttribute()
+		if attribute == nil {
+			return nil
+		}
+		attributes = append(attributes, attribute)
+		p.nextToken()
+	}
+
+	switch p.curToken.Type {
+	case lexer.FUNCTION:
+		stmt, ok := p.parseFunctionStatement(false).(*FunctionStatement)
+		if !ok {
+			return nil
+		}
+		stmt.Attributes = attributes
+		p.checkAttributes(attributes, "function")
+		p.checkFunctionAttributes(stmt)
+		return stmt
+	case lexer.VAR:
+		stmt, ok := p.parseVarStatement().(*VarStatement)
+		if !ok {
+			return nil
+		}
+		stmt.Attributes = attributes
+		p.checkAttributes(attributes, "variable")
+		return stmt
+	default:
+		p.errorAt(p.curToken, ErrInvalidAttribute, "attributes must be followed by Function or Var, got %s", p.curToken.Type)
+		return nil
+	}
+}
+
+// parseAttribute parses @name or @name(arguments)
+func (p *Parser) parseAttribute() *Attribute {
+	if !p.expectPeek(lexer.IDENT) {
+		return nil
+	}
+	attribute := &Attribute{Token: p.curToken, Name: p.curToken.Literal}
+
+	if p.peekToken.Type == lexer.LPAREN {
+		p.nextToken()
+		attribute.Arguments = p.parseArgumentList()
+		if !p.expectPeek(lexer.RPAREN) {
+			return nil
+		}
+	}
+	return attribute
+}
+
+// checkAttributes reports unknown, repeated or misplaced attributes and
+// malformed arguments; kind is "function" or "variable"
+func (p *Parser) checkAttributes(attributes Attributes, kind string) {
+	seen := make(map[string]bool)
+	for _, a := range attributes {
+		spec, known := attributeKinds[a.Name]
+		switch {
+		case !known:
+			p.errorAt(a.Token, ErrInvalidAttribute, "unknown attribute @%s", a.Name)
+			continue
+		case seen[a.Name]:
+			p.errorAt(a.Token, ErrInvalidAttribute, "duplicate attribute @%s", a.Name)
+			continue
+		case kind == "function" && !spec.functions, kind == "variable" && !spec.variables:
+			p.errorAt(a.Token, ErrInvalidAttribute, "@%s cannot be applied to a %s", a.Name, kind)
+			continue
+		}
+		seen[a.Name] = true
+		p.checkAttributeArguments(a, spec)
+	}
+
+	if seen["inline"] && seen["noinline"] {
+		p.errorAt(attributes.Lookup("noinline").Token, ErrInvalidAttribute, "@inline and @noinline cannot be combined")
+	}
+}
+
+// checkAttributeArguments checks the arguments written as literals; the code
+// generator folds and checks any other constant expression
+func (p *Parser) checkAttributeArguments(a *Attribute, spec attributeKind) {
+	switch spec.argument {
+	case lexer.STRING:
+		if len(a.Arguments) != 1 {
+			p.errorAt(a.Token, ErrInvalidAttribute, "@%s expects one String argument", a.Name)
+			return
+		}
+		switch arg := a.Arguments[0].(type) {
+		case *StringLiteral:
+			if !ValidSectionName(arg.Value) {
+				p.errorAt(a.Token, ErrInvalidAttribute, "@%s expects a name such as '.text.boot'", a.Name)
+			}
+		case *IntegerLiteral, *CharLiteral:
+			p.errorAt(a.Token, ErrInvalidAttribute, "@%s expects a name such as '.text.boot'", a.Name)
+		}
+	case lexer.INT:
+		if len(a.Arguments) != 1 {
+			p.errorAt(a.Token, ErrInvalidAttribute, "@%s expects one Int argument", a.Name)
+			return
+		}
+		switch arg := a.Arguments[0].(type) {
+		case *IntegerLiteral:
+			if !PowerOfTwo(arg.Value) {
+				p.errorAt(a.Token, ErrInvalidAttribute, "@%s expects a power of two", a.Name)
+			}
+		case *StringLiteral, *CharLiteral:
+			p.errorAt(a.Token, ErrInvalidAttribute, "@%s expects a power of two", a.Name)
+		}
+	default:
+		if a.Arguments != nil {
+			p.errorAt(a.Token, ErrInvalidAttribute, "@%s takes no arguments", a.Name)
+		}
+	}
+}
+
+// PowerOfTwo reports whether n is a valid alignment
+func PowerOfTwo(n int64) bool {
+	return n > 0 && n&(n-1) == 0
+}
+
+// ValidSectionName reports whether name can be passed to the assembler as is
+func ValidSectionName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '$' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// checkFunctionAttributes reports attributes that contradict each other or
+// the function's signature
+func (p *Parser) checkFunctionAttributes(stmt *FunctionStatement) {
+	naked, interrupt := stmt.Attributes.Has("naked"), stmt.Attributes.Has("interrupt")
+	switch {
+	case naked && interrupt:
+		p.errorAt(stmt.Token, ErrInvalidAttribute, "@naked and @interrupt cannot be combined")
+	case naked && len(stmt.Parameters) > 0:
+		p.errorAt(stmt.Token, ErrInvalidAttribute, "naked function %s cannot take parameters", stmt.Name)
+	case interrupt && len(stmt.Parameters) > 0:
+		p.errorAt(stmt.Token, ErrInvalidAttribute, "interrupt handler %s cannot take parameters", stmt.Name)
+	case interrupt && stmt.ReturnType != "Void":
+		p.errorAt(stmt.Token, ErrInvalidAttribute, "interrupt handler %s must return Void", stmt.Name)
+	}
+}
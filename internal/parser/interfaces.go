@@ -0,0 +1,80 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"dreadlang/internal/lexer"
+)
+
+// InterfaceStatement declares the methods a struct must have to be used
+// as the interface: Interface Writer { Write(s String) Int }
+type InterfaceStatement struct {
+	Token   lexer.Token // the interface name
+	Private bool        // hidden from the other files of the program
+	Name    string
+	Methods []*InterfaceMethod
+}
+
+func (is *InterfaceStatement) statementNode() {}
+func (is *InterfaceStatement) String() string {
+	methods := make([]string, len(is.Methods))
+	for i, m := range is.Methods {
+		methods[i] = m.String()
+	}
+	return fmt.Sprintf("%sInterface %s { %s }", visibilityPrefix(is.Private), is.Name, strings.Join(methods, ", "))
+}
+
+// InterfaceMethod is one method of an interface: its name, parameters and
+// return type, with no body
+type InterfaceMethod struct {
+	Token      lexer.Token // the method name
+	Name       string
+	Parameters []*Parameter
+	ReturnType string
+}
+
+func (im *InterfaceMethod) String() string {
+	params := make([]string, len(im.Parameters))
+	for i, param := range im.Parameters {
+		params[i] = param.String()
+	}
+	return fmt.Sprintf("%s(%s) (%s)", im.Name, strings.Join(params, ", "), im.ReturnType)
+}
+
+// parseInterfaceStatement parses an interface declaration. Its methods are
+// written like functions without the keyword or a body, one per line or
+// separated by commas.
+func (p *Parser) parseInterfaceStatement() Statement {
+	if !p.expectPeek(lexer.IDENT) {
+		return nil
+	}
+	stmt := &InterfaceStatement{Token: p.curToken, Name: p.curToken.Literal}
+	if !p.expectPeek(lexer.LBRACE) {
+		return nil
+	}
+
+	for p.peekToken.Type != lexer.RBRACE {
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		method := &InterfaceMethod{Token: p.curToken, Name: p.curToken.Literal}
+		if !p.expectPeek(lexer.LPAREN) {
+			return nil
+		}
+		method.Parameters = p.parseParameters()
+		if !p.expectPeek(lexer.RPAREN) {
+			return nil
+		}
+		if !p.parseReturnType(&method.ReturnType) {
+			return nil
+		}
+		stmt.Methods = append(stmt.Methods, method)
+		if p.peekToken.Type == lexer.COMMA {
+			p.nextToken()
+		}
+	}
+	p.nextToken()
+
+	return stmt
+}
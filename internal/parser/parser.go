@@ -4,6 +4,7 @@ import (
 	"dreadlang/internal/lexer"
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 // AST Node types
@@ -23,11 +24,15 @@ type Expression interface {
 
 // Program is the root node of every AST
 type Program struct {
+	Pragmas    Pragmas // of every file joined into the program
 	Statements []Statement
 }
 
 func (p *Program) String() string {
 	var out string
+	for _, pr := range p.Pragmas {
+		out += pr.String() + "\n"
+	}
 	for _, s := range p.Statements {
 		out += s.String()
 	}
@@ -36,21 +41,34 @@ func (p *Program) String() string {
 
 // Parameter represents a function parameter
 type Parameter struct {
-	Name string
-	Type string
+	Token    lexer.Token // the name
+	Name     string
+	Type     string
+	Variadic bool // values Int...: the extra arguments, as a slice of Type
 }
 
 func (p *Parameter) String() string {
+	if p.Variadic {
+		return fmt.Sprintf("%s %s...", p.Name, strings.TrimSuffix(p.Type, "[]"))
+	}
 	return fmt.Sprintf("%s %s", p.Name, p.Type)
 }
 
 // Statements
 type FunctionStatement struct {
+	Token      lexer.Token // the Entry or Function keyword
 	IsEntry    bool
+	Attributes Attributes // written before Function
+	Private    bool       // hidden from the other files of the program
+	Receiver   *Parameter // set for methods: Function (p Point) Name()
+	NameToken  lexer.Token
 	Name       string
-	Parameters []*Parameter
-	ReturnType string
-	Body       *BlockStatement
+	// TypeParameters name the types a generic function is written for, as
+	// in Function Max[T](a T, b T) T
+	TypeParameters []string
+	Parameters     []*Parameter
+	ReturnType     string
+	Body           *BlockStatement
 }
 
 func (fs *FunctionStatement) statementNode() {}
@@ -70,18 +88,43 @@ func (fs *FunctionStatement) String() string {
 		params += param.String()
 	}
 
-	return fmt.Sprintf("%s %s(%s) (%s) %s", keyword, fs.Name, params, fs.ReturnType, fs.Body.String())
+	var receiver string
+	if fs.Receiver != nil {
+		receiver = fmt.Sprintf("(%s) ", fs.Receiver.String())
+	}
+
+	var typeParams string
+	if len(fs.TypeParameters) > 0 {
+		typeParams = "[" + strings.Join(fs.TypeParameters, ", ") + "]"
+	}
+
+	return fmt.Sprintf("%s%s%s %s%s%s(%s) (%s) %s", visibilityPrefix(fs.Private), fs.Attributes.prefix(), keyword, receiver, fs.Name, typeParams, params, fs.ReturnType, fs.Body.String())
+}
+
+// Symbol returns the assembly symbol of the function. Methods are named
+// after their receiver's type, as in Point.Length, which no plain function
+// name can clash with.
+func (fs *FunctionStatement) Symbol() string {
+	if fs.Receiver != nil {
+		return fs.Receiver.Type + "." + fs.Name
+	}
+	return fs.Name
 }
 
 type BlockStatement struct {
+	Token      lexer.Token // the {
 	Statements []Statement
+	End        lexer.Token // the }, or EOF when it is missing
 }
 
 func (bs *BlockStatement) statementNode() {}
 func (bs *BlockStatement) String() string {
 	var out string
 	out += "{"
-	for _, s := range bs.Statements {
+	for i, s := range bs.Statements {
+		if i > 0 {
+			out += "; "
+		}
 		out += s.String()
 	}
 	out += "}"
@@ -89,30 +132,292 @@ func (bs *BlockStatement) String() string {
 }
 
 type AssignStatement struct {
+	Token lexer.Token // the variable name
 	Name  string
+	Field *FieldExpression // set when assigning to a field of Name: name.field = value
+	Index Expression       // set when assigning one element: name[index] = value
 	Value Expression
 }
 
 func (as *AssignStatement) statementNode() {}
 func (as *AssignStatement) String() string {
-	return fmt.Sprintf("%s = %s", as.Name, as.Value.String())
+	target := as.Target().String()
+	if as.Index != nil {
+		target = fmt.Sprintf("%s[%s]", target, as.Index.String())
+	}
+	return fmt.Sprintf("%s = %s", target, as.Value.String())
+}
+
+// Target returns what is assigned to, or indexed into when Index is set:
+// the variable itself, or one of its fields
+func (as *AssignStatement) Target() Expression {
+	if as.Field != nil {
+		return as.Field
+	}
+	return &Identifier{Token: as.Token, Value: as.Name}
+}
+
+// DestructureStatement assigns the elements of a tuple to variables, in
+// order: (a, b) = pair. A name of _ skips its element.
+type DestructureStatement struct {
+	Token lexer.Token // the (
+	Names []string
+	Value Expression
+}
+
+func (ds *DestructureStatement) statementNode() {}
+func (ds *DestructureStatement) String() string {
+	return fmt.Sprintf("(%s) = %s", strings.Join(ds.Names, ", "), ds.Value.String())
+}
+
+// VarStatement declares a variable with a fixed type: Var name Type [= value].
+// An array type also has a length, a constant expression: Var name Int[3].
+type VarStatement struct {
+	Token      lexer.Token // the variable name
+	Attributes Attributes  // only allowed on global variables
+	Private    bool        // hidden from the other files of the program
+	Name       string
+	Type       string     // the element type of an array
+	Length     Expression // nil unless the variable is an array
+	Value      Expression // nil means the zero value: 0 or ''
+}
+
+func (vs *VarStatement) statementNode() {}
+func (vs *VarStatement) String() string {
+	typ := typeString(vs.Type, vs.Length)
+	if vs.Value == nil {
+		return fmt.Sprintf("%s%sVar %s %s", visibilityPrefix(vs.Private), vs.Attributes.prefix(), vs.Name, typ)
+	}
+	return fmt.Sprintf("%s%sVar %s %s = %s", visibilityPrefix(vs.Private), vs.Attributes.prefix(), vs.Name, typ, vs.Value.String())
+}
+
+// typeString renders a type, with the length expression of an array type
+func typeString(name string, length Expression) string {
+	if length == nil {
+		return name
+	}
+	return fmt.Sprintf("%s[%s]", name, length.String())
+}
+
+// ModuleStatement names the module a file holds: Module geometry
+type ModuleStatement struct {
+	Token lexer.Token // the module name
+	Name  string
+}
+
+func (ms *ModuleStatement) statementNode() {}
+func (ms *ModuleStatement) String() string {
+	return "Module " + ms.Name
+}
+
+// ImportStatement makes the declarations of another module visible:
+// Import geometry
+type ImportStatement struct {
+	Token lexer.Token // the module name
+	Name  string
+}
+
+func (is *ImportStatement) statementNode() {}
+func (is *ImportStatement) String() string {
+	return "Import " + is.Name
+}
+
+// StructStatement declares a struct type at file scope:
+// Struct Point { x Int, y Int }
+type StructStatement struct {
+	Token   lexer.Token // the struct name
+	Private bool        // hidden from the other files of the program
+	Name    string
+	Fields  []*StructField
+}
+
+func (ss *StructStatement) statementNode() {}
+func (ss *StructStatement) String() string {
+	var fields string
+	for i, f := range ss.Fields {
+		if i > 0 {
+			fields += ", "
+		}
+		fields += f.String()
+	}
+	return fmt.Sprintf("%sStruct %s { %s }", visibilityPrefix(ss.Private), ss.Name, fields)
+}
+
+// StructField is one field of a struct declaration: name Type
+type StructField struct {
+	Token  lexer.Token // the field name
+	Name   string
+	Type   string     // the element type of an array
+	Length Expression // nil unless the field is an array
+}
+
+func (sf *StructField) String() string {
+	return fmt.Sprintf("%s %s", sf.Name, typeString(sf.Type, sf.Length))
+}
+
+// ConstStatement names a compile-time constant: Const NAME = value
+type ConstStatement struct {
+	Token   lexer.Token // the constant name
+	Private bool        // hidden from the other files of the program
+	Name    string
+	Value   Expression
+}
+
+func (cs *ConstStatement) statementNode() {}
+func (cs *ConstStatement) String() string {
+	return fmt.Sprintf("%sConst %s = %s", visibilityPrefix(cs.Private), cs.Name, cs.Value.String())
 }
 
 type CallStatement struct {
+	Token     lexer.Token // the function name
+	Receiver  Expression  // set for method calls: receiver.Function(args)
 	Function  string
 	Arguments []Expression
 }
 
 func (cs *CallStatement) statementNode() {}
 func (cs *CallStatement) String() string {
+	return callString(cs.Receiver, cs.Function, cs.Arguments)
+}
+
+// callString renders a call, with the receiver of a method call
+func callString(receiver Expression, function string, arguments []Expression) string {
 	var args string
-	for i, arg := range cs.Arguments {
+	for i, arg := range arguments {
 		if i > 0 {
 			args += ", "
 		}
 		args += arg.String()
 	}
-	return fmt.Sprintf("%s(%s)", cs.Function, args)
+	if receiver != nil {
+		return fmt.Sprintf("%s.%s(%s)", receiver.String(), function, args)
+	}
+	return fmt.Sprintf("%s(%s)", function, args)
+}
+
+// ForStatement is a C-style loop: For (init; condition; post) { body }
+type ForStatement struct {
+	Label     string     // set by "name: For ...", for Break(name) and Continue(name)
+	Init      Statement  // may be nil
+	Condition Expression // may be nil (loop forever)
+	Post      Statement  // may be nil
+	Body      *BlockStatement
+}
+
+func (fs *ForStatement) statementNode() {}
+func (fs *ForStatement) String() string {
+	var init, cond, post string
+	if fs.Init != nil {
+		init = fs.Init.String()
+	}
+	if fs.Condition != nil {
+		cond = fs.Condition.String()
+	}
+	if fs.Post != nil {
+		post = fs.Post.String()
+	}
+	return fmt.Sprintf("%sFor (%s; %s; %s) %s", labelPrefix(fs.Label), init, cond, post, fs.Body.String())
+}
+
+// labelPrefix renders the label of a loop
+func labelPrefix(label string) string {
+	if label == "" {
+		return ""
+	}
+	return label + ": "
+}
+
+// BranchStatement leaves or restarts a loop: Break(), Continue(), or
+// Break(label) for an enclosing loop that carries the label
+type BranchStatement struct {
+	Token lexer.Token // the Break or Continue keyword
+	Label string      // empty for the innermost loop
+}
+
+func (bs *BranchStatement) statementNode() {}
+func (bs *BranchStatement) String() string {
+	return fmt.Sprintf("%s(%s)", bs.Token.Literal, bs.Label)
+}
+
+// DoWhileStatement runs Body once, then again while Condition is non-zero:
+// Do { body } While (condition)
+type DoWhileStatement struct {
+	Token     lexer.Token // the While keyword
+	Label     string      // set by "name: Do ..."
+	Body      *BlockStatement
+	Condition Expression
+}
+
+func (ds *DoWhileStatement) statementNode() {}
+func (ds *DoWhileStatement) String() string {
+	return fmt.Sprintf("%sDo %s While (%s)", labelPrefix(ds.Label), ds.Body.String(), ds.Condition.String())
+}
+
+// IfStatement runs the body of the first branch whose condition is non-zero,
+// or Else when none is: If (a) { } Else If (b) { } Else { }
+type IfStatement struct {
+	Branches []*IfBranch
+	Else     *BlockStatement // may be nil
+}
+
+func (is *IfStatement) statementNode() {}
+func (is *IfStatement) String() string {
+	var out string
+	for i, b := range is.Branches {
+		if i > 0 {
+			out += " Else "
+		}
+		out += fmt.Sprintf("If (%s) %s", b.Condition.String(), b.Body.String())
+	}
+	if is.Else != nil {
+		out += " Else " + is.Else.String()
+	}
+	return out
+}
+
+// IfBranch is the If or one of the Else If arms of an IfStatement
+type IfBranch struct {
+	Token     lexer.Token // the If keyword
+	Condition Expression
+	Body      *BlockStatement
+}
+
+// MatchStatement selects the first case whose value equals Value
+type MatchStatement struct {
+	Token   lexer.Token // the Match keyword
+	Value   Expression
+	Cases   []*MatchCase
+	Default *BlockStatement // may be nil
+}
+
+func (ms *MatchStatement) statementNode() {}
+func (ms *MatchStatement) String() string {
+	out := fmt.Sprintf("Match (%s) {", ms.Value.String())
+	for _, c := range ms.Cases {
+		out += c.String()
+	}
+	if ms.Default != nil {
+		out += "Default " + ms.Default.String()
+	}
+	out += "}"
+	return out
+}
+
+// MatchCase is one `Case v1, v2 { ... }` arm; values are integer literals
+type MatchCase struct {
+	Values []Expression
+	Body   *BlockStatement
+}
+
+func (mc *MatchCase) String() string {
+	var values string
+	for i, v := range mc.Values {
+		if i > 0 {
+			values += ", "
+		}
+		values += v.String()
+	}
+	return fmt.Sprintf("Case %s %s", values, mc.Body.String())
 }
 
 // Expressions
@@ -122,7 +427,28 @@ type StringLiteral struct {
 
 func (sl *StringLiteral) expressionNode() {}
 func (sl *StringLiteral) String() string {
-	return fmt.Sprintf("'%s'", sl.Value)
+	return lexer.Quote(sl.Value)
+}
+
+// CharLiteral is a single character in single quotes, such as 'a' or '\n'
+type CharLiteral struct {
+	Token lexer.Token // Literal holds the text between the quotes
+	Value byte
+}
+
+func (cl *CharLiteral) expressionNode() {}
+func (cl *CharLiteral) String() string {
+	return lexer.Quote(string([]byte{cl.Value}))
+}
+
+// NilLiteral is nil, the value of an optional type that holds no value
+type NilLiteral struct {
+	Token lexer.Token
+}
+
+func (nl *NilLiteral) expressionNode() {}
+func (nl *NilLiteral) String() string {
+	return "nil"
 }
 
 type IntegerLiteral struct {
@@ -134,7 +460,22 @@ func (il *IntegerLiteral) String() string {
 	return fmt.Sprintf("%d", il.Value)
 }
 
+// FloatLiteral is a number with a fractional part, such as 3.14
+type FloatLiteral struct {
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode() {}
+func (fl *FloatLiteral) String() string {
+	s := strconv.FormatFloat(fl.Value, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
+
 type Identifier struct {
+	Token lexer.Token
 	Value string
 }
 
@@ -144,23 +485,153 @@ func (i *Identifier) String() string {
 }
 
 type CallExpression struct {
+	Token     lexer.Token // the function name
+	Receiver  Expression  // set for method calls: receiver.Function(args)
 	Function  string
 	Arguments []Expression
 }
 
 func (ce *CallExpression) expressionNode() {}
 func (ce *CallExpression) String() string {
-	var args string
-	for i, arg := range ce.Arguments {
+	return callString(ce.Receiver, ce.Function, ce.Arguments)
+}
+
+// ArrayLiteral lists the elements of a fixed-size array: [1, 2, 3]
+// TupleLiteral is an anonymous tuple of two or more values: (1, 'a')
+type TupleLiteral struct {
+	Token    lexer.Token // the (
+	Elements []Expression
+}
+
+func (tl *TupleLiteral) expressionNode() {}
+func (tl *TupleLiteral) String() string {
+	var elements string
+	for i, element := range tl.Elements {
 		if i > 0 {
-			args += ", "
+			elements += ", "
 		}
-		args += arg.String()
+		elements += element.String()
+	}
+	return fmt.Sprintf("(%s)", elements)
+}
+
+type ArrayLiteral struct {
+	Token    lexer.Token // the [
+	Elements []Expression
+}
+
+func (al *ArrayLiteral) expressionNode() {}
+func (al *ArrayLiteral) String() string {
+	var elements string
+	for i, element := range al.Elements {
+		if i > 0 {
+			elements += ", "
+		}
+		elements += element.String()
+	}
+	return fmt.Sprintf("[%s]", elements)
+}
+
+// IndexExpression reads one element of an array variable, or one byte of a
+// string: name[index]. The array may also be a field: name.field[index].
+type IndexExpression struct {
+	Token lexer.Token // the [
+	Array Expression  // an *Identifier or a *FieldExpression
+	Index Expression
+}
+
+func (ie *IndexExpression) expressionNode() {}
+func (ie *IndexExpression) String() string {
+	return fmt.Sprintf("%s[%s]", ie.Array.String(), ie.Index.String())
+}
+
+// SliceExpression takes part of a string: name[start:end], where either
+// bound may be left out to mean the start or the end of the string
+type SliceExpression struct {
+	Token lexer.Token // the [
+	Array Expression  // an *Identifier or a *FieldExpression
+	Start Expression  // nil for 0
+	End   Expression  // nil for the length of the string
+}
+
+func (se *SliceExpression) expressionNode() {}
+func (se *SliceExpression) String() string {
+	var start, end string
+	if se.Start != nil {
+		start = se.Start.String()
+	}
+	if se.End != nil {
+		end = se.End.String()
+	}
+	return fmt.Sprintf("%s[%s:%s]", se.Array.String(), start, end)
+}
+
+// StructLiteral builds a struct value: Point{x: 1, y: 2}. Fields left out
+// hold their zero value.
+type StructLiteral struct {
+	Token  lexer.Token // the struct name
+	Name   string
+	Fields []*FieldValue
+}
+
+func (sl *StructLiteral) expressionNode() {}
+func (sl *StructLiteral) String() string {
+	var fields string
+	for i, f := range sl.Fields {
+		if i > 0 {
+			fields += ", "
+		}
+		fields += fmt.Sprintf("%s: %s", f.Name, f.Value.String())
 	}
-	return fmt.Sprintf("%s(%s)", ce.Function, args)
+	return fmt.Sprintf("%s{%s}", sl.Name, fields)
+}
+
+// FieldValue sets one field in a struct literal: name: value
+type FieldValue struct {
+	Token lexer.Token // the field name
+	Name  string
+	Value Expression
+}
+
+// FieldExpression reads one field of a struct: name.field. Fields of nested
+// structs chain: line.start.x.
+type FieldExpression struct {
+	Token  lexer.Token // the field name
+	Struct Expression  // an *Identifier or another *FieldExpression
+	Field  string
+}
+
+func (fe *FieldExpression) expressionNode() {}
+func (fe *FieldExpression) String() string {
+	return fmt.Sprintf("%s.%s", fe.Struct.String(), fe.Field)
+}
+
+// TypeExpression names a type where an expression is expected, as in the
+// argument of SizeOf(Int[4])
+type TypeExpression struct {
+	Token  lexer.Token
+	Name   string
+	Length Expression // nil unless the type is an array
+}
+
+func (te *TypeExpression) expressionNode() {}
+func (te *TypeExpression) String() string {
+	return typeString(te.Name, te.Length)
+}
+
+type PrefixExpression struct {
+	Token    lexer.Token // the operator
+	Operator string
+	Right    Expression
+}
+
+func (pe *PrefixExpression) expressionNode() {}
+func (pe *PrefixExpression) String() string {
+	return fmt.Sprintf("(%s%s)", pe.Operator, pe.Right.String())
 }
 
 type InfixExpression struct {
+	Token    lexer.Token // the operator
 	Left     Expression
 	Operator string
 	Right    Expression
@@ -171,6 +642,63 @@ func (ie *InfixExpression) String() string {
 	return fmt.Sprintf("(%s %s %s)", ie.Left.String(), ie.Operator, ie.Right.String())
 }
 
+// Diagnostic is a compiler error tied to a position in the source
+type Diagnostic struct {
+	File    string // set for errors in a file other than the one compiled
+	Line    int
+	Column  int
+	Code    string
+	Message string
+	Fix     *Fix // set when the error has one obvious correction
+	Warning bool // set when the program still compiles
+}
+
+func (d Diagnostic) String() string {
+	if d.File != "" {
+		return fmt.Sprintf("%s:%d:%d: %s: %s", d.File, d.Line, d.Column, d.Code, d.Message)
+	}
+	return fmt.Sprintf("%d:%d: %s: %s", d.Line, d.Column, d.Code, d.Message)
+}
+
+// Fix is an edit that corrects a diagnostic: Old, the text at Line:Column,
+// becomes New. An empty Old inserts New there.
+type Fix struct {
+	Line   int
+	Column int
+	Old    string
+	New    string
+}
+
+func (f Fix) String() string {
+	if f.Old == "" {
+		return fmt.Sprintf("insert %q at %d:%d", f.New, f.Line, f.Column)
+	}
+	return fmt.Sprintf("replace %q with %q at %d:%d", f.Old, f.New, f.Line, f.Column)
+}
+
+// Diagnostic codes reported by the parser. Codes are never reused, so tests
+// and tools can rely on them even when the wording of a message changes.
+const (
+	ErrUnexpectedToken  = "E001"
+	ErrMissingOperand   = "E002"
+	ErrInvalidInteger   = "E003"
+	ErrMultipleEntry    = "E004"
+	ErrDuplicateCase    = "E005"
+	ErrMultipleDefault  = "E006"
+	ErrInvalidMatchArm  = "E007"
+	ErrInvalidCaseValue = "E008"
+	ErrMissingType      = "E009"
+	ErrInvalidAttribute = "E010"
+	ErrInvalidVariadic  = "E011"
+	ErrUnknownType      = "E012"
+	ErrTypeParameter    = "E013"
+	ErrModule           = "E014"
+	ErrVisibility       = "E015"
+	ErrPragma           = "E016"
+	ErrUnclosedComment  = "E017"
+	ErrStatementEnd     = "E018"
+)
+
 // Parser
 type Parser struct {
 	l *lexer.Lexer
@@ -178,13 +706,20 @@ type Parser struct {
 	curToken  lexer.Token
 	peekToken lexer.Token
 
-	errors []string
+	diagnostics []Diagnostic
+
+	// typeNames are the names used as types that spell a type keyword in
+	// the wrong case, which are errors unless a struct has that name
+	typeNames []lexer.Token
+
+	// typeParameters are those of the generic function being parsed
+	typeParameters []string
 }
 
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
-		l:      l,
-		errors: []string{},
+		l:           l,
+		diagnostics: []Diagnostic{},
 	}
 
 	// Read two tokens, so curToken and peekToken are both set
@@ -199,8 +734,33 @@ func (p *Parser) nextToken() {
 	p.peekToken = p.l.NextToken()
 }
 
+// Errors returns the diagnostics rendered as "line:column: code: message"
 func (p *Parser) Errors() []string {
-	return p.errors
+	errors := make([]string, len(p.diagnostics))
+	for i, d := range p.diagnostics {
+		errors[i] = d.String()
+	}
+	return errors
+}
+
+func (p *Parser) Diagnostics() []Diagnostic {
+	return p.diagnostics
+}
+
+// errorAt records a diagnostic at the position of tok
+func (p *Parser) errorAt(tok lexer.Token, code string, format string, args ...interface{}) {
+	p.diagnostics = append(p.diagnostics, Diagnostic{
+		File:    tok.File,
+		Line:    tok.Line,
+		Column:  tok.Column,
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// fix attaches a correction to the diagnostic recorded last
+func (p *Parser) fix(f Fix) {
+	p.diagnostics[len(p.diagnostics)-1].Fix = &f
 }
 
 func (p *Parser) ParseProgram() *Program {
@@ -213,6 +773,11 @@ func (p *Parser) ParseProgram() *Program {
 			p.nextToken()
 			continue
 		}
+		if p.curToken.Type == lexer.HASH {
+			p.parsePragma(program)
+			p.nextToken()
+			continue
+		}
 
 		stmt := p.parseStatement()
 		if stmt != nil {
@@ -221,15 +786,121 @@ func (p *Parser) ParseProgram() *Program {
 		p.nextToken()
 	}
 
+	p.checkSingleEntry(program)
+	p.checkTypeNames(program)
+	p.checkModule(program)
+	p.checkComments()
+
 	return program
 }
 
+// checkComments reports a block comment still open at the end of the input,
+// which would otherwise hide everything after it without a word
+func (p *Parser) checkComments() {
+	c, ok := p.l.UnclosedComment()
+	if !ok {
+		return
+	}
+	if c.Depth == 1 {
+		p.errorAt(c.Comment, ErrUnclosedComment, "comment is never closed: end it with */")
+		return
+	}
+	p.errorAt(c.Comment, ErrUnclosedComment, "comment is never closed: comments nest, so it needs %d */, one for each /* still open", c.Depth)
+}
+
+// checkTypeNames reports the type names that no struct, interface or alias
+// declares but a type keyword spells in another case, as in Var n int
+func (p *Parser) checkTypeNames(program *Program) {
+	structs := make(map[string]bool)
+	for _, stmt := range program.Statements {
+		switch s := stmt.(type) {
+		case *StructStatement:
+			structs[s.Name] = true
+		case *InterfaceStatement:
+			structs[s.Name] = true
+		case *TypeAliasStatement:
+			structs[s.Name] = true
+		}
+	}
+	for _, tok := range p.typeNames {
+		if !structs[tok.Literal] {
+			p.unknownType(tok)
+		}
+	}
+}
+
+// unknownType reports tok, an identifier where a type belongs, and suggests
+// the type keyword it spells in another case. It reports nothing, and
+// returns false, for any other token.
+func (p *Parser) unknownType(tok lexer.Token) bool {
+	if tok.Type != lexer.IDENT {
+		return false
+	}
+	keyword, typ, ok := lexer.FoldKeyword(tok.Literal)
+	if !ok || !isScalarType(typ) {
+		return false
+	}
+	p.errorAt(tok, ErrUnknownType, "unknown type %s, did you mean %s?", tok.Literal, keyword)
+	p.fix(Fix{Line: tok.Line, Column: tok.Column, Old: tok.Literal, New: keyword})
+	return true
+}
+
+// checkModule reports a Module declaration that is not the first one in the
+// file
+func (p *Parser) checkModule(program *Program) {
+	for i, stmt := range program.Statements {
+		if m, ok := stmt.(*ModuleStatement); ok && i > 0 {
+			p.errorAt(m.Token, ErrModule, "Module %s must come before every other declaration", m.Name)
+		}
+	}
+}
+
+// checkSingleEntry reports programs declaring more than one Entry function
+func (p *Parser) checkSingleEntry(program *Program) {
+	var entry string
+	for _, stmt := range program.Statements {
+		funcStmt, ok := stmt.(*FunctionStatement)
+		if !ok || !funcStmt.IsEntry {
+			continue
+		}
+		if entry != "" {
+			p.errorAt(funcStmt.Token, ErrMultipleEntry, "multiple Entry functions: %s and %s", entry, funcStmt.Name)
+			continue
+		}
+		entry = funcStmt.Name
+	}
+}
+
 func (p *Parser) parseStatement() Statement {
 	switch p.curToken.Type {
 	case lexer.ENTRY:
 		return p.parseFunctionStatement(true)
 	case lexer.FUNCTION:
 		return p.parseFunctionStatement(false)
+	case lexer.AT:
+		return p.parseAnnotatedStatement()
+	case lexer.CONST:
+		return p.parseConstStatement()
+	case lexer.VAR:
+		return p.parseVarStatement()
+	case lexer.STRUCT:
+		return p.parseStructStatement()
+	case lexer.INTERFACE:
+		return p.parseInterfaceStatement()
+	case lexer.TYPE:
+		return p.parseTypeAliasStatement()
+	case lexer.PUBLIC, lexer.PRIVATE:
+		return p.parseVisibleStatement()
+	case lexer.MODULE:
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		return &ModuleStatement{Token: p.curToken, Name: p.curToken.Literal}
+	case lexer.IMPORT:
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		return &ImportStatement{Token: p.curToken, Name: p.curToken.Literal}
 	default:
 		return p.parseBlockStatement()
 	}
@@ -237,15 +908,33 @@ func (p *Parser) parseStatement() Statement {
 
 func (p *Parser) parseFunctionStatement(isEntry bool) Statement {
 	stmt := &FunctionStatement{
+		Token:   p.curToken,
 		IsEntry: isEntry,
 	}
 
+	if !isEntry && p.peekToken.Type == lexer.LPAREN {
+		stmt.Receiver = p.parseReceiver()
+		if stmt.Receiver == nil {
+			return nil
+		}
+	}
+
 	if !p.expectPeek(lexer.IDENT) {
 		return nil
 	}
 
+	stmt.NameToken = p.curToken
 	stmt.Name = p.curToken.Literal
 
+	if !isEntry && stmt.Receiver == nil && p.peekToken.Type == lexer.LBRACKET {
+		p.nextToken()
+		if !p.parseTypeParameters(stmt) {
+			return nil
+		}
+		p.typeParameters = stmt.TypeParameters
+		defer func() { p.typeParameters = nil }()
+	}
+
 	if !p.expectPeek(lexer.LPAREN) {
 		return nil
 	}
@@ -257,36 +946,75 @@ func (p *Parser) parseFunctionStatement(isEntry bool) Statement {
 		return nil
 	}
 
-	// Handle return type - three possible syntaxes:
-	// 1. () (Type)  - parenthesized return type
-	// 2. () Type    - bare return type
-	// 3. () {       - no return type (defaults to Void)
+	if !p.parseReturnType(&stmt.ReturnType) {
+		return nil
+	}
+
+	if !p.expectPeek(lexer.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStatement()
+
+	return stmt
+}
+
+// parseReturnType parses the return type after the parameters of a
+// function, if it has one. There are three possible syntaxes:
+// 1. () (Type)  - parenthesized return type, or a tuple: (Type, Type)
+// 2. () Type    - bare return type
+// 3. () {       - no return type (defaults to Void)
+func (p *Parser) parseReturnType(typ *string) bool {
 	if p.peekToken.Type == lexer.LPAREN {
 		// Syntax: () (Type)
 		p.nextToken() // consume LPAREN
-		if !p.expectPeek(lexer.INT_TYPE) && !p.expectPeek(lexer.STRING_TYPE) && !p.expectPeek(lexer.VOID_TYPE) {
-			return nil
+		if !isScalarType(p.peekToken.Type) && p.peekToken.Type != lexer.VOID_TYPE && !p.isTypeParameter(p.peekToken) && !p.unknownType(p.peekToken) && p.peekToken.Type != lexer.IDENT {
+			p.peekError(lexer.INT_TYPE)
+			return false
 		}
-		stmt.ReturnType = p.curToken.Literal
-		if !p.expectPeek(lexer.RPAREN) {
-			return nil
+		if p.peekToken.Type == lexer.VOID_TYPE || p.peekToken.Type == lexer.IDENT {
+			p.nextToken()
+			*typ = p.curToken.Literal
+			return p.expectPeek(lexer.RPAREN)
 		}
-	} else if p.peekToken.Type == lexer.INT_TYPE || p.peekToken.Type == lexer.STRING_TYPE || p.peekToken.Type == lexer.VOID_TYPE {
+		return p.parseTupleType(typ)
+	} else if isScalarType(p.peekToken.Type) || p.peekToken.Type == lexer.VOID_TYPE || p.isTypeParameter(p.peekToken) {
 		// Syntax: () Type
 		p.nextToken()
-		stmt.ReturnType = p.curToken.Literal
+		*typ = p.curToken.Literal
+		p.parseOptional(typ)
+		return p.parseSlice(typ)
+	} else if p.unknownType(p.peekToken) {
+		p.nextToken()
+		*typ = p.curToken.Literal
+	} else if p.peekToken.Type == lexer.IDENT && p.peekToken.Line == p.curToken.Line {
+		// A struct, interface or alias: () Name
+		p.nextToken()
+		*typ = p.curToken.Literal
+		p.parseOptional(typ)
+		return p.parseSlice(typ)
 	} else {
 		// No return type specified, default to Void
-		stmt.ReturnType = "Void"
+		*typ = "Void"
 	}
+	return true
+}
 
-	if !p.expectPeek(lexer.LBRACE) {
+// parseReceiver parses the (name Type) before the name of a method
+func (p *Parser) parseReceiver() *Parameter {
+	p.nextToken()
+	if !p.expectPeek(lexer.IDENT) {
 		return nil
 	}
-
-	stmt.Body = p.parseBlockStatement()
-
-	return stmt
+	receiver := &Parameter{Token: p.curToken, Name: p.curToken.Literal}
+	if !p.expectPeek(lexer.IDENT) {
+		return nil
+	}
+	receiver.Type = p.curToken.Literal
+	if !p.expectPeek(lexer.RPAREN) {
+		return nil
+	}
+	return receiver
 }
 
 func (p *Parser) parseParameters() []*Parameter {
@@ -306,10 +1034,17 @@ func (p *Parser) parseParameters() []*Parameter {
 		parameters = append(parameters, param)
 	}
 
-	// Parse remaining parameters
+	// Parse remaining parameters; a comma may follow the last one
 	for p.peekToken.Type == lexer.COMMA {
 		p.nextToken() // consume the comma
+		if p.peekToken.Type == lexer.RPAREN {
+			break
+		}
 		p.nextToken() // move to next parameter
+		// Only the last parameter can take the extra arguments
+		if n := len(parameters); n > 0 && parameters[n-1].Variadic {
+			p.errorAt(p.curToken, ErrInvalidVariadic, "variadic parameter %s must be the last one", parameters[n-1].Name)
+		}
 		param := p.parseParameter()
 		if param != nil {
 			parameters = append(parameters, param)
@@ -319,40 +1054,111 @@ func (p *Parser) parseParameters() []*Parameter {
 	return parameters
 }
 
+// parseTypeParameters parses the [T, U] after the name of a generic
+// function
+func (p *Parser) parseTypeParameters(stmt *FunctionStatement) bool {
+	for {
+		if !p.expectPeek(lexer.IDENT) {
+			return false
+		}
+		for _, name := range stmt.TypeParameters {
+			if name == p.curToken.Literal {
+				p.errorAt(p.curToken, ErrTypeParameter, "type parameter %s is declared twice", name)
+			}
+		}
+		stmt.TypeParameters = append(stmt.TypeParameters, p.curToken.Literal)
+		if p.peekToken.Type != lexer.COMMA {
+			break
+		}
+		p.nextToken()
+	}
+	return p.expectPeek(lexer.RBRACKET)
+}
+
+// isTypeParameter reports whether tok names a type parameter of the
+// function being parsed
+func (p *Parser) isTypeParameter(tok lexer.Token) bool {
+	if tok.Type != lexer.IDENT {
+		return false
+	}
+	for _, name := range p.typeParameters {
+		if name == tok.Literal {
+			return true
+		}
+	}
+	return false
+}
+
 func (p *Parser) parseParameter() *Parameter {
 	// Support syntax: Type name (e.g., "String input_str")
-	if p.curToken.Type == lexer.STRING_TYPE || p.curToken.Type == lexer.INT_TYPE {
+	if isScalarType(p.curToken.Type) || p.isTypeParameter(p.curToken) && !p.isTypeParameter(p.peekToken) && !isScalarType(p.peekToken.Type) {
 		param := &Parameter{
 			Type: p.curToken.Literal,
 		}
+		p.parseOptional(&param.Type)
+		if !p.parseSlice(&param.Type) {
+			return nil
+		}
+		p.parseVariadic(param)
 
 		if !p.expectPeek(lexer.IDENT) {
 			return nil
 		}
 
+		param.Token = p.curToken
 		param.Name = p.curToken.Literal
 		return param
 	}
 
-	// Support syntax: name Type (e.g., "input_str String")
+	// Support syntax: name Type (e.g., "input_str String"), where Type may
+	// also name an interface
 	if p.curToken.Type == lexer.IDENT {
 		param := &Parameter{
-			Name: p.curToken.Literal,
+			Token: p.curToken,
+			Name:  p.curToken.Literal,
 		}
 
-		if !p.expectPeek(lexer.STRING_TYPE) && !p.expectPeek(lexer.INT_TYPE) {
+		if !isScalarType(p.peekToken.Type) && !p.isTypeParameter(p.peekToken) && !p.unknownType(p.peekToken) && p.peekToken.Type != lexer.IDENT {
+			p.peekError(lexer.INT_TYPE)
 			return nil
 		}
+		p.nextToken()
 
 		param.Type = p.curToken.Literal
+		p.parseOptional(&param.Type)
+		if !p.parseSlice(&param.Type) {
+			return nil
+		}
+		p.parseVariadic(param)
 		return param
 	}
 
 	return nil
 }
 
+// parseVariadic parses the ... that may follow a parameter's type. The
+// parameter then holds a slice of that type.
+func (p *Parser) parseVariadic(param *Parameter) {
+	if p.peekToken.Type != lexer.ELLIPSIS {
+		return
+	}
+	p.nextToken()
+	if strings.HasSuffix(param.Type, "[]") {
+		p.errorAt(p.curToken, ErrInvalidVariadic, "variadic parameter cannot be a slice of %s", param.Type)
+		return
+	}
+	param.Type += "[]"
+	param.Variadic = true
+}
+
+// isScalarType reports whether t names a type whose values fit in a
+// register: Int, Float, Char or String
+func isScalarType(t lexer.TokenType) bool {
+	return t == lexer.INT_TYPE || t == lexer.FLOAT_TYPE || t == lexer.CHAR_TYPE || t == lexer.STRING_TYPE
+}
+
 func (p *Parser) parseBlockStatement() *BlockStatement {
-	block := &BlockStatement{}
+	block := &BlockStatement{Token: p.curToken}
 	block.Statements = []Statement{}
 
 	p.nextToken()
@@ -364,186 +1170,1212 @@ func (p *Parser) parseBlockStatement() *BlockStatement {
 			continue
 		}
 
+		// A ; ends the statement before it, so another can follow on its line
+		if p.curToken.Type == lexer.SEMICOLON {
+			p.nextToken()
+			continue
+		}
+
+		// Only a block opened by { holds statements; the parser also
+		// reads one from a stray token at file scope to skip past it
+		reported := len(p.diagnostics)
 		stmt := p.parseInnerStatement()
-		if stmt != nil {
+		switch {
+		case block.Token.Type != lexer.LBRACE:
+			if stmt != nil {
+				block.Statements = append(block.Statements, stmt)
+			}
+		case stmt != nil:
 			block.Statements = append(block.Statements, stmt)
+			p.checkStatementEnd()
+		case len(p.diagnostics) == reported:
+			p.notStatement()
+		default:
+			// The rest of a line the parser lost its way on would only
+			// add errors of its own
+			p.skipStatement()
 		}
 		p.nextToken()
 	}
+	block.End = p.curToken
 
 	return block
 }
 
+// checkStatementEnd reports a statement that follows the one just parsed
+// on the same line: a statement ends at the end of its line, or at a ;
+func (p *Parser) checkStatementEnd() {
+	switch p.peekToken.Type {
+	case lexer.SEMICOLON, lexer.RBRACE, lexer.EOF, lexer.COMMENT:
+		return
+	}
+	if p.peekToken.Line > p.curToken.Line {
+		return
+	}
+	p.errorAt(p.peekToken, ErrStatementEnd, "expected the end of the statement, got %s: statements on the same line must be separated by ;", p.peekToken.Type)
+	p.fix(Fix{Line: p.curToken.Line, Column: p.curToken.End, New: ";"})
+}
+
+// notStatement reports a line that starts with a token no statement starts
+// with, explaining the two ways an expression split across lines goes
+// wrong, and skips the rest of the statement
+func (p *Parser) notStatement() {
+	tok := p.curToken
+	_, operator := precedences[tok.Type]
+	switch {
+	case tok.Type == lexer.LPAREN:
+		p.errorAt(tok, ErrStatementEnd, "expected a statement, got (: a ( at the start of a line begins a new statement; to call a function, write ( on the same line as its name")
+	case operator:
+		p.errorAt(tok, ErrStatementEnd, "expected a statement, got %s: an operator at the start of a line does not continue the line before; end that line with the operator instead", tok.Literal)
+	default:
+		p.errorAt(tok, ErrStatementEnd, "expected a statement, got %s", tok.Type)
+	}
+	p.skipStatement()
+}
+
+// skipStatement moves to the last token of the current statement: the last
+// on the line before a ;, a brace or the end of the input
+func (p *Parser) skipStatement() {
+	for p.peekToken.Line == p.curToken.Line {
+		switch p.peekToken.Type {
+		case lexer.SEMICOLON, lexer.LBRACE, lexer.RBRACE, lexer.EOF:
+			return
+		}
+		p.nextToken()
+	}
+}
+
+// skipBody moves past the { } body of a declaration that starts on the
+// current line, whose fields are not statements
+func (p *Parser) skipBody() {
+	for p.peekToken.Type != lexer.LBRACE {
+		if p.peekToken.Line != p.curToken.Line || p.peekToken.Type == lexer.EOF {
+			return
+		}
+		p.nextToken()
+	}
+	depth := 0
+	for p.peekToken.Type != lexer.EOF {
+		p.nextToken()
+		switch p.curToken.Type {
+		case lexer.LBRACE:
+			depth++
+		case lexer.RBRACE:
+			if depth--; depth == 0 {
+				return
+			}
+		}
+	}
+}
+
 func (p *Parser) parseInnerStatement() Statement {
 	switch p.curToken.Type {
 	case lexer.IDENT:
-		if p.peekToken.Type == lexer.ASSIGN {
+		if p.peekToken.Type == lexer.COLON {
+			return p.parseLabeledLoop()
+		}
+		switch p.peekToken.Type {
+		case lexer.ASSIGN, lexer.LBRACKET:
 			return p.parseAssignStatement()
-		} else if p.peekToken.Type == lexer.LPAREN {
+		case lexer.DOT:
+			return p.parseFieldStatement()
+		case lexer.LPAREN:
 			// This is a function call statement
 			return p.parseCallStatement()
 		}
 		return nil
 	case lexer.PRINT, lexer.RETURN:
 		return p.parseCallStatement()
+	case lexer.TRY:
+		if p.peekToken.Type == lexer.LBRACE {
+			return p.parseTryStatement()
+		}
+		return p.parseCallStatement()
+	case lexer.CATCH:
+		p.errorAt(p.curToken, ErrUnexpectedToken, "Catch without Try")
+		p.skipCatch()
+		return nil
+	case lexer.FOR:
+		return p.parseForStatement()
+	case lexer.MATCH:
+		return p.parseMatchStatement()
+	case lexer.VAR:
+		return p.parseVarStatement()
+	case lexer.CONST:
+		return p.parseConstStatement()
+	case lexer.IF:
+		return p.parseIfStatement()
+	case lexer.ELSE:
+		p.errorAt(p.curToken, ErrUnexpectedToken, "Else without If")
+		return nil
+	case lexer.DO:
+		return p.parseDoWhileStatement()
+	case lexer.BREAK, lexer.CONTINUE:
+		return p.parseBranchStatement()
+	case lexer.WHILE:
+		p.errorAt(p.curToken, ErrUnexpectedToken, "While without Do")
+		return nil
+	case lexer.AT:
+		p.errorAt(p.curToken, ErrInvalidAttribute, "attributes are only allowed on functions and global variables")
+		return nil
+	case lexer.STRUCT, lexer.INTERFACE, lexer.TYPE:
+		p.errorAt(p.curToken, ErrUnexpectedToken, "%s is only allowed at file scope", p.curToken.Literal)
+		p.skipBody()
+		return nil
+	case lexer.PUBLIC, lexer.PRIVATE:
+		// The declaration that follows is parsed as if the keyword were not there
+		p.errorAt(p.curToken, ErrVisibility, "%s is only allowed at file scope", p.curToken.Literal)
+		return nil
+	case lexer.LBRACE:
+		// A bare block, which only opens a new scope
+		return p.parseBlockStatement()
+	case lexer.LPAREN:
+		if p.peekToken.Type == lexer.IDENT {
+			return p.parseDestructureStatement()
+		}
+		return nil
 	default:
 		return nil
 	}
 }
 
-func (p *Parser) parseAssignStatement() Statement {
-	stmt := &AssignStatement{}
-	stmt.Name = p.curToken.Literal
+// parseDestructureStatement parses (a, b) = value
+func (p *Parser) parseDestructureStatement() Statement {
+	stmt := &DestructureStatement{Token: p.curToken}
+	for {
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		stmt.Names = append(stmt.Names, p.curToken.Literal)
+		if p.peekToken.Type != lexer.COMMA {
+			break
+		}
+		p.nextToken()
+	}
+	if !p.expectPeek(lexer.RPAREN) || !p.expectPeek(lexer.ASSIGN) {
+		return nil
+	}
+	stmt.Value = p.parseValue("(" + strings.Join(stmt.Names, ", ") + ")")
+	if stmt.Value == nil {
+		return nil
+	}
+	return stmt
+}
 
-	if !p.expectPeek(lexer.ASSIGN) {
+func (p *Parser) parseConstStatement() Statement {
+	if !p.expectPeek(lexer.IDENT) {
 		return nil
 	}
+	stmt := &ConstStatement{Token: p.curToken, Name: p.curToken.Literal}
 
-	p.nextToken()
-	stmt.Value = p.parseExpression()
+	if !p.expectPeek(lexer.ASSIGN) {
+		return nil
+	}
+	stmt.Value = p.parseValue("Const " + stmt.Name)
+	if stmt.Value == nil {
+		return nil
+	}
 
 	return stmt
 }
 
-func (p *Parser) parseCallStatement() Statement {
-	stmt := &CallStatement{}
-	stmt.Function = p.curToken.Literal
-
-	if !p.expectPeek(lexer.LPAREN) {
+func (p *Parser) parseVarStatement() Statement {
+	if !p.expectPeek(lexer.IDENT) {
 		return nil
 	}
+	stmt := &VarStatement{Token: p.curToken, Name: p.curToken.Literal}
 
-	stmt.Arguments = p.parseArgumentList()
-
-	if !p.expectPeek(lexer.RPAREN) {
+	if !p.parseType("Var "+stmt.Name, &stmt.Type, &stmt.Length) {
 		return nil
 	}
 
+	if p.peekToken.Type == lexer.ASSIGN {
+		p.nextToken()
+		stmt.Value = p.parseValue("Var " + stmt.Name + " " + stmt.Type)
+		if stmt.Value == nil {
+			return nil
+		}
+	}
+
 	return stmt
 }
 
-func (p *Parser) parseArgumentList() []Expression {
-	args := []Expression{}
-
-	// If the next token is RPAREN, there are no arguments
-	if p.peekToken.Type == lexer.RPAREN {
-		return args
+// parseType parses the type after what, a variable or field: Int, String or
+// a struct name, optionally made optional with ? or followed by an array
+// length or the empty brackets of a slice, the same array written as
+// Array[Type, length], or a tuple type such as (Int, String). It reports a
+// missing or malformed type.
+func (p *Parser) parseType(what string, name *string, length *Expression) bool {
+	switch p.peekToken.Type {
+	case lexer.INT_TYPE, lexer.FLOAT_TYPE, lexer.CHAR_TYPE, lexer.STRING_TYPE, lexer.IDENT:
+		p.nextToken()
+		*name = p.curToken.Literal
+		if _, typ, ok := lexer.FoldKeyword(*name); ok && p.curToken.Type == lexer.IDENT && isScalarType(typ) {
+			p.typeNames = append(p.typeNames, p.curToken)
+		}
+		p.parseOptional(name)
+	case lexer.ARRAY:
+		p.nextToken()
+		return p.parseArrayType(name, length)
+	case lexer.LPAREN:
+		p.nextToken()
+		return p.parseTupleType(name)
+	default:
+		p.errorAt(p.peekToken, ErrMissingType, "expected type Int, Float, Char, String or a struct name after %s, got %s instead", what, p.peekToken.Type)
+		return false
+	}
+	if p.peekToken.Type == lexer.LBRACKET {
+		p.nextToken()
+		if p.peekToken.Type == lexer.RBRACKET {
+			p.nextToken()
+			*name += "[]"
+			return true
+		}
+		*length = p.parseLength()
+		return *length != nil
 	}
+	return true
+}
 
-	// Move to the first argument
-	p.nextToken()
+// parseTupleType parses (Type, Type, ...), the type of a tuple; a single
+// type in parentheses is just that type
+func (p *Parser) parseTupleType(name *string) bool {
+	var elements []string
+	for {
+		var element string
+		var length Expression
+		if !p.parseType("(", &element, &length) {
+			return false
+		}
+		if length != nil {
+			p.errorAt(p.curToken, ErrMissingType, "tuple elements cannot be arrays")
+			return false
+		}
+		elements = append(elements, element)
+		if p.peekToken.Type != lexer.COMMA {
+			break
+		}
+		p.nextToken()
+	}
+	if !p.expectPeek(lexer.RPAREN) {
+		return false
+	}
+	if len(elements) == 1 {
+		*name = elements[0]
+		return true
+	}
+	*name = "(" + strings.Join(elements, ", ") + ")"
+	return true
+}
 
-	// Parse first argument
-	arg := p.parseExpression()
-	if arg != nil {
-		args = append(args, arg)
+// parseOptional appends the ? of an optional type, as in Int?, or the ! of a
+// result type, as in Int!, to name
+func (p *Parser) parseOptional(name *string) {
+	if p.peekToken.Type == lexer.QUESTION || p.peekToken.Type == lexer.BANG {
+		p.nextToken()
+		*name += p.curToken.Literal
 	}
+}
 
-	// Parse remaining arguments
-	for p.peekToken.Type == lexer.COMMA {
-		p.nextToken() // consume the comma
-		p.nextToken() // move to next argument
-		arg := p.parseExpression()
-		if arg != nil {
-			args = append(args, arg)
-		}
+// parseSlice appends the [] of a slice type, as in Int[], to name
+func (p *Parser) parseSlice(name *string) bool {
+	if p.peekToken.Type != lexer.LBRACKET {
+		return true
+	}
+	p.nextToken()
+	if !p.expectPeek(lexer.RBRACKET) {
+		return false
 	}
+	*name += "[]"
+	return true
+}
 
-	return args
+// parseArrayType parses Array[Type, length], the long form of Type[length]
+func (p *Parser) parseArrayType(name *string, length *Expression) bool {
+	if !p.expectPeek(lexer.LBRACKET) {
+		return false
+	}
+	switch p.peekToken.Type {
+	case lexer.INT_TYPE, lexer.FLOAT_TYPE, lexer.CHAR_TYPE, lexer.STRING_TYPE, lexer.IDENT:
+		p.nextToken()
+		*name = p.curToken.Literal
+	default:
+		p.errorAt(p.peekToken, ErrMissingType, "expected element type after Array[, got %s instead", p.peekToken.Type)
+		return false
+	}
+	if !p.expectPeek(lexer.COMMA) {
+		return false
+	}
+	comma := p.curToken
+	p.nextToken()
+	*length = p.parseExpression()
+	if *length == nil {
+		p.errorAt(comma, ErrMissingOperand, "expected array length after Array[%s,", *name)
+		return false
+	}
+	return p.expectPeek(lexer.RBRACKET)
 }
 
-func (p *Parser) parseExpression() Expression {
-	left := p.parsePrimaryExpression()
+// parseStructStatement parses Struct Name { field Type, ... }. Fields may
+// be separated by commas or just whitespace, one per line.
+func (p *Parser) parseStructStatement() Statement {
+	if !p.expectPeek(lexer.IDENT) {
+		return nil
+	}
+	stmt := &StructStatement{Token: p.curToken, Name: p.curToken.Literal}
+	if !p.expectPeek(lexer.LBRACE) {
+		return nil
+	}
 
-	// Check for infix operators
-	if p.peekToken.Type == lexer.PLUS || p.peekToken.Type == lexer.MINUS {
-		return p.parseInfixExpression(left)
+	for p.peekToken.Type != lexer.RBRACE {
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		field := &StructField{Token: p.curToken, Name: p.curToken.Literal}
+		if !p.parseType(fmt.Sprintf("field %s of %s", field.Name, stmt.Name), &field.Type, &field.Length) {
+			return nil
+		}
+		stmt.Fields = append(stmt.Fields, field)
+		if p.peekToken.Type == lexer.COMMA {
+			p.nextToken()
+		}
 	}
+	p.nextToken()
 
-	return left
+	return stmt
 }
 
-func (p *Parser) parsePrimaryExpression() Expression {
+// parseLabeledLoop parses "name: For ..." or "name: Do ..."
+func (p *Parser) parseLabeledLoop() Statement {
+	label := p.curToken.Literal
+	p.nextToken() // the colon
+	p.nextToken()
+
 	switch p.curToken.Type {
-	case lexer.STRING:
-		return &StringLiteral{Value: p.curToken.Literal}
-	case lexer.INT:
-		// Parse as proper IntegerLiteral
-		val, err := strconv.ParseInt(p.curToken.Literal, 10, 64)
-		if err != nil {
-			p.errors = append(p.errors, fmt.Sprintf("could not parse %q as integer", p.curToken.Literal))
+	case lexer.FOR:
+		stmt, ok := p.parseForStatement().(*ForStatement)
+		if !ok {
 			return nil
 		}
-		return &IntegerLiteral{Value: val}
-	case lexer.MINUS:
-		// Handle negative numbers
-		if p.peekToken.Type == lexer.INT {
-			p.nextToken() // consume the minus
-			val, err := strconv.ParseInt(p.curToken.Literal, 10, 64)
-			if err != nil {
-				p.errors = append(p.errors, fmt.Sprintf("could not parse %q as integer", p.curToken.Literal))
-				return nil
-			}
-			return &IntegerLiteral{Value: -val} // negate the value
-		}
-		p.errors = append(p.errors, "minus token not followed by integer")
-		return nil
-	case lexer.IDENT:
-		// Check if this is a function call
-		if p.peekToken.Type == lexer.LPAREN {
-			return p.parseCallExpression()
+		stmt.Label = label
+		return stmt
+	case lexer.DO:
+		stmt, ok := p.parseDoWhileStatement().(*DoWhileStatement)
+		if !ok {
+			return nil
 		}
-		return &Identifier{Value: p.curToken.Literal}
+		stmt.Label = label
+		return stmt
 	default:
+		p.errorAt(p.curToken, ErrUnexpectedToken, "only loops can be labeled, got %s after %s:", p.curToken.Type, label)
 		return nil
 	}
 }
 
-func (p *Parser) parseInfixExpression(left Expression) Expression {
-	infix := &InfixExpression{
-		Left: left,
+// parseBranchStatement parses Break() or Continue(), with an optional label
+func (p *Parser) parseBranchStatement() Statement {
+	stmt := &BranchStatement{Token: p.curToken}
+	if !p.expectPeek(lexer.LPAREN) {
+		return nil
 	}
-
-	// Move to the operator
-	p.nextToken()
-	infix.Operator = p.curToken.Literal
-
-	// Move to the right operand
-	p.nextToken()
-	infix.Right = p.parsePrimaryExpression()
-
-	return infix
+	if p.peekToken.Type == lexer.IDENT {
+		p.nextToken()
+		stmt.Label = p.curToken.Literal
+	}
+	if !p.expectPeek(lexer.RPAREN) {
+		return nil
+	}
+	return stmt
 }
 
-func (p *Parser) parseCallExpression() Expression {
-	expr := &CallExpression{}
-	expr.Function = p.curToken.Literal
+func (p *Parser) parseDoWhileStatement() Statement {
+	stmt := &DoWhileStatement{}
 
-	if !p.expectPeek(lexer.LPAREN) {
+	if !p.expectPeek(lexer.LBRACE) {
 		return nil
 	}
+	stmt.Body = p.parseBlockStatement()
 
-	expr.Arguments = p.parseArgumentList()
-
+	if !p.expectPeek(lexer.WHILE) {
+		return nil
+	}
+	stmt.Token = p.curToken
+	if !p.expectPeek(lexer.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Condition = p.parseExpression()
+	if stmt.Condition == nil {
+		p.errorAt(p.curToken, ErrMissingOperand, "expected condition after While (")
+		return nil
+	}
 	if !p.expectPeek(lexer.RPAREN) {
 		return nil
 	}
 
-	return expr
+	return stmt
 }
 
-func (p *Parser) expectPeek(t lexer.TokenType) bool {
-	if p.peekToken.Type == t {
+func (p *Parser) parseIfStatement() Statement {
+	stmt := &IfStatement{}
+
+	for {
+		branch := p.parseIfBranch()
+		if branch == nil {
+			return nil
+		}
+		stmt.Branches = append(stmt.Branches, branch)
+
+		if p.peekToken.Type != lexer.ELSE {
+			return stmt
+		}
+		p.nextToken()
+		if p.peekToken.Type != lexer.IF {
+			break
+		}
 		p.nextToken()
-		return true
-	} else {
-		p.peekError(t)
-		return false
 	}
-}
 
-func (p *Parser) peekError(t lexer.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
+	if !p.expectPeek(lexer.LBRACE) {
+		return nil
+	}
+	stmt.Else = p.parseBlockStatement()
+	return stmt
+}
+
+// parseIfBranch parses "(condition) { ... }" after an If keyword
+func (p *Parser) parseIfBranch() *IfBranch {
+	branch := &IfBranch{Token: p.curToken}
+	if !p.expectPeek(lexer.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	branch.Condition = p.parseExpression()
+	if branch.Condition == nil {
+		p.errorAt(p.curToken, ErrMissingOperand, "expected condition after If (")
+		return nil
+	}
+	if !p.expectPeek(lexer.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(lexer.LBRACE) {
+		return nil
+	}
+	branch.Body = p.parseBlockStatement()
+	return branch
+}
+
+func (p *Parser) parseMatchStatement() Statement {
+	stmt := &MatchStatement{Token: p.curToken}
+
+	if !p.expectPeek(lexer.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Value = p.parseExpression()
+	if !p.expectPeek(lexer.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(lexer.LBRACE) {
+		return nil
+	}
+	p.nextToken()
+
+	seen := make(map[int64]bool)
+	for p.curToken.Type != lexer.RBRACE && p.curToken.Type != lexer.EOF {
+		switch p.curToken.Type {
+		case lexer.CASE:
+			matchCase := &MatchCase{}
+			for {
+				p.nextToken()
+				valueToken := p.curToken
+				value := p.parseCaseValue()
+				if value == nil {
+					return nil
+				}
+				if seen[value.Value] {
+					p.errorAt(valueToken, ErrDuplicateCase, "duplicate case value %d in Match", value.Value)
+				}
+				seen[value.Value] = true
+				matchCase.Values = append(matchCase.Values, value)
+				if p.peekToken.Type != lexer.COMMA {
+					break
+				}
+				p.nextToken() // consume the comma
+			}
+			if !p.expectPeek(lexer.LBRACE) {
+				return nil
+			}
+			matchCase.Body = p.parseBlockStatement()
+			stmt.Cases = append(stmt.Cases, matchCase)
+		case lexer.DEFAULT:
+			if stmt.Default != nil {
+				p.errorAt(p.curToken, ErrMultipleDefault, "multiple Default arms in Match")
+			}
+			if !p.expectPeek(lexer.LBRACE) {
+				return nil
+			}
+			stmt.Default = p.parseBlockStatement()
+		default:
+			p.errorAt(p.curToken, ErrInvalidMatchArm, "expected Case or Default in Match, got %s instead", p.curToken.Type)
+			return nil
+		}
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseCaseValue parses a Case label, which must be an integer literal (optionally negative)
+func (p *Parser) parseCaseValue() *IntegerLiteral {
+	negative := false
+	if p.curToken.Type == lexer.MINUS {
+		negative = true
+		p.nextToken()
+	}
+	if p.curToken.Type != lexer.INT {
+		p.errorAt(p.curToken, ErrInvalidCaseValue, "Case value must be an integer literal, got %s instead", p.curToken.Type)
+		return nil
+	}
+	// Parsed with its sign, so the most negative Int is a value too
+	literal := p.curToken.Literal
+	if negative {
+		literal = "-" + literal
+	}
+	val, err := strconv.ParseInt(literal, 10, 64)
+	if err != nil {
+		p.errorAt(p.curToken, ErrInvalidInteger, "could not parse %q as integer", literal)
+		return nil
+	}
+	return &IntegerLiteral{Value: val}
+}
+
+func (p *Parser) parseForStatement() Statement {
+	stmt := &ForStatement{}
+
+	if !p.expectPeek(lexer.LPAREN) {
+		return nil
+	}
+
+	// Init section: an assignment, or empty
+	if p.peekToken.Type != lexer.SEMICOLON {
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		stmt.Init = p.parseAssignStatement()
+	}
+	if !p.expectPeek(lexer.SEMICOLON) {
+		return nil
+	}
+
+	// Condition section: any expression, or empty
+	if p.peekToken.Type != lexer.SEMICOLON {
+		p.nextToken()
+		stmt.Condition = p.parseExpression()
+	}
+	if !p.expectPeek(lexer.SEMICOLON) {
+		return nil
+	}
+
+	// Post section: an assignment, or empty
+	if p.peekToken.Type != lexer.RPAREN {
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		stmt.Post = p.parseAssignStatement()
+	}
+	if !p.expectPeek(lexer.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(lexer.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseBlockStatement()
+
+	return stmt
+}
+
+// parseArrayLength parses the [length] of an array type. The length may be
+// any expression; the code generator checks that it is a positive constant.
+func (p *Parser) parseArrayLength() Expression {
+	p.nextToken()
+	return p.parseLength()
+}
+
+// parseLength parses the length and ] of an array type after its [
+func (p *Parser) parseLength() Expression {
+	bracket := p.curToken
+	p.nextToken()
+	length := p.parseExpression()
+	if length == nil {
+		p.errorAt(bracket, ErrMissingOperand, "expected array length after [")
+		return nil
+	}
+	if !p.expectPeek(lexer.RBRACKET) {
+		return nil
+	}
+	return length
+}
+
+func (p *Parser) parseAssignStatement() Statement {
+	stmt := &AssignStatement{Token: p.curToken}
+	stmt.Name = p.curToken.Literal
+
+	if p.peekToken.Type == lexer.DOT {
+		field := p.parseFieldExpression(stmt.Target())
+		if field == nil {
+			return nil
+		}
+		stmt.Field = field.(*FieldExpression)
+	}
+	return p.parseAssignment(stmt)
+}
+
+// parseFieldStatement parses a statement starting with name.field: an
+// assignment to the field, or a method call
+func (p *Parser) parseFieldStatement() Statement {
+	stmt := &AssignStatement{Token: p.curToken, Name: p.curToken.Literal}
+	field := p.parseFieldExpression(stmt.Target())
+	if field == nil {
+		return nil
+	}
+	if p.peekToken.Type == lexer.LPAREN {
+		call := p.parseMethodCall(field.(*FieldExpression))
+		if call == nil {
+			return nil
+		}
+		if p.chained() {
+			return p.parseChainedCall(call)
+		}
+		return &CallStatement{Token: call.Token, Receiver: call.Receiver, Function: call.Function, Arguments: call.Arguments}
+	}
+	stmt.Field = field.(*FieldExpression)
+	return p.parseAssignment(stmt)
+}
+
+// parseAssignment parses the rest of an assignment after its target: an
+// optional [index], then = value
+func (p *Parser) parseAssignment(stmt *AssignStatement) Statement {
+	if p.peekToken.Type == lexer.LBRACKET {
+		p.nextToken()
+		bracket := p.curToken
+		p.nextToken()
+		stmt.Index = p.parseExpression()
+		if stmt.Index == nil {
+			p.errorAt(bracket, ErrMissingOperand, "expected index after %s[", stmt.Target().String())
+			return nil
+		}
+		if !p.expectPeek(lexer.RBRACKET) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(lexer.ASSIGN) {
+		return nil
+	}
+	target := stmt.Target().String()
+	if stmt.Index != nil {
+		target += "[" + stmt.Index.String() + "]"
+	}
+	stmt.Value = p.parseValue(target)
+	if stmt.Value == nil {
+		return nil
+	}
+
+	return stmt
+}
+
+// parseValue parses the value after the = at curToken, assigning to what.
+// It reports a missing value unless the expression itself was reported as
+// malformed.
+func (p *Parser) parseValue(what string) Expression {
+	assign := p.curToken
+	p.nextToken()
+	reported := len(p.diagnostics)
+	value := p.parseExpression()
+	if value == nil && len(p.diagnostics) == reported {
+		p.errorAt(assign, ErrMissingOperand, "expected value after %s =", what)
+	}
+	return value
+}
+
+func (p *Parser) parseCallStatement() Statement {
+	stmt := &CallStatement{Token: p.curToken}
+	stmt.Function = p.curToken.Literal
+
+	if !p.expectPeek(lexer.LPAREN) {
+		return nil
+	}
+
+	stmt.Arguments = p.parseArgumentList()
+
+	if !p.expectPeek(lexer.RPAREN) {
+		return nil
+	}
+
+	if stmt.Token.Type == lexer.IDENT && p.chained() {
+		return p.parseChainedCall(&CallExpression{Token: stmt.Token, Function: stmt.Function, Arguments: stmt.Arguments})
+	}
+	return stmt
+}
+
+// chained reports whether a call statement goes on past its call, as in
+// open(name).Close()
+func (p *Parser) chained() bool {
+	return p.peekToken.Type == lexer.DOT || p.peekToken.Type == lexer.LBRACKET && p.peekToken.Line == p.curToken.Line
+}
+
+// parseChainedCall parses the rest of a call statement that uses the result
+// of call, which must end in another call
+func (p *Parser) parseChainedCall(call *CallExpression) Statement {
+	expr := p.parsePostfix(call)
+	if expr == nil {
+		return nil
+	}
+	last, ok := expr.(*CallExpression)
+	if !ok {
+		p.errorAt(p.curToken, ErrStatementEnd, "expected a call at the end of %s: the result of a call can only be used by another call in a statement", expr.String())
+		return nil
+	}
+	return &CallStatement{Token: last.Token, Receiver: last.Receiver, Function: last.Function, Arguments: last.Arguments}
+}
+
+func (p *Parser) parseArgumentList() []Expression {
+	return p.parseExpressionList(lexer.RPAREN)
+}
+
+// parseExpressionList parses comma-separated expressions up to, but not
+// including, the end token, allowing a comma after the last one
+func (p *Parser) parseExpressionList(end lexer.TokenType) []Expression {
+	args := []Expression{}
+
+	// If the next token ends the list, it is empty
+	if p.peekToken.Type == end {
+		return args
+	}
+
+	// Move to the first argument
+	p.nextToken()
+
+	// Parse first argument
+	arg := p.parseExpression()
+	if arg != nil {
+		args = append(args, arg)
+	}
+
+	// Parse remaining arguments; a comma may follow the last one
+	for p.peekToken.Type == lexer.COMMA {
+		p.nextToken() // consume the comma
+		if p.peekToken.Type == end {
+			break
+		}
+		p.nextToken() // move to next argument
+		arg := p.parseExpression()
+		if arg != nil {
+			args = append(args, arg)
+		}
+	}
+
+	return args
+}
+
+// Operator precedences, lowest to highest
+const (
+	_ int = iota
+	LOWEST
+	EQUALS      // == !=
+	LESSGREATER // < > <= >=
+	DEFAULT_OR  // ??
+	SUM         // + -
+	PRODUCT     // * / %
+	PREFIX      // -x !x
+)
+
+var precedences = map[lexer.TokenType]int{
+	lexer.EQ:         EQUALS,
+	lexer.NOT_EQ:     EQUALS,
+	lexer.LT:         LESSGREATER,
+	lexer.GT:         LESSGREATER,
+	lexer.LT_EQ:      LESSGREATER,
+	lexer.GT_EQ:      LESSGREATER,
+	lexer.PLUS:       SUM,
+	lexer.DEFAULT_OR: DEFAULT_OR,
+	lexer.MINUS:      SUM,
+	lexer.ASTERISK:   PRODUCT,
+	lexer.SLASH:      PRODUCT,
+	lexer.PERCENT:    PRODUCT,
+}
+
+func (p *Parser) peekPrecedence() int {
+	if prec, ok := precedences[p.peekToken.Type]; ok {
+		return prec
+	}
+	return LOWEST
+}
+
+func (p *Parser) curPrecedence() int {
+	if prec, ok := precedences[p.curToken.Type]; ok {
+		return prec
+	}
+	return LOWEST
+}
+
+func (p *Parser) parseExpression() Expression {
+	return p.parseExpressionWithPrecedence(LOWEST)
+}
+
+func (p *Parser) parseExpressionWithPrecedence(precedence int) Expression {
+	left := p.parsePrimaryExpression()
+
+	// Fold in infix operators while they bind tighter than the caller. An
+	// operator on a later line does not continue the expression, since the
+	// line before ended its statement.
+	for left != nil && precedence < p.peekPrecedence() && p.peekToken.Line == p.curToken.Line {
+		p.nextToken()
+		left = p.parseInfixExpression(left)
+	}
+
+	return left
+}
+
+func (p *Parser) parsePrimaryExpression() Expression {
+	switch p.curToken.Type {
+	case lexer.STRING:
+		return &StringLiteral{Value: p.curToken.Literal}
+	case lexer.CHAR:
+		return &CharLiteral{Token: p.curToken, Value: p.curToken.Literal[0]}
+	case lexer.INT:
+		// Parse as proper IntegerLiteral
+		val, err := strconv.ParseInt(p.curToken.Literal, 10, 64)
+		if err != nil {
+			p.errorAt(p.curToken, ErrInvalidInteger, "could not parse %q as integer", p.curToken.Literal)
+			return nil
+		}
+		return &IntegerLiteral{Value: val}
+	case lexer.FLOAT:
+		val, err := strconv.ParseFloat(p.curToken.Literal, 64)
+		if err != nil {
+			p.errorAt(p.curToken, ErrInvalidInteger, "could not parse %q as float", p.curToken.Literal)
+			return nil
+		}
+		return &FloatLiteral{Value: val}
+	case lexer.NIL:
+		return &NilLiteral{Token: p.curToken}
+	case lexer.TRY:
+		// Try(result) unwraps a result, passing its error on
+		return p.parseCallExpression()
+	case lexer.MINUS, lexer.BANG:
+		return p.parsePrefixExpression()
+	case lexer.LPAREN:
+		// Parenthesized sub-expression, or a tuple when commas follow it
+		tok := p.curToken
+		p.nextToken()
+		expr := p.parseExpression()
+		if expr != nil && p.peekToken.Type == lexer.COMMA {
+			return p.parseTupleLiteral(tok, expr)
+		}
+		if !p.expectPeek(lexer.RPAREN) {
+			return nil
+		}
+		return expr
+	case lexer.LBRACKET:
+		return p.parseArrayLiteral()
+	case lexer.ARRAY:
+		expr := &TypeExpression{Token: p.curToken}
+		if !p.parseArrayType(&expr.Name, &expr.Length) {
+			return nil
+		}
+		return expr
+	case lexer.INT_TYPE, lexer.FLOAT_TYPE, lexer.CHAR_TYPE, lexer.STRING_TYPE:
+		// A type called like a function converts its argument: Int(s)
+		if p.peekToken.Type == lexer.LPAREN {
+			return p.parseCallExpression()
+		}
+		expr := &TypeExpression{Token: p.curToken, Name: p.curToken.Literal}
+		if p.peekToken.Type == lexer.LBRACKET {
+			expr.Length = p.parseArrayLength()
+			if expr.Length == nil {
+				return nil
+			}
+		}
+		return expr
+	case lexer.IDENT:
+		// A call's ( and a struct literal's { must be on the same line as
+		// the name, so a destructuring or a bare block after a statement
+		// ending in a name stays a statement of its own
+		if p.peekToken.Type == lexer.LPAREN && p.peekToken.Line == p.curToken.Line {
+			return p.parsePostfix(p.parseCallExpression())
+		}
+		if p.peekToken.Type == lexer.LBRACE && p.peekToken.Line == p.curToken.Line {
+			return p.parseStructLiteral()
+		}
+		var expr Expression = &Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if p.peekToken.Type == lexer.DOT {
+			expr = p.parseFieldExpression(expr)
+			if expr == nil {
+				return nil
+			}
+			if p.peekToken.Type == lexer.LPAREN && p.peekToken.Line == p.curToken.Line {
+				if call := p.parseMethodCall(expr.(*FieldExpression)); call != nil {
+					return p.parsePostfix(call)
+				}
+				return nil
+			}
+		}
+		if p.peekToken.Type == lexer.LBRACKET {
+			return p.parseIndexExpression(expr)
+		}
+		return expr
+	default:
+		return nil
+	}
+}
+
+func (p *Parser) parsePrefixExpression() Expression {
+	operator := p.curToken
+	prefix := &PrefixExpression{
+		Token:    operator,
+		Operator: operator.Literal,
+	}
+
+	// Move to the operand
+	p.nextToken()
+	prefix.Right = p.parseExpressionWithPrecedence(PREFIX)
+	if prefix.Right == nil {
+		p.errorAt(operator, ErrMissingOperand, "expected operand after prefix operator %s", prefix.Operator)
+		return nil
+	}
+
+	return prefix
+}
+
+func (p *Parser) parseInfixExpression(left Expression) Expression {
+	infix := &InfixExpression{
+		Token:    p.curToken,
+		Left:     left,
+		Operator: p.curToken.Literal,
+	}
+
+	// Move to the right operand
+	precedence := p.curPrecedence()
+	if precedence == DEFAULT_OR {
+		// a ?? b ?? c tries a, then b, then c
+		precedence--
+	}
+	p.nextToken()
+	infix.Right = p.parseExpressionWithPrecedence(precedence)
+	if infix.Right == nil {
+		p.errorAt(infix.Token, ErrMissingOperand, "expected operand after operator %s", infix.Operator)
+		return nil
+	}
+
+	return infix
+}
+
+// parseTupleLiteral parses the rest of a tuple literal after its first element
+func (p *Parser) parseTupleLiteral(tok lexer.Token, first Expression) Expression {
+	tuple := &TupleLiteral{Token: tok, Elements: []Expression{first}}
+	for p.peekToken.Type == lexer.COMMA {
+		p.nextToken() // consume the comma
+		comma := p.curToken
+		p.nextToken()
+		element := p.parseExpression()
+		if element == nil {
+			p.errorAt(comma, ErrMissingOperand, "expected tuple element after ,")
+			return nil
+		}
+		tuple.Elements = append(tuple.Elements, element)
+	}
+	if !p.expectPeek(lexer.RPAREN) {
+		return nil
+	}
+	return tuple
+}
+
+func (p *Parser) parseArrayLiteral() Expression {
+	array := &ArrayLiteral{Token: p.curToken}
+	array.Elements = p.parseExpressionList(lexer.RBRACKET)
+	if !p.expectPeek(lexer.RBRACKET) {
+		return nil
+	}
+	return array
+}
+
+// parseStructLiteral parses Name{field: value, ...}, allowing a comma after
+// the last field
+func (p *Parser) parseStructLiteral() Expression {
+	literal := &StructLiteral{Token: p.curToken, Name: p.curToken.Literal}
+	p.nextToken()
+
+	for p.peekToken.Type != lexer.RBRACE {
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		field := &FieldValue{Token: p.curToken, Name: p.curToken.Literal}
+		if !p.expectPeek(lexer.COLON) {
+			return nil
+		}
+		colon := p.curToken
+		p.nextToken()
+		field.Value = p.parseExpression()
+		if field.Value == nil {
+			p.errorAt(colon, ErrMissingOperand, "expected value after %s: in %s literal", field.Name, literal.Name)
+			return nil
+		}
+		literal.Fields = append(literal.Fields, field)
+		if p.peekToken.Type != lexer.COMMA {
+			break
+		}
+		p.nextToken()
+	}
+	if !p.expectPeek(lexer.RBRACE) {
+		return nil
+	}
+
+	return literal
+}
+
+// parseFieldExpression parses the .field accesses following a struct name
+func (p *Parser) parseFieldExpression(left Expression) Expression {
+	for p.peekToken.Type == lexer.DOT {
+		p.nextToken()
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		left = &FieldExpression{Token: p.curToken, Struct: left, Field: p.curToken.Literal}
+	}
+	return left
+}
+
+// parseIndexExpression parses name[index] or the slice name[start:end]
+func (p *Parser) parseIndexExpression(array Expression) Expression {
+	p.nextToken()
+	bracket := p.curToken
+
+	var index Expression
+	if p.peekToken.Type != lexer.COLON {
+		p.nextToken()
+		index = p.parseExpression()
+		if index == nil {
+			p.errorAt(bracket, ErrMissingOperand, "expected index after %s[", array.String())
+			return nil
+		}
+	}
+
+	if p.peekToken.Type == lexer.COLON {
+		p.nextToken()
+		colon := p.curToken
+		slice := &SliceExpression{Token: bracket, Array: array, Start: index}
+		if p.peekToken.Type != lexer.RBRACKET {
+			p.nextToken()
+			slice.End = p.parseExpression()
+			if slice.End == nil {
+				p.errorAt(colon, ErrMissingOperand, "expected end index after : in %s[", array.String())
+				return nil
+			}
+		}
+		if !p.expectPeek(lexer.RBRACKET) {
+			return nil
+		}
+		return slice
+	}
+
+	if !p.expectPeek(lexer.RBRACKET) {
+		return nil
+	}
+	return &IndexExpression{Token: bracket, Array: array, Index: index}
+}
+
+// parsePostfix parses what follows the result of a call: a field of it, a
+// method called on it or an element of it, as in box(1).Get().name[0]. The
+// ( of a method call and the [ of an index must be on the same line as the
+// call before them.
+func (p *Parser) parsePostfix(expr Expression) Expression {
+	for expr != nil {
+		switch {
+		case p.peekToken.Type == lexer.DOT:
+			p.nextToken()
+			if !p.expectPeek(lexer.IDENT) {
+				return nil
+			}
+			field := &FieldExpression{Token: p.curToken, Struct: expr, Field: p.curToken.Literal}
+			expr = field
+			if p.peekToken.Type == lexer.LPAREN && p.peekToken.Line == p.curToken.Line {
+				if call := p.parseMethodCall(field); call != nil {
+					expr = call
+				} else {
+					return nil
+				}
+			}
+		case p.peekToken.Type == lexer.LBRACKET && p.peekToken.Line == p.curToken.Line:
+			expr = p.parseIndexExpression(expr)
+		default:
+			return expr
+		}
+	}
+	return nil
+}
+
+// parseMethodCall parses the arguments of receiver.method(...), where the
+// method was parsed as a field of the receiver
+func (p *Parser) parseMethodCall(method *FieldExpression) *CallExpression {
+	call := &CallExpression{Token: method.Token, Receiver: method.Struct, Function: method.Field}
+	p.nextToken()
+	call.Arguments = p.parseArgumentList()
+	if !p.expectPeek(lexer.RPAREN) {
+		return nil
+	}
+	return call
+}
+
+func (p *Parser) parseCallExpression() Expression {
+	expr := &CallExpression{Token: p.curToken}
+	expr.Function = p.curToken.Literal
+
+	if !p.expectPeek(lexer.LPAREN) {
+		return nil
+	}
+
+	expr.Arguments = p.parseArgumentList()
+
+	if !p.expectPeek(lexer.RPAREN) {
+		return nil
+	}
+
+	return expr
+}
+
+func (p *Parser) expectPeek(t lexer.TokenType) bool {
+	if p.peekToken.Type == t {
+		p.nextToken()
+		return true
+	} else {
+		p.peekError(t)
+		return false
+	}
+}
+
+func (p *Parser) peekError(t lexer.TokenType) {
+	p.errorAt(p.peekToken, ErrUnexpectedToken, "expected next token to be %s, got %s instead",
 		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	if closer, ok := closers[t]; ok && p.missingCloser() {
+		p.fix(Fix{Line: p.curToken.Line, Column: p.curToken.End, New: closer})
+	}
+}
+
+// closers are the tokens that end a call, index or parenthesized expression
+var closers = map[lexer.TokenType]string{
+	lexer.RPAREN:   ")",
+	lexer.RBRACKET: "]",
+}
+
+// missingCloser reports whether a closer was most likely left out after
+// the current token, rather than something else being written in its place:
+// the next token is on a later line, closes something else or ends the
+// source
+func (p *Parser) missingCloser() bool {
+	next := p.peekToken
+	_, closes := closers[next.Type]
+	return next.Line > p.curToken.Line || closes || next.Type == lexer.RBRACE || next.Type == lexer.EOF
 }
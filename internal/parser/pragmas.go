@@ -0,0 +1,126 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"dreadlang/internal/lexer"
+)
+
+// A file may begin with pragmas, written before its first declaration:
+//
+//	#pragma strict
+//	#pragma target('linux')
+//
+// They apply to that file only. The parser checks their form and records
+// them on the Program; the code generator acts on them, using the file of
+// each pragma's token to tell which declarations it covers.
+
+// Pragma is one #pragma line
+type Pragma struct {
+	Token     lexer.Token // the pragma's name
+	Name      string
+	Arguments []Expression
+}
+
+func (pr *Pragma) String() string {
+	if pr.Arguments == nil {
+		return "#pragma " + pr.Name
+	}
+	args := make([]string, len(pr.Arguments))
+	for i, arg := range pr.Arguments {
+		args[i] = arg.String()
+	}
+	return fmt.Sprintf("#pragma %s(%s)", pr.Name, strings.Join(args, ", "))
+}
+
+// Pragmas are those of a file, or of a whole program, in source order
+type Pragmas []*Pragma
+
+// Lookup returns the pragma called name that file holds, or nil
+func (ps Pragmas) Lookup(file string, name string) *Pragma {
+	for _, pr := range ps {
+		if pr.Name == name && pr.Token.File == file {
+			return pr
+		}
+	}
+	return nil
+}
+
+// pragmaArguments gives the argument each pragma takes: STRING when it
+// requires one String, ILLEGAL when it takes none
+var pragmaArguments = map[string]lexer.TokenType{
+	"strict": lexer.ILLEGAL, // variables must be declared with Var before being assigned
+	"target": lexer.STRING,  // the file only compiles for the named target or operating system
+}
+
+// parsePragma parses #pragma name or #pragma name(arguments), reporting one
+// that follows a declaration
+func (p *Parser) parsePragma(program *Program) {
+	hash := p.curToken
+	if p.peekToken.Type != lexer.IDENT || p.peekToken.Literal != "pragma" {
+		p.errorAt(p.peekToken, ErrPragma, "expected pragma after #, got %s", p.peekToken.Literal)
+		p.skipLine(hash)
+		return
+	}
+	p.nextToken()
+	if !p.expectPeek(lexer.IDENT) {
+		p.skipLine(hash)
+		return
+	}
+	pragma := &Pragma{Token: p.curToken, Name: p.curToken.Literal}
+	if p.peekToken.Type == lexer.LPAREN {
+		p.nextToken()
+		pragma.Arguments = p.parseArgumentList()
+		if !p.expectPeek(lexer.RPAREN) {
+			p.skipLine(hash)
+			return
+		}
+	}
+
+	if len(program.Statements) > 0 {
+		p.errorAt(hash, ErrPragma, "%s must come before the first declaration", pragma)
+		return
+	}
+	if p.checkPragma(program.Pragmas, pragma) {
+		program.Pragmas = append(program.Pragmas, pragma)
+	}
+}
+
+// checkPragma reports an unknown or repeated pragma, or malformed arguments,
+// and returns whether the pragma is well formed
+func (p *Parser) checkPragma(pragmas Pragmas, pragma *Pragma) bool {
+	argument, known := pragmaArguments[pragma.Name]
+	switch {
+	case !known:
+		p.errorAt(pragma.Token, ErrPragma, "unknown pragma %s", pragma.Name)
+		return false
+	case pragmas.Lookup(pragma.Token.File, pragma.Name) != nil:
+		p.errorAt(pragma.Token, ErrPragma, "duplicate pragma %s", pragma.Name)
+		return false
+	}
+	if argument == lexer.ILLEGAL {
+		if pragma.Arguments != nil {
+			p.errorAt(pragma.Token, ErrPragma, "pragma %s takes no arguments", pragma.Name)
+			return false
+		}
+		return true
+	}
+	if len(pragma.Arguments) != 1 {
+		p.errorAt(pragma.Token, ErrPragma, "pragma %s expects one String argument", pragma.Name)
+		return false
+	}
+	if _, ok := pragma.Arguments[0].(*StringLiteral); !ok {
+		p.errorAt(pragma.Token, ErrPragma, "pragma %s expects a String literal, got %s", pragma.Name, pragma.Arguments[0])
+		return false
+	}
+	return true
+}
+
+// skipLine moves to the last token on the line of tok, past the rest of a
+// malformed pragma
+func (p *Parser) skipLine(tok lexer.Token) {
+	for p.peekToken.Line == tok.Line && p.peekToken.Type != lexer.EOF {
+		p.nextToken()
+	}
+}
@@ -0,0 +1,70 @@
+package parser
+
+import (
+	"fmt"
+
+	"dreadlang/internal/lexer"
+)
+
+// TryStatement runs Body, and Catch if a Try(result) in it holds an error,
+// with the error's message in the variable ErrorName when there is one:
+// Try { n = Try(parse(s)) } Catch (err) { Print(err) }
+type TryStatement struct {
+	Token      lexer.Token // the Try keyword
+	Body       *BlockStatement
+	CatchToken lexer.Token // the Catch keyword
+	ErrorName  *Identifier // may be nil
+	Catch      *BlockStatement
+}
+
+func (ts *TryStatement) statementNode() {}
+func (ts *TryStatement) String() string {
+	if ts.ErrorName == nil {
+		return fmt.Sprintf("Try %s Catch %s", ts.Body.String(), ts.Catch.String())
+	}
+	return fmt.Sprintf("Try %s Catch (%s) %s", ts.Body.String(), ts.ErrorName.Value, ts.Catch.String())
+}
+
+// parseTryStatement parses a Try block and the Catch block that must follow
+// it, which may name the error in parentheses
+func (p *Parser) parseTryStatement() Statement {
+	stmt := &TryStatement{Token: p.curToken}
+	p.nextToken()
+	stmt.Body = p.parseBlockStatement()
+	if !p.expectPeek(lexer.CATCH) {
+		return nil
+	}
+	stmt.CatchToken = p.curToken
+	if p.peekToken.Type == lexer.LPAREN {
+		p.nextToken()
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		stmt.ErrorName = &Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if !p.expectPeek(lexer.RPAREN) {
+			return nil
+		}
+	}
+	if !p.expectPeek(lexer.LBRACE) {
+		return nil
+	}
+	stmt.Catch = p.parseBlockStatement()
+	return stmt
+}
+
+// skipCatch skips the error name and block of a Catch that follows no Try,
+// so that they are not reported as well
+func (p *Parser) skipCatch() {
+	if p.peekToken.Type == lexer.LPAREN {
+		for p.peekToken.Type != lexer.RPAREN && p.peekToken.Type != lexer.LBRACE && p.peekToken.Type != lexer.EOF {
+			p.nextToken()
+		}
+		if p.peekToken.Type == lexer.RPAREN {
+			p.nextToken()
+		}
+	}
+	if p.peekToken.Type == lexer.LBRACE {
+		p.nextToken()
+		p.parseBlockStatement()
+	}
+}
@@ -0,0 +1,50 @@
+package parser
+
+import "dreadlang/internal/lexer"
+
+// A file-scope Function, Struct, Interface, Type, Const or Var may be written
+// after Private, which hides it from the other files of the program: only
+// the file declaring it may use it. Public, the default, may be written to
+// say so. The parser only records the keyword; the code generator enforces
+// it where it resolves a name, since only there is it known which file a
+// use is in.
+
+// parseVisibleStatement parses a declaration after Public or Private
+func (p *Parser) parseVisibleStatement() Statement {
+	keyword := p.curToken
+	p.nextToken()
+
+	switch p.curToken.Type {
+	case lexer.FUNCTION, lexer.STRUCT, lexer.INTERFACE, lexer.TYPE, lexer.CONST, lexer.VAR, lexer.AT:
+	default:
+		// Parse what follows as if the keyword were not there
+		p.errorAt(p.curToken, ErrVisibility, "%s must be followed by Function, Struct, Interface, Type, Const or Var, got %s", keyword.Literal, p.curToken.Type)
+		return p.parseStatement()
+	}
+
+	stmt := p.parseStatement()
+	private := keyword.Type == lexer.PRIVATE
+	switch s := stmt.(type) {
+	case *FunctionStatement:
+		s.Private = private
+	case *StructStatement:
+		s.Private = private
+	case *InterfaceStatement:
+		s.Private = private
+	case *TypeAliasStatement:
+		s.Private = private
+	case *ConstStatement:
+		s.Private = private
+	case *VarStatement:
+		s.Private = private
+	}
+	return stmt
+}
+
+// visibilityPrefix renders Private ahead of a declaration that has it
+func visibilityPrefix(private bool) string {
+	if private {
+		return "Private "
+	}
+	return ""
+}
@@ -0,0 +1,527 @@
+package progen
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Statement is a generated statement that can render itself and run in the model
+type Statement interface {
+	write(out *strings.Builder, indent int)
+	exec(e *env, out *strings.Builder)
+	check(s *scope) bool
+	// shrink returns simpler variants of the statement
+	shrink() []Statement
+}
+
+// Expression is a generated expression with a static type
+type Expression interface {
+	source() string
+	eval(e *env) value
+	check(s *scope) (typ string, ok bool)
+}
+
+func writeBlock(out *strings.Builder, stmts []Statement, indent int) {
+	for _, stmt := range stmts {
+		stmt.write(out, indent)
+	}
+}
+
+func writeIndent(out *strings.Builder, indent int) {
+	out.WriteString(strings.Repeat("    ", indent))
+}
+
+// wellTyped reports whether every variable is declared before use with a consistent type
+func wellTyped(p *Program) bool {
+	for _, f := range p.Functions {
+		if !f.check() {
+			return false
+		}
+	}
+	s := newScope(nil)
+	if !checkBlock(s, p.Statements) {
+		return false
+	}
+	typ, ok := p.Exit.check(s)
+	return ok && typ == intType
+}
+
+func checkBlock(s *scope, stmts []Statement) bool {
+	for _, stmt := range stmts {
+		if !stmt.check(s) {
+			return false
+		}
+	}
+	return true
+}
+
+// assignStmt is `name = value`
+type assignStmt struct {
+	name  string
+	value Expression
+}
+
+func (a *assignStmt) write(out *strings.Builder, indent int) {
+	writeIndent(out, indent)
+	fmt.Fprintf(out, "%s = %s\n", a.name, a.value.source())
+}
+
+func (a *assignStmt) exec(e *env, out *strings.Builder) {
+	e.set(a.name, a.value.eval(e))
+}
+
+func (a *assignStmt) check(s *scope) bool {
+	typ, ok := a.value.check(s)
+	if !ok {
+		return false
+	}
+	if existing, writable, found := s.lookup(a.name); found {
+		return writable && existing == typ
+	}
+	s.vars[a.name] = typ
+	return true
+}
+
+func (a *assignStmt) shrink() []Statement {
+	return nil
+}
+
+// printStmt is `Print(value)`
+type printStmt struct {
+	value Expression
+}
+
+func (p *printStmt) write(out *strings.Builder, indent int) {
+	writeIndent(out, indent)
+	fmt.Fprintf(out, "Print(%s)\n", p.value.source())
+}
+
+func (p *printStmt) exec(e *env, out *strings.Builder) {
+	out.WriteString(p.value.eval(e).String())
+}
+
+func (p *printStmt) check(s *scope) bool {
+	_, ok := p.value.check(s)
+	return ok
+}
+
+func (p *printStmt) shrink() []Statement {
+	return nil
+}
+
+// forStmt is `For (v = 0; v < count; v = v + 1) { body }`
+type forStmt struct {
+	variable string
+	count    int64
+	body     []Statement
+}
+
+func (f *forStmt) write(out *strings.Builder, indent int) {
+	writeIndent(out, indent)
+	fmt.Fprintf(out, "For (%s = 0; %s < %d; %s = %s + 1) {\n", f.variable, f.variable, f.count, f.variable, f.variable)
+	writeBlock(out, f.body, indent+1)
+	writeIndent(out, indent)
+	out.WriteString("}\n")
+}
+
+func (f *forStmt) exec(e *env, out *strings.Builder) {
+	// Both the loop variable and variables first assigned in the body are local to the loop
+	loop := newEnv(e)
+	loop.vars[f.variable] = value{typ: intType, i: 0}
+	for loop.vars[f.variable].i < f.count {
+		for _, stmt := range f.body {
+			stmt.exec(loop, out)
+		}
+		current := loop.vars[f.variable]
+		loop = newEnv(e)
+		loop.vars[f.variable] = value{typ: intType, i: current.i + 1}
+	}
+}
+
+func (f *forStmt) check(s *scope) bool {
+	if _, _, found := s.lookup(f.variable); found {
+		return false
+	}
+	inner := newScope(s)
+	inner.vars[f.variable] = intType
+	inner.readOnly[f.variable] = true
+	return checkBlock(inner, f.body)
+}
+
+func (f *forStmt) shrink() []Statement {
+	var out []Statement
+	for _, body := range removals(f.body) {
+		out = append(out, &forStmt{variable: f.variable, count: f.count, body: body})
+	}
+	if f.count > 1 {
+		out = append(out, &forStmt{variable: f.variable, count: 1, body: f.body})
+	}
+	return out
+}
+
+// matchCase is one arm of a matchStmt
+type matchCase struct {
+	values []int64
+	body   []Statement
+}
+
+// matchStmt is `Match (value) { Case ... Default ... }`
+type matchStmt struct {
+	value       Expression
+	cases       []matchCase
+	defaultBody []Statement // nil when there is no Default arm
+	hasDefault  bool
+}
+
+func (m *matchStmt) write(out *strings.Builder, indent int) {
+	writeIndent(out, indent)
+	fmt.Fprintf(out, "Match (%s) {\n", m.value.source())
+	for _, c := range m.cases {
+		writeIndent(out, indent+1)
+		values := make([]string, len(c.values))
+		for i, v := range c.values {
+			values[i] = fmt.Sprintf("%d", v)
+		}
+		fmt.Fprintf(out, "Case %s {\n", strings.Join(values, ", "))
+		writeBlock(out, c.body, indent+2)
+		writeIndent(out, indent+1)
+		out.WriteString("}\n")
+	}
+	if m.hasDefault {
+		writeIndent(out, indent+1)
+		out.WriteString("Default {\n")
+		writeBlock(out, m.defaultBody, indent+2)
+		writeIndent(out, indent+1)
+		out.WriteString("}\n")
+	}
+	writeIndent(out, indent)
+	out.WriteString("}\n")
+}
+
+func (m *matchStmt) exec(e *env, out *strings.Builder) {
+	v := m.value.eval(e).i
+	for _, c := range m.cases {
+		for _, candidate := range c.values {
+			if candidate == v {
+				m.run(e, c.body, out)
+				return
+			}
+		}
+	}
+	m.run(e, m.defaultBody, out)
+}
+
+func (m *matchStmt) run(e *env, body []Statement, out *strings.Builder) {
+	arm := newEnv(e)
+	for _, stmt := range body {
+		stmt.exec(arm, out)
+	}
+}
+
+func (m *matchStmt) check(s *scope) bool {
+	if typ, ok := m.value.check(s); !ok || typ != intType {
+		return false
+	}
+	// Generated programs never use a variable declared inside an arm after the Match
+	for _, c := range m.cases {
+		if !checkBlock(newScope(s), c.body) {
+			return false
+		}
+	}
+	return checkBlock(newScope(s), m.defaultBody)
+}
+
+func (m *matchStmt) shrink() []Statement {
+	var out []Statement
+	for i := range m.cases {
+		cases := append(append([]matchCase{}, m.cases[:i]...), m.cases[i+1:]...)
+		out = append(out, &matchStmt{value: m.value, cases: cases, defaultBody: m.defaultBody, hasDefault: m.hasDefault})
+	}
+	for i, c := range m.cases {
+		for _, body := range removals(c.body) {
+			cases := append([]matchCase{}, m.cases...)
+			cases[i] = matchCase{values: c.values, body: body}
+			out = append(out, &matchStmt{value: m.value, cases: cases, defaultBody: m.defaultBody, hasDefault: m.hasDefault})
+		}
+	}
+	if m.hasDefault {
+		out = append(out, &matchStmt{value: m.value, cases: m.cases})
+	}
+	return out
+}
+
+// intLit is an integer literal; negative values render as a prefix minus
+type intLit struct {
+	value int64
+}
+
+func (l *intLit) source() string {
+	if l.value < 0 {
+		return fmt.Sprintf("(-%d)", -l.value)
+	}
+	return fmt.Sprintf("%d", l.value)
+}
+
+func (l *intLit) eval(e *env) value {
+	return value{typ: intType, i: l.value}
+}
+
+func (l *intLit) check(s *scope) (string, bool) {
+	return intType, true
+}
+
+// stringLit is a string literal made of characters that need no escaping.
+// It is written in double quotes, since 'a' would be a Char.
+type stringLit struct {
+	value string
+}
+
+func (l *stringLit) source() string {
+	return `"` + l.value + `"`
+}
+
+func (l *stringLit) eval(e *env) value {
+	return value{typ: stringType, s: l.value}
+}
+
+func (l *stringLit) check(s *scope) (string, bool) {
+	return stringType, true
+}
+
+// varRef reads a variable
+type varRef struct {
+	name string
+}
+
+func (v *varRef) source() string {
+	return v.name
+}
+
+func (v *varRef) eval(e *env) value {
+	return e.get(v.name)
+}
+
+func (v *varRef) check(s *scope) (string, bool) {
+	typ, _, ok := s.lookup(v.name)
+	return typ, ok
+}
+
+// prefixExpr is `-x` or `!x` on integers
+type prefixExpr struct {
+	operator string
+	right    Expression
+}
+
+func (p *prefixExpr) source() string {
+	return fmt.Sprintf("%s(%s)", p.operator, p.right.source())
+}
+
+func (p *prefixExpr) eval(e *env) value {
+	v := p.right.eval(e).i
+	switch p.operator {
+	case "-":
+		return value{typ: intType, i: -v}
+	default:
+		return value{typ: intType, i: boolInt(v == 0)}
+	}
+}
+
+func (p *prefixExpr) check(s *scope) (string, bool) {
+	typ, ok := p.right.check(s)
+	return intType, ok && typ == intType
+}
+
+// infixExpr is a binary operation; + on two strings concatenates
+type infixExpr struct {
+	left     Expression
+	operator string
+	right    Expression
+}
+
+func (i *infixExpr) source() string {
+	return fmt.Sprintf("(%s %s %s)", i.left.source(), i.operator, i.right.source())
+}
+
+func (i *infixExpr) eval(e *env) value {
+	l, r := i.left.eval(e), i.right.eval(e)
+	if l.typ == stringType {
+		return value{typ: stringType, s: l.s + r.s}
+	}
+	switch i.operator {
+	case "+":
+		return value{typ: intType, i: l.i + r.i}
+	case "-":
+		return value{typ: intType, i: l.i - r.i}
+	case "==":
+		return value{typ: intType, i: boolInt(l.i == r.i)}
+	case "!=":
+		return value{typ: intType, i: boolInt(l.i != r.i)}
+	case "<":
+		return value{typ: intType, i: boolInt(l.i < r.i)}
+	case ">":
+		return value{typ: intType, i: boolInt(l.i > r.i)}
+	case "<=":
+		return value{typ: intType, i: boolInt(l.i <= r.i)}
+	default:
+		return value{typ: intType, i: boolInt(l.i >= r.i)}
+	}
+}
+
+func (i *infixExpr) check(s *scope) (string, bool) {
+	lt, lok := i.left.check(s)
+	rt, rok := i.right.check(s)
+	if !lok || !rok || lt != rt {
+		return "", false
+	}
+	if lt == stringType && i.operator != "+" {
+		return "", false
+	}
+	return lt, true
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Function is a generated helper function. One that returns a value never
+// prints, so the order in which its calls are evaluated cannot change the
+// output; a Void one is only called as a statement.
+type Function struct {
+	name   string
+	params []param
+	result string // "" when the function is Void
+	body   []Statement
+	value  Expression // what it returns, when it is not Void
+}
+
+type param struct {
+	name string
+	typ  string
+}
+
+func (f *Function) write(out *strings.Builder) {
+	params := make([]string, len(f.params))
+	for i, p := range f.params {
+		params[i] = p.typ + " " + p.name
+	}
+	fmt.Fprintf(out, "Function %s(%s)", f.name, strings.Join(params, ", "))
+	if f.result != "" {
+		fmt.Fprintf(out, " %s", f.result)
+	}
+	out.WriteString(" {\n")
+	writeBlock(out, f.body, 1)
+	if f.result != "" {
+		fmt.Fprintf(out, "    Return(%s)\n", f.value.source())
+	}
+	out.WriteString("}\n")
+}
+
+// call runs the function in the model with the given arguments
+func (f *Function) call(args []value, out *strings.Builder) value {
+	// A function sees its parameters and its own variables only
+	e := newEnv(nil)
+	for i, p := range f.params {
+		e.vars[p.name] = args[i]
+	}
+	for _, stmt := range f.body {
+		stmt.exec(e, out)
+	}
+	if f.result == "" {
+		return value{}
+	}
+	return f.value.eval(e)
+}
+
+func (f *Function) check() bool {
+	s := newScope(nil)
+	for _, p := range f.params {
+		s.vars[p.name] = p.typ
+		s.readOnly[p.name] = true
+	}
+	if !checkBlock(s, f.body) {
+		return false
+	}
+	if f.result == "" {
+		return f.value == nil
+	}
+	typ, ok := f.value.check(s)
+	return ok && typ == f.result
+}
+
+// checkArguments reports whether args match the parameters of f
+func checkArguments(s *scope, f *Function, args []Expression) bool {
+	if len(args) != len(f.params) {
+		return false
+	}
+	for i, arg := range args {
+		if typ, ok := arg.check(s); !ok || typ != f.params[i].typ {
+			return false
+		}
+	}
+	return true
+}
+
+func argumentSource(args []Expression) string {
+	sources := make([]string, len(args))
+	for i, arg := range args {
+		sources[i] = arg.source()
+	}
+	return strings.Join(sources, ", ")
+}
+
+func evalArguments(e *env, args []Expression) []value {
+	values := make([]value, len(args))
+	for i, arg := range args {
+		values[i] = arg.eval(e)
+	}
+	return values
+}
+
+// callStmt is `f(args)` of a Void function
+type callStmt struct {
+	function *Function
+	args     []Expression
+}
+
+func (c *callStmt) write(out *strings.Builder, indent int) {
+	writeIndent(out, indent)
+	fmt.Fprintf(out, "%s(%s)\n", c.function.name, argumentSource(c.args))
+}
+
+func (c *callStmt) exec(e *env, out *strings.Builder) {
+	c.function.call(evalArguments(e, c.args), out)
+}
+
+func (c *callStmt) check(s *scope) bool {
+	return c.function.result == "" && checkArguments(s, c.function, c.args)
+}
+
+func (c *callStmt) shrink() []Statement {
+	return nil
+}
+
+// callExpr is `f(args)` of a function that returns a value
+type callExpr struct {
+	function *Function
+	args     []Expression
+}
+
+func (c *callExpr) source() string {
+	return fmt.Sprintf("%s(%s)", c.function.name, argumentSource(c.args))
+}
+
+func (c *callExpr) eval(e *env) value {
+	// Functions that return a value never print
+	var discarded strings.Builder
+	return c.function.call(evalArguments(e, c.args), &discarded)
+}
+
+func (c *callExpr) check(s *scope) (string, bool) {
+	if c.function.result == "" || !checkArguments(s, c.function, c.args) {
+		return "", false
+	}
+	return c.function.result, true
+}
@@ -0,0 +1,199 @@
+package progen
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+type generator struct {
+	r         *rand.Rand
+	config    Config
+	counter   int
+	functions []*Function // the functions generated so far, which may be called
+	quiet     bool        // generating a function that returns a value, so must not print
+}
+
+// newName returns a variable name never used before in this program
+func (g *generator) newName(prefix string) string {
+	name := fmt.Sprintf("%s%d", prefix, g.counter)
+	g.counter++
+	return name
+}
+
+// block generates between one and MaxStatements statements
+func (g *generator) block(s *scope, depth int) []Statement {
+	count := 1 + g.r.Intn(g.config.MaxStatements)
+	stmts := make([]Statement, 0, count)
+	for i := 0; i < count; i++ {
+		stmts = append(stmts, g.statement(s, depth))
+	}
+	return stmts
+}
+
+func (g *generator) statement(s *scope, depth int) Statement {
+	nested := depth < g.config.MaxDepth
+	switch n := g.r.Intn(10); {
+	case n < 4:
+		return g.assign(s, depth)
+	case n < 7 || !nested:
+		if g.quiet {
+			return g.assign(s, depth)
+		}
+		if void := g.returning(""); len(void) > 0 && g.r.Intn(3) == 0 {
+			f := void[g.r.Intn(len(void))]
+			return &callStmt{function: f, args: g.arguments(s, f, depth)}
+		}
+		return &printStmt{value: g.expression(s, g.anyType(), depth)}
+	case n < 9:
+		loop := &forStmt{
+			variable: g.newName("i"),
+			count:    int64(g.r.Intn(g.config.MaxLoop + 1)),
+		}
+		inner := newScope(s)
+		inner.vars[loop.variable] = intType
+		inner.readOnly[loop.variable] = true
+		loop.body = g.block(inner, depth+1)
+		return loop
+	default:
+		return g.match(s, depth)
+	}
+}
+
+// function generates a helper function with its own parameters and
+// variables. Its body is one level deep, so it stays as small as a block of
+// Entry's.
+func (g *generator) function() *Function {
+	f := &Function{name: g.newName("f")}
+	s := newScope(nil)
+	for n := g.r.Intn(g.config.MaxParams + 1); n > 0; n-- {
+		p := param{name: g.newName("p"), typ: g.anyType()}
+		f.params = append(f.params, p)
+		s.vars[p.name] = p.typ
+		s.readOnly[p.name] = true
+	}
+	if g.r.Intn(3) == 0 {
+		f.body = g.block(s, 1)
+		return f
+	}
+	f.result = g.anyType()
+	g.quiet = true
+	f.body = g.block(s, 1)
+	f.value = g.expression(s, f.result, 1)
+	g.quiet = false
+	return f
+}
+
+// returning lists the functions generated so far that return typ, or the
+// Void ones when typ is ""
+func (g *generator) returning(typ string) []*Function {
+	var out []*Function
+	for _, f := range g.functions {
+		if f.result == typ {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+func (g *generator) arguments(s *scope, f *Function, depth int) []Expression {
+	args := make([]Expression, len(f.params))
+	for i, p := range f.params {
+		args[i] = g.expression(s, p.typ, depth+1)
+	}
+	return args
+}
+
+func (g *generator) assign(s *scope, depth int) Statement {
+	typ := g.anyType()
+	// Either update an existing variable of that type or declare a new one
+	if existing := s.visible(typ, true); len(existing) > 0 && g.r.Intn(2) == 0 {
+		name := existing[g.r.Intn(len(existing))]
+		return &assignStmt{name: name, value: g.expression(s, typ, depth)}
+	}
+	stmt := &assignStmt{name: g.newName("v"), value: g.expression(s, typ, depth)}
+	s.vars[stmt.name] = typ
+	return stmt
+}
+
+func (g *generator) match(s *scope, depth int) Statement {
+	m := &matchStmt{value: g.expression(s, intType, depth)}
+
+	// Draw distinct case values from a small range so dense and sparse sets both occur
+	used := make(map[int64]bool)
+	arms := 1 + g.r.Intn(4)
+	for i := 0; i < arms; i++ {
+		c := matchCase{}
+		for n := 1 + g.r.Intn(2); n > 0; n-- {
+			v := int64(g.r.Intn(12) - 3)
+			if !used[v] {
+				used[v] = true
+				c.values = append(c.values, v)
+			}
+		}
+		if len(c.values) == 0 {
+			continue
+		}
+		c.body = g.block(newScope(s), depth+1)
+		m.cases = append(m.cases, c)
+	}
+	if g.r.Intn(2) == 0 {
+		m.hasDefault = true
+		m.defaultBody = g.block(newScope(s), depth+1)
+	}
+	return m
+}
+
+func (g *generator) anyType() string {
+	if g.r.Intn(3) == 0 {
+		return stringType
+	}
+	return intType
+}
+
+func (g *generator) expression(s *scope, typ string, depth int) Expression {
+	if depth >= g.config.MaxDepth || g.r.Intn(3) == 0 {
+		return g.leaf(s, typ)
+	}
+
+	if functions := g.returning(typ); len(functions) > 0 && g.r.Intn(4) == 0 {
+		f := functions[g.r.Intn(len(functions))]
+		return &callExpr{function: f, args: g.arguments(s, f, depth)}
+	}
+
+	if typ == stringType {
+		return &infixExpr{
+			left:     g.expression(s, stringType, depth+1),
+			operator: "+",
+			right:    g.expression(s, stringType, depth+1),
+		}
+	}
+
+	if g.r.Intn(4) == 0 {
+		operators := []string{"-", "!"}
+		return &prefixExpr{
+			operator: operators[g.r.Intn(len(operators))],
+			right:    g.expression(s, intType, depth+1),
+		}
+	}
+	operators := []string{"+", "-", "+", "-", "==", "!=", "<", ">", "<=", ">="}
+	return &infixExpr{
+		left:     g.expression(s, intType, depth+1),
+		operator: operators[g.r.Intn(len(operators))],
+		right:    g.expression(s, intType, depth+1),
+	}
+}
+
+func (g *generator) leaf(s *scope, typ string) Expression {
+	if names := s.visible(typ, false); len(names) > 0 && g.r.Intn(2) == 0 {
+		return &varRef{name: names[g.r.Intn(len(names))]}
+	}
+	if typ == stringType {
+		letters := "abcdefghij "
+		b := make([]byte, g.r.Intn(4))
+		for i := range b {
+			b[i] = letters[g.r.Intn(len(letters))]
+		}
+		return &stringLit{value: string(b)}
+	}
+	return &intLit{value: int64(g.r.Intn(200) - 50)}
+}
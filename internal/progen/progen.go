@@ -0,0 +1,239 @@
+// Package progen generates random, well-typed Dread programs for
+// property-based testing of the compiler.
+//
+// Every generated program carries its own expected output: the generator's
+// model is evaluated in Go, so a compiled program whose output differs from
+// Expected() has exposed a bug somewhere in the pipeline.
+package progen
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// Config bounds the size of generated programs
+type Config struct {
+	MaxStatements int // statements per block
+	MaxDepth      int // nesting of For/Match blocks and expressions
+	MaxLoop       int // iterations of each For loop
+	MaxFunctions  int // helper functions besides Entry
+	MaxParams     int // parameters of each helper function
+}
+
+// DefaultConfig keeps programs small enough to compile and run quickly
+var DefaultConfig = Config{
+	MaxStatements: 6,
+	MaxDepth:      3,
+	MaxLoop:       4,
+	MaxFunctions:  3,
+	MaxParams:     3,
+}
+
+// Program is a generated Entry function and the helper functions it calls
+type Program struct {
+	Functions  []*Function
+	Statements []Statement
+	Exit       Expression // the Int that Entry returns
+}
+
+// Source renders the program as Dread source code
+func (p *Program) Source() string {
+	var out strings.Builder
+	for _, f := range p.Functions {
+		f.write(&out)
+		out.WriteString("\n")
+	}
+	out.WriteString("Entry main() {\n")
+	writeBlock(&out, p.Statements, 1)
+	fmt.Fprintf(&out, "    Return(%s)\n", p.Exit.source())
+	out.WriteString("}\n")
+	return out.String()
+}
+
+// Expected returns what the compiled program must print
+func (p *Program) Expected() string {
+	out, _ := p.run()
+	return out
+}
+
+// ExitStatus returns the status the compiled program must exit with: the
+// low byte of what Entry returns
+func (p *Program) ExitStatus() int {
+	_, exit := p.run()
+	return int(exit & 0xff)
+}
+
+func (p *Program) run() (string, int64) {
+	var out strings.Builder
+	env := newEnv(nil)
+	for _, stmt := range p.Statements {
+		stmt.exec(env, &out)
+	}
+	return out.String(), p.Exit.eval(env).i
+}
+
+// Generate builds a random program from the given source of randomness
+func Generate(r *rand.Rand, config Config) *Program {
+	g := &generator{r: r, config: config}
+	program := &Program{}
+	// Each function only calls those generated before it, so none recurses
+	for n := g.r.Intn(config.MaxFunctions + 1); n > 0; n-- {
+		f := g.function()
+		program.Functions = append(program.Functions, f)
+		g.functions = append(g.functions, f)
+	}
+	scope := newScope(nil)
+	program.Statements = g.block(scope, 0)
+	program.Exit = g.expression(scope, intType, 0)
+	return program
+}
+
+// Shrink repeatedly removes statements from a failing program while
+// stillFails keeps reporting a failure, returning the smallest program found.
+// The calls in p refer to its functions, so their bodies shrink in place.
+func Shrink(p *Program, stillFails func(*Program) bool) *Program {
+	for {
+		if next := p.shrinkEntry(stillFails); next != nil {
+			p = next
+		} else if !p.shrinkFunctions(stillFails) {
+			return p
+		}
+	}
+}
+
+// shrinkEntry returns the first smaller Entry function, or one that exits
+// with 0, that still fails
+func (p *Program) shrinkEntry(stillFails func(*Program) bool) *Program {
+	var candidates []*Program
+	for _, stmts := range removals(p.Statements) {
+		candidates = append(candidates, &Program{Functions: p.Functions, Statements: stmts, Exit: p.Exit})
+	}
+	if exit, ok := p.Exit.(*intLit); !ok || exit.value != 0 {
+		candidates = append(candidates, &Program{Functions: p.Functions, Statements: p.Statements, Exit: &intLit{}})
+	}
+	for _, next := range candidates {
+		if wellTyped(next) && stillFails(next) {
+			return next
+		}
+	}
+	return nil
+}
+
+// shrinkFunctions removes a statement from one of the functions of p if the
+// program still fails without it
+func (p *Program) shrinkFunctions(stillFails func(*Program) bool) bool {
+	for _, f := range p.Functions {
+		body := f.body
+		for _, smaller := range removals(body) {
+			f.body = smaller
+			if wellTyped(p) && stillFails(p) {
+				return true
+			}
+		}
+		f.body = body
+	}
+	return false
+}
+
+// removals lists every block reachable from stmts with exactly one statement removed
+func removals(stmts []Statement) [][]Statement {
+	var out [][]Statement
+	for i := range stmts {
+		without := append(append([]Statement{}, stmts[:i]...), stmts[i+1:]...)
+		out = append(out, without)
+	}
+	for i, stmt := range stmts {
+		for _, replacement := range stmt.shrink() {
+			with := append([]Statement{}, stmts...)
+			with[i] = replacement
+			out = append(out, with)
+		}
+	}
+	return out
+}
+
+// Value types
+const (
+	intType    = "Int"
+	stringType = "String"
+)
+
+type value struct {
+	typ string
+	i   int64
+	s   string
+}
+
+func (v value) String() string {
+	if v.typ == intType {
+		return fmt.Sprintf("%d", v.i)
+	}
+	return v.s
+}
+
+// env holds runtime values while evaluating the model
+type env struct {
+	parent *env
+	vars   map[string]value
+}
+
+func newEnv(parent *env) *env {
+	return &env{parent: parent, vars: make(map[string]value)}
+}
+
+func (e *env) get(name string) value {
+	for cur := e; cur != nil; cur = cur.parent {
+		if v, ok := cur.vars[name]; ok {
+			return v
+		}
+	}
+	panic("progen: undefined variable " + name)
+}
+
+// set assigns to the innermost existing variable, or declares it in e
+func (e *env) set(name string, v value) {
+	for cur := e; cur != nil; cur = cur.parent {
+		if _, ok := cur.vars[name]; ok {
+			cur.vars[name] = v
+			return
+		}
+	}
+	e.vars[name] = v
+}
+
+// scope tracks variable types while generating or checking a program
+type scope struct {
+	parent   *scope
+	vars     map[string]string
+	readOnly map[string]bool // loop variables
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{parent: parent, vars: make(map[string]string), readOnly: make(map[string]bool)}
+}
+
+func (s *scope) lookup(name string) (typ string, writable bool, ok bool) {
+	for cur := s; cur != nil; cur = cur.parent {
+		if t, found := cur.vars[name]; found {
+			return t, !cur.readOnly[name], true
+		}
+	}
+	return "", false, false
+}
+
+// visible lists the variables of the given type in sorted order
+func (s *scope) visible(typ string, writableOnly bool) []string {
+	var names []string
+	for cur := s; cur != nil; cur = cur.parent {
+		for name, t := range cur.vars {
+			if t == typ && (!writableOnly || !cur.readOnly[name]) {
+				names = append(names, name)
+			}
+		}
+	}
+	// Map iteration order is random; keep generation deterministic per seed
+	sort.Strings(names)
+	return names
+}
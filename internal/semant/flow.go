@@ -0,0 +1,378 @@
+package semant
+
+import (
+	"fmt"
+	"sort"
+
+	"dreadlang/internal/lexer"
+	"dreadlang/internal/parser"
+)
+
+// Warnings come from the flow of values through a function. A liveness
+// analysis walks each body backwards, from the end of a statement to its
+// start, keeping the set of variables whose value some later statement may
+// still read. A store to a variable outside that set is dead: whatever
+// follows assigns it again or never looks at it. Loops are walked until the
+// set at their start stops growing, and only the last walk reports, so each
+// dead store is reported once. Globals are left alone, since other
+// functions read them.
+//
+// A call statement also drops the result of a function that returns one,
+// which is reported unless it is assigned to _.
+
+// live is a set of variables whose value may still be read
+type live map[*symbol]bool
+
+// union returns the variables of a or b
+func union(a, b live) live {
+	out := make(live, len(a)+len(b))
+	for sym := range a {
+		out[sym] = true
+	}
+	for sym := range b {
+		out[sym] = true
+	}
+	return out
+}
+
+// without returns the variables of a but sym
+func without(a live, sym *symbol) live {
+	if !a[sym] {
+		return a
+	}
+	out := make(live, len(a))
+	for s := range a {
+		if s != sym {
+			out[s] = true
+		}
+	}
+	return out
+}
+
+// covers reports whether a holds every variable of b
+func covers(a, b live) bool {
+	for sym := range b {
+		if !a[sym] {
+			return false
+		}
+	}
+	return true
+}
+
+// loop is where the Breaks and Continues of a loop lead
+type loop struct {
+	label string
+	exit  live // live after the loop
+	next  live // live where the next iteration starts
+}
+
+// flow holds the state of walking one function
+type flow struct {
+	c        *checker
+	loops    []loop // innermost last
+	catches  []live // live at the start of the Catch of each enclosing Try
+	report   bool   // whether this walk reports, rather than only computes
+	warnings []parser.Diagnostic
+}
+
+// Warnings returns what program, which compiles, does in vain: values
+// stored in variables and never read, and results of calls that nothing
+// uses
+func Warnings(program *parser.Program) []parser.Diagnostic {
+	c := check(program)
+	if len(c.diagnostics) > 0 {
+		return nil
+	}
+	var warnings []parser.Diagnostic
+	for _, stmt := range program.Statements {
+		if fn, ok := stmt.(*parser.FunctionStatement); ok && fn.Body != nil {
+			f := &flow{c: c, report: true}
+			f.block(fn.Body, live{})
+			// The walk went backwards
+			sort.SliceStable(f.warnings, func(i, j int) bool {
+				a, b := f.warnings[i], f.warnings[j]
+				return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+			})
+			warnings = append(warnings, f.warnings...)
+		}
+	}
+	return warnings
+}
+
+// block returns the variables live at the start of b, given those live
+// after it
+func (f *flow) block(b *parser.BlockStatement, out live) live {
+	for i := len(b.Statements) - 1; i >= 0; i-- {
+		out = f.statement(b.Statements[i], out)
+		if len(f.catches) > 0 {
+			// Any statement of a Try may end up in its Catch
+			out = union(out, f.catches[len(f.catches)-1])
+		}
+	}
+	return out
+}
+
+// statement returns the variables live before stmt, given those live after
+func (f *flow) statement(stmt parser.Statement, out live) live {
+	switch s := stmt.(type) {
+	case *parser.AssignStatement:
+		return f.assign(s, out)
+	case *parser.DestructureStatement:
+		for _, sym := range f.c.stores[s] {
+			f.store(s.Token, sym, out)
+		}
+		for _, sym := range f.c.stores[s] {
+			out = without(out, sym)
+		}
+		return f.reads(s.Value, out)
+	case *parser.VarStatement:
+		sym := f.c.stores[s][0]
+		if s.Value != nil {
+			f.store(s.Token, sym, out)
+			out = f.reads(s.Value, without(out, sym))
+		} else {
+			out = without(out, sym)
+		}
+		if s.Length != nil {
+			out = f.reads(s.Length, out)
+		}
+		return out
+	case *parser.ConstStatement:
+		return f.reads(s.Value, out)
+	case *parser.CallStatement:
+		f.result(s)
+		if s.Function == "Return" || s.Function == "Panic" {
+			// Nothing after it runs
+			out = live{}
+		}
+		for i := len(s.Arguments) - 1; i >= 0; i-- {
+			out = f.reads(s.Arguments[i], out)
+		}
+		if s.Receiver != nil {
+			out = f.reads(s.Receiver, out)
+		}
+		return out
+	case *parser.BranchStatement:
+		for i := len(f.loops) - 1; i >= 0; i-- {
+			if s.Label != "" && f.loops[i].label != s.Label {
+				continue
+			}
+			if s.Token.Type == lexer.BREAK {
+				return f.loops[i].exit
+			}
+			return f.loops[i].next
+		}
+		return out
+	case *parser.IfStatement:
+		next := out
+		if s.Else != nil {
+			next = f.block(s.Else, out)
+		}
+		for i := len(s.Branches) - 1; i >= 0; i-- {
+			b := s.Branches[i]
+			next = f.reads(b.Condition, union(f.block(b.Body, out), next))
+		}
+		return next
+	case *parser.MatchStatement:
+		in := out
+		if s.Default != nil {
+			in = f.block(s.Default, out)
+		}
+		for _, mc := range s.Cases {
+			in = union(in, f.block(mc.Body, out))
+			for _, v := range mc.Values {
+				in = f.reads(v, in)
+			}
+		}
+		return f.reads(s.Value, in)
+	case *parser.ForStatement:
+		return f.forLoop(s, out)
+	case *parser.DoWhileStatement:
+		return f.doWhile(s, out)
+	case *parser.TryStatement:
+		catch := f.block(s.Catch, out)
+		f.catches = append(f.catches, catch)
+		body := f.block(s.Body, out)
+		f.catches = f.catches[:len(f.catches)-1]
+		return union(body, catch)
+	case *parser.BlockStatement:
+		return f.block(s, out)
+	}
+	return out
+}
+
+// assign returns the variables live before an assignment. Setting a field
+// or an element reads the rest of the variable, so it is not a store.
+func (f *flow) assign(stmt *parser.AssignStatement, out live) live {
+	switch {
+	case stmt.Field != nil:
+		out = f.reads(stmt.Field, out)
+		if stmt.Index != nil {
+			out = f.reads(stmt.Index, out)
+		}
+	case stmt.Index != nil:
+		if sym := f.c.elements[stmt]; sym != nil {
+			out = union(out, live{sym: true})
+		}
+		out = f.reads(stmt.Index, out)
+	default:
+		sym := f.c.stores[stmt][0]
+		f.store(stmt.Token, sym, out)
+		out = without(out, sym)
+	}
+	return f.reads(stmt.Value, out)
+}
+
+// store reports a value stored at tok in sym that nothing reads
+func (f *flow) store(tok lexer.Token, sym *symbol, out live) {
+	if !f.report || sym == nil || out[sym] || sym.kind != "variable" && sym.kind != "parameter" {
+		return
+	}
+	f.warnAt(tok, WarnDeadStore, "the value assigned to %s is never read", sym.name)
+}
+
+// result reports a call statement that drops the result of the function
+// it calls
+func (f *flow) result(call *parser.CallStatement) {
+	name := call.Function
+	if call.Receiver != nil {
+		name = "." + name
+	} else if builtins[name] || f.c.types[name] {
+		return
+	}
+	if f.report && f.c.results[name] {
+		f.warnAt(call.Token, WarnUnusedResult, "the result of %s is not used; assign it to _ to discard it", call.Function)
+	}
+}
+
+// forLoop returns the variables live before a For loop. Those live where
+// its condition is checked are found by walking the body and the post
+// statement until they stop growing.
+func (f *flow) forLoop(s *parser.ForStatement, out live) live {
+	// Without a condition, only Break leaves the loop
+	head := live{}
+	if s.Condition != nil {
+		head = f.reads(s.Condition, out)
+	}
+	report := f.report
+	f.report = false
+	for {
+		in := f.forIteration(s, out, head)
+		if covers(head, in) {
+			break
+		}
+		head = union(head, in)
+	}
+	f.report = report
+	f.forIteration(s, out, head)
+
+	if s.Init != nil {
+		return f.statement(s.Init, head)
+	}
+	return head
+}
+
+// forIteration returns the variables live before the condition of a For
+// loop, given those live there on the next iteration
+func (f *flow) forIteration(s *parser.ForStatement, out live, head live) live {
+	next := head
+	if s.Post != nil {
+		next = f.statement(s.Post, head)
+	}
+	f.loops = append(f.loops, loop{label: s.Label, exit: out, next: next})
+	body := f.block(s.Body, next)
+	f.loops = f.loops[:len(f.loops)-1]
+
+	in := body
+	if s.Condition != nil {
+		in = f.reads(s.Condition, union(in, out))
+	}
+	return in
+}
+
+// doWhile returns the variables live before a Do loop, walking it until
+// those live before its condition stop growing
+func (f *flow) doWhile(s *parser.DoWhileStatement, out live) live {
+	condition := f.reads(s.Condition, out)
+	report := f.report
+	f.report = false
+	for {
+		in := f.reads(s.Condition, union(out, f.doIteration(s, out, condition)))
+		if covers(condition, in) {
+			break
+		}
+		condition = union(condition, in)
+	}
+	f.report = report
+	return f.doIteration(s, out, condition)
+}
+
+// doIteration returns the variables live before the body of a Do loop,
+// given those live before its condition
+func (f *flow) doIteration(s *parser.DoWhileStatement, out live, condition live) live {
+	f.loops = append(f.loops, loop{label: s.Label, exit: out, next: condition})
+	body := f.block(s.Body, condition)
+	f.loops = f.loops[:len(f.loops)-1]
+	return body
+}
+
+// reads returns out with the variables expr reads
+func (f *flow) reads(expr parser.Expression, out live) live {
+	switch e := expr.(type) {
+	case *parser.Identifier:
+		if sym := f.c.reads[e]; sym != nil && !out[sym] {
+			out = union(out, live{sym: true})
+		}
+	case *parser.CallExpression:
+		if e.Receiver != nil {
+			out = f.reads(e.Receiver, out)
+		}
+		for _, arg := range e.Arguments {
+			out = f.reads(arg, out)
+		}
+	case *parser.TupleLiteral:
+		for _, el := range e.Elements {
+			out = f.reads(el, out)
+		}
+	case *parser.ArrayLiteral:
+		for _, el := range e.Elements {
+			out = f.reads(el, out)
+		}
+	case *parser.IndexExpression:
+		out = f.reads(e.Index, f.reads(e.Array, out))
+	case *parser.SliceExpression:
+		out = f.reads(e.Array, out)
+		if e.Start != nil {
+			out = f.reads(e.Start, out)
+		}
+		if e.End != nil {
+			out = f.reads(e.End, out)
+		}
+	case *parser.StructLiteral:
+		for _, field := range e.Fields {
+			out = f.reads(field.Value, out)
+		}
+	case *parser.FieldExpression:
+		out = f.reads(e.Struct, out)
+	case *parser.TypeExpression:
+		if e.Length != nil {
+			out = f.reads(e.Length, out)
+		}
+	case *parser.PrefixExpression:
+		out = f.reads(e.Right, out)
+	case *parser.InfixExpression:
+		out = f.reads(e.Right, f.reads(e.Left, out))
+	}
+	return out
+}
+
+func (f *flow) warnAt(tok lexer.Token, code string, format string, args ...interface{}) {
+	f.warnings = append(f.warnings, parser.Diagnostic{
+		File:    tok.File,
+		Line:    tok.Line,
+		Column:  tok.Column,
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+		Warning: true,
+	})
+}
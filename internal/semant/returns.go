@@ -0,0 +1,145 @@
+package semant
+
+import (
+	"strings"
+
+	"dreadlang/internal/lexer"
+	"dreadlang/internal/parser"
+)
+
+// A function that returns a value must not reach the } that ends its body,
+// where it would return whatever rax last held. Whether a statement can
+// complete, so that the one after it runs, follows its shape rather than
+// the values of its conditions: Return and Panic never complete, an If or a
+// Match completes unless it has an Else or Default and none of its bodies
+// completes, and a For without a condition only completes through a Break.
+
+// checkReturns reports a function returning a value whose body can run to
+// its end
+func (c *checker) checkReturns(fn *parser.FunctionStatement) {
+	if fn.IsEntry || !returnsValue(fn.ReturnType) {
+		return
+	}
+	if completes(fn.Body) {
+		c.errorAt(fn.Body.End, ErrMissingReturn, "missing Return at the end of %s, which returns %s", fn.Symbol(), fn.ReturnType)
+	}
+}
+
+// returnsValue reports whether a function declared to return typ must end
+// with a Return. One returning a Void result returns success when it runs
+// to its end.
+func returnsValue(typ string) bool {
+	switch strings.TrimSuffix(typ, "!") {
+	case "", "Void":
+		return false
+	}
+	return true
+}
+
+// completes reports whether running a block can reach its end
+func completes(block *parser.BlockStatement) bool {
+	for _, stmt := range block.Statements {
+		if !completesStatement(stmt) {
+			return false
+		}
+	}
+	return true
+}
+
+// completesStatement reports whether running stmt can go on to the
+// statement after it
+func completesStatement(stmt parser.Statement) bool {
+	switch s := stmt.(type) {
+	case *parser.CallStatement:
+		return s.Receiver != nil || s.Function != "Return" && s.Function != "Panic"
+	case *parser.BranchStatement:
+		return false
+	case *parser.BlockStatement:
+		return completes(s)
+	case *parser.IfStatement:
+		if s.Else == nil || completes(s.Else) {
+			return true
+		}
+		for _, b := range s.Branches {
+			if completes(b.Body) {
+				return true
+			}
+		}
+		return false
+	case *parser.MatchStatement:
+		if s.Default == nil || completes(s.Default) {
+			return true
+		}
+		for _, mc := range s.Cases {
+			if completes(mc.Body) {
+				return true
+			}
+		}
+		return false
+	case *parser.ForStatement:
+		return s.Condition != nil || leaves(s.Body, s.Label, true)
+	case *parser.DoWhileStatement:
+		// The condition is checked after a body that completes or continues
+		return completes(s.Body) || leaves(s.Body, s.Label, false)
+	case *parser.TryStatement:
+		return completes(s.Body) || completes(s.Catch)
+	}
+	return true
+}
+
+// leaves reports whether block, the body of a loop with label, has a Break
+// that ends the loop, or any Break or Continue of it when breakOnly is
+// false
+func leaves(block *parser.BlockStatement, label string, breakOnly bool) bool {
+	return branches(block.Statements, label, breakOnly, false)
+}
+
+// branches is leaves for the statements of a block, nested inside another
+// loop when nested is set, which takes the Breaks and Continues without a
+// label
+func branches(stmts []parser.Statement, label string, breakOnly bool, nested bool) bool {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *parser.BranchStatement:
+			ours := s.Label == "" && !nested || s.Label != "" && s.Label == label
+			if ours && (!breakOnly || s.Token.Type == lexer.BREAK) {
+				return true
+			}
+		case *parser.BlockStatement:
+			if branches(s.Statements, label, breakOnly, nested) {
+				return true
+			}
+		case *parser.IfStatement:
+			for _, b := range s.Branches {
+				if branches(b.Body.Statements, label, breakOnly, nested) {
+					return true
+				}
+			}
+			if s.Else != nil && branches(s.Else.Statements, label, breakOnly, nested) {
+				return true
+			}
+		case *parser.MatchStatement:
+			for _, mc := range s.Cases {
+				if branches(mc.Body.Statements, label, breakOnly, nested) {
+					return true
+				}
+			}
+			if s.Default != nil && branches(s.Default.Statements, label, breakOnly, nested) {
+				return true
+			}
+		case *parser.ForStatement:
+			if branches(s.Body.Statements, label, breakOnly, true) {
+				return true
+			}
+		case *parser.DoWhileStatement:
+			if branches(s.Body.Statements, label, breakOnly, true) {
+				return true
+			}
+		case *parser.TryStatement:
+			if branches(s.Body.Statements, label, breakOnly, nested) || branches(s.Catch.Statements, label, breakOnly, nested) {
+				return true
+			}
+		}
+	}
+	return false
+}
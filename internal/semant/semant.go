@@ -0,0 +1,534 @@
+// Package semant checks a parsed program before code is generated for it.
+// It builds the program's symbol tables, a file scope and one scope per
+// block, resolves every name a function or a file-scope declaration reads
+// against them, and reports what is wrong with a name regardless of types:
+// a variable or function declared nowhere, which is reported with the
+// declared name closest to it (see suggest.go), a call with the wrong number
+// of arguments, and a name read before the statement that declares it. Once
+// a program compiles, Warnings finds what it does in vain (see flow.go).
+//
+// The scopes follow the code generator's rules: a block's names are visible
+// in the blocks inside it from the statement declaring them on, a For loop's
+// variable only in the loop, and the constants and globals at file scope in
+// every function and in the file-scope declarations after them.
+package semant
+
+import (
+	"fmt"
+
+	"dreadlang/internal/lexer"
+	"dreadlang/internal/parser"
+)
+
+// Error codes of the checks this pass makes. Undefined names keep the codes
+// the code generator reported them with before this pass did.
+const (
+	ErrUndefinedVariable    = "E104"
+	ErrUndefinedFunction    = "E117"
+	ErrArgumentCount        = "E201"
+	ErrUseBeforeDeclaration = "E202"
+	ErrMissingReturn        = "E203"
+)
+
+// Warning codes
+const (
+	WarnDeadStore    = "W001"
+	WarnUnusedResult = "W002"
+)
+
+// builtins are the functions the language provides, which are called in
+// place of a declared function of the same name
+var builtins = map[string]bool{
+	"AlignOf": true, "Append": true, "Chr": true, "Error": true, "Len": true,
+	"Matches": true, "Ord": true, "Panic": true, "ParseInt": true, "Peek": true,
+	"Poke": true, "Print": true, "Return": true, "SizeOf": true, "Syscall": true,
+	"Try": true,
+}
+
+// conversions are the types a call converts to, besides the declared ones:
+// Int(x), UInt8(x)
+var conversions = map[string]bool{
+	"Int": true, "Float": true, "String": true, "Char": true,
+	"Int8": true, "Int16": true, "Int32": true, "Int64": true,
+	"UInt8": true, "UInt16": true, "UInt32": true, "UInt64": true,
+}
+
+// symbol is a declared name
+type symbol struct {
+	name  string
+	kind  string      // "constant", "global", "variable" or "parameter"
+	token lexer.Token // where it is declared
+}
+
+// scope holds the names declared in a block, or at file scope. pending
+// holds those that statements of the block not yet checked declare, so a
+// read of one of them is a read before its declaration.
+type scope struct {
+	parent  *scope
+	symbols map[string]*symbol
+	pending map[string]lexer.Token
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{parent: parent, symbols: make(map[string]*symbol), pending: make(map[string]lexer.Token)}
+}
+
+// lookup finds the innermost symbol called name
+func (s *scope) lookup(name string) (*symbol, bool) {
+	for ; s != nil; s = s.parent {
+		if sym, ok := s.symbols[name]; ok {
+			return sym, true
+		}
+	}
+	return nil, false
+}
+
+// declare adds a symbol to the scope
+func (s *scope) declare(name string, kind string, tok lexer.Token) *symbol {
+	sym := &symbol{name: name, kind: kind, token: tok}
+	s.symbols[name] = sym
+	delete(s.pending, name)
+	return sym
+}
+
+// checker holds the state of checking one program
+type checker struct {
+	functions map[string]arity   // plain functions, by name
+	entries   map[string]bool    // the Entry functions, which are not suggested
+	methods   map[string][]arity // the methods of each name, of every type
+	types     map[string]bool    // structs, interfaces and aliases
+	// the type parameters of the generic function being checked
+	typeParameters map[string]bool
+	results        map[string]bool // the functions, and .Name for the methods, whose every declaration returns a value
+	diagnostics    []parser.Diagnostic
+
+	// What the names of the program resolved to, for Warnings
+	reads    map[*parser.Identifier]*symbol
+	stores   map[parser.Statement][]*symbol      // the variables a statement assigns, in order, nil for _
+	elements map[*parser.AssignStatement]*symbol // the array or slice whose element an assignment sets
+}
+
+// Check checks program, which must have parsed without errors, and returns
+// what it found wrong
+func Check(program *parser.Program) []parser.Diagnostic {
+	return check(program).diagnostics
+}
+
+// check walks program, resolving its names
+func check(program *parser.Program) *checker {
+	c := &checker{
+		functions: make(map[string]arity),
+		entries:   make(map[string]bool),
+		methods:   make(map[string][]arity),
+		types:     make(map[string]bool),
+		results:   make(map[string]bool),
+		reads:     make(map[*parser.Identifier]*symbol),
+		stores:    make(map[parser.Statement][]*symbol),
+		elements:  make(map[*parser.AssignStatement]*symbol),
+	}
+	c.collect(program)
+
+	// File-scope constants and globals are visible in the declarations
+	// that follow them, and in every function
+	file := newScope(nil)
+	for _, stmt := range program.Statements {
+		if name, tok, ok := fileDeclaration(stmt); ok {
+			if _, exists := file.pending[name]; !exists {
+				file.pending[name] = tok
+			}
+		}
+	}
+	for _, stmt := range program.Statements {
+		switch s := stmt.(type) {
+		case *parser.ConstStatement:
+			c.expression(file, s.Value)
+			file.declare(s.Name, "constant", s.Token)
+		case *parser.VarStatement:
+			c.optional(file, s.Length)
+			c.optional(file, s.Value)
+			file.declare(s.Name, "global", s.Token)
+		case *parser.StructStatement:
+			for _, f := range s.Fields {
+				c.optional(file, f.Length)
+			}
+		case *parser.TypeAliasStatement:
+			c.optional(file, s.Length)
+		}
+	}
+	for _, stmt := range program.Statements {
+		if fn, ok := stmt.(*parser.FunctionStatement); ok && fn.Body != nil {
+			c.function(file, fn)
+		}
+	}
+	return c
+}
+
+// collect records the functions, methods and types the program declares,
+// which are visible everywhere
+func (c *checker) collect(program *parser.Program) {
+	for _, stmt := range program.Statements {
+		switch s := stmt.(type) {
+		case *parser.FunctionStatement:
+			if s.Receiver != nil {
+				c.methods[s.Name] = append(c.methods[s.Name], arityOf(s.Parameters))
+				c.returns("."+s.Name, s.ReturnType)
+			} else if _, exists := c.functions[s.Name]; !exists {
+				c.functions[s.Name] = arityOf(s.Parameters)
+				c.entries[s.Name] = s.IsEntry
+				c.returns(s.Name, s.ReturnType)
+			}
+		case *parser.InterfaceStatement:
+			c.types[s.Name] = true
+			for _, m := range s.Methods {
+				c.methods[m.Name] = append(c.methods[m.Name], arityOf(m.Parameters))
+				c.returns("."+m.Name, m.ReturnType)
+			}
+		case *parser.StructStatement:
+			c.types[s.Name] = true
+		case *parser.TypeAliasStatement:
+			c.types[s.Name] = true
+		}
+	}
+}
+
+// returns records whether a function, or a method of any type, returns a
+// value. A method name only does when every method of that name does.
+func (c *checker) returns(name string, typ string) {
+	result := typ != "" && typ != "Void"
+	if previous, ok := c.results[name]; ok {
+		result = result && previous
+	}
+	c.results[name] = result
+}
+
+// fileDeclaration returns the name a file-scope constant or global declares
+func fileDeclaration(stmt parser.Statement) (string, lexer.Token, bool) {
+	switch s := stmt.(type) {
+	case *parser.ConstStatement:
+		return s.Name, s.Token, true
+	case *parser.VarStatement:
+		return s.Name, s.Token, true
+	}
+	return "", lexer.Token{}, false
+}
+
+// function checks the body of a function, whose parameters and receiver
+// are its outermost names
+func (c *checker) function(file *scope, fn *parser.FunctionStatement) {
+	params := newScope(file)
+	if fn.Receiver != nil {
+		params.declare(fn.Receiver.Name, "parameter", fn.Receiver.Token)
+	}
+	for _, p := range fn.Parameters {
+		params.declare(p.Name, "parameter", p.Token)
+	}
+	c.typeParameters = make(map[string]bool)
+	for _, name := range fn.TypeParameters {
+		c.typeParameters[name] = true
+	}
+	c.block(params, fn.Body)
+	c.checkReturns(fn)
+}
+
+// block checks a block in a new scope inside outer
+func (c *checker) block(outer *scope, block *parser.BlockStatement) {
+	s := newScope(outer)
+	for _, stmt := range block.Statements {
+		for _, d := range declarations(stmt) {
+			if _, exists := s.pending[d.Literal]; !exists {
+				s.pending[d.Literal] = d
+			}
+		}
+	}
+	for _, stmt := range block.Statements {
+		c.statement(s, stmt)
+	}
+}
+
+// declarations returns the names a statement may declare in its block: the
+// variables it assigns, and those it declares with Var or Const
+func declarations(stmt parser.Statement) []lexer.Token {
+	switch s := stmt.(type) {
+	case *parser.AssignStatement:
+		if s.Field == nil && s.Index == nil {
+			return []lexer.Token{named(s.Token, s.Name)}
+		}
+	case *parser.DestructureStatement:
+		var names []lexer.Token
+		for _, name := range s.Names {
+			names = append(names, named(s.Token, name))
+		}
+		return names
+	case *parser.VarStatement:
+		return []lexer.Token{named(s.Token, s.Name)}
+	case *parser.ConstStatement:
+		return []lexer.Token{named(s.Token, s.Name)}
+	}
+	return nil
+}
+
+// named returns tok with name as its text, for a declaration whose token
+// is not the name itself
+func named(tok lexer.Token, name string) lexer.Token {
+	tok.Literal = name
+	return tok
+}
+
+// statement checks one statement in scope s
+func (c *checker) statement(s *scope, stmt parser.Statement) {
+	switch st := stmt.(type) {
+	case *parser.AssignStatement:
+		c.assign(s, st)
+	case *parser.DestructureStatement:
+		c.expression(s, st.Value)
+		for _, name := range st.Names {
+			c.stores[st] = append(c.stores[st], c.assigned(s, named(st.Token, name)))
+		}
+	case *parser.VarStatement:
+		c.optional(s, st.Length)
+		c.optional(s, st.Value)
+		c.stores[st] = []*symbol{s.declare(st.Name, "variable", st.Token)}
+	case *parser.ConstStatement:
+		c.expression(s, st.Value)
+		s.declare(st.Name, "constant", st.Token)
+	case *parser.CallStatement:
+		c.call(s, st.Token, st.Receiver, st.Function, st.Arguments)
+	case *parser.ForStatement:
+		loop := newScope(s)
+		if init, ok := st.Init.(*parser.AssignStatement); ok {
+			if init.Field == nil && init.Index == nil {
+				// The loop variable always gets a slot of its own
+				c.expression(loop, init.Value)
+				c.stores[init] = []*symbol{loop.declare(init.Name, "variable", init.Token)}
+			} else {
+				c.assign(loop, init)
+			}
+		}
+		c.optional(loop, st.Condition)
+		c.block(loop, st.Body)
+		if post, ok := st.Post.(*parser.AssignStatement); ok {
+			c.assign(loop, post)
+		}
+	case *parser.IfStatement:
+		for _, b := range st.Branches {
+			c.expression(s, b.Condition)
+			c.block(s, b.Body)
+		}
+		if st.Else != nil {
+			c.block(s, st.Else)
+		}
+	case *parser.DoWhileStatement:
+		c.block(s, st.Body)
+		c.expression(s, st.Condition)
+	case *parser.TryStatement:
+		c.block(s, st.Body)
+		catch := newScope(s)
+		if st.ErrorName != nil {
+			catch.declare(st.ErrorName.Value, "variable", st.ErrorName.Token)
+		}
+		c.block(catch, st.Catch)
+	case *parser.MatchStatement:
+		c.expression(s, st.Value)
+		for _, mc := range st.Cases {
+			for _, v := range mc.Values {
+				c.expression(s, v)
+			}
+			c.block(s, mc.Body)
+		}
+		if st.Default != nil {
+			c.block(s, st.Default)
+		}
+	case *parser.BlockStatement:
+		c.block(s, st)
+	}
+}
+
+// assign checks an assignment, which declares its variable when no
+// variable of that name is visible
+func (c *checker) assign(s *scope, stmt *parser.AssignStatement) {
+	c.expression(s, stmt.Value)
+	if stmt.Field != nil || stmt.Index != nil {
+		if stmt.Field != nil {
+			c.expression(s, stmt.Field)
+		} else {
+			target := stmt.Target().(*parser.Identifier)
+			c.expression(s, target)
+			c.elements[stmt] = c.reads[target]
+		}
+		c.optional(s, stmt.Index)
+		return
+	}
+	c.stores[stmt] = []*symbol{c.assigned(s, stmt.Token)}
+}
+
+// assigned returns the variable named by tok, declaring it in s unless one
+// is visible, or nil for _, which discards a value
+func (c *checker) assigned(s *scope, tok lexer.Token) *symbol {
+	if tok.Literal == "_" {
+		return nil
+	}
+	if sym, exists := s.lookup(tok.Literal); exists {
+		return sym
+	}
+	return s.declare(tok.Literal, "variable", tok)
+}
+
+// optional checks expr unless it is nil, as the length of a type that is
+// not an array is
+func (c *checker) optional(s *scope, expr parser.Expression) {
+	if expr != nil {
+		c.expression(s, expr)
+	}
+}
+
+// expression resolves the names expr reads and checks the calls it makes
+func (c *checker) expression(s *scope, expr parser.Expression) {
+	switch e := expr.(type) {
+	case *parser.Identifier:
+		c.resolve(s, e)
+	case *parser.CallExpression:
+		c.call(s, e.Token, e.Receiver, e.Function, e.Arguments)
+	case *parser.TupleLiteral:
+		for _, el := range e.Elements {
+			c.expression(s, el)
+		}
+	case *parser.ArrayLiteral:
+		for _, el := range e.Elements {
+			c.expression(s, el)
+		}
+	case *parser.IndexExpression:
+		c.expression(s, e.Array)
+		c.expression(s, e.Index)
+	case *parser.SliceExpression:
+		c.expression(s, e.Array)
+		c.optional(s, e.Start)
+		c.optional(s, e.End)
+	case *parser.StructLiteral:
+		for _, f := range e.Fields {
+			c.expression(s, f.Value)
+		}
+	case *parser.FieldExpression:
+		c.expression(s, e.Struct)
+	case *parser.TypeExpression:
+		c.optional(s, e.Length)
+	case *parser.PrefixExpression:
+		c.expression(s, e.Right)
+	case *parser.InfixExpression:
+		c.expression(s, e.Left)
+		c.expression(s, e.Right)
+	}
+}
+
+// resolve finds the declaration of a name that is read. A name that a
+// statement of an enclosing block declares later is reported as read too
+// early, and one declared nowhere as undefined.
+func (c *checker) resolve(s *scope, id *parser.Identifier) {
+	if sym, ok := s.lookup(id.Value); ok {
+		c.reads[id] = sym
+		return
+	}
+	for outer := s; outer != nil; outer = outer.parent {
+		if tok, ok := outer.pending[id.Value]; ok {
+			c.errorAt(id.Token, ErrUseBeforeDeclaration, "%s is used before it is declared, %s", id.Value, where(id.Token, tok))
+			return
+		}
+	}
+	c.diagnostics = append(c.diagnostics, Suggest(id.Token, ErrUndefinedVariable, "variable", id.Value, s.names()))
+}
+
+// where describes the position of tok, a declaration, for a diagnostic
+// about use
+func where(use lexer.Token, tok lexer.Token) string {
+	if tok.Line == use.Line && tok.File == use.File {
+		return "on the same line"
+	}
+	if tok.File != use.File && tok.File != "" {
+		return fmt.Sprintf("in %s on line %d", tok.File, tok.Line)
+	}
+	return fmt.Sprintf("on line %d", tok.Line)
+}
+
+// call checks the arguments of a call, and that a function or method is
+// called with as many as it has parameters
+func (c *checker) call(s *scope, tok lexer.Token, receiver parser.Expression, function string, args []parser.Expression) {
+	if receiver != nil {
+		c.expression(s, receiver)
+	}
+	for _, arg := range args {
+		if id, ok := arg.(*parser.Identifier); ok && (function == "SizeOf" || function == "AlignOf") && c.isType(id.Value) {
+			// A type, not a value
+			continue
+		}
+		c.expression(s, arg)
+	}
+
+	switch {
+	case receiver != nil:
+		methods := c.methods[function]
+		for _, m := range methods {
+			if m != methods[0] {
+				// Which method is called depends on the receiver's type
+				return
+			}
+		}
+		if len(methods) > 0 {
+			c.checkArguments(tok, "method "+function, methods[0], len(args))
+		}
+	case builtins[function] || c.isType(function):
+	default:
+		fn, ok := c.functions[function]
+		if !ok {
+			c.diagnostics = append(c.diagnostics, Suggest(tok, ErrUndefinedFunction, "function", function, c.functionNames()))
+			return
+		}
+		c.checkArguments(tok, "function "+function, fn, len(args))
+	}
+}
+
+// isType reports whether name is a type, which a call converts to and
+// SizeOf measures
+func (c *checker) isType(name string) bool {
+	return c.types[name] || conversions[name] || c.typeParameters[name]
+}
+
+// arity is how many arguments a function or method takes
+type arity struct {
+	parameters int
+	variadic   bool // the last parameter takes any number of them, none included
+}
+
+func arityOf(parameters []*parser.Parameter) arity {
+	n := len(parameters)
+	if n > 0 && parameters[n-1].Variadic {
+		return arity{parameters: n - 1, variadic: true}
+	}
+	return arity{parameters: n}
+}
+
+// checkArguments reports a call passing n arguments to what, which takes a
+func (c *checker) checkArguments(tok lexer.Token, what string, a arity, n int) {
+	switch {
+	case a.variadic && n < a.parameters:
+		c.errorAt(tok, ErrArgumentCount, "%s expects at least %s, got %d", what, arguments(a.parameters), n)
+	case !a.variadic && n != a.parameters:
+		c.errorAt(tok, ErrArgumentCount, "%s expects %s, got %d", what, arguments(a.parameters), n)
+	}
+}
+
+// arguments renders a number of arguments
+func arguments(n int) string {
+	if n == 1 {
+		return "1 argument"
+	}
+	return fmt.Sprintf("%d arguments", n)
+}
+
+func (c *checker) errorAt(tok lexer.Token, code string, format string, args ...interface{}) {
+	c.diagnostics = append(c.diagnostics, parser.Diagnostic{
+		File:    tok.File,
+		Line:    tok.Line,
+		Column:  tok.Column,
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
@@ -0,0 +1,106 @@
+package semant
+
+import (
+	"sort"
+	"strings"
+
+	"dreadlang/internal/lexer"
+	"dreadlang/internal/parser"
+)
+
+// Undefined names are reported with the closest defined name of the same
+// kind, when one is close enough to be a misspelling of it:
+//
+//	undefined variable countr, did you mean count?
+
+// builtinNames are the builtin functions a call may have misspelled
+var builtinNames = []string{"AlignOf", "Append", "Chr", "Len", "Matches", "Ord", "Panic", "ParseInt", "Peek", "Poke", "Print", "SizeOf", "Syscall"}
+
+// ClosestName returns the candidate with the fewest single-character edits
+// from name, no more than a third of name's length away; differences of
+// case are not counted, so a short name still finds its other spelling.
+// Ties go to the first in alphabetical order.
+func ClosestName(name string, candidates []string) (string, bool) {
+	sorted := append([]string(nil), candidates...)
+	sort.Strings(sorted)
+	best, bestDistance := "", len(name)/3+1
+	for _, candidate := range sorted {
+		if candidate == name {
+			continue
+		}
+		d := editDistance(strings.ToLower(name), strings.ToLower(candidate))
+		if d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best, best != ""
+}
+
+// editDistance is the number of characters to insert, delete or replace,
+// or of adjacent pairs to swap, to turn a into b (the optimal string
+// alignment distance)
+func editDistance(a, b string) int {
+	// d[i][j] is the distance between a[:i] and b[:j]
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+// Suggest returns the diagnostic reporting the name of tok, of the given
+// kind, as undefined, suggesting the closest of candidates. The suggestion
+// is attached as a fix when tok is the name itself.
+func Suggest(tok lexer.Token, code string, kind string, name string, candidates []string) parser.Diagnostic {
+	d := parser.Diagnostic{File: tok.File, Line: tok.Line, Column: tok.Column, Code: code}
+	suggestion, ok := ClosestName(name, candidates)
+	if !ok {
+		d.Message = "undefined " + kind + " " + name
+		return d
+	}
+	d.Message = "undefined " + kind + " " + name + ", did you mean " + suggestion + "?"
+	if tok.Literal == name {
+		d.Fix = &parser.Fix{Line: tok.Line, Column: tok.Column, Old: name, New: suggestion}
+	}
+	return d
+}
+
+// names returns the names of the variables, parameters and constants
+// visible in s
+func (s *scope) names() []string {
+	var names []string
+	for ; s != nil; s = s.parent {
+		for name := range s.symbols {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// functionNames returns the names of the builtin and declared functions
+// that can be called by name; methods need a receiver
+func (c *checker) functionNames() []string {
+	names := append([]string(nil), builtinNames...)
+	for name := range c.functions {
+		if !c.entries[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
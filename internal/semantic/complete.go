@@ -0,0 +1,292 @@
+package semantic
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"dreadlang/internal/codegen"
+	"dreadlang/internal/lexer"
+	"dreadlang/internal/parser"
+)
+
+// Completion is something that may be written at a position: a name in
+// scope there, a builtin, or a keyword that fits the grammar there
+type Completion struct {
+	Label  string
+	Kind   string // "variable", "parameter", "constant", "function", "builtin" or "keyword"
+	Detail string // the type of a variable or constant, how a function is called
+}
+
+// builtins are the builtin functions, with how each is called
+var builtins = []Completion{
+	{Label: "AlignOf", Kind: "builtin", Detail: "AlignOf(Type) Int"},
+	{Label: "Append", Kind: "builtin", Detail: "Append(xs T[], value T)"},
+	{Label: "Chr", Kind: "builtin", Detail: "Chr(n Int) Char"},
+	{Label: "Error", Kind: "builtin", Detail: "Error(message String)"},
+	{Label: "Len", Kind: "builtin", Detail: "Len(x) Int"},
+	{Label: "Matches", Kind: "builtin", Detail: "Matches(pattern String, text String) Int"},
+	{Label: "Ord", Kind: "builtin", Detail: "Ord(c Char) Int"},
+	{Label: "Panic", Kind: "builtin", Detail: "Panic(message String)"},
+	{Label: "ParseInt", Kind: "builtin", Detail: "ParseInt(text String) Int!"},
+	{Label: "Peek", Kind: "builtin", Detail: "Peek(address Int, width Int) Int"},
+	{Label: "Poke", Kind: "builtin", Detail: "Poke(address Int, value Int, width Int)"},
+	{Label: "Print", Kind: "builtin", Detail: "Print(value)"},
+	{Label: "SizeOf", Kind: "builtin", Detail: "SizeOf(Type) Int"},
+	{Label: "Syscall", Kind: "builtin", Detail: "Syscall(name String, arguments...) Int"},
+	{Label: "Try", Kind: "builtin", Detail: "Try(result T!) T"},
+}
+
+// The keywords that may start a declaration at file scope, a statement in a
+// block, and an expression
+var (
+	declarationKeywords = []string{"Const", "Entry", "Function", "Import", "Interface", "Module", "Private", "Public", "Struct", "Type", "Var"}
+	statementKeywords   = []string{"Break", "Const", "Continue", "Do", "For", "If", "Match", "Return", "Var"}
+	expressionKeywords  = []string{"nil"}
+)
+
+// statementEnds are the tokens a statement may end with, so that the next
+// line starts a new statement rather than continuing an expression
+var statementEnds = map[lexer.TokenType]bool{
+	lexer.IDENT: true, lexer.STRING: true, lexer.CHAR: true, lexer.INT: true, lexer.FLOAT: true, lexer.NIL: true,
+	lexer.RPAREN: true, lexer.RBRACKET: true, lexer.QUESTION: true, lexer.BREAK: true, lexer.CONTINUE: true,
+	lexer.INT_TYPE: true, lexer.FLOAT_TYPE: true, lexer.CHAR_TYPE: true, lexer.STRING_TYPE: true,
+}
+
+// Complete returns what may be written at the byte offset in file, which
+// the name being written there, if any, starts: the variables, parameters
+// and constants in scope and the functions and builtins, in a statement or
+// expression, and the keywords that may start one. Outside any function
+// only declaration keywords are offered, and nothing after a dot. If the
+// file has syntax errors, it is analyzed without the line being written.
+func Complete(file string, offset int) ([]Completion, error) {
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 || offset > len(source) {
+		return nil, fmt.Errorf("%s: offset %d is outside the file", file, offset)
+	}
+	completions, err := complete(file, string(source), offset)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%v", file, err)
+	}
+	return completions, nil
+}
+
+func complete(file string, source string, offset int) ([]Completion, error) {
+	a, err := analyze(file, source)
+	if err != nil {
+		// The line being written is the likeliest to be incomplete
+		if a, err = analyze(file, blankLine(source, offset)); err != nil {
+			return nil, err
+		}
+	}
+	start := offset
+	for start > 0 && isNameByte(source[start-1]) {
+		start--
+	}
+	prefix := strings.ToLower(source[start:offset])
+	pos := position(source, start)
+	b := scanBlocks(source)
+
+	var candidates []Completion
+	prev, depth := b.before(pos)
+	switch {
+	case prev.Type == lexer.DOT:
+		return nil, nil
+	case depth == 0:
+		candidates = keywords(declarationKeywords)
+	case prev.Type == lexer.LBRACE || prev.Type == lexer.RBRACE || prev.Line < pos.Line && statementEnds[prev.Type]:
+		candidates = append(names(a, b, pos), keywords(statementKeywords)...)
+		if prev.Type == lexer.RBRACE {
+			candidates = append(candidates, Completion{Label: "Else", Kind: "keyword"})
+		}
+	default:
+		candidates = append(names(a, b, pos), keywords(expressionKeywords)...)
+	}
+
+	var completions []Completion
+	for _, c := range candidates {
+		if strings.HasPrefix(strings.ToLower(c.Label), prefix) {
+			completions = append(completions, c)
+		}
+	}
+	return completions, nil
+}
+
+// names returns the variables, parameters and constants in scope at pos,
+// the innermost of any that share a name, then the functions and builtins,
+// each in alphabetical order without regard to case. Those private to a
+// module are left out.
+func names(a *analysis, b *blocks, pos Position) []Completion {
+	type declared struct {
+		Completion
+		at Position
+	}
+	hidden := make(map[lexer.Token]bool)
+	for _, stmt := range a.program.Statements {
+		switch s := stmt.(type) {
+		case *parser.ConstStatement:
+			hidden[s.Token] = s.Private && s.Token.File != ""
+		case *parser.VarStatement:
+			hidden[s.Token] = s.Private && s.Token.File != ""
+		}
+	}
+	visible := make(map[string]declared)
+	seen := make(map[lexer.Token]bool)
+	for _, r := range a.all {
+		if r.Kind == "function" || r.Token != r.Declaration || seen[r.Token] || hidden[r.Token] {
+			continue
+		}
+		seen[r.Token] = true
+		at := positionOf(r.Declaration)
+		if r.Scope != "global" && (r.Token.File != "" || !before(at, pos) || !b.inScope(at, pos)) {
+			continue
+		}
+		c := Completion{Label: r.Token.Literal, Kind: "variable", Detail: r.Type}
+		switch {
+		case r.Kind == "constant":
+			c.Kind = "constant"
+		case r.Scope == "parameter":
+			c.Kind = "parameter"
+		}
+		// Globals have no position in the function, so any local hides them
+		if r.Scope == "global" {
+			at = Position{}
+		}
+		if other, ok := visible[c.Label]; !ok || before(other.at, at) {
+			visible[c.Label] = declared{c, at}
+		}
+	}
+	var variables []Completion
+	for _, d := range visible {
+		variables = append(variables, d.Completion)
+	}
+	sortCompletions(variables)
+
+	var functions []Completion
+	for _, stmt := range a.program.Statements {
+		if fn, ok := stmt.(*parser.FunctionStatement); ok && !fn.IsEntry && fn.Receiver == nil && !(fn.Private && fn.NameToken.File != "") {
+			functions = append(functions, Completion{Label: fn.Name, Kind: "function", Detail: codegen.Signature(fn)})
+		}
+	}
+	sortCompletions(functions)
+	return append(append(variables, functions...), builtins...)
+}
+
+func keywords(words []string) []Completion {
+	completions := make([]Completion, len(words))
+	for i, word := range words {
+		completions[i] = Completion{Label: word, Kind: "keyword"}
+	}
+	return completions
+}
+
+func sortCompletions(completions []Completion) {
+	sort.Slice(completions, func(i, j int) bool {
+		return strings.ToLower(completions[i].Label) < strings.ToLower(completions[j].Label)
+	})
+}
+
+// blocks holds the tokens of a source, for finding the blocks that contain
+// a position
+type blocks struct {
+	tokens []lexer.Token
+}
+
+func scanBlocks(source string) *blocks {
+	b := &blocks{}
+	l := lexer.New(source)
+	for tok := l.NextToken(); tok.Type != lexer.EOF; tok = l.NextToken() {
+		if tok.Type != lexer.COMMENT {
+			b.tokens = append(b.tokens, tok)
+		}
+	}
+	return b
+}
+
+// before returns the last token before pos and the number of braces open
+// there
+func (b *blocks) before(pos Position) (lexer.Token, int) {
+	var prev lexer.Token
+	depth := 0
+	for _, tok := range b.tokens {
+		if !before(positionOf(tok), pos) {
+			break
+		}
+		prev = tok
+		switch tok.Type {
+		case lexer.LBRACE:
+			depth++
+		case lexer.RBRACE:
+			depth--
+		}
+	}
+	return prev, depth
+}
+
+// inScope reports whether a name declared at decl may be used at pos: pos
+// is in the block it was declared in. A name declared in parentheses, a
+// parameter or the variable of a For, belongs to the block that follows.
+func (b *blocks) inScope(decl Position, pos Position) bool {
+	var open []int // indexes of the braces open, innermost last
+	parens := 0
+	scope := -1
+	found, following := false, false
+	for i, tok := range b.tokens {
+		if !found && !before(positionOf(tok), decl) {
+			found = true
+			if parens > 0 {
+				following = true
+			} else if len(open) == 0 {
+				return true
+			} else {
+				scope = open[len(open)-1]
+			}
+		}
+		if following && tok.Type == lexer.LBRACE {
+			scope, following = i, false
+		}
+		switch tok.Type {
+		case lexer.LPAREN:
+			parens++
+		case lexer.RPAREN:
+			parens--
+		case lexer.LBRACE:
+			open = append(open, i)
+			parens = 0
+		case lexer.RBRACE:
+			if len(open) == 0 {
+				continue
+			}
+			if open[len(open)-1] == scope {
+				return before(pos, positionOf(tok))
+			}
+			open = open[:len(open)-1]
+		}
+	}
+	return true // the block is never closed
+}
+
+// before reports whether p comes before q
+func before(p, q Position) bool {
+	return p.Line < q.Line || p.Line == q.Line && p.Column < q.Column
+}
+
+// blankLine replaces the line of source containing offset with spaces
+func blankLine(source string, offset int) string {
+	start := strings.LastIndexByte(source[:offset], '\n') + 1
+	end := strings.IndexByte(source[offset:], '\n')
+	if end < 0 {
+		end = len(source)
+	} else {
+		end += offset
+	}
+	return source[:start] + strings.Repeat(" ", end-start) + source[end:]
+}
+
+func isNameByte(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
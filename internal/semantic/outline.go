@@ -0,0 +1,102 @@
+package semantic
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"dreadlang/internal/codegen"
+	"dreadlang/internal/lexer"
+	"dreadlang/internal/parser"
+)
+
+// FoldingRange is lines of a file an editor may fold away, keeping the
+// first: a function's body from its { to its }, or a block comment
+type FoldingRange struct {
+	Start int    // the line of the { or /*
+	End   int    // the line of the } or */
+	Kind  string // "region" or "comment", as in the language server protocol
+}
+
+// Symbol is a function or method in the outline of a file
+type Symbol struct {
+	Name      string
+	Kind      string   // "function" or "method"
+	Detail    string   // its signature: sum(values Int...) Int
+	Start     Position // of the Function or Entry keyword
+	End       Position // of the } that closes its body
+	Selection Position // of its name
+}
+
+// FoldingRanges returns the function bodies and block comments of file
+// that span more than one line, in the order they start. Only the file is
+// parsed, not the modules it imports, and when it has syntax errors the
+// functions that could still be parsed are folded.
+func FoldingRanges(file string) ([]FoldingRange, error) {
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	program, comments := parse(string(source))
+	var ranges []FoldingRange
+	for _, fn := range functions(program) {
+		if fn.Body.End.Line > fn.Body.Token.Line {
+			ranges = append(ranges, FoldingRange{Start: fn.Body.Token.Line, End: fn.Body.End.Line, Kind: "region"})
+		}
+	}
+	for _, c := range comments {
+		if lines := strings.Count(c.Literal, "\n"); lines > 0 {
+			ranges = append(ranges, FoldingRange{Start: c.Line, End: c.Line + lines, Kind: "comment"})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].Start < ranges[j].Start
+	})
+	return ranges, nil
+}
+
+// Outline returns the functions and methods declared in file, Entry among
+// them, in the order they are declared. Like FoldingRanges, it only parses
+// the file.
+func Outline(file string) ([]Symbol, error) {
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	program, _ := parse(string(source))
+	var symbols []Symbol
+	for _, fn := range functions(program) {
+		kind := "function"
+		if fn.Receiver != nil {
+			kind = "method"
+		}
+		symbols = append(symbols, Symbol{
+			Name:      fn.Name,
+			Kind:      kind,
+			Detail:    codegen.Signature(fn),
+			Start:     positionOf(fn.Token),
+			End:       positionOf(fn.Body.End),
+			Selection: positionOf(fn.NameToken),
+		})
+	}
+	return symbols, nil
+}
+
+// parse parses source on its own, returning what could be parsed despite
+// any syntax errors, and its block comments
+func parse(source string) (*parser.Program, []lexer.Token) {
+	l := lexer.New(source)
+	program := parser.New(l).ParseProgram()
+	return program, l.Comments()
+}
+
+// functions returns the functions of program that have a body
+func functions(program *parser.Program) []*parser.FunctionStatement {
+	var fns []*parser.FunctionStatement
+	for _, stmt := range program.Statements {
+		if fn, ok := stmt.(*parser.FunctionStatement); ok && fn.Body != nil {
+			fns = append(fns, fn)
+		}
+	}
+	return fns
+}
@@ -0,0 +1,169 @@
+package semantic
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"dreadlang/internal/lexer"
+)
+
+// References returns the positions of the names in file that refer to the
+// same variable, constant or function as the name at the byte offset, its
+// declaration included unless an imported module has it, in the order they
+// appear. It returns nil if there is no name there.
+func References(file string, offset int) ([]Position, error) {
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 || offset > len(source) {
+		return nil, fmt.Errorf("%s: offset %d is outside the file", file, offset)
+	}
+	a, err := analyze(file, string(source))
+	if err != nil {
+		return nil, fmt.Errorf("%s:%v", file, err)
+	}
+	r, ok := a.referenceAt(position(string(source), offset))
+	if !ok {
+		return nil, nil
+	}
+	if r.Declaration.Line == 0 {
+		return []Position{positionOf(r.Token)}, nil
+	}
+	declaration, in := positionOf(r.Declaration), r.Declaration.File
+	var positions []Position
+	for _, r := range a.references {
+		if positionOf(r.Declaration) != declaration || r.Declaration.File != in {
+			continue
+		}
+		positions = append(positions, positionOf(r.Token))
+		if in == "" {
+			positions = append(positions, declaration)
+		}
+	}
+	return sortPositions(positions), nil
+}
+
+// Rename renames every variable, constant and function called old in file
+// to new, and returns the renamed source and the number of names changed,
+// which is 0 if nothing is called old; the file itself is left alone. The rename is refused if it would change
+// what any name refers to, as when new is already the name of a variable in
+// scope, or the errors the program has.
+func Rename(file string, old, new string) (string, int, error) {
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return "", 0, err
+	}
+	renamed, n, err := rename(file, string(source), old, new)
+	if err != nil {
+		return "", 0, fmt.Errorf("%s: %v", file, err)
+	}
+	return renamed, n, nil
+}
+
+func rename(file string, source string, old, new string) (string, int, error) {
+	l := lexer.New(new)
+	if tok := l.NextToken(); tok.Type != lexer.IDENT || tok.Literal != new || l.NextToken().Type != lexer.EOF {
+		return "", 0, fmt.Errorf("%s is not a name", new)
+	}
+	before, err := analyze(file, source)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var positions []Position
+	for _, r := range before.references {
+		for _, tok := range []lexer.Token{r.Token, r.Declaration} {
+			// A name declared in an imported module is only renamed here,
+			// which the check below refuses
+			if tok.Literal == old && tok.Line > 0 && tok.File == "" {
+				positions = append(positions, positionOf(tok))
+			}
+		}
+	}
+	positions = sortPositions(positions)
+	if len(positions) == 0 {
+		return source, 0, nil
+	}
+	renamed, err := replaceAt(source, positions, old, new)
+	if err != nil {
+		return "", 0, err
+	}
+
+	// The renamed program must mean the same: every name refers to the
+	// same declaration, now moved along its line by the names renamed
+	// before it, and the diagnostics are the same
+	after, err := analyze(file, renamed)
+	if err != nil {
+		return "", 0, fmt.Errorf("renaming %s to %s breaks the program: %v", old, new, err)
+	}
+	moved := func(p Position) Position {
+		for _, q := range positions {
+			if q.Line == p.Line && q.Column < p.Column {
+				p.Column += len(new) - len(old)
+			}
+		}
+		return p
+	}
+	if len(after.references) != len(before.references) {
+		return "", 0, fmt.Errorf("renaming %s to %s would change what the program's names refer to", old, new)
+	}
+	for i, b := range before.references {
+		a := after.references[i]
+		if positionOf(a.Token) != moved(positionOf(b.Token)) || positionOf(a.Declaration) != moved(positionOf(b.Declaration)) {
+			return "", 0, fmt.Errorf("renaming %s to %s would change what %s at %d:%d refers to", old, new, b.Token.Literal, b.Token.Line, b.Token.Column)
+		}
+	}
+	if len(after.diagnostics) != len(before.diagnostics) {
+		return "", 0, fmt.Errorf("renaming %s to %s would change the program's errors", old, new)
+	}
+	for i, b := range before.diagnostics {
+		if after.diagnostics[i].Code != b.Code {
+			return "", 0, fmt.Errorf("renaming %s to %s would change the program's errors", old, new)
+		}
+	}
+	return renamed, len(positions), nil
+}
+
+// replaceAt replaces old with new at each of positions, which are sorted
+func replaceAt(source string, positions []Position, old, new string) (string, error) {
+	offsets := make([]int, 0, len(positions))
+	line, start := 1, 0
+	for _, pos := range positions {
+		for ; line < pos.Line; line++ {
+			next := start
+			for next < len(source) && source[next] != '\n' {
+				next++
+			}
+			start = next + 1
+		}
+		offset := start + pos.Column - 1
+		if offset+len(old) > len(source) || source[offset:offset+len(old)] != old {
+			return "", fmt.Errorf("%d:%d is not %s", pos.Line, pos.Column, old)
+		}
+		offsets = append(offsets, offset)
+	}
+	for i := len(offsets) - 1; i >= 0; i-- {
+		source = source[:offsets[i]] + new + source[offsets[i]+len(old):]
+	}
+	return source, nil
+}
+
+// sortPositions sorts positions in the order they appear in the source and
+// drops repeats
+func sortPositions(positions []Position) []Position {
+	sort.Slice(positions, func(i, j int) bool {
+		if positions[i].Line != positions[j].Line {
+			return positions[i].Line < positions[j].Line
+		}
+		return positions[i].Column < positions[j].Column
+	})
+	var unique []Position
+	for i, p := range positions {
+		if i == 0 || p != positions[i-1] {
+			unique = append(unique, p)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,120 @@
+// Package semantic answers questions about what the names in a Dread
+// program mean, for tools such as editors: the type of a variable and where
+// it was declared, or the signature of a function.
+package semantic
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"dreadlang/internal/codegen"
+	"dreadlang/internal/lexer"
+	"dreadlang/internal/module"
+	"dreadlang/internal/parser"
+	"dreadlang/internal/semant"
+)
+
+// Position is a place in a source file, counted from 1 like diagnostics
+type Position struct {
+	Line   int
+	Column int
+}
+
+// Info describes the entity a name refers to
+type Info struct {
+	Name        string
+	Kind        string   // "variable", "constant" or "function"
+	Type        string   // a function's is its signature: sum(values Int...) Int
+	Position    Position // of the name that was asked about
+	Declaration Position // of the name where it was declared
+	File        string   // the module declaring it, if not the file asked about
+}
+
+// TypeAt returns what the name at the byte offset in file refers to, or
+// nil if there is no name there. A file with syntax errors cannot be
+// analyzed; other errors only leave the names after them unresolved.
+func TypeAt(file string, offset int) (*Info, error) {
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 || offset > len(source) {
+		return nil, fmt.Errorf("%s: offset %d is outside the file", file, offset)
+	}
+	info, err := typeAt(file, string(source), offset)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%v", file, err)
+	}
+	return info, nil
+}
+
+func typeAt(file string, source string, offset int) (*Info, error) {
+	a, err := analyze(file, source)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := a.referenceAt(position(source, offset))
+	if !ok {
+		return nil, nil
+	}
+	return &Info{
+		Name:        r.Token.Literal,
+		Kind:        r.Kind,
+		Type:        r.Type,
+		Position:    positionOf(r.Token),
+		Declaration: positionOf(r.Declaration),
+		File:        r.Declaration.File,
+	}, nil
+}
+
+// analysis holds what the code generator found out about a source
+type analysis struct {
+	program     *parser.Program     // the source joined with its modules
+	references  []codegen.Reference // those in the source itself
+	all         []codegen.Reference // those in its modules too
+	diagnostics []parser.Diagnostic
+}
+
+// analyze runs the code generator over source. Syntax errors are returned
+// as an error, as are those loading the modules it imports; other
+// diagnostics are kept in the analysis. Only the references in source
+// itself are kept, not those in its modules.
+func analyze(file string, source string) (*analysis, error) {
+	program, diagnostics := module.Load(file, source)
+	if len(diagnostics) > 0 {
+		return nil, fmt.Errorf("%s", diagnostics[0])
+	}
+	cg := codegen.New()
+	cg.Generate(program)
+	a := &analysis{program: program, all: cg.References(), diagnostics: append(semant.Check(program), cg.Diagnostics()...)}
+	for _, r := range cg.References() {
+		if r.Token.File == "" {
+			a.references = append(a.references, r)
+		}
+	}
+	return a, nil
+}
+
+// referenceAt returns the reference whose name covers pos
+func (a *analysis) referenceAt(pos Position) (codegen.Reference, bool) {
+	for _, r := range a.references {
+		if r.Token.Line == pos.Line && r.Token.Column <= pos.Column && pos.Column < r.Token.End {
+			return r, true
+		}
+	}
+	return codegen.Reference{}, false
+}
+
+func positionOf(tok lexer.Token) Position {
+	return Position{tok.Line, tok.Column}
+}
+
+// position returns the position of the byte offset in source
+func position(source string, offset int) Position {
+	before := source[:offset]
+	return Position{
+		Line:   strings.Count(before, "\n") + 1,
+		Column: offset - strings.LastIndexByte(before, '\n'),
+	}
+}
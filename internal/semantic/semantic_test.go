@@ -0,0 +1,413 @@
+package semantic
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTypeAt(t *testing.T) {
+	source := `Const LIMIT = 10
+
+Function sum(values Int...) Int {
+    total = 0
+    For (i = 0; i < Len(values); i = i + 1) {
+        total = total + values[i]
+    }
+    Return(total)
+}
+
+Entry main() {
+    Var name String = 'dread'
+    Print(name)
+    Print(sum(1, LIMIT))
+}
+`
+	file := filepath.Join(t.TempDir(), "hover.dread")
+	if err := os.WriteFile(file, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		at          string // the text whose first character is asked about
+		kind        string
+		typ         string
+		declaration Position
+	}{
+		{"name)", "variable", "String", Position{Line: 12, Column: 9}},
+		{"sum(1", "function", "sum(values Int...) Int", Position{Line: 3, Column: 10}},
+		{"MIT)", "constant", "Int", Position{Line: 1, Column: 7}},
+		{"values[i]", "variable", "Int[]", Position{Line: 3, Column: 14}},
+		{"total)", "variable", "Int", Position{Line: 4, Column: 5}},
+	}
+	for _, tt := range tests {
+		info, err := TypeAt(file, strings.Index(source, tt.at))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info == nil {
+			t.Errorf("nothing found at %q", tt.at)
+			continue
+		}
+		if info.Kind != tt.kind || info.Type != tt.typ || info.Declaration != tt.declaration {
+			t.Errorf("at %q: got %s %s declared at %v, want %s %s declared at %v",
+				tt.at, info.Kind, info.Type, info.Declaration, tt.kind, tt.typ, tt.declaration)
+		}
+	}
+
+	if info, err := TypeAt(file, strings.Index(source, "Print")); err != nil || info != nil {
+		t.Errorf("found %v (error %v) at a keyword", info, err)
+	}
+}
+
+const renameSource = `Var count Int = 0
+
+Function bump(n Int) Int {
+    total = n + 1
+    count = count + 1
+    Return(total)
+}
+
+Entry main() {
+    total = bump(1)
+    Print(total + count)
+}
+`
+
+func TestReferences(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "references.dread")
+	if err := os.WriteFile(file, []byte(renameSource), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The total of main, not the one in bump
+	positions, err := References(file, strings.Index(renameSource, "total +"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Position{{Line: 10, Column: 5}, {Line: 11, Column: 11}}
+	if !reflect.DeepEqual(positions, want) {
+		t.Errorf("references = %v, want %v", positions, want)
+	}
+}
+
+func TestRename(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rename.dread")
+	if err := os.WriteFile(file, []byte(renameSource), 0644); err != nil {
+		t.Fatal(err)
+	}
+	renamed, n, err := Rename(file, "bump", "increment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.ReplaceAll(renameSource, "bump", "increment"); renamed != want || n != 2 {
+		t.Errorf("renamed %d names to:\n%s\nwant 2:\n%s", n, renamed, want)
+	}
+
+	// Each of these would change what a name refers to, or is no name
+	for _, names := range [][2]string{{"total", "count"}, {"count", "total"}, {"n", "count"}, {"bump", "Len"}, {"total", "Var"}} {
+		if _, _, err := Rename(file, names[0], names[1]); err == nil {
+			t.Errorf("renaming %s to %s was allowed", names[0], names[1])
+		}
+	}
+}
+
+func TestSemanticModules(t *testing.T) {
+	modulesDir := filepath.Join("testdata", "modules")
+	file := filepath.Join(modulesDir, "shapes.dread")
+	source, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := TypeAt(file, strings.Index(string(source), "label("))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(modulesDir, "text.dread"); info == nil || info.Type != "label(name String, value Int) String" || info.File != want {
+		t.Errorf("TypeAt(label) = %+v, want label declared in %s", info, want)
+	}
+
+	// Renaming only the uses of a name from another module breaks them
+	if _, _, err := Rename(file, "label", "caption"); err == nil {
+		t.Error("renaming a function of an imported module was allowed")
+	}
+
+	// The private declarations of units are not offered
+	completions, err := Complete(file, strings.Index(string(source), "label("))
+	if err != nil {
+		t.Fatal(err)
+	}
+	offered := make(map[string]bool)
+	for _, c := range completions {
+		offered[c.Label] = true
+	}
+	if !offered["scale"] || offered["divide"] || offered["DIVISOR"] {
+		t.Errorf("completions = %+v, want scale but not the private divide and DIVISOR", completions)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	source := `Const LIMIT = 10
+Var count Int = 0
+
+Struct Point { x Int, y Int }
+
+Function (p Point) Sum() Int {
+    Return(p.x + p.y)
+}
+
+Function twice(n Int) Int {
+    total = n + n
+    Return(total)
+}
+
+Entry main() {
+    Var p Point = Point{x: 1, y: LIMIT}
+    count = twice(p.Sum())
+}
+`
+	file := filepath.Join(t.TempDir(), "tokens.dread")
+	if err := os.WriteFile(file, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := Tokens(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, tok := range tokens {
+		line := strings.Split(source, "\n")[tok.Position.Line-1]
+		name := line[tok.Position.Column-1 : tok.Position.Column-1+tok.Length]
+		got = append(got, strings.TrimSpace(fmt.Sprintf("%s %s %s", name, tok.Type, strings.Join(tok.Modifiers, " "))))
+	}
+	want := []string{
+		"LIMIT variable declaration readonly",
+		"count variable declaration",
+		"Point type declaration",
+		"p parameter declaration",
+		"Point type",
+		"Sum method declaration",
+		"p parameter",
+		"x property",
+		"p parameter",
+		"y property",
+		"twice function declaration",
+		"n parameter declaration",
+		"total variable declaration",
+		"n parameter",
+		"n parameter",
+		"total variable",
+		"main function declaration",
+		"p variable declaration",
+		"Point type",
+		"Point type",
+		"LIMIT variable readonly",
+		"count variable",
+		"twice function",
+		"p variable",
+		"Sum method",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tokens:\n  %s\nwant:\n  %s", strings.Join(got, "\n  "), strings.Join(want, "\n  "))
+	}
+}
+
+func TestComplete(t *testing.T) {
+	source := `Const LIMIT = 10
+
+Function total(values Int...) Int {
+    sum = 0
+    For (i = 0; i < Len(values); i = i + 1) {
+        sum = sum + values[i]
+    }
+    Return(sum)
+}
+
+Entry main() {
+    If (1) {
+        hidden = 1
+    }
+    count = total(1, 2)
+    Print(count)
+    
+}
+`
+	file := filepath.Join(t.TempDir(), "complete.dread")
+	if err := os.WriteFile(file, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	labels := func(completions []Completion) string {
+		var labels []string
+		for _, c := range completions {
+			labels = append(labels, c.Label)
+		}
+		return strings.Join(labels, " ")
+	}
+	tests := []struct {
+		name   string
+		source string // replaces the empty line in main
+		at     string // the text after which to complete, in the new source
+		want   string
+	}{
+		{"statement", "    ", "    \n}", "count LIMIT total AlignOf Append Chr Error Len Matches Ord Panic ParseInt Peek Poke Print SizeOf Syscall Try Break Const Continue Do For If Match Return Var"},
+		{"prefix", "    co", "    co", "count Const Continue"},
+		{"argument", "    Print(c", "Print(c", "count Chr"},
+		{"loop body", "", "sum + ", "i LIMIT sum values total AlignOf Append Chr Error Len Matches Ord Panic ParseInt Peek Poke Print SizeOf Syscall Try nil"},
+		{"after a block", "    If (count) {\n    }\n    El", "    El", "Else"},
+		{"declaration", "", "", "Const Entry Function Import Interface Module Private Public Struct Type Var"},
+		{"member", "    count.", "count.", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text := strings.Replace(source, "    \n}", tt.source+"\n}", 1)
+			if err := os.WriteFile(file, []byte(text), 0644); err != nil {
+				t.Fatal(err)
+			}
+			offset := strings.LastIndex(text, tt.at) + len(tt.at)
+			if tt.at == "    \n}" {
+				offset = strings.LastIndex(text, tt.at) + 4
+			}
+			completions, err := Complete(file, offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := labels(completions); got != tt.want {
+				t.Errorf("completions = %s, want %s", got, tt.want)
+			}
+		})
+	}
+	if err := os.WriteFile(file, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	completions, err := Complete(file, strings.Index(source, "Print(count)")+6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if completions[0] != (Completion{Label: "count", Kind: "variable", Detail: "Int"}) {
+		t.Errorf("first completion = %+v, want the variable count", completions[0])
+	}
+}
+
+func TestSignatureAt(t *testing.T) {
+	source := `Struct Point { x Int, y Int }
+
+Function (p Point) Scaled(by Int, offset Int) Int {
+    Return(p.x + by + offset)
+}
+
+Function add(a Int, b Int) Int {
+    Return(a + b)
+}
+
+Function total(values Int...) Int {
+    Return(Len(values))
+}
+
+Entry main() {
+    Var p Point = Point{x: 1, y: 2}
+    
+}
+`
+	file := filepath.Join(t.TempDir(), "signature.dread")
+	tests := []struct {
+		name   string
+		source string // replaces the empty line in main, which the position ends
+		want   string // the label and active parameter, or "" for no signature
+	}{
+		{"open", "    add(", "add(a Int, b Int) Int 0"},
+		{"second argument", "    add(1, ", "add(a Int, b Int) Int 1"},
+		{"after a nested call", "    add(total(1, 2), ", "add(a Int, b Int) Int 1"},
+		{"nested call", "    add(1, total(4, 5, ", "total(values Int...) Int 0"},
+		{"builtin", "    Print(add(1, 2) + ", "Print(value) 0"},
+		{"method", "    Print(p.Scaled(1, ", "(p Point) Scaled(by Int, offset Int) Int 1"},
+		{"too many arguments", "    add(1, 2, 3", "add(a Int, b Int) Int -1"},
+		{"grouping", "    x = (1 + ", ""},
+		{"closed", "    add(1, 2)", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text := strings.Replace(source, "    \n}", tt.source+"\n}", 1)
+			if err := os.WriteFile(file, []byte(text), 0644); err != nil {
+				t.Fatal(err)
+			}
+			signature, err := SignatureAt(file, strings.Index(text, tt.source)+len(tt.source))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := ""
+			if signature != nil {
+				got = fmt.Sprintf("%s %d", signature.Label, signature.Active)
+			}
+			if got != tt.want {
+				t.Errorf("signature = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// The parameters of a declaration are not a call's arguments
+	if err := os.WriteFile(file, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if signature, err := SignatureAt(file, strings.Index(source, "a Int")); err != nil || signature != nil {
+		t.Errorf("signature in a declaration = %+v, %v, want none", signature, err)
+	}
+}
+
+func TestOutline(t *testing.T) {
+	source := `/*
+ * Points and sums
+ */
+Struct Point { x Int, y Int }
+
+Function (p Point) Sum() Int {
+    Return(p.x + p.y)
+}
+
+/* one line */
+@inline
+Function add(a Int, b Int) Int { Return(a + b) }
+
+Entry main() {
+    p = Point{x: 1, y: 2}
+    If (add(1, 2) > 0) {
+        Print('yes')
+    }
+}
+`
+	file := filepath.Join(t.TempDir(), "outline.dread")
+	if err := os.WriteFile(file, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ranges, err := FoldingRanges(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range ranges {
+		got = append(got, fmt.Sprintf("%d-%d %s", r.Start, r.End, r.Kind))
+	}
+	want := []string{"1-3 comment", "6-8 region", "14-19 region"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("folding ranges = %v, want %v", got, want)
+	}
+
+	symbols, err := Outline(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	for _, s := range symbols {
+		got = append(got, fmt.Sprintf("%s %s %q %v-%v at %v", s.Kind, s.Name, s.Detail, s.Start, s.End, s.Selection))
+	}
+	want = []string{
+		`method Sum "(p Point) Sum() Int" {6 1}-{8 1} at {6 20}`,
+		`function add "add(a Int, b Int) Int" {12 1}-{12 48} at {12 10}`,
+		`function main "main()" {14 1}-{19 1} at {14 7}`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("outline:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,187 @@
+package semantic
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"dreadlang/internal/codegen"
+	"dreadlang/internal/lexer"
+	"dreadlang/internal/parser"
+)
+
+// Signature describes the function called around a position, for help
+// while its arguments are being written
+type Signature struct {
+	Label      string   // how it is called: sum(values Int...) Int
+	Parameters []string // each parameter as the label writes it
+	Active     int      // the parameter of the argument being written, or -1
+}
+
+// SignatureAt returns the signature of the function whose call's
+// parentheses contain the byte offset in file, or nil if there is no call
+// there or its function is unknown. The call may be unfinished, and the
+// argument being written is counted by the commas before it. If the file
+// has syntax errors, it is analyzed without the line being written.
+func SignatureAt(file string, offset int) (*Signature, error) {
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 || offset > len(source) {
+		return nil, fmt.Errorf("%s: offset %d is outside the file", file, offset)
+	}
+	signature, err := signatureAt(file, string(source), offset)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%v", file, err)
+	}
+	return signature, nil
+}
+
+func signatureAt(file string, source string, offset int) (*Signature, error) {
+	pos := position(source, offset)
+	b := scanBlocks(source)
+	callee, receiver, argument, ok := b.call(pos)
+	if !ok {
+		return nil, nil
+	}
+	a, err := analyze(file, source)
+	if err != nil {
+		if a, err = analyze(file, blankLine(source, offset)); err != nil {
+			return nil, err
+		}
+	}
+
+	var signature *Signature
+	if receiver.Type == lexer.IDENT {
+		signature = methodSignature(a, b, receiver, callee.Literal, pos)
+	} else {
+		signature = functionSignature(a, callee.Literal)
+	}
+	if signature == nil {
+		return nil, nil
+	}
+	signature.Active = -1
+	switch n := len(signature.Parameters); {
+	case argument < n:
+		signature.Active = argument
+	case n > 0 && strings.HasSuffix(signature.Parameters[n-1], "..."):
+		signature.Active = n - 1
+	}
+	return signature, nil
+}
+
+// call finds the innermost call whose parentheses are open at pos, skipping
+// the parentheses and brackets of the expressions in its arguments. It
+// returns the name called, the variable before the dot if it is a method,
+// and how many arguments come before pos. Parentheses outside any
+// function's body are a declaration's, not a call's.
+func (b *blocks) call(pos Position) (callee lexer.Token, receiver lexer.Token, argument int, ok bool) {
+	type open struct {
+		index  int
+		commas int
+	}
+	var stack []open
+	for i, tok := range b.tokens {
+		if !before(positionOf(tok), pos) {
+			break
+		}
+		switch tok.Type {
+		case lexer.LPAREN, lexer.LBRACKET, lexer.LBRACE:
+			stack = append(stack, open{index: i})
+		case lexer.RPAREN, lexer.RBRACKET, lexer.RBRACE:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case lexer.COMMA:
+			if len(stack) > 0 {
+				stack[len(stack)-1].commas++
+			}
+		}
+	}
+
+	for i := len(stack) - 1; i >= 0; i-- {
+		paren := b.tokens[stack[i].index]
+		if paren.Type == lexer.LBRACE {
+			return lexer.Token{}, lexer.Token{}, 0, false
+		}
+		if paren.Type != lexer.LPAREN || stack[i].index == 0 {
+			continue
+		}
+		name := b.tokens[stack[i].index-1]
+		if name.Type != lexer.IDENT && name.Type != lexer.PRINT {
+			continue
+		}
+		insideBody := false
+		for _, outer := range stack[:i] {
+			if b.tokens[outer.index].Type == lexer.LBRACE {
+				insideBody = true
+			}
+		}
+		if !insideBody {
+			return lexer.Token{}, lexer.Token{}, 0, false
+		}
+		if j := stack[i].index - 2; j >= 1 && b.tokens[j].Type == lexer.DOT {
+			receiver = b.tokens[j-1]
+		}
+		return name, receiver, stack[i].commas, true
+	}
+	return lexer.Token{}, lexer.Token{}, 0, false
+}
+
+// functionSignature returns the signature of the function or builtin
+// called name
+func functionSignature(a *analysis, name string) *Signature {
+	for _, stmt := range a.program.Statements {
+		if fn, ok := stmt.(*parser.FunctionStatement); ok && !fn.IsEntry && fn.Receiver == nil && fn.Name == name {
+			return signatureOf(fn)
+		}
+	}
+	for _, builtin := range builtins {
+		if builtin.Label == name {
+			params := builtin.Detail[strings.IndexByte(builtin.Detail, '(')+1 : strings.LastIndexByte(builtin.Detail, ')')]
+			return &Signature{Label: builtin.Detail, Parameters: strings.Split(params, ", ")}
+		}
+	}
+	return nil
+}
+
+// methodSignature returns the signature of the method called name on the
+// variable receiver. Without the variable's type, a method is found by its
+// name alone when only one type has it.
+func methodSignature(a *analysis, b *blocks, receiver lexer.Token, name string, pos Position) *Signature {
+	var typ string
+	for _, c := range names(a, b, pos) {
+		if c.Label == receiver.Literal && c.Kind != "function" && c.Kind != "builtin" {
+			typ = c.Detail
+		}
+	}
+	var found *parser.FunctionStatement
+	for _, stmt := range a.program.Statements {
+		fn, ok := stmt.(*parser.FunctionStatement)
+		if !ok || fn.Receiver == nil || fn.Name != name {
+			continue
+		}
+		if fn.Receiver.Type == typ {
+			return signatureOf(fn)
+		}
+		if typ == "" {
+			if found != nil {
+				return nil
+			}
+			found = fn
+		}
+	}
+	if found == nil {
+		return nil
+	}
+	return signatureOf(found)
+}
+
+func signatureOf(fn *parser.FunctionStatement) *Signature {
+	params := make([]string, len(fn.Parameters))
+	for i, param := range fn.Parameters {
+		params[i] = param.String()
+	}
+	return &Signature{Label: codegen.Signature(fn), Parameters: params}
+}
@@ -0,0 +1,160 @@
+package semantic
+
+import (
+	"fmt"
+	"os"
+
+	"dreadlang/internal/codegen"
+	"dreadlang/internal/lexer"
+	"dreadlang/internal/parser"
+)
+
+// Token is a name in a file classified by what it refers to, which
+// lexical highlighting cannot tell: a parameter from a local variable, or
+// a function from a struct. Types and modifiers are those of the semantic
+// tokens of the language server protocol.
+type Token struct {
+	Position  Position
+	Length    int
+	Type      string   // "namespace", "type", "parameter", "variable", "property", "function" or "method"
+	Modifiers []string // "declaration" where the name is declared, "readonly" for constants
+}
+
+// Tokens classifies the names in file, in the order they appear. Names the
+// code generator did not resolve, such as those after a semantic error or
+// the fields of a struct declaration, are left out. A file with syntax
+// errors cannot be classified.
+func Tokens(file string) ([]Token, error) {
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := classify(file, string(source))
+	if err != nil {
+		return nil, fmt.Errorf("%s:%v", file, err)
+	}
+	return tokens, nil
+}
+
+func classify(file string, source string) ([]Token, error) {
+	a, err := analyze(file, source)
+	if err != nil {
+		return nil, err
+	}
+
+	// What each name in the file is, by position: its references, then the
+	// declarations that nothing may refer to
+	kinds := make(map[Position]Token)
+	for _, r := range a.references {
+		t := referenceToken(r)
+		kinds[positionOf(r.Token)] = t
+		if r.Declaration.Line > 0 && r.Declaration.File == "" {
+			kinds[positionOf(r.Declaration)] = t
+		}
+	}
+	types := make(map[string]bool)
+	for _, stmt := range a.program.Statements {
+		switch s := stmt.(type) {
+		case *parser.StructStatement:
+			types[s.Name] = true
+		case *parser.TypeAliasStatement:
+			types[s.Name] = true
+		case *parser.InterfaceStatement:
+			types[s.Name] = true
+			for _, m := range s.Methods {
+				if m.Token.File == "" {
+					kinds[positionOf(m.Token)] = Token{Type: "method"}
+				}
+			}
+		case *parser.FunctionStatement:
+			if s.NameToken.File == "" && s.NameToken.Line > 0 {
+				t := Token{Type: "function"}
+				if s.Receiver != nil {
+					t.Type = "method"
+				}
+				kinds[positionOf(s.NameToken)] = t
+			}
+		}
+	}
+
+	var tokens []Token
+	var previous lexer.TokenType
+	l := lexer.New(source)
+	for tok := l.NextToken(); tok.Type != lexer.EOF; tok = l.NextToken() {
+		before := previous
+		previous = tok.Type
+		if tok.Type != lexer.IDENT {
+			continue
+		}
+		t, ok := kinds[positionOf(tok)]
+		switch {
+		case ok:
+		case types[tok.Literal]:
+			t = Token{Type: "type"}
+		case before == lexer.DOT:
+			t = Token{Type: "property"}
+		case before == lexer.MODULE || before == lexer.IMPORT:
+			t = Token{Type: "namespace"}
+		default:
+			continue
+		}
+		t.Position = positionOf(tok)
+		t.Length = tok.End - tok.Column
+		if declaration(a, tok) {
+			t.Modifiers = append([]string{"declaration"}, t.Modifiers...)
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
+
+// referenceToken classifies a reference, leaving its position to be set
+func referenceToken(r codegen.Reference) Token {
+	switch {
+	case r.Kind == "function" && r.Scope == "method":
+		return Token{Type: "method"}
+	case r.Kind == "function":
+		return Token{Type: "function"}
+	case r.Kind == "constant":
+		return Token{Type: "variable", Modifiers: []string{"readonly"}}
+	case r.Scope == "parameter":
+		return Token{Type: "parameter"}
+	}
+	return Token{Type: "variable"}
+}
+
+// declaration reports whether tok is where a name of the file is declared
+func declaration(a *analysis, tok lexer.Token) bool {
+	pos := positionOf(tok)
+	for _, r := range a.references {
+		if r.Declaration.File == "" && positionOf(r.Declaration) == pos {
+			return true
+		}
+	}
+	for _, stmt := range a.program.Statements {
+		switch s := stmt.(type) {
+		case *parser.StructStatement:
+			if s.Token.File == "" && positionOf(s.Token) == pos {
+				return true
+			}
+		case *parser.TypeAliasStatement:
+			if s.Token.File == "" && positionOf(s.Token) == pos {
+				return true
+			}
+		case *parser.InterfaceStatement:
+			if s.Token.File == "" && positionOf(s.Token) == pos {
+				return true
+			}
+			for _, m := range s.Methods {
+				if m.Token.File == "" && positionOf(m.Token) == pos {
+					return true
+				}
+			}
+		case *parser.FunctionStatement:
+			if s.NameToken.File == "" && positionOf(s.NameToken) == pos {
+				return true
+			}
+		}
+	}
+	return false
+}